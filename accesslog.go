@@ -0,0 +1,128 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+//go:build !log4go_nohttp
+// +build !log4go_nohttp
+
+package log4go
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// AccessHandler returns an http.Handler which serves the requests with next
+// and logs each of them to log at the ACCESS level once it's served, e.g.
+//
+//	log.AddAccessFilter("access", log4go.NewAccessLogWriter("access.log", "combined"))
+//	http.ListenAndServe(":8080", log4go.AccessHandler(log, mux))
+//
+// The message of a record is the request line, its fields are remote_addr,
+// user (of the basic authentication), method, uri, proto, status, bytes (of
+// the body of the response), latency_ms, referer and user_agent, which
+// AccessLayout and the json format print.  A request whose handler panics
+// is logged with the status 500 unless it was sent already.
+func AccessHandler(log Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		aw := &accessResponseWriter{ResponseWriter: rw}
+		served := false
+		defer func() {
+			if aw.status == 0 {
+				aw.status = http.StatusOK
+				if !served {
+					aw.status = http.StatusInternalServerError
+				}
+			}
+			log.AccessRequest(req, aw.status, aw.bytes, start)
+		}()
+		next.ServeHTTP(aw, req)
+		served = true
+	})
+}
+
+// AccessRequest logs a request served, with the fields of AccessHandler:
+// status is that of the response, bytes the size of its body and start when
+// the request came in.  It lets the middlewares of other frameworks log like
+// AccessHandler, see the middleware package.
+func (log Logger) AccessRequest(req *http.Request, status int, bytes int64, start time.Time) {
+	if log.skip(ACCESS) {
+		return
+	}
+	latency := time.Since(start)
+
+	host := req.RemoteAddr
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	user, _, _ := req.BasicAuth()
+
+	rec := newRecord(ACCESS, "log4go/access", req.Method+" "+req.RequestURI+" "+req.Proto)
+	rec.Created = start
+	rec.Fields = []Field{
+		{"remote_addr", host},
+		{"user", user},
+		{"method", req.Method},
+		{"uri", req.RequestURI},
+		{"proto", req.Proto},
+		{"status", status},
+		{"bytes", bytes},
+		{"latency_ms", float64(latency.Microseconds()) / 1000},
+		{"referer", req.Referer()},
+		{"user_agent", req.UserAgent()},
+	}
+	log.dispatch(rec)
+}
+
+// The ResponseWriter of AccessHandler, which keeps the status and the size
+// of the response
+type accessResponseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *accessResponseWriter) WriteHeader(status int) {
+	if w.status == 0 && status >= 200 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *accessResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *accessResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		f.Flush()
+	}
+}
+
+// Hijack lets the handlers take over the connection, e.g. for a websocket:
+// the request is logged with the status 101 they send themselves
+func (w *accessResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("log4go: the ResponseWriter doesn't support hijacking")
+	}
+	if w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return h.Hijack()
+}
+
+// Unwrap returns the ResponseWriter wrapped, for http.ResponseController
+func (w *accessResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
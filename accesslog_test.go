@@ -0,0 +1,103 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+//go:build !log4go_nohttp
+// +build !log4go_nohttp
+
+package log4go
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccessHandler(t *testing.T) {
+	w := &testWriter{}
+	log := NewLogger().AddAccessFilter("access", w)
+	handler := AccessHandler(log, http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/missing":
+			http.NotFound(rw, req)
+		case "/panic":
+			panic("boom")
+		default:
+			io.WriteString(rw, "hello")
+		}
+	}))
+
+	req := httptest.NewRequest("GET", "/hello?x=1", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.SetBasicAuth("frank", "secret")
+	req.Header.Set("Referer", "http://example.com/")
+	req.Header.Set("User-Agent", "test/1.0")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/missing", nil))
+	func() {
+		defer func() { recover() }()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/panic", nil))
+	}()
+
+	if len(w.recs) != 3 {
+		t.Fatalf("AccessHandler: got %d records, want 3", len(w.recs))
+	}
+	rec := w.recs[0]
+	if rec.Level != ACCESS || rec.Message != "GET /hello?x=1 HTTP/1.1" {
+		t.Errorf("AccessHandler: got record %s %q", rec.Level, rec.Message)
+	}
+	want := map[string]interface{}{
+		"remote_addr": "192.0.2.1",
+		"user":        "frank",
+		"status":      200,
+		"bytes":       int64(5),
+		"referer":     "http://example.com/",
+		"user_agent":  "test/1.0",
+	}
+	for key, value := range want {
+		if got := accessField(rec, key); got != value {
+			t.Errorf("AccessHandler: field %s is %v, want %v", key, got, value)
+		}
+	}
+	if _, ok := accessField(rec, "latency_ms").(float64); !ok {
+		t.Errorf("AccessHandler: no latency_ms")
+	}
+	if got := accessField(w.recs[1], "status"); got != 404 {
+		t.Errorf("AccessHandler: status of /missing is %v, want 404", got)
+	}
+	if got := accessField(w.recs[2], "status"); got != 500 {
+		t.Errorf("AccessHandler: status of /panic is %v, want 500", got)
+	}
+}
+
+func TestAccessLayout(t *testing.T) {
+	rec := &LogRecord{
+		Level:   ACCESS,
+		Created: time.Date(2000, 10, 10, 13, 55, 36, 0, time.FixedZone("", -7*3600)),
+		Message: `GET /a "b".gif HTTP/1.0`,
+		Fields: []Field{
+			{"remote_addr", "127.0.0.1"},
+			{"user", ""},
+			{"method", "GET"},
+			{"status", 200},
+			{"bytes", int64(2326)},
+			{"referer", ""},
+			{"user_agent", "Mozilla/4.08"},
+		},
+	}
+	common := `127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /a \"b\".gif HTTP/1.0" 200 2326` + "\n"
+	if got := string(AccessLayout{}.Format(rec)); got != common {
+		t.Errorf("AccessLayout: got %q, want %q", got, common)
+	}
+	combined := strings.TrimSuffix(common, "\n") + ` "-" "Mozilla/4.08"` + "\n"
+	if got := string((AccessLayout{Combined: true}).Format(rec)); got != combined {
+		t.Errorf("AccessLayout: combined got %q, want %q", got, combined)
+	}
+
+	// The other records are formatted as usual
+	rec = &LogRecord{Level: INFO, Created: rec.Created, Source: "source", Message: "message"}
+	if got := string(AccessLayout{}.Format(rec)); !strings.HasSuffix(got, "[INFO] (source) message\n") {
+		t.Errorf("AccessLayout: got %q for an INFO record", got)
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+//go:build !log4go_nohttp
+// +build !log4go_nohttp
+
+package log4go
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The endpoints served by AdminHandler, by path
+var adminEndpoints = map[string]http.HandlerFunc{
+	"/toptalkers": adminTopTalkers,
+	"/memory":     adminMemory,
+	"/stats":      adminStats,
+	"/level":      adminLevel,
+	"/state":      adminState,
+	"/errors":     adminErrors,
+	"/health":     adminHealth,
+}
+
+// An AdminAuth authenticates a request to the admin endpoints, and returns who
+// made it, as written in the audit records.
+type AdminAuth func(req *http.Request) (who string, ok bool)
+
+// TokenAuth accepts the requests bearing one of the tokens in an
+// "Authorization: Bearer TOKEN" header.  tokens maps each token to who uses
+// it.
+func TokenAuth(tokens map[string]string) AdminAuth {
+	return func(req *http.Request) (string, bool) {
+		auth := req.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") {
+			return "", false
+		}
+		given := []byte(strings.TrimPrefix(auth, "Bearer "))
+		for token, who := range tokens {
+			if subtle.ConstantTimeCompare(given, []byte(token)) == 1 {
+				return who, true
+			}
+		}
+		return "", false
+	}
+}
+
+// ClientCertAuth accepts the requests made with a verified TLS client
+// certificate (mTLS) whose common name is one of names, or any verified
+// certificate if there are no names.  Who made the request is the common
+// name.  The server must verify the client certificates, see
+// tls.RequireAndVerifyClientCert.
+func ClientCertAuth(names ...string) AdminAuth {
+	return func(req *http.Request) (string, bool) {
+		if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+			return "", false
+		}
+		cn := req.TLS.VerifiedChains[0][0].Subject.CommonName
+		if len(names) == 0 {
+			return cn, true
+		}
+		for _, name := range names {
+			if cn == name {
+				return cn, true
+			}
+		}
+		return "", false
+	}
+}
+
+// AnyAuth accepts the requests which one of auths accepts, e.g. a token or a
+// client certificate.
+func AnyAuth(auths ...AdminAuth) AdminAuth {
+	return func(req *http.Request) (string, bool) {
+		for _, auth := range auths {
+			if who, ok := auth(req); ok {
+				return who, true
+			}
+		}
+		return "", false
+	}
+}
+
+// The key of who made an authenticated admin request, in its context
+type adminWhoKey struct{}
+
+// AdminHandler returns an http.Handler serving the status of the logging
+// system, to be mounted on an internal admin server:
+//
+//   http.Handle("/debug/log4go/", http.StripPrefix("/debug/log4go", log4go.AdminHandler()))
+//
+// Endpoints:
+//   /toptalkers?n=10 - JSON list of the packages logging the most bytes (see TopTalkers)
+//   /memory          - records buffered by the MemoryLogWriters of the global logger
+//   /stats           - JSON counters of the writers of the global logger, by filter tag (see Stats)
+//   /level           - JSON levels of the filters of the global logger, by filter tag;
+//                      POST filter=TAG&level=LEVEL changes one (see Filter.SetLevel)
+//   /state           - internal state of the global logger and goroutine stacks (see DumpState)
+//   /errors?n=20     - JSON list of the recent groups of errors, the last seen first (see ErrorSummary)
+//   /health          - "ok", or 503 and the JSON errors of the writers failing their health check (see HealthCheck)
+//
+// The handler isn't authenticated, and refuses the changes: use
+// NewAdminHandler for that.
+func AdminHandler() http.Handler {
+	return NewAdminHandler(nil)
+}
+
+// NewAdminHandler returns the handler of AdminHandler, which only serves the
+// requests accepted by auth (401 otherwise), and accepts the changes.  Each
+// change is audited, see Logger.Audit.  A nil auth accepts all the requests
+// but refuses the changes (403).
+func NewAdminHandler(auth AdminAuth) http.Handler {
+	mux := http.NewServeMux()
+	for path, h := range adminEndpoints {
+		mux.HandleFunc(path, h)
+	}
+	if auth == nil {
+		return mux
+	}
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		who, ok := auth(req)
+		if !ok {
+			rw.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(rw, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(rw, req.WithContext(context.WithValue(req.Context(), adminWhoKey{}, who)))
+	})
+}
+
+func adminTopTalkers(rw http.ResponseWriter, req *http.Request) {
+	n := 10
+	if s := req.FormValue("n"); s != "" {
+		var err error
+		if n, err = strconv.Atoi(s); err != nil {
+			http.Error(rw, "invalid n: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	adminJSON(rw, TopTalkers(n))
+}
+
+func adminErrors(rw http.ResponseWriter, req *http.Request) {
+	summary := ErrorSummary()
+	if s := req.FormValue("n"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			http.Error(rw, "invalid n: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if n > 0 && n < len(summary) {
+			summary = summary[:n]
+		}
+	}
+	adminJSON(rw, summary)
+}
+
+// 200 with "ok" if the writers pass their health check, 503 with the errors
+// by filter tag otherwise
+func adminHealth(rw http.ResponseWriter, req *http.Request) {
+	err := HealthCheck()
+	if err == nil {
+		rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(rw, "ok")
+		return
+	}
+	failed := make(map[string]string)
+	if he, ok := err.(HealthError); ok {
+		for tag, err := range he {
+			failed[tag] = err.Error()
+		}
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(rw).Encode(failed)
+}
+
+func adminMemory(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	DumpMemory(rw)
+}
+
+func adminState(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	DumpState(rw)
+}
+
+func adminStats(rw http.ResponseWriter, req *http.Request) {
+	adminJSON(rw, Stats())
+}
+
+func adminLevel(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		levels := make(map[string]string)
+		for tag, filt := range Global.filters() {
+			levels[tag] = levelName(filt.CurrentLevel())
+		}
+		adminJSON(rw, levels)
+		return
+	}
+
+	who, ok := req.Context().Value(adminWhoKey{}).(string)
+	if !ok {
+		http.Error(rw, "changes need an authenticated admin handler, see NewAdminHandler", http.StatusForbidden)
+		return
+	}
+	tag := req.FormValue("filter")
+	filt := Global.Filter(tag)
+	if filt == nil {
+		filters := Global.filters()
+		tags := make([]string, 0, len(filters))
+		for tag := range filters {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+		http.Error(rw, fmt.Sprintf("unknown filter %q, expect one of %s", tag, strings.Join(tags, ", ")), http.StatusBadRequest)
+		return
+	}
+	lvl, ok := levelByName(req.FormValue("level"))
+	if !ok {
+		http.Error(rw, fmt.Sprintf("unknown level %q", req.FormValue("level")), http.StatusBadRequest)
+		return
+	}
+
+	old := filt.CurrentLevel()
+	filt.SetLevel(lvl)
+	Audit(who, fmt.Sprintf("admin: level of filter %q changed from %s to %s", tag, levelName(old), levelName(lvl)),
+		F("action", "level"), F("filter", tag), F("from", levelName(old)), F("to", levelName(lvl)), F("remote", req.RemoteAddr))
+	adminJSON(rw, map[string]string{tag: levelName(lvl)})
+}
+
+func adminJSON(rw http.ResponseWriter, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(v)
+}
@@ -0,0 +1,146 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+//go:build !log4go_nohttp
+// +build !log4go_nohttp
+
+package log4go
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAdminTopTalkers(t *testing.T) {
+	ResetTalkers()
+	SetCostAccounting(true)
+	defer SetCostAccounting(false)
+
+	log := NewLogger().SetFilter("test", &Filter{Level: INFO, LogWriter: &testWriter{}})
+	log.Log(INFO, "example.com/noisy.Loop:1", "0123456789")
+	log.Log(INFO, "example.com/noisy.Loop:1", "0123456789")
+	log.Log(INFO, "example.com/quiet.(*T).Run:7", "01234")
+
+	rec := httptest.NewRecorder()
+	AdminHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/toptalkers?n=1", nil))
+	var top []Talker
+	if err := json.Unmarshal(rec.Body.Bytes(), &top); err != nil {
+		t.Fatalf("AdminHandler: %s: %q", err, rec.Body.String())
+	}
+	if len(top) != 1 || top[0] != (Talker{"example.com/noisy", 2, 20}) {
+		t.Errorf("AdminHandler: /toptalkers?n=1 = %+v", top)
+	}
+
+	rec = httptest.NewRecorder()
+	AdminHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/toptalkers?n=x", nil))
+	if rec.Code != 400 {
+		t.Errorf("AdminHandler: /toptalkers?n=x = %d, want 400", rec.Code)
+	}
+}
+
+func TestAdminErrors(t *testing.T) {
+	ResetErrorSummary()
+	defer ResetErrorSummary()
+
+	log := NewLogger().SetFilter("test", &Filter{Level: INFO, LogWriter: &testWriter{}})
+	log.Log(ERROR, "example.com/db.Query:10", "query 1 failed")
+	log.Log(ERROR, "example.com/db.Query:10", "query 2 failed")
+
+	rec := httptest.NewRecorder()
+	AdminHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/errors?n=5", nil))
+	var summary []ErrorGroup
+	if err := json.Unmarshal(rec.Body.Bytes(), &summary); err != nil {
+		t.Fatalf("AdminHandler: %s: %q", err, rec.Body.String())
+	}
+	if len(summary) != 1 || summary[0].Template != "query # failed" || summary[0].Count != 2 {
+		t.Errorf("AdminHandler: /errors = %+v", summary)
+	}
+}
+
+func TestAdminLevel(t *testing.T) {
+	saved := Global
+	defer func() { Global = saved }()
+	app, audit := &testWriter{}, &testWriter{}
+	Global = NewLogger().
+		SetFilter("app", &Filter{Level: INFO, LogWriter: app}).
+		SetFilter("audit", &Filter{Level: INFO, LogWriter: audit, Audit: true})
+
+	post := func(h http.Handler, token, form string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/level", strings.NewReader(form))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// No changes without authentication
+	if rec := post(AdminHandler(), "", "filter=app&level=DEBUG"); rec.Code != 403 {
+		t.Errorf("AdminHandler: POST /level = %d, want 403", rec.Code)
+	}
+	h := NewAdminHandler(TokenAuth(map[string]string{"s3cret": "alice"}))
+	if rec := post(h, "guess", "filter=app&level=DEBUG"); rec.Code != 401 {
+		t.Errorf("NewAdminHandler: POST /level with a bad token = %d, want 401", rec.Code)
+	}
+	if rec := post(h, "s3cret", "filter=app&level=LOUD"); rec.Code != 400 {
+		t.Errorf("NewAdminHandler: POST /level with a bad level = %d, want 400", rec.Code)
+	}
+	if Global.Filter("app").CurrentLevel() != INFO || len(audit.recs) != 0 {
+		t.Fatalf("NewAdminHandler: a refused change was applied or audited")
+	}
+
+	// An accepted change is applied and audited, to the audit filter only
+	if rec := post(h, "s3cret", "filter=app&level=DEBUG"); rec.Code != 200 {
+		t.Fatalf("NewAdminHandler: POST /level = %d: %s", rec.Code, rec.Body.String())
+	}
+	if lvl := Global.Filter("app").CurrentLevel(); lvl != DEBUG {
+		t.Errorf("NewAdminHandler: level of app = %v, want DEBUG", lvl)
+	}
+	if len(audit.recs) != 1 || len(app.recs) != 0 {
+		t.Fatalf("NewAdminHandler: %d audit records, %d app records", len(audit.recs), len(app.recs))
+	}
+	if msg := audit.recs[0].Message; msg != `admin: level of filter "app" changed from INFO to DEBUG, by alice` {
+		t.Errorf("NewAdminHandler: audit record %q", msg)
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/level", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	h.ServeHTTP(rec, req)
+	var levels map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &levels); err != nil || levels["app"] != "DEBUG" {
+		t.Errorf("NewAdminHandler: GET /level = %q (%v)", rec.Body.String(), err)
+	}
+
+	// Without an audit filter, the change goes to all the filters
+	Global.RemoveFilter("audit")
+	post(h, "s3cret", "filter=app&level=WARNING")
+	if len(app.recs) != 1 || app.recs[0].Level != WARNING {
+		t.Errorf("NewAdminHandler: audit without an audit filter: %v", app.recs)
+	}
+}
+
+func TestClientCertAuth(t *testing.T) {
+	req := httptest.NewRequest("GET", "/stats", nil)
+	if _, ok := ClientCertAuth()(req); ok {
+		t.Errorf("ClientCertAuth: accepted a request without TLS")
+	}
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "ops"}}
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	if who, ok := ClientCertAuth("ops", "sre")(req); !ok || who != "ops" {
+		t.Errorf("ClientCertAuth: got %q, %v", who, ok)
+	}
+	if _, ok := ClientCertAuth("sre")(req); ok {
+		t.Errorf("ClientCertAuth: accepted an unknown common name")
+	}
+	if who, ok := AnyAuth(TokenAuth(nil), ClientCertAuth())(req); !ok || who != "ops" {
+		t.Errorf("AnyAuth: got %q, %v", who, ok)
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"fmt"
+	"strings"
+)
+
+// An OverflowPolicy tells what an AsyncWriter does with a record when its queue
+// is full.
+type OverflowPolicy int
+
+const (
+	// Wait for room in the queue, like the builtin writers do
+	OverflowBlock OverflowPolicy = iota
+
+	// Drop the record logged
+	OverflowDropNewest
+
+	// Drop the oldest record of the queue to make room for the one logged
+	OverflowDropOldest
+)
+
+var overflowPolicyNames = []string{"block", "drop_newest", "drop_oldest"}
+
+func (p OverflowPolicy) String() string {
+	if p < 0 || int(p) >= len(overflowPolicyNames) {
+		return "unknown"
+	}
+	return overflowPolicyNames[p]
+}
+
+// The policy named name, see OverflowPolicy.String
+func overflowPolicyByName(name string) (OverflowPolicy, bool) {
+	for i, n := range overflowPolicyNames {
+		if strings.EqualFold(n, name) {
+			return OverflowPolicy(i), true
+		}
+	}
+	return OverflowBlock, false
+}
+
+// This log writer makes another writer asynchronous: the records are queued
+// and written to it by a goroutine of their own, so that a writer which blocks,
+// e.g. on a network call, doesn't stall the callers and the other filters.
+// When the queue is full, the policy decides whether the caller waits or a
+// record is dropped (counted in the Dropped of the stats).
+type AsyncWriter struct {
+	inner  LogWriter
+	policy OverflowPolicy
+
+	rec   chan *LogRecord
+	flush chan chan struct{}
+	done  chan struct{}
+
+	writerStats
+}
+
+// NewAsyncWriter creates a new LogWriter which queues up to queueSize records
+// (LogBufferLength if it's not positive) for inner, and applies policy when the
+// queue is full.  It owns inner: closing it writes the records queued and
+// closes inner.
+func NewAsyncWriter(inner LogWriter, queueSize int, policy OverflowPolicy) *AsyncWriter {
+	if queueSize <= 0 {
+		queueSize = LogBufferLength
+	}
+	w := &AsyncWriter{
+		inner:  inner,
+		policy: policy,
+		rec:    make(chan *LogRecord, queueSize),
+		flush:  make(chan chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// This is the AsyncWriter's output method
+func (w *AsyncWriter) LogWrite(rec *LogRecord) {
+	switch w.policy {
+	case OverflowDropNewest:
+		select {
+		case w.rec <- rec:
+		default:
+			w.drop(1)
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case w.rec <- rec:
+				return
+			default:
+			}
+			select {
+			case <-w.rec:
+				w.drop(1)
+			default:
+			}
+		}
+	default:
+		w.rec <- rec
+	}
+}
+
+func (w *AsyncWriter) run() {
+	defer close(w.done)
+	for {
+		select {
+		case rec, ok := <-w.rec:
+			if !ok {
+				w.inner.Close()
+				return
+			}
+			w.inner.LogWrite(rec)
+		case done := <-w.flush:
+			for n := len(w.rec); n > 0; n-- {
+				rec, ok := <-w.rec
+				if !ok {
+					break
+				}
+				w.inner.LogWrite(rec)
+			}
+			if f, ok := w.inner.(Flusher); ok {
+				f.Flush()
+			}
+			close(done)
+		}
+	}
+}
+
+func (w *AsyncWriter) queued() (int, int) {
+	return len(w.rec), cap(w.rec)
+}
+
+// Flush returns once the records queued so far are handed to the inner
+// writer, and flushed if it's a Flusher.
+func (w *AsyncWriter) Flush() {
+	done := make(chan struct{})
+	select {
+	case w.flush <- done:
+		<-done
+	case <-w.done:
+	}
+}
+
+// Close writes the records still queued to the inner writer and closes it.
+func (w *AsyncWriter) Close() {
+	close(w.rec)
+	<-w.done
+}
+
+// Stats returns the counters of the inner writer, if it keeps some, with the
+// records dropped from the queue added to its Dropped.
+func (w *AsyncWriter) Stats() WriterStats {
+	var stats WriterStats
+	if sw, ok := w.inner.(StatsWriter); ok {
+		stats = sw.Stats()
+	}
+	stats.Dropped += w.writerStats.Stats().Dropped
+	return stats
+}
+
+// Ready returns the readiness of the inner writer, see ReadyWriter.
+func (w *AsyncWriter) Ready() <-chan struct{} {
+	return readyOf([]LogWriter{w.inner})
+}
+
+// Inner returns the writer the records are written to.
+func (w *AsyncWriter) Inner() LogWriter {
+	return w.inner
+}
+
+// The queue of the AsyncWriter of a filter with async="true", from the filter
+// properties async_queue, its size, and async_overflow, the OverflowPolicy by
+// name (block, drop_newest or drop_oldest)
+func xmlToAsync(queue, overflow string) (size int, policy OverflowPolicy, ok bool) {
+	size = LogBufferLength
+	if queue != "" {
+		if size = strToNumSuffix(queue, 1000); size <= 0 {
+			fmt.Fprintf(configOut, "LoadConfiguration: Error: Invalid property \"%s\" for filter: must be positive\n", "async_queue")
+			return 0, OverflowBlock, false
+		}
+	}
+	if overflow != "" {
+		if policy, ok = overflowPolicyByName(overflow); !ok {
+			fmt.Fprintf(configOut, "LoadConfiguration: Error: Invalid property \"%s\" for filter: %s, expect block, drop_newest or drop_oldest\n", "async_overflow", overflow)
+			return 0, OverflowBlock, false
+		}
+	}
+	return size, policy, true
+}
@@ -0,0 +1,47 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"fmt"
+)
+
+// Audit logs a record of a change made to the logging system at runtime, e.g.
+// through the admin API: who made it, what it is, and its details as fields.
+//
+// The record goes to the audit filters (Filter.Audit, audit="true" in the
+// configuration) if there are some, whatever their level (they get nothing
+// else), and to all the filters at the WARNING level otherwise, so that a
+// change is never silent.
+func (log Logger) Audit(who, action string, fields ...Field) {
+	rec := &LogRecord{
+		Level:   WARNING,
+		Created: clockNow(),
+		Source:  "log4go/audit",
+		Message: fmt.Sprintf("%s, by %s", action, who),
+		Fields:  append([]Field{{"who", who}}, fields...),
+	}
+	if log.fs != nil {
+		set := log.acquire()
+		defer set.release()
+		audited := false
+		for tag, filt := range set.filters {
+			if !filt.Audit {
+				continue
+			}
+			if !audited {
+				addWorkerID(rec)
+				audited = true
+			}
+			out := rec
+			if filt.Redactor != nil {
+				out = filt.Redactor.Redact(rec)
+			}
+			filt.write(tag, out)
+		}
+		if audited {
+			return
+		}
+	}
+	log.dispatch(rec)
+}
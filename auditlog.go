@@ -0,0 +1,291 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// The field which ends every line of an audit log, before the closing brace
+const auditChainKey = `,"chain":"`
+
+// This log writer appends the records to a tamper-evident audit log, for the
+// logs which must show whether they were modified: each record is a line of
+// JSON (see JSONLayout) with a sequence number, seq, and a chain field, the
+// HMAC-SHA256 under a secret key of the chain of the record before and of the
+// record itself (the fields of the record are grouped under "fields").
+// Changing, inserting or removing a record breaks the chain from there on,
+// which VerifyAuditLog detects; without the key, the chain can't be
+// recomputed to hide it.  Close appends a last record, "audit log closed", so
+// that the truncation of a log closed properly shows too.
+//
+// The records are written as they are logged, not queued, so that none is lost
+// if the program dies.  An existing file is continued: the chain goes on from
+// its last record.  Without a key, the chain is a plain SHA-256 one, which
+// detects accidental damage only.
+type AuditLogWriter struct {
+	mu       sync.Mutex
+	file     *os.File
+	filename string
+	key      []byte
+	sync     bool
+	layout   JSONLayout
+
+	// The sequence number and the chain of the last record written
+	seq  uint64
+	prev []byte
+
+	writerStats
+}
+
+// NewAuditLogWriter creates a new AuditLogWriter appending to the file
+// fname, with the chain keyed by key.  It returns nil if the file can't be
+// opened, or if its last record can't be read to continue the chain.
+func NewAuditLogWriter(fname string, key []byte) *AuditLogWriter {
+	w := &AuditLogWriter{
+		filename: fname,
+		key:      append([]byte(nil), key...),
+		layout:   JSONLayout{TimeFormat: "rfc3339nano", FieldsKey: "fields"},
+	}
+	if err := w.open(); err != nil {
+		ReportError(fmt.Sprintf("AuditLogWriter(%q)", fname), err)
+		return nil
+	}
+	return w
+}
+
+// Open the file and read its last record
+func (w *AuditLogWriter) open() error {
+	fd, err := os.OpenFile(w.filename, os.O_RDWR|os.O_APPEND|os.O_CREATE, FileMode)
+	if err != nil {
+		return err
+	}
+	line, err := lastLine(fd)
+	if err != nil {
+		fd.Close()
+		return err
+	}
+	if len(line) > 0 {
+		seq, chain, _, err := parseAuditLine(line)
+		if err != nil {
+			fd.Close()
+			return fmt.Errorf("can't continue the chain: %s", err)
+		}
+		w.seq, w.prev = seq, chain
+	}
+	w.file = fd
+	return nil
+}
+
+// This is the AuditLogWriter's output method.  The record is written, and
+// synced if SetSync was called, before it returns.
+func (w *AuditLogWriter) LogWrite(rec *LogRecord) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		w.drop(1)
+		return
+	}
+	w.write(rec)
+}
+
+// Write a record, the lock held
+func (w *AuditLogWriter) write(rec *LogRecord) {
+	body := bytes.TrimRight(w.layout.Format(rec), "\n")
+	payload := make([]byte, 0, len(body)+32)
+	payload = append(payload, `{"seq":`...)
+	payload = strconv.AppendUint(payload, w.seq+1, 10)
+	payload = append(payload, ',')
+	payload = append(payload, body[1:]...)
+
+	chain := auditChain(w.key, w.prev, payload)
+	line := make([]byte, 0, len(payload)+len(auditChainKey)+2*len(chain)+3)
+	line = append(line, payload[:len(payload)-1]...)
+	line = append(line, auditChainKey...)
+	line = append(line, hex.EncodeToString(chain)...)
+	line = append(line, "\"}\n"...)
+
+	n, err := w.file.Write(line)
+	if err == nil && w.sync {
+		err = w.file.Sync()
+	}
+	if err != nil {
+		ReportError(fmt.Sprintf("AuditLogWriter(%q)", w.filename), err)
+		w.failed()
+		return
+	}
+	w.seq, w.prev = w.seq+1, chain
+	w.wrote(1, n)
+}
+
+// Close appends the last record, which seals the log, and closes the file.
+func (w *AuditLogWriter) Close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return
+	}
+	w.write(&LogRecord{Level: INFO, Created: clockNow(), Source: "log4go/audit", Message: auditSealMessage})
+	w.file.Sync()
+	w.file.Close()
+	w.file = nil
+}
+
+// Sync the file after each record (chainable): a record logged is on disk,
+// at the cost of a sync per record.
+func (w *AuditLogWriter) SetSync(sync bool) *AuditLogWriter {
+	w.mu.Lock()
+	w.sync = sync
+	w.mu.Unlock()
+	return w
+}
+
+// Chain returns the sequence number and the chain of the last record
+// written, e.g. to keep them apart as the anchor against which a later
+// VerifyAuditLog detects the truncation of the log.
+func (w *AuditLogWriter) Chain() (seq uint64, chain string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.seq, hex.EncodeToString(w.prev)
+}
+
+// The message of the record appended by Close
+const auditSealMessage = "audit log closed"
+
+// The chain of a record: the HMAC-SHA256 of the chain before it and of the
+// record under key, or their SHA-256 without a key
+func auditChain(key, prev, payload []byte) []byte {
+	var h hash.Hash
+	if len(key) > 0 {
+		h = hmac.New(sha256.New, key)
+	} else {
+		h = sha256.New()
+	}
+	h.Write(prev)
+	h.Write(payload)
+	return h.Sum(nil)
+}
+
+// Split a line of an audit log, without its newline, into its sequence
+// number, its chain and the record which is chained
+func parseAuditLine(line []byte) (seq uint64, chain, payload []byte, err error) {
+	i := bytes.LastIndex(line, []byte(auditChainKey))
+	if i < 0 || !bytes.HasSuffix(line, []byte(`"}`)) {
+		return 0, nil, nil, errors.New("no chain")
+	}
+	chain, err = hex.DecodeString(string(line[i+len(auditChainKey) : len(line)-2]))
+	if err != nil || len(chain) != sha256.Size {
+		return 0, nil, nil, errors.New("malformed chain")
+	}
+	payload = append(line[:i:i], '}')
+
+	var rec struct {
+		Seq uint64 `json:"seq"`
+	}
+	if err := json.Unmarshal(payload, &rec); err != nil {
+		return 0, nil, nil, fmt.Errorf("malformed record: %s", err)
+	}
+	return rec.Seq, chain, payload, nil
+}
+
+// The last line of a file, without its newline
+func lastLine(f *os.File) ([]byte, error) {
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil || size == 0 {
+		return nil, err
+	}
+
+	var tail []byte
+	for end := size; end > 0; {
+		start := end - 4096
+		if start < 0 {
+			start = 0
+		}
+		chunk := make([]byte, end-start)
+		n, err := f.ReadAt(chunk, start)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		tail = append(chunk[:n], tail...)
+		end = start
+		if i := bytes.LastIndexByte(bytes.TrimRight(tail, "\n"), '\n'); i >= 0 {
+			tail = tail[i+1:]
+			break
+		}
+	}
+	return bytes.TrimRight(tail, "\n"), nil
+}
+
+// An AuditReport is the result of the verification of an audit log.
+type AuditReport struct {
+	Records uint64 // The records verified
+	Sealed  bool   // Whether the last one is the record appended by Close
+	Chain   string // The chain of the last one, in hex
+}
+
+// An AuditError tells where the chain of an audit log breaks.
+type AuditError struct {
+	Line   int // The line of the first record which doesn't verify, from 1
+	Reason string
+}
+
+func (e *AuditError) Error() string {
+	return fmt.Sprintf("audit log: line %d: %s", e.Line, e.Reason)
+}
+
+// VerifyAuditLog reads an audit log written by an AuditLogWriter and checks
+// its chain with key: it returns an *AuditError at the first record which
+// was modified, inserted or removed, or isn't complete.  The records removed
+// from the end can't show in the chain itself: a log is complete if it's
+// sealed and the program was done with it, or if its last chain is the one
+// kept apart (see AuditLogWriter.Chain).
+func VerifyAuditLog(r io.Reader, key []byte) (AuditReport, error) {
+	var report AuditReport
+	var prev []byte
+	br := bufio.NewReader(r)
+	for lineno := 1; ; lineno++ {
+		line, err := br.ReadBytes('\n')
+		if len(line) == 0 && err == io.EOF {
+			return report, nil
+		}
+		if err != nil && err != io.EOF {
+			return report, err
+		}
+		if err == io.EOF {
+			return report, &AuditError{lineno, "incomplete record"}
+		}
+
+		seq, chain, payload, perr := parseAuditLine(line[:len(line)-1])
+		if perr != nil {
+			return report, &AuditError{lineno, perr.Error()}
+		}
+		if seq != report.Records+1 {
+			return report, &AuditError{lineno, fmt.Sprintf("sequence number %d, want %d", seq, report.Records+1)}
+		}
+		if !hmac.Equal(chain, auditChain(key, prev, payload)) {
+			return report, &AuditError{lineno, "chain mismatch"}
+		}
+
+		var rec struct {
+			Source  string `json:"source"`
+			Message string `json:"message"`
+		}
+		json.Unmarshal(payload, &rec)
+		report.Records = seq
+		report.Sealed = rec.Source == "log4go/audit" && rec.Message == auditSealMessage
+		report.Chain = hex.EncodeToString(chain)
+		prev = chain
+	}
+}
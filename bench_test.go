@@ -0,0 +1,215 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// The benchmarks of the pipeline, from the call to the writer: run them with
+// "make bench", and compare two runs with "make benchcmp" (see the Makefile).
+// The writers are closed before the timer stops, so that the records still
+// queued count.
+
+// A logger with a single filter at INFO writing to w
+func benchLogger(w LogWriter) Logger {
+	return NewLogger().SetFilter("bench", &Filter{Level: INFO, LogWriter: w})
+}
+
+// A temporary directory for the files of a benchmark
+func benchDir(b *testing.B) string {
+	dir, err := ioutil.TempDir("", "log4go-bench")
+	if err != nil {
+		b.Fatalf("TempDir: %s", err)
+	}
+	return dir
+}
+
+func BenchmarkDisabledLevel(b *testing.B) {
+	b.ReportAllocs()
+	l := benchLogger(NewConsoleLogWriterTo(ioutil.Discard))
+	defer l.Close()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.Debug("This is a log message")
+	}
+}
+
+func BenchmarkDisabledLevelArgs(b *testing.B) {
+	b.ReportAllocs()
+	l := benchLogger(NewConsoleLogWriterTo(ioutil.Discard))
+	defer l.Close()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.Debug("%s is a log message number %d", "This", i)
+	}
+}
+
+func BenchmarkDisabledLevelClosure(b *testing.B) {
+	b.ReportAllocs()
+	l := benchLogger(NewConsoleLogWriterTo(ioutil.Discard))
+	defer l.Close()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.Debugc(func() string { return "This is a log message" })
+	}
+}
+
+func BenchmarkConsoleWriter(b *testing.B) {
+	b.ReportAllocs()
+	l := benchLogger(NewConsoleLogWriterTo(ioutil.Discard))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.Info("%s is a log message number %d", "This", i)
+	}
+	l.Close()
+}
+
+func BenchmarkFileWriter(b *testing.B) {
+	b.ReportAllocs()
+	dir := benchDir(b)
+	defer os.RemoveAll(dir)
+	l := benchLogger(NewFileLogWriter(filepath.Join(dir, "bench.log"), false, false))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.Info("%s is a log message number %d", "This", i)
+	}
+	l.Close()
+}
+
+func BenchmarkFileWriterBuffered(b *testing.B) {
+	b.ReportAllocs()
+	dir := benchDir(b)
+	defer os.RemoveAll(dir)
+	w := NewFileLogWriter(filepath.Join(dir, "bench.log"), false, false).SetBuffer(64*1024, time.Second)
+	l := benchLogger(w)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.Info("%s is a log message number %d", "This", i)
+	}
+	l.Close()
+}
+
+func BenchmarkFileWriterJSON(b *testing.B) {
+	b.ReportAllocs()
+	dir := benchDir(b)
+	defer os.RemoveAll(dir)
+	w := NewFileLogWriter(filepath.Join(dir, "bench.log"), false, false).SetLayout(JSONLayout{})
+	l := benchLogger(w)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.LogcFields(INFO, func() (string, []Field) {
+			return "This is a log message", []Field{{"number", i}, {"user", "alice"}}
+		})
+	}
+	l.Close()
+}
+
+func BenchmarkSocketWriter(b *testing.B) {
+	b.ReportAllocs()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatalf("Listen: %s", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(ioutil.Discard, conn)
+		}
+	}()
+
+	l := benchLogger(NewSocketLogWriter("tcp", ln.Addr().String()))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.Info("%s is a log message number %d", "This", i)
+	}
+	l.Close()
+}
+
+func BenchmarkJSONLayout(b *testing.B) {
+	b.ReportAllocs()
+	rec := &LogRecord{Level: INFO, Created: now, Source: "source", Message: "This is a log message",
+		Fields: []Field{{"number", 42}, {"user", "alice"}}}
+	layout := JSONLayout{}
+	for i := 0; i < b.N; i++ {
+		layout.Format(rec)
+	}
+}
+
+func BenchmarkPatternLayout(b *testing.B) {
+	b.ReportAllocs()
+	rec := &LogRecord{Level: INFO, Created: now, Source: "source", Message: "This is a log message",
+		Fields: []Field{{"number", 42}, {"user", "alice"}}}
+	layout := PatternLayout{Pattern: FORMAT_DEFAULT}
+	for i := 0; i < b.N; i++ {
+		layout.Format(rec)
+	}
+}
+
+func BenchmarkConcurrentProducers(b *testing.B) {
+	b.ReportAllocs()
+	dir := benchDir(b)
+	defer os.RemoveAll(dir)
+	l := benchLogger(NewFileLogWriter(filepath.Join(dir, "bench.log"), false, false))
+	b.SetParallelism(8)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			l.Info("%s is a log message number %d", "This", i)
+		}
+	})
+	l.Close()
+}
+
+func BenchmarkAsyncDropNewest(b *testing.B) {
+	b.ReportAllocs()
+	dir := benchDir(b)
+	defer os.RemoveAll(dir)
+	w := NewAsyncWriter(NewFileLogWriter(filepath.Join(dir, "bench.log"), false, false), 1024, OverflowDropNewest)
+	l := benchLogger(w)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.Info("%s is a log message number %d", "This", i)
+	}
+	l.Close()
+}
+
+func BenchmarkExcludes(b *testing.B) {
+	b.ReportAllocs()
+	l := NewLogger()
+	for i := 0; i < 8; i++ {
+		excludes := []string{"github.com/example/noisy", "github.com/example/chatty", "golang.org/x/net", "google.golang.org/grpc"}
+		l.SetFilter(fmt.Sprintf("bench%d", i), &Filter{Level: INFO, LogWriter: NewMemoryLogWriter(1), Excludes: excludes})
+	}
+	defer l.Close()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.Info("This is a log message")
+	}
+}
+
+// Baseline results (linux amd64, go1.27, 1 CPU), make bench:
+//
+// BenchmarkDisabledLevel        	13752706	        86.72 ns/op	       0 B/op	       0 allocs/op
+// BenchmarkDisabledLevelArgs    	 9964036	       118.1 ns/op	       7 B/op	       0 allocs/op
+// BenchmarkDisabledLevelClosure 	12434558	        90.56 ns/op	       0 B/op	       0 allocs/op
+// BenchmarkConsoleWriter        	  817497	      1523 ns/op	     304 B/op	       4 allocs/op
+// BenchmarkFileWriter           	  416496	      2560 ns/op	     304 B/op	       4 allocs/op
+// BenchmarkFileWriterBuffered   	  642976	      1805 ns/op	     304 B/op	       4 allocs/op
+// BenchmarkFileWriterJSON       	  280543	      4475 ns/op	    1112 B/op	      29 allocs/op
+// BenchmarkSocketWriter         	  275112	      3657 ns/op	     663 B/op	       7 allocs/op
+// BenchmarkJSONLayout           	  373290	      4606 ns/op	     736 B/op	      25 allocs/op
+// BenchmarkPatternLayout        	 1186682	       847.9 ns/op	     368 B/op	       6 allocs/op
+// BenchmarkConcurrentProducers  	  672292	      2220 ns/op	     304 B/op	       3 allocs/op
+// BenchmarkAsyncDropNewest      	  484918	      2282 ns/op	     464 B/op	       5 allocs/op
@@ -0,0 +1,152 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	stdlog "log"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// A Classifier picks the level of the lines coming from another logging
+// package (the standard log package, gRPC, the errors of an http.Server...),
+// which only gives text.  The rules are tried in the order they were added,
+// the first which matches decides; the lines matching none get the default
+// level.
+type Classifier struct {
+	mu    sync.RWMutex
+	rules []classifierRule
+	def   Level
+}
+
+type classifierRule struct {
+	prefix string
+	re     *regexp.Regexp
+	lvl    Level
+}
+
+// NewClassifier creates a Classifier without rules, which gives def to every
+// line.
+func NewClassifier(def Level) *Classifier {
+	return &Classifier{def: def}
+}
+
+// DefaultClassifier creates a Classifier which looks for the usual severity
+// words: panic and fatal are CRITICAL, error and err ERROR, warn and warning
+// WARNING, debug DEBUG, anything else INFO.  More rules can be added.
+func DefaultClassifier() *Classifier {
+	return NewClassifier(INFO).
+		AddRegexp(regexp.MustCompile(`(?i)\b(panic|fatal)\b`), CRITICAL).
+		AddRegexp(regexp.MustCompile(`(?i)\berr(or)?\b`), ERROR).
+		AddRegexp(regexp.MustCompile(`(?i)\bwarn(ing)?\b`), WARNING).
+		AddRegexp(regexp.MustCompile(`(?i)\bdebug\b`), DEBUG)
+}
+
+// Give lvl to the lines starting with prefix (chainable).
+func (c *Classifier) AddPrefix(prefix string, lvl Level) *Classifier {
+	c.mu.Lock()
+	c.rules = append(c.rules, classifierRule{prefix: prefix, lvl: lvl})
+	c.mu.Unlock()
+	return c
+}
+
+// Give lvl to the lines matching re (chainable).
+func (c *Classifier) AddRegexp(re *regexp.Regexp, lvl Level) *Classifier {
+	c.mu.Lock()
+	c.rules = append(c.rules, classifierRule{re: re, lvl: lvl})
+	c.mu.Unlock()
+	return c
+}
+
+// Classify returns the level of line.
+func (c *Classifier) Classify(line string) Level {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, rule := range c.rules {
+		if rule.re != nil && rule.re.MatchString(line) {
+			return rule.lvl
+		}
+		if rule.re == nil && strings.HasPrefix(line, rule.prefix) {
+			return rule.lvl
+		}
+	}
+	return c.def
+}
+
+// This is an io.Writer which logs what is written to it, one record per
+// write, at the level given by its Classifier.  Hand it to the packages which
+// log through an io.Writer or a standard *log.Logger.
+type BridgeWriter struct {
+	log        Logger
+	source     string
+	classifier *Classifier
+
+	// The lines start with the file and line of their caller, "file.go:42: ",
+	// which replace the source (the Lshortfile flag of the standard log package)
+	callers bool
+}
+
+// NewBridgeWriter creates a BridgeWriter which logs to log, with the given
+// source (e.g. "grpc", %S in the patterns), at the levels given by c.
+// DefaultClassifier is used if c is nil.
+func NewBridgeWriter(log Logger, source string, c *Classifier) *BridgeWriter {
+	if c == nil {
+		c = DefaultClassifier()
+	}
+	return &BridgeWriter{log: log, source: source, classifier: c}
+}
+
+// This is the BridgeWriter's output method.  A trailing newline is removed,
+// the other ones are kept, e.g. in the stack trace of a panic.
+func (w *BridgeWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimRight(string(p), "\r\n")
+	src := w.source
+	if w.callers {
+		if i := strings.Index(msg, ": "); i > 0 && strings.Contains(msg[:i], ".go:") {
+			src, msg = msg[:i], msg[i+2:]
+		}
+	}
+	if msg != "" {
+		w.log.Log(w.classifier.Classify(msg), src, msg)
+	}
+	return len(p), nil
+}
+
+// StdLogger returns a standard *log.Logger which logs to the logger through a
+// BridgeWriter, e.g. for the ErrorLog of an http.Server:
+//
+//	srv.ErrorLog = log.StdLogger("http", nil)
+func (log Logger) StdLogger(source string, c *Classifier) *stdlog.Logger {
+	return stdlog.New(NewBridgeWriter(log, source, c), "", 0)
+}
+
+// Wrapper for (*Logger).StdLogger
+func StdLogger(source string, c *Classifier) *stdlog.Logger {
+	return Global.StdLogger(source, c)
+}
+
+// RedirectStdLog sends the output of the standard log package to the global
+// logger, with "log" as the source.  Its time prefix is turned off, the
+// records have their own.
+func RedirectStdLog(c *Classifier) {
+	stdlog.SetFlags(0)
+	stdlog.SetOutput(NewBridgeWriter(Global, "log", c))
+}
+
+// HijackStdLog sends the output of the standard log package to the global
+// logger at lvl, so that the log.Printf of third-party code gets the times,
+// levels and writers of log4go rather than going raw to stderr.  The source
+// of a record is the file and line of the caller, e.g. "client.go:42"; the
+// prefix of the standard logger stays in the message.  The returned function
+// restores the standard logger as it was.
+func HijackStdLog(lvl Level) (restore func()) {
+	out, flags, prefix := stdlog.Writer(), stdlog.Flags(), stdlog.Prefix()
+	stdlog.SetFlags(stdlog.Lshortfile | stdlog.Lmsgprefix)
+	stdlog.SetOutput(&BridgeWriter{log: Global, source: "log", classifier: NewClassifier(lvl), callers: true})
+	return func() {
+		stdlog.SetOutput(out)
+		stdlog.SetFlags(flags)
+		stdlog.SetPrefix(prefix)
+	}
+}
@@ -0,0 +1,359 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"fmt"
+	"github.com/kimiazhu/log4go/stack"
+	"os"
+	"time"
+)
+
+// A ConfigBuilder configures the filters of a logger in code, the counterpart
+// of the XML configuration checked at compile time:
+//
+//	err := log.NewConfig().
+//	    Console(log.INFO, log.WithFormat("[%T] %M")).
+//	    File("app.log", log.DEBUG, log.WithRotateDaily(), log.WithMaxBackup(7)).
+//	    Socket("udp", "192.168.1.255:12124", log.ERROR, log.WithTag("network")).
+//	    Apply(log.Global)
+//
+// The writers are only created by Apply.
+type ConfigBuilder struct {
+	filters []*filterSpec
+}
+
+// The settings of a filter to be created
+type filterSpec struct {
+	tag    string
+	level  Level
+	filter Filter
+	create func(spec *filterSpec) (LogWriter, error)
+
+	// The settings of the writers, each takes the ones which apply to it
+	format, timeformat string
+	layout             Layout
+	utc                bool
+	transcoder         Transcoder
+	rotate, daily      bool
+	maxlines           int
+	maxsize            int64
+	maxbackup          int
+	crlf, bom          bool
+	shared             bool
+	lockwrites         bool
+	filemode           os.FileMode
+	bufsize            int
+	flushinterval      time.Duration
+	batchsize          int
+	batchlatency       time.Duration
+	header, trailer    string
+	async              bool
+	asyncqueue         int
+	asyncpolicy        OverflowPolicy
+}
+
+// A FilterOption is a setting of a filter built by a ConfigBuilder.  The
+// options which don't apply to the writer of the filter, e.g. WithRotateDaily
+// for a console, are ignored.
+type FilterOption func(spec *filterSpec)
+
+// NewConfig returns an empty ConfigBuilder.
+func NewConfig() *ConfigBuilder {
+	return &ConfigBuilder{}
+}
+
+func (b *ConfigBuilder) add(tag string, lvl Level, create func(spec *filterSpec) (LogWriter, error), opts []FilterOption) *ConfigBuilder {
+	spec := &filterSpec{tag: tag, level: lvl, create: create, maxbackup: 999, filemode: FileMode, batchsize: FileBatchSize}
+	for _, opt := range opts {
+		opt(spec)
+	}
+	b.filters = append(b.filters, spec)
+	return b
+}
+
+// Console adds a filter writing to stdout, tagged "stdout" (chainable).
+func (b *ConfigBuilder) Console(lvl Level, opts ...FilterOption) *ConfigBuilder {
+	return b.add("stdout", lvl, func(spec *filterSpec) (LogWriter, error) {
+		w := NewConsoleLogWriter()
+		if spec.format != "" {
+			w.SetFormat(spec.format)
+		}
+		w.SetTimeFormat(spec.timeformat)
+		if spec.layout != nil {
+			w.SetLayout(spec.layout)
+		}
+		w.SetUTC(spec.utc)
+		return w, nil
+	}, opts)
+}
+
+// File adds a filter writing to filename, tagged with the file name
+// (chainable).
+func (b *ConfigBuilder) File(filename string, lvl Level, opts ...FilterOption) *ConfigBuilder {
+	return b.add(filename, lvl, func(spec *filterSpec) (LogWriter, error) {
+		w := NewFileLogWriter(filename, spec.rotate, spec.daily)
+		if w == nil {
+			return nil, fmt.Errorf("could not open %q", filename)
+		}
+		if spec.format != "" {
+			w.SetFormat(spec.format)
+		}
+		w.SetTimeFormat(spec.timeformat)
+		if spec.layout != nil {
+			w.SetLayout(spec.layout)
+		}
+		w.SetUTC(spec.utc)
+		w.SetTranscoder(spec.transcoder)
+		w.SetCRLF(spec.crlf)
+		w.SetBOM(spec.bom)
+		w.SetShared(spec.shared)
+		w.SetLockWrites(spec.lockwrites)
+		w.SetFileMode(spec.filemode)
+		w.SetBuffer(spec.bufsize, spec.flushinterval)
+		w.SetBatch(spec.batchsize, spec.batchlatency)
+		if spec.header != "" || spec.trailer != "" {
+			w.SetHeadFoot(spec.header, spec.trailer)
+		}
+		w.SetRotateLines(spec.maxlines)
+		w.SetRotateSize(spec.maxsize)
+		w.SetRotateMaxBackup(spec.maxbackup)
+		return w, nil
+	}, opts)
+}
+
+// Socket adds a filter sending the records to hostport, tagged with hostport
+// (chainable).
+func (b *ConfigBuilder) Socket(proto, hostport string, lvl Level, opts ...FilterOption) *ConfigBuilder {
+	return b.add(hostport, lvl, func(spec *filterSpec) (LogWriter, error) {
+		w := NewSocketLogWriter(proto, hostport)
+		if spec.layout != nil {
+			w.SetLayout(spec.layout)
+		}
+		w.SetUTC(spec.utc)
+		w.SetTranscoder(spec.transcoder)
+		return w, nil
+	}, opts)
+}
+
+// Memory adds a filter keeping the last size records in memory, tagged
+// "memory" (chainable).
+func (b *ConfigBuilder) Memory(size int, lvl Level, opts ...FilterOption) *ConfigBuilder {
+	return b.add("memory", lvl, func(spec *filterSpec) (LogWriter, error) {
+		w := NewMemoryLogWriter(size)
+		if spec.format != "" {
+			w.SetFormat(spec.format)
+		}
+		w.SetTimeFormat(spec.timeformat)
+		if spec.layout != nil {
+			w.SetLayout(spec.layout)
+		}
+		w.SetUTC(spec.utc)
+		return w, nil
+	}, opts)
+}
+
+// Writer adds a filter tagged tag with a writer of its own (chainable).  Only
+// the options of the filter itself apply: WithTag, WithExcludes, WithAccess,
+// WithAudit, WithStackLevel and WithAsync.
+func (b *ConfigBuilder) Writer(tag string, lvl Level, writer LogWriter, opts ...FilterOption) *ConfigBuilder {
+	return b.add(tag, lvl, func(spec *filterSpec) (LogWriter, error) {
+		return writer, nil
+	}, opts)
+}
+
+// Apply creates the writers and adds the filters to log, replacing the filters
+// with the same tags.  If a writer can't be created, the ones already created
+// are closed, log is left alone and the error is returned.
+func (b *ConfigBuilder) Apply(log Logger) error {
+	filters := make(map[string]*Filter, len(b.filters))
+	for _, spec := range b.filters {
+		w, err := spec.create(spec)
+		if err == nil {
+			if _, dup := filters[spec.tag]; dup {
+				w.Close()
+				err = fmt.Errorf("duplicate tag %q", spec.tag)
+			}
+		}
+		if err != nil {
+			for _, filt := range filters {
+				filt.Close()
+			}
+			return fmt.Errorf("filter %q: %s", spec.tag, err)
+		}
+
+		if spec.async {
+			w = NewAsyncWriter(w, spec.asyncqueue, spec.asyncpolicy)
+		}
+		filt := spec.filter
+		filt.Level = spec.level
+		filt.LogWriter = w
+		filters[spec.tag] = &filt
+	}
+
+	replaced := log.change(func(current map[string]*Filter) []*Filter {
+		var replaced []*Filter
+		for tag, filt := range filters {
+			if old, ok := current[tag]; ok {
+				replaced = append(replaced, old)
+			}
+			current[tag] = filt
+		}
+		return replaced
+	})
+	for _, old := range replaced {
+		old.Close()
+	}
+	return nil
+}
+
+// WithTag tags the filter with tag rather than the default of its writer.
+func WithTag(tag string) FilterOption {
+	return func(spec *filterSpec) { spec.tag = tag }
+}
+
+// WithExcludes keeps the records from the sources starting with one of the
+// prefixes out of the filter.
+func WithExcludes(prefixes ...string) FilterOption {
+	return func(spec *filterSpec) { spec.filter.Excludes = append(spec.filter.Excludes, prefixes...) }
+}
+
+// WithAccess sets how the filter treats the ACCESS records.
+func WithAccess(access AccessMode) FilterOption {
+	return func(spec *filterSpec) { spec.filter.Access = access }
+}
+
+// WithAudit makes the filter an audit filter, which only gets the records of
+// Logger.Audit.
+func WithAudit() FilterOption {
+	return func(spec *filterSpec) { spec.filter.Audit = true }
+}
+
+// WithStackLevel appends the call stack to the records at or above lvl.
+func WithStackLevel(lvl Level) FilterOption {
+	return func(spec *filterSpec) { spec.filter.StackLevel = lvl }
+}
+
+// WithStackFormat prints the call stacks of WithStackLevel in format, with
+// depth frames at most (all of them if 0).
+func WithStackFormat(format stack.Format, depth int) FilterOption {
+	return func(spec *filterSpec) {
+		spec.filter.StackFormat = format
+		spec.filter.StackDepth = depth
+	}
+}
+
+// WithFormat sets the format of the records, see FormatLogRecord.
+func WithFormat(format string) FilterOption {
+	return func(spec *filterSpec) { spec.format = format }
+}
+
+// WithTimeFormat sets the time format of %Z, a preset name or a layout.
+func WithTimeFormat(timeformat string) FilterOption {
+	return func(spec *filterSpec) { spec.timeformat = timeformat }
+}
+
+// WithLayout sets the layout of the records, which replaces the format.
+func WithLayout(layout Layout) FilterOption {
+	return func(spec *filterSpec) { spec.layout = layout }
+}
+
+// WithUTC prints the times in UTC rather than in the local time zone.
+func WithUTC() FilterOption {
+	return func(spec *filterSpec) { spec.utc = true }
+}
+
+// WithTranscoder sets the character encoding of a file or a socket.
+func WithTranscoder(t Transcoder) FilterOption {
+	return func(spec *filterSpec) { spec.transcoder = t }
+}
+
+// WithRotate keeps the old files of a file filter, renamed with a .### suffix.
+func WithRotate() FilterOption {
+	return func(spec *filterSpec) { spec.rotate = true }
+}
+
+// WithRotateDaily starts a new file every day, keeping the old ones.
+func WithRotateDaily() FilterOption {
+	return func(spec *filterSpec) { spec.rotate, spec.daily = true, true }
+}
+
+// WithRotateLines starts a new file after maxlines records, keeping the old
+// ones.
+func WithRotateLines(maxlines int) FilterOption {
+	return func(spec *filterSpec) { spec.rotate, spec.maxlines = true, maxlines }
+}
+
+// WithRotateSize starts a new file after maxsize bytes, keeping the old ones.
+func WithRotateSize(maxsize int64) FilterOption {
+	return func(spec *filterSpec) { spec.rotate, spec.maxsize = true, maxsize }
+}
+
+// WithMaxBackup sets how many old files are kept, 999 by default.
+func WithMaxBackup(maxbackup int) FilterOption {
+	return func(spec *filterSpec) { spec.maxbackup = maxbackup }
+}
+
+// WithHeadFoot sets the header and the trailer of the files.
+func WithHeadFoot(header, trailer string) FilterOption {
+	return func(spec *filterSpec) { spec.header, spec.trailer = header, trailer }
+}
+
+// WithCRLF ends the lines of a file with CRLF rather than LF.
+func WithCRLF() FilterOption {
+	return func(spec *filterSpec) { spec.crlf = true }
+}
+
+// WithBOM starts the new files with a UTF-8 byte order mark.
+func WithBOM() FilterOption {
+	return func(spec *filterSpec) { spec.bom = true }
+}
+
+// WithShared rotates a file shared with other processes exactly once, see
+// FileLogWriter.SetShared.
+func WithShared() FilterOption {
+	return func(spec *filterSpec) { spec.shared = true }
+}
+
+// WithLockWrites locks the file shared with other processes for each write, see
+// FileLogWriter.SetLockWrites.
+func WithLockWrites() FilterOption {
+	return func(spec *filterSpec) { spec.lockwrites = true }
+}
+
+// WithSampler writes only the records s keeps, see Filter.Sampler.
+func WithSampler(s Sampler) FilterOption {
+	return func(spec *filterSpec) { spec.filter.Sampler = s }
+}
+
+// WithPredicate writes only the records p keeps, see Filter.SetPredicate.
+func WithPredicate(p Predicate) FilterOption {
+	return func(spec *filterSpec) { spec.filter.SetPredicate(p) }
+}
+
+// WithRedactor scrubs the records before they are written, see
+// Filter.Redactor.
+func WithRedactor(r *Redactor) FilterOption {
+	return func(spec *filterSpec) { spec.filter.Redactor = r }
+}
+
+// WithAsync makes the writer of the filter asynchronous, see NewAsyncWriter.
+func WithAsync(queueSize int, policy OverflowPolicy) FilterOption {
+	return func(spec *filterSpec) { spec.async, spec.asyncqueue, spec.asyncpolicy = true, queueSize, policy }
+}
+
+// WithFileMode sets the permissions of the files of a file filter, e.g. 0600.
+func WithFileMode(mode os.FileMode) FilterOption {
+	return func(spec *filterSpec) { spec.filemode = mode }
+}
+
+// WithBuffer buffers the writes of a file filter, see FileLogWriter.SetBuffer.
+func WithBuffer(size int, interval time.Duration) FilterOption {
+	return func(spec *filterSpec) { spec.bufsize, spec.flushinterval = size, interval }
+}
+
+// WithBatch sets how a file filter writes the records queued at once, see
+// FileLogWriter.SetBatch.
+func WithBatch(size int, latency time.Duration) FilterOption {
+	return func(spec *filterSpec) { spec.batchsize, spec.batchlatency = size, latency }
+}
@@ -0,0 +1,54 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"github.com/kimiazhu/log4go/stack"
+	"runtime"
+)
+
+// The path of this package, whose frames are left out of the call stacks: the
+// stacks start at the caller of the logging function, however deep in the
+// package the stack is taken
+var packagePath = func() string {
+	pc, _, _, _ := runtime.Caller(0)
+	return stack.Package(runtime.FuncForPC(pc).Name())
+}()
+
+// The frames of the stack from the caller of the logging function
+func callerFrames() []stack.Frame {
+	return stack.TrimPackage(stack.Callers(1, 0), packagePath)
+}
+
+// The call stack of the caller of the logging function in full, as Critical
+// appends it
+func callStack() string {
+	return stack.Full.Sprint(callerFrames())
+}
+
+// A copy of a record with the stack appended, in a format and a depth
+type stackedRecord struct {
+	format stack.Format
+	depth  int
+	rec    *LogRecord
+}
+
+// The copy of rec with frames appended as filt wants them, made once for all
+// the filters wanting the same format and depth: the copies made so far are
+// in stacked
+func withStack(rec *LogRecord, filt *Filter, frames []stack.Frame, stacked []stackedRecord) (*LogRecord, []stackedRecord) {
+	for _, s := range stacked {
+		if s.format == filt.StackFormat && s.depth == filt.StackDepth {
+			return s.rec, stacked
+		}
+	}
+
+	if filt.StackDepth > 0 && filt.StackDepth < len(frames) {
+		frames = frames[:filt.StackDepth]
+	}
+	copied := new(LogRecord)
+	*copied = *rec
+	copied.refs = 0
+	copied.Message = rec.Message + "\n" + filt.StackFormat.Sprint(frames)
+	return copied, append(stacked, stackedRecord{filt.StackFormat, filt.StackDepth, copied})
+}
@@ -0,0 +1,128 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+// DefaultLocale is the locale used when a key is missing from the catalog of
+// the configured locale.
+const DefaultLocale = "en"
+
+var catalogs = struct {
+	sync.RWMutex
+	locale   string
+	messages map[string]map[string]string
+}{locale: DefaultLocale, messages: make(map[string]map[string]string)}
+
+// RegisterCatalog adds the messages of locale (e.g. "en", "zh-CN"), a map from
+// the message keys to their fmt format in that language.  It can be called
+// several times for the same locale, later messages override earlier ones.
+func RegisterCatalog(locale string, messages map[string]string) {
+	catalogs.Lock()
+	defer catalogs.Unlock()
+	catalog, ok := catalogs.messages[locale]
+	if !ok {
+		catalog = make(map[string]string, len(messages))
+		catalogs.messages[locale] = catalog
+	}
+	for key, format := range messages {
+		catalog[key] = format
+	}
+}
+
+// LoadCatalog registers the messages of locale read from a JSON file holding
+// an object of key/format pairs.
+func LoadCatalog(locale, filename string) error {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	messages := make(map[string]string)
+	if err := json.Unmarshal(contents, &messages); err != nil {
+		return fmt.Errorf("LoadCatalog: %s: %s", filename, err)
+	}
+	RegisterCatalog(locale, messages)
+	return nil
+}
+
+// SetLocale sets the locale the messages are rendered in.  The locale can also
+// be set with the locale attribute of the <logging> element in the XML
+// configuration.
+func SetLocale(locale string) {
+	catalogs.Lock()
+	catalogs.locale = locale
+	catalogs.Unlock()
+}
+
+// Localize renders the message key with args in locale.  If the key is missing
+// from the catalog of locale, the catalog of its base language ("zh" for
+// "zh-CN") and then of DefaultLocale are tried.  Unknown keys are rendered as
+// the key followed by the arguments.
+func Localize(locale, key string, args ...interface{}) string {
+	catalogs.RLock()
+	format, ok := catalogs.messages[locale][key]
+	if i := strings.IndexAny(locale, "-_"); !ok && i > 0 {
+		format, ok = catalogs.messages[locale[:i]][key]
+	}
+	if !ok {
+		format, ok = catalogs.messages[DefaultLocale][key]
+	}
+	catalogs.RUnlock()
+
+	if !ok {
+		return strings.TrimSpace(fmt.Sprintln(append([]interface{}{key}, args...)...))
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// A Message is a catalog key with its arguments, rendered in the configured
+// locale only when the record is formatted, so that it costs nothing if the
+// level is disabled:
+//
+//      log4go.RegisterCatalog("en", map[string]string{"disk.full": "disk %s is full"})
+//      log4go.RegisterCatalog("de", map[string]string{"disk.full": "Datenträger %s ist voll"})
+//      log4go.Warn(log4go.Msg("disk.full", "/data"))
+//
+// Use LogMsg to also keep the key as the msg_key field of the record, for
+// the machines reading the logs.
+type Message struct {
+	Key  string
+	Args []interface{}
+}
+
+// Msg creates a Message for key.
+func Msg(key string, args ...interface{}) Message {
+	return Message{key, args}
+}
+
+// String renders the message in the configured locale.
+func (m Message) String() string {
+	catalogs.RLock()
+	locale := catalogs.locale
+	catalogs.RUnlock()
+	return Localize(locale, m.Key, m.Args...)
+}
+
+// LogMsg logs the message key rendered in the configured locale at the given
+// log level, with the key as the msg_key field.
+func (log Logger) LogMsg(lvl Level, key string, args ...interface{}) {
+	if log.skip(lvl) {
+		return
+	}
+	log.intLogFields(lvl, []Field{{"msg_key", key}}, Msg(key, args...).String())
+}
+
+// Send a localized message with its key
+// Wrapper for (*Logger).LogMsg
+func LogMsg(lvl Level, key string, args ...interface{}) {
+	if Global.skip(lvl) {
+		return
+	}
+	Global.intLogFields(lvl, []Field{{"msg_key", key}}, Msg(key, args...).String())
+}
@@ -0,0 +1,98 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A Clock tells the time of the records (LogRecord.Created) and the time the
+// logger decides on: the daily rotations of the files, the age of the records
+// held back (see SetRecordTTL), the window of the crash dumps, the rate of
+// Every and Progress, the duration of the jobs and when a failover writer
+// tries its primary again.  The timeouts, the backoffs between the attempts
+// and the access records, timed by their requests, keep the time of the
+// system.
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc adapts a function to a Clock
+type ClockFunc func() time.Time
+
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// The clock of the system
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// The clock in use, in a holder so that the type stored is always the same
+var clock atomic.Value // clockHolder
+
+type clockHolder struct {
+	Clock
+}
+
+func init() {
+	clock.Store(clockHolder{systemClock{}})
+}
+
+// SetClock replaces the clock of the package, e.g. with a ManualClock so that
+// a test decides the times of the records and when the files rotate.  A nil
+// clock restores the clock of the system.
+func SetClock(c Clock) {
+	if c == nil {
+		c = systemClock{}
+	}
+	clock.Store(clockHolder{c})
+}
+
+// The time of the clock
+func clockNow() time.Time {
+	return clock.Load().(clockHolder).Now()
+}
+
+// A ManualClock only moves when told to, see SetClock:
+//
+//	c := log4go.NewManualClock(time.Date(2017, 3, 1, 23, 59, 0, 0, time.UTC))
+//	log4go.SetClock(c)
+//	defer log4go.SetClock(nil)
+//	log.Info("before midnight")
+//	c.Advance(2 * time.Minute)
+//	log.Info("after midnight, in a new file")
+type ManualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewManualClock creates a ManualClock showing t.
+func NewManualClock(t time.Time) *ManualClock {
+	return &ManualClock{now: t}
+}
+
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Set sets the time of the clock.
+func (c *ManualClock) Set(t time.Time) {
+	c.mu.Lock()
+	c.now = t
+	c.mu.Unlock()
+}
+
+// Advance moves the clock forward by d.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
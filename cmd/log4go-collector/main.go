@@ -0,0 +1,96 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+// Command log4go-collector receives the records the socket writers of log4go
+// send, and writes them through a local configuration, e.g. to files rotated
+// daily:
+//
+//	log4go-collector -config collector.xml -tcp :12124 -udp :12124
+//
+// The -format flag is the wire format of the socket writers: json (their
+// default), msgpack, protobuf or binary.  Without -config, the records go to
+// the standard output.  SIGHUP reloads the configuration, SIGINT and SIGTERM
+// stop the collector.
+package main
+
+import (
+	"flag"
+	"fmt"
+	log "github.com/kimiazhu/log4go"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+var (
+	config = flag.String("config", "", "log4go configuration of the records received, standard output if empty")
+	tcp    = flag.String("tcp", "", "TCP address to listen on, e.g. :12124")
+	udp    = flag.String("udp", "", "UDP address to listen on, e.g. :12124")
+	format = flag.String("format", "json", "wire format of the records: json, msgpack, protobuf or binary")
+)
+
+func main() {
+	flag.Parse()
+	if *tcp == "" && *udp == "" {
+		fmt.Fprintln(os.Stderr, "log4go-collector: -tcp or -udp is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+	wire, ok := wireFormat(*format)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "log4go-collector: unknown format %q\n", *format)
+		os.Exit(2)
+	}
+
+	logger := log.NewDefaultLogger(log.ACCESS)
+	if *config != "" {
+		logger = log.NewLogger()
+		logger.LoadConfiguration(*config)
+	}
+	collector := log.NewCollector(logger, wire)
+
+	errs := make(chan error, 2)
+	for _, listen := range []struct{ proto, addr string }{{"tcp", *tcp}, {"udp", *udp}} {
+		if listen.addr == "" {
+			continue
+		}
+		go func(proto, addr string) {
+			errs <- collector.ListenAndServe(proto, addr)
+		}(listen.proto, listen.addr)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, os.Interrupt, syscall.SIGTERM)
+	status := 0
+loop:
+	for {
+		select {
+		case sig := <-signals:
+			if sig != syscall.SIGHUP {
+				break loop
+			}
+			if *config != "" {
+				if err := logger.ReloadConfiguration(*config); err != nil {
+					fmt.Fprintf(os.Stderr, "log4go-collector: %s\n", err)
+				}
+			}
+		case err := <-errs:
+			fmt.Fprintf(os.Stderr, "log4go-collector: %s\n", err)
+			status = 1
+			break loop
+		}
+	}
+
+	collector.Close()
+	logger.Close()
+	os.Exit(status)
+}
+
+// The wire format named name
+func wireFormat(name string) (log.WireFormat, bool) {
+	for _, wire := range []log.WireFormat{log.WireJSON, log.WireMsgpack, log.WireProtobuf, log.WireBinary} {
+		if wire.String() == name {
+			return wire, true
+		}
+	}
+	return log.WireJSON, false
+}
@@ -0,0 +1,188 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// A Collector receives the records of SocketLogWriters, in a WireFormat, and
+// logs them through a logger (see Logger.Forward), e.g. one writing them to
+// rotated files: it's the receiving end of the socket writers, which the
+// log4go-collector command runs.
+//
+//	c := log.NewCollector(log.Global, log.WireJSON)
+//	go c.ListenAndServe("udp", ":12124")
+//	err := c.ListenAndServe("tcp", ":12124")
+//
+// The records keep their time, source and fields.  Over TCP, a connection
+// which sends something else than records is closed; over UDP, each datagram
+// holds records of its own.  The decoding errors are reported to the error
+// handler, see SetErrorHandler.
+type Collector struct {
+	received, invalid uint64 // First, for the atomic accesses on 32 bits
+
+	log    Logger
+	format WireFormat
+
+	mu      sync.Mutex
+	closers map[io.Closer]bool // The listeners and the connections
+	closed  bool
+	conns   sync.WaitGroup
+}
+
+// NewCollector creates a Collector of the records in format, which it logs
+// through log.
+func NewCollector(log Logger, format WireFormat) *Collector {
+	return &Collector{
+		log:     log,
+		format:  format,
+		closers: make(map[io.Closer]bool),
+	}
+}
+
+// ListenAndServe listens on the address of the network proto, tcp or udp (or
+// their variants, e.g. tcp4 or unix), and receives the records sent there
+// until the collector is closed, when it returns nil.
+func (c *Collector) ListenAndServe(proto, addr string) error {
+	if strings.HasPrefix(proto, "udp") || proto == "unixgram" {
+		pc, err := net.ListenPacket(proto, addr)
+		if err != nil {
+			return err
+		}
+		return c.ServePacket(pc)
+	}
+	ln, err := net.Listen(proto, addr)
+	if err != nil {
+		return err
+	}
+	return c.Serve(ln)
+}
+
+// Serve receives the records of the connections ln accepts until the
+// collector is closed, when it returns nil.  ln is closed.
+func (c *Collector) Serve(ln net.Listener) error {
+	if !c.track(ln) {
+		return nil
+	}
+	defer c.untrack(ln)
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if c.isClosed() {
+				return nil
+			}
+			return err
+		}
+		if !c.track(conn) {
+			return nil
+		}
+		c.conns.Add(1)
+		go func() {
+			defer c.conns.Done()
+			defer c.untrack(conn)
+			c.serveConn(conn)
+		}()
+	}
+}
+
+// Receive the records of a connection until it ends or sends garbage
+func (c *Collector) serveConn(conn net.Conn) {
+	dec := NewWireDecoder(conn, c.format)
+	for {
+		rec, err := dec.Decode()
+		if err != nil {
+			if err != io.EOF && !c.isClosed() {
+				atomic.AddUint64(&c.invalid, 1)
+				ReportError(fmt.Sprintf("Collector(%s)", conn.RemoteAddr()), err)
+			}
+			return
+		}
+		atomic.AddUint64(&c.received, 1)
+		c.log.Forward(rec)
+	}
+}
+
+// ServePacket receives the records of the datagrams read from pc until the
+// collector is closed, when it returns nil.  pc is closed.
+func (c *Collector) ServePacket(pc net.PacketConn) error {
+	if !c.track(pc) {
+		return nil
+	}
+	defer c.untrack(pc)
+	buf := make([]byte, 64<<10)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			if c.isClosed() {
+				return nil
+			}
+			return err
+		}
+		dec := NewWireDecoder(bytes.NewReader(buf[:n]), c.format)
+		for {
+			rec, err := dec.Decode()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				atomic.AddUint64(&c.invalid, 1)
+				ReportError(fmt.Sprintf("Collector(%s)", addr), err)
+				break
+			}
+			atomic.AddUint64(&c.received, 1)
+			c.log.Forward(rec)
+		}
+	}
+}
+
+// Received returns how many records the collector logged, and how many
+// connections or datagrams it gave up on because they held something else.
+func (c *Collector) Received() (records, invalid uint64) {
+	return atomic.LoadUint64(&c.received), atomic.LoadUint64(&c.invalid)
+}
+
+// Close stops the collector: the listeners and the connections are closed, and
+// the records being received logged.  It doesn't close the logger.
+func (c *Collector) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	for closer := range c.closers {
+		closer.Close()
+	}
+	c.mu.Unlock()
+	c.conns.Wait()
+	return nil
+}
+
+// Keep closer to close it with the collector, or close it right away if the
+// collector is closed already
+func (c *Collector) track(closer io.Closer) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		closer.Close()
+		return false
+	}
+	c.closers[closer] = true
+	return true
+}
+
+func (c *Collector) untrack(closer io.Closer) {
+	closer.Close()
+	c.mu.Lock()
+	delete(c.closers, closer)
+	c.mu.Unlock()
+}
+
+func (c *Collector) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
@@ -4,123 +4,829 @@ package log4go
 
 import (
 	"encoding/xml"
+	"errors"
 	"fmt"
+	"github.com/kimiazhu/log4go/stack"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
-type xmlProperty struct {
+// Where the configuration errors are reported, and the lock which lets
+// ValidateConfiguration collect them
+var (
+	configMu  sync.Mutex
+	configOut io.Writer = os.Stderr
+)
+
+// A Property is a <property name="...">value</property> of a filter
+// configuration.
+type Property struct {
 	Name  string `xml:"name,attr"`
 	Value string `xml:",chardata"`
 }
 
-type xmlFilter struct {
-	Enabled  string        `xml:"enabled,attr"`
-	Tag      string        `xml:"tag"`
-	Level    string        `xml:"level"`
-	Type     string        `xml:"type"`
-	Property []xmlProperty `xml:"property"`
-	Exclude  []string      `xml:"exclude"`
+// A FilterConfig is the configuration of a filter, a <filter> of the XML
+// configuration.  The values are checked when the configuration is applied.
+type FilterConfig struct {
+	Enabled  string     `xml:"enabled,attr"`
+	Async    string     `xml:"async,attr"`
+	Audit    string     `xml:"audit,attr"`
+	Tag      string     `xml:"tag"`
+	Level    string     `xml:"level"`
+	Type     string     `xml:"type"`
+	Property []Property `xml:"property"`
+	Exclude  []string   `xml:"exclude"`
+	Access   string     `xml:"access"`
+}
+
+// A LoggerConfig is a configuration of the logger, the <logging> element of
+// the XML configuration.  The parsers of the other configuration formats
+// produce one, see RegisterConfigFormat.
+type LoggerConfig struct {
+	Locale   string         `xml:"locale,attr"`
+	PathBase string         `xml:"path_base,attr"`
+	Filter   []FilterConfig `xml:"filter"`
+	Route    []RouteConfig  `xml:"route"`
+
+	// What to do with filters sharing a tag: "error", "tee" (the writer of
+	// the second one is added to the first, whose level and options apply)
+	// or "last" (the last one wins, the default)
+	Duplicates string `xml:"duplicates,attr"`
+
+	// The directory of the configuration file, against which the relative
+	// paths are resolved with the config-dir path base.  LoadConfiguration
+	// sets it.
+	Dir string `xml:"-"`
+}
+
+// The parsers of the configuration formats other than XML, by file extension
+var configFormats = make(map[string]func(config []byte) (*LoggerConfig, error))
+
+// RegisterConfigFormat makes LoadConfiguration parse the files with the
+// extension ext (e.g. ".yaml") with parse rather than as XML.  Extensions are
+// case insensitive.  JSON is builtin (".json", see ParseJSONConfig), YAML is
+// registered by importing github.com/kimiazhu/log4go/yamlconf.
+func RegisterConfigFormat(ext string, parse func(config []byte) (*LoggerConfig, error)) {
+	configFormats[strings.ToLower(ext)] = parse
+}
+
+// A writerFactory creates the LogWriter of a filter from its properties, or
+// only checks the properties if the filter is not enabled.  It reports errors
+// to stderr and returns false if the filter can't be created.
+type writerFactory func(excludes []string, props []Property, enabled bool) (LogWriter, bool)
+
+// The filter types known to the configuration.  Writers which are optional in
+// the build register their type from an init function of their own file, so
+// that excluding the file also removes them from the configuration.
+var writerFactories = map[string]writerFactory{
+	"console": func(excludes []string, props []Property, enabled bool) (LogWriter, bool) {
+		return xmlToConsoleLogWriter(excludes, props, enabled)
+	},
+	"file": func(excludes []string, props []Property, enabled bool) (LogWriter, bool) {
+		return xmlToFileLogWriter(excludes, props, enabled)
+	},
+	"xml": func(excludes []string, props []Property, enabled bool) (LogWriter, bool) {
+		return xmlToXMLLogWriter(excludes, props, enabled)
+	},
+	"socket": func(excludes []string, props []Property, enabled bool) (LogWriter, bool) {
+		return xmlToSocketLogWriter(excludes, props, enabled)
+	},
+	"memory": func(excludes []string, props []Property, enabled bool) (LogWriter, bool) {
+		return xmlToMemoryLogWriter(excludes, props, enabled)
+	},
+	"split": func(excludes []string, props []Property, enabled bool) (LogWriter, bool) {
+		return xmlToSplitLogWriter(excludes, props, enabled)
+	},
+	"audit": func(excludes []string, props []Property, enabled bool) (LogWriter, bool) {
+		return xmlToAuditLogWriter(excludes, props, enabled)
+	},
+}
+
+// RegisterWriterType makes <type>name</type> available in the configuration,
+// for a LogWriter created by factory from the properties of the filter.  The
+// factory isn't called for a disabled filter.  A third-party writer usually
+// registers its type from an init function:
+//
+//	func init() {
+//	    log4go.RegisterWriterType("mywriter", func(props []log4go.Property) (log4go.LogWriter, error) {
+//	        ...
+//	    })
+//	}
+//
+// Registering a name again replaces the type, builtin ones included.
+func RegisterWriterType(name string, factory func(props []Property) (LogWriter, error)) {
+	writerFactories[name] = func(excludes []string, props []Property, enabled bool) (LogWriter, bool) {
+		// If it's disabled, we can't check anything
+		if !enabled {
+			return nil, true
+		}
+
+		writer, err := factory(props)
+		if err != nil {
+			fmt.Fprintf(configOut, "LoadConfiguration: Error: Could not create %s filter: %s\n", name, err)
+			return nil, false
+		}
+		return writer, true
+	}
 }
 
-type xmlLoggerConfig struct {
-	Filter []xmlFilter `xml:"filter"`
+// Create a writer of type typ which is part of a filter of type filter, e.g.
+// a writer of a tee, from the properties given to it.  prop is the property
+// which named the type.  The writers made of other writers can't be nested,
+// their properties would be ambiguous.
+func xmlToChildWriter(filter, prop, typ string, excludes []string, props []Property, enabled bool) (LogWriter, bool) {
+	factory, ok := writerFactories[typ]
+	if !ok || typ == "tee" || typ == "failover" {
+		fmt.Fprintf(configOut, "LoadConfiguration: Error: Invalid property \"%s\" for %s filter: unknown writer type %q\n", prop, filter, typ)
+		return nil, false
+	}
+	return factory(excludes, props, enabled)
 }
 
 func (log Logger) Config(config []byte) {
-	xc := new(xmlLoggerConfig)
+	xc := new(LoggerConfig)
 	if err := xml.Unmarshal(config, xc); err != nil {
-		fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Could not parse XML configuration: %s\n", err)
+		fmt.Fprintf(configOut, "LoadConfiguration: Error: Could not parse XML configuration: %s\n", err)
 		os.Exit(1)
 	}
+	log.ApplyConfig(xc)
+}
 
+// ApplyConfig adds the filters of a parsed configuration to the logger, like
+// Config does with an XML one, replacing the filters with the same tags.  The
+// errors are fatal, as in Config.
+func (log Logger) ApplyConfig(xc *LoggerConfig) {
+	if err := log.swapConfig(xc, swapAdd); err != nil {
+		os.Exit(1)
+	}
+}
+
+// ReplaceConfig replaces all the filters of the logger with those of a parsed
+// configuration.  The new filters are created first: if one can't be, the
+// logger keeps its filters and an error is returned (the details go to
+// stderr), a *DuplicateTagError for filters sharing a tag with
+// duplicates="error".  The old filters are closed once the new ones are in
+// place.
+func (log Logger) ReplaceConfig(xc *LoggerConfig) error {
+	return log.swapConfig(xc, swapReplace)
+}
+
+// ApplyConfigDelta replaces the filters of the logger created from a
+// configuration with those of the XML configuration config, changing only
+// what changed: the filters whose configuration is the same are kept as
+// they are, with their files open and their records queued, the others are
+// created, and the filters not in config are closed.  The filters added in
+// code are kept.  On an error, the logger keeps its filters and the error is
+// returned, as with ReplaceConfig.
+func (log Logger) ApplyConfigDelta(config []byte) error {
+	xc := new(LoggerConfig)
+	if err := xml.Unmarshal(config, xc); err != nil {
+		fmt.Fprintf(configOut, "LoadConfiguration: Error: Could not parse XML configuration: %s\n", err)
+		return err
+	}
+	return log.swapConfig(xc, swapDelta)
+}
+
+// How swapConfig changes the filters of a logger
+type swapMode int
+
+const (
+	swapAdd     swapMode = iota // replace the filters with the same tags
+	swapReplace                 // replace all the filters
+	swapDelta                   // keep the unchanged ones, see ApplyConfigDelta
+)
+
+// DuplicateTagError is the error of a configuration with duplicates="error"
+// whose enabled filters share a tag.
+type DuplicateTagError struct {
+	Tag string
+}
+
+func (e *DuplicateTagError) Error() string {
+	return fmt.Sprintf("duplicate filter tag %q", e.Tag)
+}
+
+// Create all the filters of a configuration, then put them in the logger and
+// close the filters they replace, as mode says.  If a filter can't be
+// created, the ones already created are closed, the logger is left alone and
+// an error is returned.
+func (log Logger) swapConfig(xc *LoggerConfig, mode swapMode) error {
+	configMu.Lock()
+	defer configMu.Unlock()
+
+	duplicates, ok := convertDuplicates(xc.Duplicates)
+	if !ok {
+		return errors.New("invalid configuration")
+	}
+	tags := make(map[string]bool, len(xc.Filter))
+	enabled := make(map[string]bool, len(xc.Filter))
+	duplicated := make(map[string]bool)
 	for _, xmlfilt := range xc.Filter {
-		var filt LogWriter
-		var lvl Level
-		bad, good, enabled := false, true, false
-
-		// Check required children
-		if len(xmlfilt.Enabled) == 0 {
-			fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Required attribute %s for filter\n", "enabled")
-			bad = true
-		} else {
-			enabled = xmlfilt.Enabled != "false"
+		tags[xmlfilt.Tag] = true
+		if xmlfilt.Enabled == "false" {
+			continue
+		}
+		if enabled[xmlfilt.Tag] && duplicates == "error" {
+			fmt.Fprintf(configOut, "LoadConfiguration: Error: Duplicate tag \"%s\"\n", xmlfilt.Tag)
+			return &DuplicateTagError{xmlfilt.Tag}
+		}
+		duplicated[xmlfilt.Tag] = enabled[xmlfilt.Tag]
+		enabled[xmlfilt.Tag] = true
+	}
+	routes, ok := configRoutes(xc, tags)
+	if !ok {
+		return errors.New("invalid configuration")
+	}
+
+	// The filters kept by a delta, unchanged
+	kept := make(map[string]*Filter)
+	if mode == swapDelta {
+		current := log.filters()
+		for _, xmlfilt := range xc.Filter {
+			filt := current[xmlfilt.Tag]
+			if xmlfilt.Enabled != "false" && !duplicated[xmlfilt.Tag] && filt != nil && filt.sameConfig(xmlfilt, xc, routes) {
+				kept[xmlfilt.Tag] = filt
+			}
+		}
+	}
+
+	filters := make(map[string]*Filter, len(xc.Filter))
+	for _, xmlfilt := range xc.Filter {
+		if kept[xmlfilt.Tag] != nil {
+			continue
 		}
-		if len(xmlfilt.Tag) == 0 {
-			fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Required child <%s> for filter\n", "tag")
-			bad = true
+		filt, ok := configFilter(xmlfilt, xmlfilt.Enabled != "false", xc)
+		if !ok {
+			for _, filt := range filters {
+				filt.Close()
+			}
+			return errors.New("invalid configuration")
 		}
-		if len(xmlfilt.Type) == 0 {
-			fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Required child <%s> for filter\n", "type")
-			bad = true
+
+		// If we're disabled (syntax and correctness checks only), don't add to logger
+		if filt == nil {
+			continue
 		}
-		if len(xmlfilt.Level) == 0 {
-			fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Required child <%s> for filter\n", "level")
-			bad = true
+		if first, dup := filters[xmlfilt.Tag]; dup && duplicates == "tee" {
+			if !mergeFilters(xmlfilt.Tag, first, filt) {
+				filt.Close()
+				for _, filt := range filters {
+					filt.Close()
+				}
+				return errors.New("invalid configuration")
+			}
+			continue
+		} else if dup {
+			fmt.Fprintf(configOut, "LoadConfiguration: Warning: Duplicate tag \"%s\", the last filter replaces the others (see the duplicates attribute)\n", xmlfilt.Tag)
+			first.Close()
 		}
+		filters[xmlfilt.Tag] = filt
+	}
+	applyRoutes(filters, routes, xc)
+	for tag, filt := range kept {
+		filters[tag] = filt
+	}
 
-		lvl, bad = convertLevel(xmlfilt.Level)
+	if xc.Locale != "" && log.isolated() {
+		fmt.Fprintf(configOut, "LoadConfiguration: Warning: Locale %s ignored, a logger created by NewLoggerFromConfig has the global one\n", xc.Locale)
+	} else if xc.Locale != "" {
+		SetLocale(xc.Locale)
+	}
 
-		// Just so all of the required attributes are errored at the same time if missing
-		if bad {
-			os.Exit(1)
+	// The old writers are closed once the new ones are in place, so that no
+	// record goes to a closed writer
+	old := log.change(func(current map[string]*Filter) []*Filter {
+		var old []*Filter
+		for tag, filt := range current {
+			newfilt, ok := filters[tag]
+			if newfilt == filt {
+				// Kept by a delta
+				continue
+			}
+			if ok || mode == swapReplace || (mode == swapDelta && filt.config != nil) {
+				old = append(old, filt)
+				if !ok {
+					delete(current, tag)
+				}
+			}
 		}
+		for tag, filt := range filters {
+			current[tag] = filt
+		}
+		return old
+	})
+	for _, filt := range old {
+		filt.Close()
+	}
+	return nil
+}
+
+// Create the filter of a configuration, or only check it if it's not enabled
+// (then the filter is nil).  The errors are reported to configOut, and false is
+// returned if there is one.
+func configFilter(xmlfilt FilterConfig, enabled bool, xc *LoggerConfig) (*Filter, bool) {
+	bad := false
+
+	// Check required children
+	if len(xmlfilt.Enabled) == 0 {
+		fmt.Fprintf(configOut, "LoadConfiguration: Error: Required attribute %s for filter\n", "enabled")
+		bad = true
+	}
+	if len(xmlfilt.Tag) == 0 {
+		fmt.Fprintf(configOut, "LoadConfiguration: Error: Required child <%s> for filter\n", "tag")
+		bad = true
+	}
+	if len(xmlfilt.Type) == 0 {
+		fmt.Fprintf(configOut, "LoadConfiguration: Error: Required child <%s> for filter\n", "type")
+		bad = true
+	}
+	if len(xmlfilt.Level) == 0 {
+		fmt.Fprintf(configOut, "LoadConfiguration: Error: Required child <%s> for filter\n", "level")
+		bad = true
+	}
+
+	lvl, badlvl := convertLevel(xmlfilt.Level)
+	if badlvl {
+		bad = true
+	}
+
+	access, ok := convertAccess(xmlfilt.Access)
+	if !ok {
+		bad = true
+	}
+
+	var audit bool
+	switch value := strings.Trim(xmlfilt.Audit, " \r\n"); value {
+	case "", "false":
+	case "true":
+		audit = true
+	default:
+		fmt.Fprintf(configOut, "LoadConfiguration: Error: Invalid attribute %s for filter: %s, expect true or false\n", "audit", value)
+		bad = true
+	}
+
+	base, ok := filterPathBase(xmlfilt, xc)
+	if !ok {
+		bad = true
+	}
+
+	// Just so all of the required attributes are errored at the same time if missing
+	if bad {
+		return nil, false
+	}
 
-		switch xmlfilt.Type {
-		case "console":
-			filt, good = xmlToConsoleLogWriter(xmlfilt.Exclude, xmlfilt.Property, enabled)
-		case "file":
-			filt, good = xmlToFileLogWriter(xmlfilt.Exclude, xmlfilt.Property, enabled)
-		case "xml":
-			filt, good = xmlToXMLLogWriter(xmlfilt.Exclude, xmlfilt.Property, enabled)
-		case "socket":
-			filt, good = xmlToSocketLogWriter(xmlfilt.Exclude, xmlfilt.Property, enabled)
+	// The properties of the filter itself, the others go to the writer, and
+	// all of them as they are used, which the filter remembers
+	var stacklvl Level
+	var stackformat stack.Format
+	var stackdepth int
+	var samplerate, samplemode, sampleseed string
+	samplelvl := WARNING
+	var redact string
+	var redactpatterns, redactfields []string
+	var predicatenames []string
+	var asyncqueue, asyncoverflow string
+	props := make([]Property, 0, len(xmlfilt.Property))
+	resolved, ok := resolveProperties(xmlfilt.Property, base, xc.Dir)
+	if !ok {
+		return nil, false
+	}
+	for _, prop := range resolved {
+		switch prop.Name {
+		case "path_base":
+			// See filterPathBase
+		case "stacktrace_level":
+			value := strings.Trim(prop.Value, " \r\n")
+			if stacklvl, ok = levelByName(value); !ok {
+				fmt.Fprintf(configOut, "LoadConfiguration: Error: Invalid property \"%s\" for filter: unknown level %s\n", "stacktrace_level", value)
+				return nil, false
+			}
+		case "stacktrace_format":
+			value := strings.Trim(prop.Value, " \r\n")
+			if stackformat, ok = stack.ParseFormat(value); !ok {
+				fmt.Fprintf(configOut, "LoadConfiguration: Error: Invalid property \"%s\" for filter: %s, expect full or condensed\n", "stacktrace_format", value)
+				return nil, false
+			}
+		case "stacktrace_depth":
+			value := strings.Trim(prop.Value, " \r\n")
+			var err error
+			if stackdepth, err = strconv.Atoi(value); err != nil || stackdepth < 0 {
+				fmt.Fprintf(configOut, "LoadConfiguration: Error: Invalid property \"%s\" for filter: %s, expect a number of frames\n", "stacktrace_depth", value)
+				return nil, false
+			}
+		case "sample_rate":
+			samplerate = strings.Trim(prop.Value, " \r\n")
+		case "sample_mode":
+			samplemode = strings.Trim(prop.Value, " \r\n")
+		case "sample_seed":
+			sampleseed = strings.Trim(prop.Value, " \r\n")
+		case "sample_level":
+			value := strings.Trim(prop.Value, " \r\n")
+			if samplelvl, ok = levelByName(value); !ok {
+				fmt.Fprintf(configOut, "LoadConfiguration: Error: Invalid property \"%s\" for filter: unknown level %s\n", "sample_level", value)
+				return nil, false
+			}
+		case "redact":
+			redact = strings.Trim(prop.Value, " \r\n")
+		case "redact_pattern":
+			redactpatterns = append(redactpatterns, strings.Trim(prop.Value, " \r\n"))
+		case "redact_field":
+			redactfields = append(redactfields, strings.Trim(prop.Value, " \r\n"))
+		case "predicate":
+			predicatenames = append(predicatenames, strings.Trim(prop.Value, " \r\n"))
+		case "async_queue":
+			asyncqueue = strings.Trim(prop.Value, " \r\n")
+		case "async_overflow":
+			asyncoverflow = strings.Trim(prop.Value, " \r\n")
 		default:
-			fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Could not load XML configuration: unknown filter type \"%s\"\n", xmlfilt.Type)
-			os.Exit(1)
+			props = append(props, prop)
 		}
+	}
+
+	redactor, ok := xmlToRedactor(redact, redactpatterns, redactfields)
+	if !ok {
+		return nil, false
+	}
+
+	predicate, ok := xmlToPredicate(predicatenames)
+	if !ok {
+		return nil, false
+	}
 
-		// Just so all of the required params are errored at the same time if wrong
-		if !good {
-			os.Exit(1)
+	var sampler Sampler
+	if samplerate != "" {
+		if sampler, ok = xmlToSampler(samplerate, samplemode, sampleseed, samplelvl); !ok {
+			return nil, false
 		}
+	}
 
-		// If we're disabled (syntax and correctness checks only), don't add to logger
-		if !enabled {
+	async := strings.Trim(xmlfilt.Async, " \r\n") == "true"
+	queue, policy, ok := xmlToAsync(asyncqueue, asyncoverflow)
+	if !ok {
+		return nil, false
+	}
+	if !async && (asyncqueue != "" || asyncoverflow != "") {
+		fmt.Fprintf(configOut, "LoadConfiguration: Warning: Properties \"%s\" and \"%s\" ignored without async=\"true\"\n", "async_queue", "async_overflow")
+	}
+
+	factory, ok := writerFactories[xmlfilt.Type]
+	if !ok {
+		fmt.Fprintf(configOut, "LoadConfiguration: Error: Could not load XML configuration: unknown filter type \"%s\"\n", xmlfilt.Type)
+		return nil, false
+	}
+	writer, good := factory(xmlfilt.Exclude, props, enabled)
+	if !good || !enabled {
+		return nil, good
+	}
+	if async {
+		writer = NewAsyncWriter(writer, queue, policy)
+	}
+
+	xmlfilt.Property = resolved
+	filt := &Filter{
+		Level:       lvl,
+		LogWriter:   writer,
+		Excludes:    xmlfilt.Exclude,
+		Access:      access,
+		StackLevel:  stacklvl,
+		StackFormat: stackformat,
+		StackDepth:  stackdepth,
+		Sampler:     sampler,
+		Redactor:    redactor,
+		Audit:       audit,
+		config:      &xmlfilt,
+	}
+	if predicate != nil {
+		filt.SetPredicate(predicate)
+	}
+	return filt, true
+}
+
+// The properties of a filter as they are used: the environment variables
+// expanded, and the file names resolved against the path base
+func resolveProperties(props []Property, base, dir string) ([]Property, bool) {
+	resolved := make([]Property, 0, len(props))
+	for _, prop := range props {
+		var ok bool
+		if prop.Value, ok = expandEnv(prop.Value); !ok {
+			fmt.Fprintf(configOut, "LoadConfiguration: Error: Invalid property \"%s\" for filter: unterminated ${\n", prop.Name)
+			return nil, false
+		}
+		if pathProperties[prop.Name] {
+			var err error
+			if prop.Value, err = resolvePath(prop.Value, base, dir); err != nil {
+				fmt.Fprintf(configOut, "LoadConfiguration: Error: Invalid property \"%s\" for filter: %s\n", prop.Name, err)
+				return nil, false
+			}
+		}
+		resolved = append(resolved, prop)
+	}
+	return resolved, true
+}
+
+// Report whether the filter was created from the configuration xmlfilt of xc,
+// with the same routes, so that a delta keeps it.  A filter merged with
+// others or added in code is created again.
+func (f *Filter) sameConfig(xmlfilt FilterConfig, xc *LoggerConfig, routes []*route) bool {
+	if f.config == nil || len(f.merged) > 0 {
+		return false
+	}
+	if (routePredicate(xmlfilt.Tag, routes) != nil || len(f.routes) > 0) && !reflect.DeepEqual(f.routes, xc.Route) {
+		return false
+	}
+	// The errors are reported when the filter is created again
+	saved := configOut
+	configOut = ioutil.Discard
+	defer func() { configOut = saved }()
+	base, ok := filterPathBase(xmlfilt, xc)
+	if !ok {
+		return false
+	}
+	if xmlfilt.Property, ok = resolveProperties(xmlfilt.Property, base, xc.Dir); !ok {
+		return false
+	}
+	return reflect.DeepEqual(xmlfilt, *f.config)
+}
+
+// The properties which are file names, resolved according to the path base
+var pathProperties = map[string]bool{"filename": true, "crashfile": true, "pattern": true}
+
+// The path base of a filter: its path_base property, or the one of the
+// configuration
+func filterPathBase(xmlfilt FilterConfig, xc *LoggerConfig) (string, bool) {
+	base := xc.PathBase
+	for _, prop := range xmlfilt.Property {
+		if prop.Name == "path_base" {
+			base = prop.Value
+		}
+	}
+	switch base = strings.Trim(base, " \r\n"); base {
+	case "", "exe-dir", "cwd", "config-dir", "absolute":
+		return base, true
+	}
+	fmt.Fprintf(configOut, "LoadConfiguration: Error: Unknown path_base \"%s\", expect exe-dir, cwd, config-dir or absolute\n", base)
+	return "", false
+}
+
+// Resolve a relative file name against the path base: the directory of the
+// program (the default, done by xmlToPath), the working directory, the
+// directory of the configuration file dir, or none (absolute: relative names
+// are refused).  The absolute file names are kept as they are.
+func resolvePath(value, base, dir string) (string, error) {
+	path := strings.Trim(value, " \r\n")
+	if filepath.IsAbs(path) {
+		return path, nil
+	}
+	switch base {
+	case "cwd":
+		return filepath.Abs(path)
+	case "config-dir":
+		if dir == "" {
+			return "", fmt.Errorf("relative path %s with path_base config-dir, but no configuration file", path)
+		}
+		return filepath.Join(dir, path), nil
+	case "absolute":
+		return "", fmt.Errorf("relative path %s with path_base absolute", path)
+	}
+	return path, nil
+}
+
+// ValidateConfiguration checks the configuration in filename as
+// LoadConfiguration would load it, without creating any writer nor exiting,
+// e.g. in a deployment preflight check.  It returns the errors and the
+// warnings (unknown properties, bad levels, unwritable files, ...), none if the
+// configuration is fine.  The properties of the types registered with
+// RegisterWriterType aren't checked.
+func ValidateConfiguration(filename string) []error {
+	lc, err := readConfig(filename)
+	if err != nil {
+		return []error{err}
+	}
+	return validateConfig(lc)
+}
+
+// Read and parse the configuration file filename, as XML unless its extension
+// was registered with RegisterConfigFormat
+func readConfig(filename string) (*LoggerConfig, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	lc := new(LoggerConfig)
+	if parse, ok := configFormats[strings.ToLower(filepath.Ext(filename))]; ok {
+		lc, err = parse(contents)
+	} else {
+		err = xml.Unmarshal(contents, lc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %q: %s", filename, err)
+	}
+	lc.Dir = ConfigDir(filename)
+	return lc, nil
+}
+
+// Check all the filters of a configuration, the enabled ones included
+func validateConfig(lc *LoggerConfig) []error {
+	configMu.Lock()
+	defer configMu.Unlock()
+	var errs configErrors
+	configOut = &errs
+	defer func() { configOut = os.Stderr }()
+
+	duplicates, _ := convertDuplicates(lc.Duplicates)
+	tags := make(map[string]bool)
+	firsts := make(map[string]FilterConfig)
+	for _, fc := range lc.Filter {
+		n := len(errs)
+		// Without the duplicates attribute, a duplicate tag is likely a
+		// mistake
+		switch {
+		case !tags[fc.Tag] || duplicates == "tee":
+		case duplicates == "last" && lc.Duplicates != "":
+			fmt.Fprintf(configOut, "LoadConfiguration: Warning: Duplicate tag, the last filter replaces the others\n")
+		default:
+			fmt.Fprintf(configOut, "LoadConfiguration: Error: Duplicate tag\n")
+		}
+		tags[fc.Tag] = true
+		if first, ok := firsts[fc.Tag]; !ok && fc.Enabled != "false" {
+			firsts[fc.Tag] = fc
+		} else if ok && fc.Enabled != "false" && duplicates == "tee" && !reflect.DeepEqual(filterSettings(&first), filterSettings(&fc)) {
+			fmt.Fprintf(configOut, "LoadConfiguration: Error: Duplicate tag can't be merged: its excludes, access, audit, stacktrace, sample, redact or predicate settings differ from those of the first filter\n")
+		}
+
+		if _, ok := configFilter(fc, false, lc); ok {
+			base, _ := filterPathBase(fc, lc)
+			for _, prop := range fc.Property {
+				if !pathProperties[prop.Name] {
+					continue
+				}
+				value, _ := expandEnv(prop.Value)
+				value, _ = resolvePath(value, base, lc.Dir)
+				if prop.Name == "pattern" {
+					value = strings.Replace(value, "%s", "default", -1)
+				}
+				if err := checkWritable(xmlToPath(value)); err != nil {
+					fmt.Fprintf(configOut, "LoadConfiguration: Error: Invalid property \"%s\" for %s filter: %s\n", prop.Name, fc.Type, err)
+				}
+			}
+		}
+
+		for i := n; i < len(errs); i++ {
+			errs[i] = fmt.Errorf("filter %q: %s", fc.Tag, errs[i])
+		}
+	}
+	configRoutes(lc, tags)
+	return errs
+}
+
+// The errors reported to configOut, one per line
+type configErrors []error
+
+func (errs *configErrors) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		*errs = append(*errs, errors.New(strings.TrimPrefix(line, "LoadConfiguration: ")))
+	}
+	return len(p), nil
+}
+
+// Check that the file can be written or created, without creating it
+func checkWritable(path string) error {
+	if fi, err := os.Stat(path); err == nil {
+		if fi.IsDir() {
+			return fmt.Errorf("%s is a directory", path)
+		}
+		fd, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			return err
+		}
+		return fd.Close()
+	}
+
+	// The directory is created if needed: check the closest one which exists
+	dir := filepath.Dir(path)
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	fd, err := ioutil.TempFile(dir, ".log4go-check")
+	if err != nil {
+		return fmt.Errorf("can't create %s: %s", path, err)
+	}
+	fd.Close()
+	return os.Remove(fd.Name())
+}
+
+// Expand the ${VAR} and ${VAR:-default} references to environment variables
+// in the value of a property; $${ stands for a literal ${.  An unset variable
+// without a default is empty, with a warning.  Returns false if a reference
+// isn't terminated.
+func expandEnv(value string) (string, bool) {
+	if !strings.Contains(value, "${") {
+		return value, true
+	}
+
+	var out strings.Builder
+	for {
+		i := strings.Index(value, "${")
+		if i < 0 {
+			out.WriteString(value)
+			return out.String(), true
+		}
+		if i > 0 && value[i-1] == '$' {
+			out.WriteString(value[:i-1] + "${")
+			value = value[i+2:]
 			continue
 		}
+		out.WriteString(value[:i])
+		end := strings.IndexByte(value[i:], '}')
+		if end < 0 {
+			return "", false
+		}
+		ref := value[i+2 : i+end]
+		value = value[i+end+1:]
 
-		log[xmlfilt.Tag] = &Filter{lvl, filt, xmlfilt.Exclude}
+		name, def, hasDef := ref, "", false
+		if j := strings.Index(ref, ":-"); j >= 0 {
+			name, def, hasDef = ref[:j], ref[j+2:], true
+		}
+		if v := os.Getenv(name); v != "" {
+			out.WriteString(v)
+		} else if hasDef {
+			out.WriteString(def)
+		} else {
+			fmt.Fprintf(configOut, "LoadConfiguration: Warning: Environment variable %s is not set\n", name)
+		}
 	}
 }
 
-// Load XML configuration; see examples/example.xml for documentation
+// Load XML configuration; see examples/example.xml for documentation.  The
+// files with an extension registered with RegisterConfigFormat are parsed
+// accordingly.  The filters of the configuration replace all those of the
+// logger, which are only closed once the new ones are created.  The errors
+// are fatal; see ReloadConfiguration for a reload which keeps the previous
+// filters on an error.
 func (log Logger) LoadConfiguration(filename string) {
 	fmt.Fprintf(os.Stdout, "Load log4go configuration: %s\n", filename)
-	log.Close()
-
-	// Open the configuration file
-	fd, err := os.Open(filename)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Could not open %q for reading: %s\n", filename, err)
+	if err := log.ReloadConfiguration(filename); err != nil {
 		os.Exit(1)
 	}
+}
 
-	contents, err := ioutil.ReadAll(fd)
+// ReloadConfiguration loads the configuration in filename as
+// LoadConfiguration does, e.g. on SIGHUP, except that the errors aren't
+// fatal: the logger keeps its filters and the error is returned, wrapping the
+// error of ReplaceConfig.  The errors are also reported to stderr.
+func (log Logger) ReloadConfiguration(filename string) error {
+	xc, err := readConfig(filename)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Could not read %q: %s\n", filename, err)
-		os.Exit(1)
+		fmt.Fprintf(configOut, "LoadConfiguration: Error: %s\n", err)
+		return err
 	}
+	if err := log.ReplaceConfig(xc); err != nil {
+		return fmt.Errorf("%q: %w", filename, err)
+	}
+	return nil
+}
 
-	log.Config(contents)
-	fd.Close()
+// ConfigDir returns the directory of the configuration file filename, the
+// Dir of its LoggerConfig.
+func ConfigDir(filename string) string {
+	if abs, err := filepath.Abs(filename); err == nil {
+		filename = abs
+	}
+	return filepath.Dir(filename)
 }
 
 func convertLevel(level string) (lvl Level, bad bool) {
+	lvl, ok := levelByName(level)
+	if !ok {
+		fmt.Fprintf(configOut, "LoadConfiguration: Error: Required child <%s> for filter has unknown value: %s\n", "level", level)
+		bad = true
+	}
+	return
+}
+
+func levelByName(level string) (lvl Level, ok bool) {
+	lvl, err := ParseLevel(level)
+	return lvl, err == nil
+}
+
+func builtinLevelByName(level string) (lvl Level, ok bool) {
 	switch level {
 	case "ACCESS":
 		lvl = ACCESS
@@ -140,19 +846,128 @@ func convertLevel(level string) (lvl Level, bad bool) {
 		lvl = ERROR
 	case "CRITICAL":
 		lvl = CRITICAL
+	case "FATAL":
+		lvl = FATAL
 	default:
-		fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Required child <%s> for filter has unknown value: %s\n", "level", level)
-		bad = true
+		return lvl, false
 	}
-	return
+	return lvl, true
+}
+
+// The name of a level in the configuration, the reverse of levelByName
+func levelName(lvl Level) string {
+	names := [...]string{"ACCESS", "FINEST", "FINE", "DEBUG", "TRACE", "INFO", "WARNING", "ERROR", "CRITICAL", "FATAL"}
+	if lvl < 0 || int(lvl) >= len(names) {
+		if name := customLevelName(lvl); name != "" {
+			return name
+		}
+		return lvl.String()
+	}
+	return names[lvl]
+}
+
+func convertAccess(access string) (AccessMode, bool) {
+	switch strings.Trim(access, " \r\n") {
+	case "", "include":
+		return AccessInclude, true
+	case "only":
+		return AccessOnly, true
+	case "exclude":
+		return AccessExclude, true
+	}
+	fmt.Fprintf(configOut, "LoadConfiguration: Error: Child <%s> for filter has unknown value: %s, expect include, only or exclude\n", "access", access)
+	return AccessInclude, false
+}
+
+func convertDuplicates(duplicates string) (string, bool) {
+	switch duplicates = strings.Trim(duplicates, " \r\n"); duplicates {
+	case "", "last":
+		return "last", true
+	case "error", "tee":
+		return duplicates, true
+	}
+	fmt.Fprintf(configOut, "LoadConfiguration: Error: Attribute %s for logging has unknown value: %s, expect error, tee or last\n", "duplicates", duplicates)
+	return "", false
 }
 
-func xmlToConsoleLogWriter(excludes []string, props []xmlProperty, enabled bool) (*ConsoleLogWriter, bool) {
+// Merge the filter dup into the filter first with the same tag: the writer of
+// dup is added to the tee of first, which writes the records first accepts.
+// The settings of the filters themselves must be the same, or the records of
+// dup would go through those of first, e.g. without its redactor: false is
+// returned otherwise.
+func mergeFilters(tag string, first, dup *Filter) bool {
+	if first.config != nil && dup.config != nil && !reflect.DeepEqual(filterSettings(first.config), filterSettings(dup.config)) {
+		fmt.Fprintf(configOut, "LoadConfiguration: Error: Duplicate tag \"%s\" can't be merged: its excludes, access, audit, stacktrace, sample, redact or predicate settings differ from those of the first filter\n", tag)
+		return false
+	}
+	if dup.Level != first.Level {
+		fmt.Fprintf(configOut, "LoadConfiguration: Warning: Duplicate tag \"%s\" merged at level %s, the level of the first filter\n", tag, levelName(first.Level))
+	}
+	if tee, ok := first.LogWriter.(*TeeLogWriter); ok {
+		tee.Add(dup.LogWriter)
+	} else {
+		first.LogWriter = NewTeeLogWriter(first.LogWriter, dup.LogWriter)
+	}
+	if dup.config != nil {
+		first.merged = append(first.merged, *dup.config)
+	}
+	return true
+}
+
+// The properties of a filter which apply to the filter itself rather than to
+// its writer, see configFilter
+var filterProperties = map[string]bool{
+	"stacktrace_level": true, "stacktrace_format": true, "stacktrace_depth": true,
+	"sample_rate": true, "sample_mode": true, "sample_seed": true, "sample_level": true,
+	"redact": true, "redact_pattern": true, "redact_field": true,
+	"predicate": true,
+}
+
+// The settings of the filter itself in a filter configuration, its writer
+// left out
+func filterSettings(fc *FilterConfig) FilterConfig {
+	settings := FilterConfig{
+		Exclude: fc.Exclude,
+		Access:  strings.Trim(fc.Access, " \r\n"),
+		Audit:   strings.Trim(fc.Audit, " \r\n"),
+	}
+	for _, prop := range fc.Property {
+		if filterProperties[prop.Name] {
+			settings.Property = append(settings.Property, Property{prop.Name, strings.Trim(prop.Value, " \r\n")})
+		}
+	}
+	return settings
+}
+
+func xmlToConsoleLogWriter(excludes []string, props []Property, enabled bool) (*ConsoleLogWriter, bool) {
+	out := stdout
+	format := ""
+	timeformat := ""
+	utc := false
+
 	// Parse properties
 	for _, prop := range props {
 		switch prop.Name {
+		case "target":
+			switch target := strings.Trim(prop.Value, " \r\n"); target {
+			case "stdout":
+				out = stdout
+			case "stderr":
+				out = stderr
+			default:
+				fmt.Fprintf(configOut, "LoadConfiguration: Error: Unknown target \"%s\" for console filter, expect stdout or stderr\n", target)
+				return nil, false
+			}
+		case "format":
+			format = strings.Trim(prop.Value, " \r\n")
+		case "timeformat":
+			if timeformat = xmlToTimeFormat(prop.Value, "console"); timeformat == "" {
+				return nil, false
+			}
+		case "utc":
+			utc = strings.Trim(prop.Value, " \r\n") != "false"
 		default:
-			fmt.Fprintf(os.Stderr, "LoadConfiguration: Warning: Unknown property \"%s\" for console filter\n", prop.Name)
+			fmt.Fprintf(configOut, "LoadConfiguration: Warning: Unknown property \"%s\" for console filter\n", prop.Name)
 		}
 	}
 
@@ -161,7 +976,91 @@ func xmlToConsoleLogWriter(excludes []string, props []xmlProperty, enabled bool)
 		return nil, true
 	}
 
-	return NewConsoleLogWriter(), true
+	if format == "" && timeformat != "" {
+		format = "[%Z] [%L] (%S) %M"
+	}
+
+	clw := NewConsoleLogWriterTo(out)
+	if format != "" {
+		clw.SetFormat(format)
+	}
+	clw.SetTimeFormat(timeformat)
+	clw.SetUTC(utc)
+	if layout := namedLayout(format, timeformat); layout != nil {
+		clw.SetLayout(layout)
+	}
+	return clw, true
+}
+
+// The layouts which can be selected by name in a format property, instead of
+// a pattern
+func namedLayout(format, timeformat string) Layout {
+	switch format {
+	case "logfmt":
+		return LogfmtLayout{TimeFormat: timeformat}
+	case "json":
+		return JSONLayout{TimeFormat: timeformat}
+	case "common":
+		return AccessLayout{}
+	case "combined":
+		return AccessLayout{Combined: true}
+	}
+	return nil
+}
+
+// The path of a file property: relative to the directory of the program,
+// unless it's absolute
+func xmlToPath(value string) string {
+	path := strings.Trim(value, " \r\n")
+	if filepath.IsAbs(path) {
+		return path
+	}
+	abspath, _ := exec.LookPath(os.Args[0])
+	return filepath.Join(filepath.Dir(abspath), path)
+}
+
+// Parse a filemode or dirmode property, octal permissions such as 0640
+func xmlToFileMode(name, value, filter string) (os.FileMode, bool) {
+	mode, err := strconv.ParseUint(strings.Trim(value, " \r\n"), 8, 32)
+	if err != nil || mode > 0777 {
+		fmt.Fprintf(configOut, "LoadConfiguration: Error: Invalid property \"%s\" for %s filter: %s, expect octal permissions such as 0640\n", name, filter, strings.Trim(value, " \r\n"))
+		return 0, false
+	}
+	return os.FileMode(mode), true
+}
+
+// Check a timeformat property, returns "" if it's invalid
+func xmlToTimeFormat(value, filter string) string {
+	timeformat := strings.Trim(value, " \r\n")
+	if !validTimeFormat(timeformat) {
+		fmt.Fprintf(configOut, "LoadConfiguration: Error: Unknown timeformat \"%s\" for %s filter, expect a preset or a time layout\n", timeformat, filter)
+		return ""
+	}
+	return timeformat
+}
+
+// Parse the record TTLs of a store-and-forward filter, a comma separated list
+// of DURATION (for all the levels) or LEVEL=DURATION (for that level and
+// above), e.g. "1h, ERROR=24h"
+func xmlToRecordTTL(value, filter string) (ttl recordTTL, ok bool) {
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		lvl, dur := ACCESS, item
+		if i := strings.Index(item, "="); i >= 0 {
+			if lvl, ok = levelByName(strings.TrimSpace(item[:i])); !ok {
+				fmt.Fprintf(configOut, "LoadConfiguration: Error: Unknown level \"%s\" in property \"%s\" for %s filter\n", strings.TrimSpace(item[:i]), "ttl", filter)
+				return ttl, false
+			}
+			dur = strings.TrimSpace(item[i+1:])
+		}
+		d, err := time.ParseDuration(dur)
+		if err != nil {
+			fmt.Fprintf(configOut, "LoadConfiguration: Error: Invalid property \"%s\" for %s filter: %s\n", "ttl", filter, err)
+			return ttl, false
+		}
+		ttl.set(lvl, d)
+	}
+	return ttl, true
 }
 
 // Parse a number with K/M/G suffixes based on thousands (1000) or 2^10 (1024)
@@ -184,26 +1083,35 @@ func strToNumSuffix(str string, mult int) int {
 	return parsed * num
 }
 
-func xmlToFileLogWriter(excludes []string, props []xmlProperty, enabled bool) (*FileLogWriter, bool) {
+func xmlToFileLogWriter(excludes []string, props []Property, enabled bool) (*FileLogWriter, bool) {
 	file := ""
-	format := "[%D %T] [%L] (%S) %M"
+	format := ""
+	timeformat := ""
+	utc := false
 	maxlines := 0
 	maxsize := 0
 	daily := false
 	rotate := false
+	encoding, unmappable := "", ""
+	crlf, bom := false, false
+	shared, lockwrites := false, false
+	filemode, dirmode := FileMode, os.ModePerm
+	bufsize, flushinterval := 0, time.Second
+	batchsize, batchlatency := FileBatchSize, time.Duration(0)
 
 	// Parse properties
 	for _, prop := range props {
 		switch prop.Name {
 		case "filename":
-			abspath, _ := exec.LookPath(os.Args[0])
-			dir := filepath.Dir(abspath)
-			file = filepath.Join(dir, strings.Trim(prop.Value, " \r\n"))
-			if _, err := os.Lstat(filepath.Dir(file)); os.IsNotExist(err) {
-				os.MkdirAll(filepath.Dir(file), os.ModeDir|os.ModePerm)
-			}
+			file = xmlToPath(prop.Value)
 		case "format":
 			format = strings.Trim(prop.Value, " \r\n")
+		case "timeformat":
+			if timeformat = xmlToTimeFormat(prop.Value, "file"); timeformat == "" {
+				return nil, false
+			}
+		case "utc":
+			utc = strings.Trim(prop.Value, " \r\n") != "false"
 		case "maxlines":
 			maxlines = strToNumSuffix(strings.Trim(prop.Value, " \r\n"), 1000)
 		case "maxsize":
@@ -212,14 +1120,66 @@ func xmlToFileLogWriter(excludes []string, props []xmlProperty, enabled bool) (*
 			daily = strings.Trim(prop.Value, " \r\n") != "false"
 		case "rotate":
 			rotate = strings.Trim(prop.Value, " \r\n") != "false"
+		case "encoding":
+			encoding = prop.Value
+		case "unmappable":
+			unmappable = prop.Value
+		case "newline":
+			switch newline := strings.ToLower(strings.Trim(prop.Value, " \r\n")); newline {
+			case "lf":
+				crlf = false
+			case "crlf":
+				crlf = true
+			default:
+				fmt.Fprintf(configOut, "LoadConfiguration: Error: Unknown newline style \"%s\" for file filter, want lf or crlf\n", newline)
+				return nil, false
+			}
+		case "bom":
+			bom = strings.Trim(prop.Value, " \r\n") != "false"
+		case "shared":
+			shared = strings.Trim(prop.Value, " \r\n") != "false"
+		case "lockwrites":
+			lockwrites = strings.Trim(prop.Value, " \r\n") != "false"
+		case "bufsize":
+			bufsize = strToNumSuffix(strings.Trim(prop.Value, " \r\n"), 1024)
+		case "flushinterval":
+			d, err := time.ParseDuration(strings.Trim(prop.Value, " \r\n"))
+			if err != nil {
+				fmt.Fprintf(configOut, "LoadConfiguration: Error: Invalid property \"%s\" for file filter: %s\n", "flushinterval", err)
+				return nil, false
+			}
+			flushinterval = d
+		case "batchsize":
+			batchsize = strToNumSuffix(strings.Trim(prop.Value, " \r\n"), 1000)
+		case "batchlatency":
+			d, err := time.ParseDuration(strings.Trim(prop.Value, " \r\n"))
+			if err != nil {
+				fmt.Fprintf(configOut, "LoadConfiguration: Error: Invalid property \"%s\" for file filter: %s\n", "batchlatency", err)
+				return nil, false
+			}
+			batchlatency = d
+		case "filemode", "dirmode":
+			mode, ok := xmlToFileMode(prop.Name, prop.Value, "file")
+			if !ok {
+				return nil, false
+			}
+			if prop.Name == "filemode" {
+				filemode = mode
+			} else {
+				dirmode = mode
+			}
 		default:
-			fmt.Fprintf(os.Stderr, "LoadConfiguration: Warning: Unknown property \"%s\" for file filter\n", prop.Name)
+			fmt.Fprintf(configOut, "LoadConfiguration: Warning: Unknown property \"%s\" for file filter\n", prop.Name)
 		}
 	}
 
 	// Check properties
 	if len(file) == 0 {
-		fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Required property \"%s\" for file filter\n", "filename")
+		fmt.Fprintf(configOut, "LoadConfiguration: Error: Required property \"%s\" for file filter\n", "filename")
+		return nil, false
+	}
+	transcoder, ok := xmlToTranscoder(encoding, unmappable, "file")
+	if !ok {
 		return nil, false
 	}
 
@@ -228,28 +1188,50 @@ func xmlToFileLogWriter(excludes []string, props []xmlProperty, enabled bool) (*
 		return nil, true
 	}
 
+	if format == "" {
+		format = "[%D %T] [%L] (%S) %M"
+		if timeformat != "" {
+			format = "[%Z] [%L] (%S) %M"
+		}
+	}
+
+	if _, err := os.Lstat(filepath.Dir(file)); os.IsNotExist(err) {
+		os.MkdirAll(filepath.Dir(file), os.ModeDir|dirmode)
+	}
 	flw := NewFileLogWriter(file, rotate, daily)
+	flw.SetFileMode(filemode)
+	flw.SetBuffer(bufsize, flushinterval)
+	flw.SetBatch(batchsize, batchlatency)
 	flw.SetFormat(format)
+	flw.SetTimeFormat(timeformat)
+	flw.SetUTC(utc)
+	if layout := namedLayout(format, timeformat); layout != nil {
+		flw.SetLayout(layout)
+	}
+	flw.SetTranscoder(transcoder)
+	flw.SetCRLF(crlf)
+	flw.SetBOM(bom)
+	flw.SetShared(shared)
+	flw.SetLockWrites(lockwrites)
 	flw.SetRotateLines(maxlines)
 	flw.SetRotateSize(int64(maxsize))
 	//flw.SetRotateDaily(daily)
 	return flw, true
 }
 
-func xmlToXMLLogWriter(excludes []string, props []xmlProperty, enabled bool) (*FileLogWriter, bool) {
+func xmlToXMLLogWriter(excludes []string, props []Property, enabled bool) (*FileLogWriter, bool) {
 	file := ""
 	maxrecords := 0
 	maxsize := 0
 	daily := false
 	rotate := false
+	utc := false
 
 	// Parse properties
 	for _, prop := range props {
 		switch prop.Name {
 		case "filename":
-			abspath, _ := exec.LookPath(os.Args[0])
-			dir := filepath.Dir(abspath)
-			file = filepath.Join(dir, strings.Trim(prop.Value, " \r\n"))
+			file = xmlToPath(prop.Value)
 		case "maxrecords":
 			maxrecords = strToNumSuffix(strings.Trim(prop.Value, " \r\n"), 1000)
 		case "maxsize":
@@ -258,14 +1240,16 @@ func xmlToXMLLogWriter(excludes []string, props []xmlProperty, enabled bool) (*F
 			daily = strings.Trim(prop.Value, " \r\n") != "false"
 		case "rotate":
 			rotate = strings.Trim(prop.Value, " \r\n") != "false"
+		case "utc":
+			utc = strings.Trim(prop.Value, " \r\n") != "false"
 		default:
-			fmt.Fprintf(os.Stderr, "LoadConfiguration: Warning: Unknown property \"%s\" for xml filter\n", prop.Name)
+			fmt.Fprintf(configOut, "LoadConfiguration: Warning: Unknown property \"%s\" for xml filter\n", prop.Name)
 		}
 	}
 
 	// Check properties
 	if len(file) == 0 {
-		fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Required property \"%s\" for xml filter\n", "filename")
+		fmt.Fprintf(configOut, "LoadConfiguration: Error: Required property \"%s\" for xml filter\n", "filename")
 		return nil, false
 	}
 
@@ -277,13 +1261,21 @@ func xmlToXMLLogWriter(excludes []string, props []xmlProperty, enabled bool) (*F
 	xlw := NewXMLLogWriter(file, rotate, daily)
 	xlw.SetRotateLines(maxrecords)
 	xlw.SetRotateSize(int64(maxsize))
+	xlw.SetUTC(utc)
 	//xlw.SetRotateDaily(daily)
 	return xlw, true
 }
 
-func xmlToSocketLogWriter(exclude []string, props []xmlProperty, enabled bool) (SocketLogWriter, bool) {
+func xmlToSocketLogWriter(exclude []string, props []Property, enabled bool) (*SocketLogWriter, bool) {
 	endpoint := ""
 	protocol := "udp"
+	maxbuffered := SocketMaxBuffered
+	maxbackoff := SocketMaxBackoff
+	format := ""
+	timeformat := ""
+	utc := false
+	var ttl recordTTL
+	encoding, unmappable := "", ""
 
 	// Parse properties
 	for _, prop := range props {
@@ -292,21 +1284,269 @@ func xmlToSocketLogWriter(exclude []string, props []xmlProperty, enabled bool) (
 			endpoint = strings.Trim(prop.Value, " \r\n")
 		case "protocol":
 			protocol = strings.Trim(prop.Value, " \r\n")
+			switch protocol {
+			case "udp", "udp4", "udp6", "tcp", "tcp4", "tcp6", "unix", "unixgram":
+			default:
+				fmt.Fprintf(configOut, "LoadConfiguration: Error: Unknown protocol \"%s\" for socket filter, expect udp, tcp, unix or unixgram\n", protocol)
+				return nil, false
+			}
+		case "maxbuffered":
+			maxbuffered = strToNumSuffix(strings.Trim(prop.Value, " \r\n"), 1000)
+		case "maxbackoff":
+			d, err := time.ParseDuration(strings.Trim(prop.Value, " \r\n"))
+			if err != nil {
+				fmt.Fprintf(configOut, "LoadConfiguration: Error: Invalid property \"%s\" for socket filter: %s\n", "maxbackoff", err)
+				return nil, false
+			}
+			maxbackoff = d
+		case "ttl":
+			var ok bool
+			if ttl, ok = xmlToRecordTTL(prop.Value, "socket"); !ok {
+				return nil, false
+			}
+		case "format":
+			format = strings.Trim(prop.Value, " \r\n")
+		case "timeformat":
+			if timeformat = xmlToTimeFormat(prop.Value, "socket"); timeformat == "" {
+				return nil, false
+			}
+		case "utc":
+			utc = strings.Trim(prop.Value, " \r\n") != "false"
+		case "encoding":
+			encoding = prop.Value
+		case "unmappable":
+			unmappable = prop.Value
 		default:
-			fmt.Fprintf(os.Stderr, "LoadConfiguration: Warning: Unknown property \"%s\" for file filter\n", prop.Name)
+			fmt.Fprintf(configOut, "LoadConfiguration: Warning: Unknown property \"%s\" for file filter\n", prop.Name)
 		}
 	}
 
 	// Check properties
 	if len(endpoint) == 0 {
-		fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Required property \"%s\" for file filter\n", "endpoint")
+		fmt.Fprintf(configOut, "LoadConfiguration: Error: Required property \"%s\" for file filter\n", "endpoint")
+		return nil, false
+	}
+	transcoder, ok := xmlToTranscoder(encoding, unmappable, "socket")
+	if !ok {
 		return nil, false
 	}
 
+	// The endpoint of a unix socket is a path, relative to the program like
+	// the files, unless it's in the abstract namespace of linux (@name)
+	if strings.HasPrefix(protocol, "unix") && !strings.HasPrefix(endpoint, "@") {
+		endpoint = xmlToPath(endpoint)
+	}
+
 	// If it's disabled, we're just checking syntax
 	if !enabled {
 		return nil, true
 	}
 
-	return NewSocketLogWriter(protocol, endpoint), true
+	slw := NewSocketLogWriter(protocol, endpoint).SetMaxBuffered(maxbuffered).SetReconnectBackoff(SocketMinBackoff, maxbackoff).SetUTC(utc)
+	slw.ttl = ttl
+	slw.SetTranscoder(transcoder)
+	if wire, ok := wireFormatByName(format); ok && wire != WireJSON {
+		slw.SetWireFormat(wire)
+	} else if layout := namedLayout(format, timeformat); layout != nil {
+		slw.SetLayout(layout)
+	} else if format != "" {
+		slw.SetLayout(PatternLayout{format, timeformat})
+	}
+	return slw, true
+}
+
+func xmlToMemoryLogWriter(excludes []string, props []Property, enabled bool) (*MemoryLogWriter, bool) {
+	size := 1000
+	format := ""
+	timeformat := ""
+	utc := false
+	crashfile := ""
+	crashwindow := time.Duration(0)
+
+	// Parse properties
+	for _, prop := range props {
+		switch prop.Name {
+		case "size":
+			size = strToNumSuffix(strings.Trim(prop.Value, " \r\n"), 1000)
+		case "format":
+			format = strings.Trim(prop.Value, " \r\n")
+		case "timeformat":
+			if timeformat = xmlToTimeFormat(prop.Value, "memory"); timeformat == "" {
+				return nil, false
+			}
+		case "utc":
+			utc = strings.Trim(prop.Value, " \r\n") != "false"
+		case "crashfile":
+			crashfile = xmlToPath(prop.Value)
+		case "crashwindow":
+			d, err := time.ParseDuration(strings.Trim(prop.Value, " \r\n"))
+			if err != nil {
+				fmt.Fprintf(configOut, "LoadConfiguration: Error: Invalid property \"%s\" for memory filter: %s\n", "crashwindow", err)
+				return nil, false
+			}
+			crashwindow = d
+		default:
+			fmt.Fprintf(configOut, "LoadConfiguration: Warning: Unknown property \"%s\" for memory filter\n", prop.Name)
+		}
+	}
+
+	// Check properties
+	if size <= 0 {
+		fmt.Fprintf(configOut, "LoadConfiguration: Error: Invalid property \"%s\" for memory filter: must be positive\n", "size")
+		return nil, false
+	}
+
+	// If it's disabled, we're just checking syntax
+	if !enabled {
+		return nil, true
+	}
+
+	if format == "" {
+		format = "[%D %T] [%L] (%S) %M"
+		if timeformat != "" {
+			format = "[%Z] [%L] (%S) %M"
+		}
+	}
+
+	mlw := NewMemoryLogWriter(size).SetFormat(format).SetTimeFormat(timeformat).SetCrashFile(crashfile, crashwindow).SetUTC(utc)
+	if layout := namedLayout(format, timeformat); layout != nil {
+		mlw.SetLayout(layout)
+	}
+	return mlw, true
+}
+
+func xmlToSplitLogWriter(excludes []string, props []Property, enabled bool) (*SplitLogWriter, bool) {
+	pattern := ""
+	var key func(rec *LogRecord) string
+	format := ""
+	timeformat := ""
+	utc := false
+	maxopen := SplitMaxOpen
+	idle := SplitIdleTimeout
+	filemode, dirmode := FileMode, os.ModePerm
+
+	// Parse properties
+	for _, prop := range props {
+		switch prop.Name {
+		case "pattern":
+			pattern = xmlToPath(prop.Value)
+		case "split":
+			switch split := strings.Trim(prop.Value, " \r\n"); {
+			case split == "source":
+				key = SplitBySource
+			case strings.HasPrefix(split, "field:") && len(split) > len("field:"):
+				key = SplitByField(strings.TrimPrefix(split, "field:"))
+			default:
+				fmt.Fprintf(configOut, "LoadConfiguration: Error: Unknown split \"%s\" for split filter, expect source or field:NAME\n", split)
+				return nil, false
+			}
+		case "format":
+			format = strings.Trim(prop.Value, " \r\n")
+		case "timeformat":
+			if timeformat = xmlToTimeFormat(prop.Value, "split"); timeformat == "" {
+				return nil, false
+			}
+		case "utc":
+			utc = strings.Trim(prop.Value, " \r\n") != "false"
+		case "maxopen":
+			maxopen = strToNumSuffix(strings.Trim(prop.Value, " \r\n"), 1000)
+		case "idle":
+			d, err := time.ParseDuration(strings.Trim(prop.Value, " \r\n"))
+			if err != nil {
+				fmt.Fprintf(configOut, "LoadConfiguration: Error: Invalid property \"%s\" for split filter: %s\n", "idle", err)
+				return nil, false
+			}
+			idle = d
+		case "filemode", "dirmode":
+			mode, ok := xmlToFileMode(prop.Name, prop.Value, "split")
+			if !ok {
+				return nil, false
+			}
+			if prop.Name == "filemode" {
+				filemode = mode
+			} else {
+				dirmode = mode
+			}
+		default:
+			fmt.Fprintf(configOut, "LoadConfiguration: Warning: Unknown property \"%s\" for split filter\n", prop.Name)
+		}
+	}
+
+	// Check properties
+	if !strings.Contains(pattern, "%s") {
+		fmt.Fprintf(configOut, "LoadConfiguration: Error: Required property \"%s\" for split filter, with %%s for the key\n", "pattern")
+		return nil, false
+	}
+	if key == nil {
+		fmt.Fprintf(configOut, "LoadConfiguration: Error: Required property \"%s\" for split filter\n", "split")
+		return nil, false
+	}
+
+	// If it's disabled, we're just checking syntax
+	if !enabled {
+		return nil, true
+	}
+
+	if format == "" {
+		format = "[%D %T] [%L] (%S) %M"
+		if timeformat != "" {
+			format = "[%Z] [%L] (%S) %M"
+		}
+	}
+
+	slw := NewSplitLogWriter(pattern, key).SetFormat(format).SetTimeFormat(timeformat).SetUTC(utc).SetMaxOpen(maxopen).SetIdleTimeout(idle)
+	slw.SetFileMode(filemode).SetDirMode(dirmode)
+	if layout := namedLayout(format, timeformat); layout != nil {
+		slw.SetLayout(layout)
+	}
+	return slw, true
+}
+
+// The key of the chain is given by the environment variable named by key_env,
+// rather than in the configuration itself, or else by key
+func xmlToAuditLogWriter(excludes []string, props []Property, enabled bool) (*AuditLogWriter, bool) {
+	file := ""
+	key, keyenv := "", ""
+	sync := false
+
+	// Parse properties
+	for _, prop := range props {
+		switch prop.Name {
+		case "filename":
+			file = xmlToPath(prop.Value)
+		case "key":
+			key = strings.Trim(prop.Value, " \r\n")
+		case "key_env":
+			keyenv = strings.Trim(prop.Value, " \r\n")
+		case "sync":
+			sync = strings.Trim(prop.Value, " \r\n") != "false"
+		default:
+			fmt.Fprintf(configOut, "LoadConfiguration: Warning: Unknown property \"%s\" for audit filter\n", prop.Name)
+		}
+	}
+
+	// Check properties
+	if len(file) == 0 {
+		fmt.Fprintf(configOut, "LoadConfiguration: Error: Required property \"%s\" for audit filter\n", "filename")
+		return nil, false
+	}
+
+	// If it's disabled, we're just checking syntax
+	if !enabled {
+		return nil, true
+	}
+
+	if keyenv != "" {
+		var ok bool
+		if key, ok = os.LookupEnv(keyenv); !ok || key == "" {
+			fmt.Fprintf(configOut, "LoadConfiguration: Error: Invalid property \"%s\" for audit filter: %s is not set\n", "key_env", keyenv)
+			return nil, false
+		}
+	}
+
+	alw := NewAuditLogWriter(file, []byte(key))
+	if alw == nil {
+		return nil, false
+	}
+	return alw.SetSync(sync), true
 }
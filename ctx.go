@@ -0,0 +1,346 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// The extractors of fields from the contexts, see RegisterContextFields
+var contextExtractors []func(ctx context.Context) []Field
+
+// RegisterContextFields adds the fields found in ctx by extract to the
+// records logged with ctx through the *Ctx functions, e.g. the ids of the
+// trace and of the span of OpenTelemetry (see
+// github.com/kimiazhu/log4go/otellog).  It must be called before logging,
+// usually from an init function.
+func RegisterContextFields(extract func(ctx context.Context) []Field) {
+	contextExtractors = append(contextExtractors, extract)
+}
+
+// Build the fields describing the state of ctx: those of the registered
+// extractors, the time remaining before its deadline, and why it is done if
+// it has already been cancelled.
+func contextFields(ctx context.Context) []Field {
+	if ctx == nil {
+		return nil
+	}
+	var fields []Field
+	for _, extract := range contextExtractors {
+		fields = append(fields, extract(ctx)...)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		fields = append(fields, Field{"ctx_deadline", time.Until(deadline).Round(time.Millisecond)})
+	}
+	if err := ctx.Err(); err != nil {
+		fields = append(fields, Field{"ctx_err", err.Error()})
+		if cause := context.Cause(ctx); cause != nil && cause != err {
+			fields = append(fields, Field{"ctx_cause", cause.Error()})
+		}
+	}
+	return fields
+}
+
+type ndcKey struct{}
+
+// PushContext returns a copy of ctx with item pushed on its nested diagnostic
+// context, e.g. "request 42" then "batch 7".  The records logged with the
+// returned context through the *Ctx functions carry the whole stack, which %x
+// prints.  The item is popped by going back to ctx, or with PopContext.
+func PushContext(ctx context.Context, item string) context.Context {
+	ndc := ContextNDC(ctx)
+	return context.WithValue(ctx, ndcKey{}, append(ndc[:len(ndc):len(ndc)], item))
+}
+
+// PopContext returns a copy of ctx without the innermost item of its nested
+// diagnostic context.
+func PopContext(ctx context.Context) context.Context {
+	ndc := ContextNDC(ctx)
+	if len(ndc) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, ndcKey{}, ndc[:len(ndc)-1:len(ndc)-1])
+}
+
+// ContextNDC returns the nested diagnostic context of ctx, outermost first.
+// The slice must not be modified.
+func ContextNDC(ctx context.Context) []string {
+	if ctx == nil {
+		return nil
+	}
+	ndc, _ := ctx.Value(ndcKey{}).([]string)
+	return ndc
+}
+
+// Send a log message with the fields of ctx internally
+func (log Logger) intLogCtx(ctx context.Context, lvl Level, arg0 interface{}, args ...interface{}) {
+	// Determine if any logging will be done
+	if log.skip(lvl) {
+		return
+	}
+
+	// Determine caller func
+	src := callerSource(2)
+
+	// Make the log record
+	rec := newRecord(lvl, src, argsMessage(arg0, args))
+	rec.Fields = contextFields(ctx)
+	rec.NDC = ContextNDC(ctx)
+	rec.MDC = mergeMDC(currentMDC(), ContextMDC(ctx))
+
+	log.dispatch(rec)
+}
+
+// FinestCtx logs a message at the finest log level, together with the remaining
+// deadline and cancellation cause of ctx.
+// See Debug for an explanation of the arguments.
+func (log Logger) FinestCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	log.intLogCtx(ctx, FINEST, arg0, args...)
+}
+
+// FineCtx logs a message at the fine log level, together with the remaining
+// deadline and cancellation cause of ctx.
+// See Debug for an explanation of the arguments.
+func (log Logger) FineCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	log.intLogCtx(ctx, FINE, arg0, args...)
+}
+
+// DebugCtx logs a message at the debug log level, together with the remaining
+// deadline and cancellation cause of ctx.  The fields are named ctx_deadline,
+// ctx_err and ctx_cause, and each one is only present if it applies to ctx.
+// See Debug for an explanation of the arguments.
+func (log Logger) DebugCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	log.intLogCtx(ctx, DEBUG, arg0, args...)
+}
+
+// TraceCtx logs a message at the trace log level, together with the remaining
+// deadline and cancellation cause of ctx.
+// See Debug for an explanation of the arguments.
+func (log Logger) TraceCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	log.intLogCtx(ctx, TRACE, arg0, args...)
+}
+
+// InfoCtx logs a message at the info log level, together with the remaining
+// deadline and cancellation cause of ctx.
+// See Debug for an explanation of the arguments.
+func (log Logger) InfoCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	log.intLogCtx(ctx, INFO, arg0, args...)
+}
+
+// WarnCtx logs a message at the warning log level, together with the remaining
+// deadline and cancellation cause of ctx, and returns the formatted error.
+// See Warn for an explanation of the performance.
+func (log Logger) WarnCtx(ctx context.Context, arg0 interface{}, args ...interface{}) error {
+	msg := argsMessage(arg0, args)
+	log.intLogCtx(ctx, WARNING, msg)
+	return argsError(msg, arg0, args)
+}
+
+// ErrorCtx logs a message at the error log level, together with the remaining
+// deadline and cancellation cause of ctx, and returns the formatted error.
+// See Warn for an explanation of the performance.
+func (log Logger) ErrorCtx(ctx context.Context, arg0 interface{}, args ...interface{}) error {
+	msg := argsMessage(arg0, args)
+	log.intLogCtx(ctx, ERROR, msg)
+	return argsError(msg, arg0, args)
+}
+
+// CriticalCtx logs a message and the call stack at the critical log level,
+// together with the remaining deadline and cancellation cause of ctx, and
+// returns the formatted error.
+// See Warn for an explanation of the performance.
+func (log Logger) CriticalCtx(ctx context.Context, arg0 interface{}, args ...interface{}) error {
+	msg := argsMessage(arg0, args)
+	if !log.skip(CRITICAL) {
+		log.intLogCtx(ctx, CRITICAL, msg+"\n"+callStack())
+	}
+	return argsError(msg, arg0, args)
+}
+
+// Utility for finest log messages with context (see DebugCtx() for parameter explanation)
+// Wrapper for (*Logger).FinestCtx
+func FinestCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	Global.intLogCtx(ctx, FINEST, arg0, args...)
+}
+
+// Utility for fine log messages with context (see DebugCtx() for parameter explanation)
+// Wrapper for (*Logger).FineCtx
+func FineCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	Global.intLogCtx(ctx, FINE, arg0, args...)
+}
+
+// Utility for debug log messages with context, which appends the remaining
+// deadline and cancellation cause of ctx to the record.
+// Wrapper for (*Logger).DebugCtx
+func DebugCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	Global.intLogCtx(ctx, DEBUG, arg0, args...)
+}
+
+// Utility for trace log messages with context (see DebugCtx() for parameter explanation)
+// Wrapper for (*Logger).TraceCtx
+func TraceCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	Global.intLogCtx(ctx, TRACE, arg0, args...)
+}
+
+// Utility for info log messages with context (see DebugCtx() for parameter explanation)
+// Wrapper for (*Logger).InfoCtx
+func InfoCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	Global.intLogCtx(ctx, INFO, arg0, args...)
+}
+
+// Utility for warn log messages with context (returns an error for easy function returns)
+// Wrapper for (*Logger).WarnCtx
+func WarnCtx(ctx context.Context, arg0 interface{}, args ...interface{}) error {
+	msg := argsMessage(arg0, args)
+	Global.intLogCtx(ctx, WARNING, msg)
+	return argsError(msg, arg0, args)
+}
+
+// Utility for error log messages with context (returns an error for easy function returns)
+// Wrapper for (*Logger).ErrorCtx
+func ErrorCtx(ctx context.Context, arg0 interface{}, args ...interface{}) error {
+	msg := argsMessage(arg0, args)
+	Global.intLogCtx(ctx, ERROR, msg)
+	return argsError(msg, arg0, args)
+}
+
+// Utility for critical log messages with context (returns an error for easy function returns)
+// Wrapper for (*Logger).CriticalCtx. This method will log the call stack
+func CriticalCtx(ctx context.Context, arg0 interface{}, args ...interface{}) error {
+	msg := argsMessage(arg0, args)
+	if isLevelEnabled(CRITICAL) {
+		Global.intLogCtx(ctx, CRITICAL, msg+"\n"+callStack())
+	}
+	return argsError(msg, arg0, args)
+}
+
+// Send a formatted log message with the fields of ctx internally
+func (log Logger) intLogCtxf(ctx context.Context, lvl Level, format string, args ...interface{}) {
+	// Determine if any logging will be done
+	if log.skip(lvl) {
+		return
+	}
+
+	// Determine caller func
+	src := callerSource(2)
+
+	msg := format
+	if len(args) > 0 {
+		msg = fmt.Sprintf(format, args...)
+	}
+
+	// Make the log record
+	rec := newRecord(lvl, src, msg)
+	rec.Fields = contextFields(ctx)
+	rec.NDC = ContextNDC(ctx)
+	rec.MDC = mergeMDC(currentMDC(), ContextMDC(ctx))
+
+	log.dispatch(rec)
+}
+
+// FinestCtxf logs a message at the finest log level with the fields of ctx, like
+// FinestCtx, formatted with fmt.Sprintf.
+func (log Logger) FinestCtxf(ctx context.Context, format string, args ...interface{}) {
+	log.intLogCtxf(ctx, FINEST, format, args...)
+}
+
+// FineCtxf logs a message at the fine log level with the fields of ctx, like
+// FineCtx, formatted with fmt.Sprintf.
+func (log Logger) FineCtxf(ctx context.Context, format string, args ...interface{}) {
+	log.intLogCtxf(ctx, FINE, format, args...)
+}
+
+// DebugCtxf logs a message at the debug log level with the fields of ctx, like
+// DebugCtx, formatted with fmt.Sprintf.
+func (log Logger) DebugCtxf(ctx context.Context, format string, args ...interface{}) {
+	log.intLogCtxf(ctx, DEBUG, format, args...)
+}
+
+// TraceCtxf logs a message at the trace log level with the fields of ctx, like
+// TraceCtx, formatted with fmt.Sprintf.
+func (log Logger) TraceCtxf(ctx context.Context, format string, args ...interface{}) {
+	log.intLogCtxf(ctx, TRACE, format, args...)
+}
+
+// InfoCtxf logs a message at the info log level with the fields of ctx, like
+// InfoCtx, formatted with fmt.Sprintf.
+func (log Logger) InfoCtxf(ctx context.Context, format string, args ...interface{}) {
+	log.intLogCtxf(ctx, INFO, format, args...)
+}
+
+// WarnCtxf logs a message at the warning log level with the fields of ctx, like
+// WarnCtx, formatted with fmt.Sprintf, and returns it as an error.
+func (log Logger) WarnCtxf(ctx context.Context, format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	log.intLogCtx(ctx, WARNING, msg)
+	return argsError(msg, nil, args)
+}
+
+// ErrorCtxf logs a message at the error log level with the fields of ctx, like
+// ErrorCtx, formatted with fmt.Sprintf, and returns it as an error.
+func (log Logger) ErrorCtxf(ctx context.Context, format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	log.intLogCtx(ctx, ERROR, msg)
+	return argsError(msg, nil, args)
+}
+
+// CriticalCtxf logs a message and the call stack at the critical log level
+// with the fields of ctx, like CriticalCtx, formatted with fmt.Sprintf, and
+// returns it as an error.
+func (log Logger) CriticalCtxf(ctx context.Context, format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	if !log.skip(CRITICAL) {
+		log.intLogCtx(ctx, CRITICAL, msg+"\n"+callStack())
+	}
+	return argsError(msg, nil, args)
+}
+
+// Wrapper for (*Logger).FinestCtxf
+func FinestCtxf(ctx context.Context, format string, args ...interface{}) {
+	Global.intLogCtxf(ctx, FINEST, format, args...)
+}
+
+// Wrapper for (*Logger).FineCtxf
+func FineCtxf(ctx context.Context, format string, args ...interface{}) {
+	Global.intLogCtxf(ctx, FINE, format, args...)
+}
+
+// Wrapper for (*Logger).DebugCtxf
+func DebugCtxf(ctx context.Context, format string, args ...interface{}) {
+	Global.intLogCtxf(ctx, DEBUG, format, args...)
+}
+
+// Wrapper for (*Logger).TraceCtxf
+func TraceCtxf(ctx context.Context, format string, args ...interface{}) {
+	Global.intLogCtxf(ctx, TRACE, format, args...)
+}
+
+// Wrapper for (*Logger).InfoCtxf
+func InfoCtxf(ctx context.Context, format string, args ...interface{}) {
+	Global.intLogCtxf(ctx, INFO, format, args...)
+}
+
+// Wrapper for (*Logger).WarnCtxf
+func WarnCtxf(ctx context.Context, format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	Global.intLogCtx(ctx, WARNING, msg)
+	return argsError(msg, nil, args)
+}
+
+// Wrapper for (*Logger).ErrorCtxf
+func ErrorCtxf(ctx context.Context, format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	Global.intLogCtx(ctx, ERROR, msg)
+	return argsError(msg, nil, args)
+}
+
+// Wrapper for (*Logger).CriticalCtxf.  This method will log the call stack
+func CriticalCtxf(ctx context.Context, format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	if isLevelEnabled(CRITICAL) {
+		Global.intLogCtx(ctx, CRITICAL, msg+"\n"+callStack())
+	}
+	return argsError(msg, nil, args)
+}
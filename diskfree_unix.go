@@ -0,0 +1,19 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+//go:build !windows
+// +build !windows
+
+package log4go
+
+import (
+	"syscall"
+)
+
+// The bytes available to the process on the volume of path
+func diskFreeSpace(path string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
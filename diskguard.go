@@ -0,0 +1,187 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A DiskAction is what the disk guard does to the file writers of a volume
+// which runs out of space, see GuardDisk.
+type DiskAction int
+
+const (
+	// Drop the records below INFO, the access ones included
+	DiskDropDebug DiskAction = iota
+
+	// Drop all the records
+	DiskStopWriting
+)
+
+// DiskGuardInterval is how often the disk guard checks the free space of the
+// volumes, see GuardDisk.
+var DiskGuardInterval = 10 * time.Second
+
+// The free space of the volume of a path, replaced by the tests
+var diskFree = diskFreeSpace
+
+// GuardDisk starts watching the free space of the volumes the file writers of
+// the logger write to, those behind the async, tee and failover writers
+// included, every DiskGuardInterval.  When a volume has less than minFree bytes
+// left, the file writers on it apply action, and a single CRITICAL record from
+// the source "log4go/diskguard" tells the other writers, so that a full disk
+// doesn't go unnoticed and logging doesn't take the host down.  The writers go
+// back to normal, with an INFO record, once the volume has 10% more than
+// minFree again.
+//
+// The writers are those of the logger at each check, so the guard follows the
+// configuration reloads.  The returned function stops the guard and puts the
+// writers back to normal.
+func (log Logger) GuardDisk(minFree uint64, action DiskAction) (stop func()) {
+	g := &diskGuard{
+		log:     log,
+		minFree: minFree,
+		action:  action,
+		low:     make(map[string]bool),
+	}
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(DiskGuardInterval)
+		defer ticker.Stop()
+		for {
+			g.check()
+			select {
+			case <-ticker.C:
+			case <-done:
+				g.restore()
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-stopped
+		})
+	}
+}
+
+// The state of a disk guard, owned by its goroutine
+type diskGuard struct {
+	log     Logger
+	minFree uint64
+	action  DiskAction
+	low     map[string]bool // The directories on a volume low on space
+}
+
+// Check the free space of the volumes and degrade or restore their writers
+func (g *diskGuard) check() {
+	for dir, writers := range g.writersByDir() {
+		free, err := diskFree(dir)
+		if err != nil {
+			continue
+		}
+		switch {
+		case !g.low[dir] && free < g.minFree:
+			g.low[dir] = true
+			for _, w := range writers {
+				w.degrade(g.action)
+			}
+			g.log.Log(CRITICAL, "log4go/diskguard", fmt.Sprintf("diskguard: %s has %d bytes free, less than %d: %s of the file writers on it",
+				dir, free, g.minFree, g.action.verb()))
+		case g.low[dir] && free >= g.minFree+g.minFree/10:
+			delete(g.low, dir)
+			for _, w := range writers {
+				w.restore()
+			}
+			g.log.Log(INFO, "log4go/diskguard", fmt.Sprintf("diskguard: %s has %d bytes free again, the file writers on it are back to normal", dir, free))
+		case g.low[dir]:
+			// The writers added since, e.g. by a reload
+			for _, w := range writers {
+				w.degrade(g.action)
+			}
+		}
+	}
+}
+
+// Put the degraded writers back to normal
+func (g *diskGuard) restore() {
+	for dir, writers := range g.writersByDir() {
+		if g.low[dir] {
+			for _, w := range writers {
+				w.restore()
+			}
+		}
+	}
+	g.low = make(map[string]bool)
+}
+
+// The file writers of the logger by the directory of their file
+func (g *diskGuard) writersByDir() map[string][]*FileLogWriter {
+	byDir := make(map[string][]*FileLogWriter)
+	for _, filt := range g.log.filters() {
+		for _, w := range fileWriters(filt.LogWriter) {
+			dir, err := filepath.Abs(filepath.Dir(w.filename))
+			if err != nil {
+				continue
+			}
+			byDir[dir] = append(byDir[dir], w)
+		}
+	}
+	return byDir
+}
+
+// The file writers of w, w itself or those it wraps
+func fileWriters(w LogWriter) []*FileLogWriter {
+	switch w := w.(type) {
+	case *FileLogWriter:
+		return []*FileLogWriter{w}
+	case *AsyncWriter:
+		return fileWriters(w.inner)
+	case *TeeLogWriter:
+		var writers []*FileLogWriter
+		for _, child := range w.Writers() {
+			writers = append(writers, fileWriters(child)...)
+		}
+		return writers
+	case *FailoverLogWriter:
+		return append(fileWriters(w.primary), fileWriters(w.fallback)...)
+	}
+	return nil
+}
+
+// What the action does, for the messages
+func (a DiskAction) verb() string {
+	if a == DiskStopWriting {
+		return "stopping the writes"
+	}
+	return "dropping the records below INFO"
+}
+
+// Drop the records as the action of the disk guard says
+func (w *FileLogWriter) degrade(action DiskAction) {
+	min := int32(INFO) + 1
+	if action == DiskStopWriting {
+		min = math.MaxInt32
+	}
+	atomic.StoreInt32(&w.diskMin, min)
+}
+
+// Take all the records again
+func (w *FileLogWriter) restore() {
+	atomic.StoreInt32(&w.diskMin, 0)
+}
+
+// Whether the disk guard has the record dropped
+func (w *FileLogWriter) diskDrops(rec *LogRecord) bool {
+	min := atomic.LoadInt32(&w.diskMin)
+	return min != 0 && int32(rec.Level) < min-1
+}
@@ -0,0 +1,69 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A Transcoder converts the formatted records of a writer from UTF-8 to
+// another character encoding, e.g. for the legacy systems which read GBK or
+// Shift-JIS files.  A writer uses its own Transcoder, which needn't be safe
+// for concurrent use.
+type Transcoder interface {
+	// Transcode converts a formatted record.  An error means the record
+	// couldn't be converted, it isn't written.
+	Transcode(b []byte) ([]byte, error)
+}
+
+// How the runes which the encoding can't represent are written, the values of
+// the unmappable property
+const (
+	UnmappableReplace = "replace" // by the substitute of the encoding, typically '?'
+	UnmappableEscape  = "escape"  // as an HTML numeric character reference, &#20320;
+	UnmappableError   = "error"   // not at all: the record is dropped and the error reported
+)
+
+// The character encodings of the encoding property, by lower case name
+var encodings = make(map[string]func(unmappable string) (Transcoder, error))
+
+// RegisterEncoding makes a character encoding available to the encoding
+// property of the file and socket filters.  factory creates a Transcoder for
+// one writer, given the unmappable property (UnmappableReplace by default).
+// Names are case insensitive.  The encodings of golang.org/x/text are
+// registered by importing github.com/kimiazhu/log4go/textenc.
+func RegisterEncoding(name string, factory func(unmappable string) (Transcoder, error)) {
+	encodings[strings.ToLower(name)] = factory
+}
+
+// Create the Transcoder of the encoding and unmappable properties of a filter,
+// nil for UTF-8
+func xmlToTranscoder(encoding, unmappable, filter string) (Transcoder, bool) {
+	encoding = strings.Trim(encoding, " \r\n")
+	unmappable = strings.Trim(unmappable, " \r\n")
+	switch unmappable {
+	case "":
+		unmappable = UnmappableReplace
+	case UnmappableReplace, UnmappableEscape, UnmappableError:
+	default:
+		fmt.Fprintf(configOut, "LoadConfiguration: Error: Unknown unmappable \"%s\" for %s filter, expect replace, escape or error\n", unmappable, filter)
+		return nil, false
+	}
+	switch strings.ToLower(encoding) {
+	case "", "utf-8", "utf8":
+		return nil, true
+	}
+
+	factory, ok := encodings[strings.ToLower(encoding)]
+	if !ok {
+		fmt.Fprintf(configOut, "LoadConfiguration: Error: Unknown encoding \"%s\" for %s filter, import github.com/kimiazhu/log4go/textenc for golang.org/x/text ones\n", encoding, filter)
+		return nil, false
+	}
+	t, err := factory(unmappable)
+	if err != nil {
+		fmt.Fprintf(configOut, "LoadConfiguration: Error: Invalid encoding \"%s\" for %s filter: %s\n", encoding, filter, err)
+		return nil, false
+	}
+	return t, true
+}
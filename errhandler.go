@@ -0,0 +1,67 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// The function the writers report their failures to, nil for stderr
+var errorHandler struct {
+	sync.RWMutex
+	handle func(writer string, err error)
+}
+
+// The last failures reported, for DumpState
+const maxRecentErrors = 20
+
+var recentErrors struct {
+	sync.Mutex
+	errs []writerError
+}
+
+// A failure reported by a writer
+type writerError struct {
+	when   time.Time
+	writer string
+	err    error
+}
+
+// SetErrorHandler sets the function the writers report their failures to, a
+// file write error, a failed connection or a batch of records given up, e.g.
+// to alert when log shipping breaks.  writer identifies the writer, like
+// `SocketLogWriter("collector:9999")`.  By default, and with a nil handler,
+// the failures are printed to stderr.
+//
+// The handler is called from the goroutine of the failing writer: it must
+// not block, and must not log through that writer.
+func SetErrorHandler(handler func(writer string, err error)) {
+	errorHandler.Lock()
+	errorHandler.handle = handler
+	errorHandler.Unlock()
+}
+
+// ReportError reports the failure of a writer to the error handler, see
+// SetErrorHandler.  It's meant for the writers outside of this package.
+func ReportError(writer string, err error) {
+	recentErrors.Lock()
+	if len(recentErrors.errs) == maxRecentErrors {
+		copy(recentErrors.errs, recentErrors.errs[1:])
+		recentErrors.errs = recentErrors.errs[:maxRecentErrors-1]
+	}
+	recentErrors.errs = append(recentErrors.errs, writerError{time.Now(), writer, err})
+	recentErrors.Unlock()
+
+	errorHandler.RLock()
+	handle := errorHandler.handle
+	errorHandler.RUnlock()
+
+	if handle == nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", writer, err)
+		return
+	}
+	handle(writer, err)
+}
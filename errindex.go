@@ -0,0 +1,152 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// ErrorIndexSize specifies how many fingerprints the index of the recent
+// errors keeps at most: the one seen the longest ago is dropped for a new one.
+var ErrorIndexSize = 1000
+
+// ErrorGroup is the summary of the ERROR and CRITICAL records with the same
+// fingerprint: the same template of message from the same function.
+type ErrorGroup struct {
+	Fingerprint string    `json:"fingerprint"`
+	Level       string    `json:"level"` // The highest level seen
+	Source      string    `json:"source"`
+	Template    string    `json:"template"` // The message with its variable parts as #
+	Message     string    `json:"message"`  // The last message
+	Count       uint64    `json:"count"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+
+	lvl Level
+	seq uint64 // When it was last seen, in records of the index
+}
+
+// The recent errors, by fingerprint
+var errorIndex = struct {
+	sync.Mutex
+	groups map[string]*ErrorGroup
+	seq    uint64
+}{groups: make(map[string]*ErrorGroup)}
+
+// ErrorSummary returns the groups of ERROR and CRITICAL records logged
+// recently, the last seen first: what is breaking right now.  The index is
+// that of the process, all the loggers feed it, with the records written by at
+// least one filter.
+func (log Logger) ErrorSummary() []ErrorGroup {
+	errorIndex.Lock()
+	summary := make([]ErrorGroup, 0, len(errorIndex.groups))
+	for _, g := range errorIndex.groups {
+		summary = append(summary, *g)
+	}
+	errorIndex.Unlock()
+
+	sort.Slice(summary, func(i, j int) bool {
+		return summary[i].seq > summary[j].seq
+	})
+	return summary
+}
+
+// ResetErrorSummary clears the index of the recent errors
+func ResetErrorSummary() {
+	errorIndex.Lock()
+	errorIndex.groups = make(map[string]*ErrorGroup)
+	errorIndex.Unlock()
+}
+
+// Count an ERROR or CRITICAL record in the index of the recent errors
+func indexError(rec *LogRecord) {
+	if rec.Level < ERROR {
+		return
+	}
+
+	// The call stack of stacktrace_level isn't part of the message
+	msg := rec.Message
+	if i := strings.IndexByte(msg, '\n'); i >= 0 {
+		msg = msg[:i]
+	}
+	src := rec.Source
+	if i := strings.LastIndexByte(src, ':'); i >= 0 {
+		src = src[:i]
+	}
+	template := messageTemplate(msg)
+	h := fnv.New64a()
+	h.Write([]byte(src))
+	h.Write([]byte{0})
+	h.Write([]byte(template))
+	fp := fmt.Sprintf("%016x", h.Sum64())
+
+	errorIndex.Lock()
+	defer errorIndex.Unlock()
+	g, ok := errorIndex.groups[fp]
+	if !ok {
+		if ErrorIndexSize <= 0 {
+			return
+		}
+		for len(errorIndex.groups) >= ErrorIndexSize {
+			dropOldestError()
+		}
+		g = &ErrorGroup{Fingerprint: fp, Source: src, Template: template, FirstSeen: rec.Created}
+		errorIndex.groups[fp] = g
+	}
+	if rec.Level > g.lvl {
+		g.lvl, g.Level = rec.Level, levelName(rec.Level)
+	}
+	errorIndex.seq++
+	g.seq = errorIndex.seq
+	g.Message = msg
+	g.Count++
+	if rec.Created.After(g.LastSeen) {
+		g.LastSeen = rec.Created
+	}
+}
+
+// Drop the group seen the longest ago.  Must be called with errorIndex held.
+func dropOldestError() {
+	var oldest *ErrorGroup
+	for _, g := range errorIndex.groups {
+		if oldest == nil || g.seq < oldest.seq {
+			oldest = g
+		}
+	}
+	delete(errorIndex.groups, oldest.Fingerprint)
+}
+
+// The template of a message: the words containing a digit (numbers, ids,
+// addresses, durations...) are replaced by #, e.g. "dial 10.0.0.1:5432: i/o
+// timeout after 3s" gives "dial #:#: i/o timeout after #".
+func messageTemplate(msg string) string {
+	const maxlen = 256
+	var b strings.Builder
+	word := func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '-' || r == '_'
+	}
+	for i := 0; i < len(msg) && b.Len() < maxlen; {
+		j := strings.IndexFunc(msg[i:], func(r rune) bool { return !word(r) })
+		if j == 0 {
+			b.WriteByte(msg[i])
+			i++
+			continue
+		}
+		if j < 0 {
+			j = len(msg) - i
+		}
+		if w := msg[i : i+j]; strings.IndexFunc(w, unicode.IsDigit) >= 0 {
+			b.WriteByte('#')
+		} else {
+			b.WriteString(w)
+		}
+		i += j
+	}
+	return b.String()
+}
@@ -0,0 +1,98 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The error returned by Warn, Error, Critical and the like: the message logged,
+// wrapping the first error among the arguments so that errors.Is and errors.As
+// see through it, as %w of fmt.Errorf
+type loggedError struct {
+	msg string
+	err error
+}
+
+func (e *loggedError) Error() string {
+	return e.msg
+}
+
+func (e *loggedError) Unwrap() error {
+	return e.err
+}
+
+// The error of the message msg logged from the arguments, wrapping the first
+// of them which is an error if any
+func argsError(msg string, arg0 interface{}, args []interface{}) error {
+	if err, ok := arg0.(error); ok {
+		return &loggedError{msg, err}
+	}
+	for _, arg := range args {
+		if err, ok := arg.(error); ok {
+			return &loggedError{msg, err}
+		}
+	}
+	return errors.New(msg)
+}
+
+// The types of err and of the errors it wraps, depth first, e.g.
+// ["*fmt.wrapError" "*fs.PathError" "syscall.Errno"]
+func errorChain(err error) []string {
+	var chain []string
+	var walk func(err error)
+	walk = func(err error) {
+		if err == nil || len(chain) >= 32 {
+			return
+		}
+		chain = append(chain, fmt.Sprintf("%T", err))
+		switch err := err.(type) {
+		case interface{ Unwrap() error }:
+			walk(err.Unwrap())
+		case interface{ Unwrap() []error }:
+			for _, err := range err.Unwrap() {
+				walk(err)
+			}
+		}
+	}
+	walk(err)
+	return chain
+}
+
+// The message and the fields of ErrorErr, and the error it returns
+func errMessage(err error, format string, args ...interface{}) (string, []Field, error) {
+	msg := format
+	if len(args) > 0 {
+		msg = fmt.Sprintf(format, args...)
+	}
+	if err == nil {
+		return msg, nil, errors.New(msg)
+	}
+	msg += ": " + err.Error()
+	fields := []Field{{"error", err.Error()}, {"error_chain", errorChain(err)}}
+	return msg, fields, &loggedError{msg, err}
+}
+
+// ErrorErr logs the message, formatted with fmt.Sprintf and followed by ": "
+// and err, at the error log level, with err and the types of the errors it
+// wraps as the fields error and error_chain, and returns the message as an
+// error wrapping err:
+//
+//	if err := os.Remove(path); err != nil {
+//		return log.ErrorErr(err, "cleaning up %s", name)
+//	}
+//
+// The caller can still test the cause with errors.Is or errors.As.
+func (log Logger) ErrorErr(err error, format string, args ...interface{}) error {
+	msg, fields, logged := errMessage(err, format, args...)
+	log.intLogFields(ERROR, fields, msg)
+	return logged
+}
+
+// Wrapper for (*Logger).ErrorErr
+func ErrorErr(err error, format string, args ...interface{}) error {
+	msg, fields, logged := errMessage(err, format, args...)
+	Global.intLogFields(ERROR, fields, msg)
+	return logged
+}
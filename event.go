@@ -0,0 +1,103 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"fmt"
+	"sync"
+)
+
+// An eventTemplate describes the records logged for a named business event
+type eventTemplate struct {
+	level    Level
+	required []string
+}
+
+// An EventOption configures an event template, see RegisterEvent.
+type EventOption func(*eventTemplate)
+
+// RequiredFields makes Event fail unless all the given fields are present.
+func RequiredFields(keys ...string) EventOption {
+	return func(t *eventTemplate) {
+		t.required = append(t.required, keys...)
+	}
+}
+
+// EventLevel sets the level the event is logged at, INFO by default.
+func EventLevel(lvl Level) EventOption {
+	return func(t *eventTemplate) {
+		t.level = lvl
+	}
+}
+
+var events = struct {
+	sync.RWMutex
+	templates map[string]*eventTemplate
+}{templates: make(map[string]*eventTemplate)}
+
+// RegisterEvent defines the template of the event name, so that all the
+// records logged for it through Event carry a consistent set of fields:
+//
+//      log4go.RegisterEvent("user.login", log4go.RequiredFields("user_id", "ip"))
+//      ...
+//      log4go.Event("user.login", log4go.F("user_id", id), log4go.F("ip", ip))
+//
+// Registering an existing name replaces its template.
+func RegisterEvent(name string, opts ...EventOption) {
+	t := &eventTemplate{level: INFO}
+	for _, opt := range opts {
+		opt(t)
+	}
+	events.Lock()
+	events.templates[name] = t
+	events.Unlock()
+}
+
+// Event logs the registered event name with the given fields, the message of
+// the record being the name of the event.  Nothing is logged and an error is
+// returned if the event is unknown, a required field is missing or a field is
+// given twice.
+func (log Logger) Event(name string, fields ...Field) error {
+	lvl, err := checkEvent(name, fields)
+	if err != nil {
+		return err
+	}
+	log.intLogFields(lvl, fields, name)
+	return nil
+}
+
+// Validate the fields of an event against its template, and return the level
+// to log it at
+func checkEvent(name string, fields []Field) (Level, error) {
+	events.RLock()
+	t, ok := events.templates[name]
+	events.RUnlock()
+	if !ok {
+		return 0, fmt.Errorf("log4go: unknown event %q", name)
+	}
+
+	seen := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		if seen[field.Key] {
+			return 0, fmt.Errorf("log4go: field %q given twice for event %q", field.Key, name)
+		}
+		seen[field.Key] = true
+	}
+	for _, key := range t.required {
+		if !seen[key] {
+			return 0, fmt.Errorf("log4go: missing required field %q for event %q", key, name)
+		}
+	}
+	return t.level, nil
+}
+
+// Utility for logging registered business events (see (*Logger).Event)
+// Wrapper for (*Logger).Event
+func Event(name string, fields ...Field) error {
+	lvl, err := checkEvent(name, fields)
+	if err != nil {
+		return err
+	}
+	Global.intLogFields(lvl, fields, name)
+	return nil
+}
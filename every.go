@@ -0,0 +1,95 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The call sites of Once, EveryN and Every, by program counter
+var callSites = struct {
+	sync.RWMutex
+	m map[uintptr]*callSite
+}{m: make(map[uintptr]*callSite)}
+
+// How often a call site was reached, and when it last logged, accessed
+// atomically
+type callSite struct {
+	count uint64
+	last  int64 // unix nanoseconds
+}
+
+// The call site skip frames above the caller of siteOf
+func siteOf(skip int) *callSite {
+	pc, _, _, _ := runtime.Caller(skip + 1)
+
+	callSites.RLock()
+	site, ok := callSites.m[pc]
+	callSites.RUnlock()
+	if ok {
+		return site
+	}
+
+	callSites.Lock()
+	defer callSites.Unlock()
+	if site, ok = callSites.m[pc]; !ok {
+		site = &callSite{}
+		callSites.m[pc] = site
+	}
+	return site
+}
+
+// Whether the site is reached for the first time
+func (s *callSite) once() bool {
+	return atomic.AddUint64(&s.count, 1) == 1
+}
+
+// Whether the site is reached for the first time, or the n-th time since it
+// last logged
+func (s *callSite) everyN(n int) bool {
+	count := atomic.AddUint64(&s.count, 1)
+	return n <= 1 || (count-1)%uint64(n) == 0
+}
+
+// Whether the site is reached for the first time, or d after it last logged
+func (s *callSite) every(d time.Duration) bool {
+	now := clockNow().UnixNano()
+	last := atomic.LoadInt64(&s.last)
+	if last != 0 && now-last < int64(d) {
+		return false
+	}
+	return atomic.CompareAndSwapInt64(&s.last, last, now)
+}
+
+// Once logs the message (see Debug for the arguments) the first time the call
+// site is reached, and never again, e.g. a deprecation warning in a hot path.
+// The calls while lvl is filtered out don't count.
+func (log Logger) Once(lvl Level, arg0 interface{}, args ...interface{}) {
+	if log.skip(lvl) || !siteOf(1).once() {
+		return
+	}
+	log.intLogv(lvl, arg0, args)
+}
+
+// EveryN logs the message (see Debug for the arguments) the first time the
+// call site is reached, then every n times, e.g. the progress of a loop over
+// millions of items.  The calls while lvl is filtered out don't count.
+func (log Logger) EveryN(n int, lvl Level, arg0 interface{}, args ...interface{}) {
+	if log.skip(lvl) || !siteOf(1).everyN(n) {
+		return
+	}
+	log.intLogv(lvl, arg0, args)
+}
+
+// Every logs the message (see Debug for the arguments) the first time the call
+// site is reached, then at most once every d, e.g. an error repeated by a retry
+// loop.  The calls in between are dropped, not counted.
+func (log Logger) Every(d time.Duration, lvl Level, arg0 interface{}, args ...interface{}) {
+	if log.skip(lvl) || !siteOf(1).every(d) {
+		return
+	}
+	log.intLogv(lvl, arg0, args)
+}
@@ -0,0 +1,110 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"strings"
+	"sync/atomic"
+)
+
+// A call site, described once whatever the number of records it logs: the
+// file of its source, and whether the excludes of the filters match it, so
+// that the prefixes of a filter are only compared once per call site
+type sourceSite struct {
+	file string
+
+	// Whether the source is excluded by the sets of the current generation
+	excluded atomic.Value // *siteExcludes
+}
+
+// The results of the excludes for a site, by set, for a generation of the
+// sets
+type siteExcludes struct {
+	gen     uint64
+	results map[*excludeSet]bool
+}
+
+// The generation of the excludes, which changes with each new set: the sites
+// drop the results of the previous ones, e.g. of the filters of a replaced
+// configuration, rather than keep them forever
+var excludeGen uint64
+
+// The site of a source made by callerSource, nil for another one, e.g. the
+// source of a forwarded record
+func sourceSiteOf(src string) *sourceSite {
+	callerSources.RLock()
+	defer callerSources.RUnlock()
+	return callerSources.sites[src]
+}
+
+// The excludes of a filter as they were when the results were cached.  The
+// results of a set are kept by the sites until a new set is made, when
+// Excludes is set to another slice or a filter is added.
+type excludeSet struct {
+	prefixes []string
+}
+
+// Report whether src starts with one of the prefixes
+func (s *excludeSet) match(src string) bool {
+	for _, ex := range s.prefixes {
+		if strings.HasPrefix(src, ex) {
+			return true
+		}
+	}
+	return false
+}
+
+// The set of the current excludes of the filter, made again when Excludes is
+// set to another slice
+func (f *Filter) excludeSet() *excludeSet {
+	if s, ok := f.excludes.Load().(*excludeSet); ok && sameStrings(s.prefixes, f.Excludes) {
+		return s
+	}
+	s := &excludeSet{f.Excludes}
+	f.excludes.Store(s)
+	atomic.AddUint64(&excludeGen, 1)
+	return s
+}
+
+// Report whether a and b are the same slice, not only equal ones
+func sameStrings(a, b []string) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
+
+// Report whether the filter excludes the source src.  *site is the site of
+// the source, looked up for the first filter with excludes, so that a record
+// looks it up once.
+func (f *Filter) excluded(src string, site **sourceSite) bool {
+	if len(f.Excludes) == 0 {
+		return false
+	}
+	set := f.excludeSet()
+	if *site == nil {
+		*site = sourceSiteOf(src)
+	}
+	if *site == nil {
+		return set.match(src)
+	}
+	gen := atomic.LoadUint64(&excludeGen)
+	cached, _ := (*site).excluded.Load().(*siteExcludes)
+	if cached != nil && cached.gen != gen {
+		cached = nil
+	}
+	if cached != nil {
+		if ex, ok := cached.results[set]; ok {
+			return ex
+		}
+	}
+
+	// The results are replaced as a whole: a result lost to a concurrent
+	// update is only computed again
+	ex := set.match(src)
+	results := map[*excludeSet]bool{set: ex}
+	if cached != nil {
+		for s, r := range cached.results {
+			results[s] = r
+		}
+	}
+	(*site).excluded.Store(&siteExcludes{gen, results})
+	return ex
+}
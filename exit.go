@@ -0,0 +1,52 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"os"
+	"sync"
+)
+
+var exiting = struct {
+	sync.Mutex
+	exit  func(code int)
+	hooks []func()
+}{exit: os.Exit}
+
+// SetExitFunc replaces os.Exit as the way Exit, Fatal and the like terminate
+// the program, e.g. so that a test can check the exit code.  If the function
+// returns, so do they.  A nil func restores os.Exit.
+func SetExitFunc(exit func(code int)) {
+	if exit == nil {
+		exit = os.Exit
+	}
+	exiting.Lock()
+	exiting.exit = exit
+	exiting.Unlock()
+}
+
+// AddExitHook registers a function which Exit, Fatal and the like run before
+// terminating the program, in the order they were added, e.g. to release
+// resources or to tell a supervisor.  The hooks may still log: the logger is
+// closed after them.
+func AddExitHook(hook func()) {
+	exiting.Lock()
+	exiting.hooks = append(exiting.hooks, hook)
+	exiting.Unlock()
+}
+
+// Run the exit hooks, close the logger and those created by
+// NewLoggerFromConfig so that hopefully the messages get logged, and exit
+// with code
+func (log Logger) exit(code int) {
+	exiting.Lock()
+	exit, hooks := exiting.exit, exiting.hooks
+	exiting.Unlock()
+
+	for _, hook := range hooks {
+		hook()
+	}
+	log.Close()
+	closeIsolated()
+	exit(code)
+}
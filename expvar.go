@@ -0,0 +1,24 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+//go:build !log4go_nohttp
+// +build !log4go_nohttp
+
+package log4go
+
+import (
+	"expvar"
+)
+
+// PublishExpvar publishes the counters of the writers of the global logger as
+// the expvar name, a map by filter tag (see Stats), so that they show up in
+// /debug/vars next to the memory statistics:
+//
+//   log4go.PublishExpvar("log4go")
+//
+// The global logger is read on every request, a reconfiguration is picked up.
+// Like expvar.Publish, it panics if the name is already in use.
+func PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return Stats()
+	}))
+}
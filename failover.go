@@ -0,0 +1,233 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	writerFactories["failover"] = func(excludes []string, props []Property, enabled bool) (LogWriter, bool) {
+		return xmlToFailoverLogWriter(excludes, props, enabled)
+	}
+}
+
+// FailoverRetryInterval specifies how long a FailoverLogWriter writes to the
+// fallback before it tries the primary writer again.
+var FailoverRetryInterval = 30 * time.Second
+
+// The writers which can check whether their destination is reachable
+// implement this, e.g. the socket writer: a FailoverLogWriter probes its
+// primary before going back to it.
+type Prober interface {
+	Probe() error
+}
+
+// This log writer writes the records to a primary writer, e.g. a socket to a
+// collector, and switches to a fallback writer, e.g. a local file, when the
+// primary fails: when the Errors of its stats (see StatsWriter) go up.  Every
+// FailoverRetryInterval it tries the primary again, after probing it if it's a
+// Prober, and goes back to it if it works.  Each switch is logged, at WARNING
+// to the fallback and at INFO to the primary, from the source
+// "log4go/failover".
+//
+// The records the primary took before it failed are its own: the socket writer
+// for instance sends them when the connection comes back.
+type FailoverLogWriter struct {
+	primary, fallback LogWriter
+
+	mu       sync.Mutex
+	retry    time.Duration
+	failed   bool      // Whether the fallback is in use
+	errors   uint64    // The errors of the primary when it was last trusted
+	retryAt  time.Time // When to try the primary again
+	switches uint64
+}
+
+// NewFailoverLogWriter creates a new LogWriter which writes the records to
+// primary, and to fallback while primary fails.  It owns them: closing it
+// closes both.
+func NewFailoverLogWriter(primary, fallback LogWriter) *FailoverLogWriter {
+	return &FailoverLogWriter{
+		primary:  primary,
+		fallback: fallback,
+		retry:    FailoverRetryInterval,
+	}
+}
+
+// Set how long the fallback is written to before the primary is tried again
+// (chainable).
+func (w *FailoverLogWriter) SetRetryInterval(retry time.Duration) *FailoverLogWriter {
+	w.mu.Lock()
+	w.retry = retry
+	w.mu.Unlock()
+	return w
+}
+
+// This is the FailoverLogWriter's output method
+func (w *FailoverLogWriter) LogWrite(rec *LogRecord) {
+	target, transition := w.target()
+	if transition != nil {
+		target.LogWrite(transition)
+	}
+	target.LogWrite(rec)
+}
+
+// Decide which writer gets the next record, and the record announcing a switch
+// if there is one
+func (w *FailoverLogWriter) target() (LogWriter, *LogRecord) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := clockNow()
+	if !w.failed {
+		errors, ok := w.primaryErrors()
+		if !ok || errors <= w.errors {
+			return w.primary, nil
+		}
+		w.failed, w.retryAt = true, now.Add(w.retry)
+		w.switches++
+		msg := fmt.Sprintf("failover: the primary writer is failing (%d errors), switching to the fallback", errors-w.errors)
+		return w.fallback, &LogRecord{Level: WARNING, Created: clockNow(), Source: "log4go/failover", Message: msg}
+	}
+
+	if now.Before(w.retryAt) {
+		return w.fallback, nil
+	}
+	if p, ok := w.primary.(Prober); ok {
+		if err := p.Probe(); err != nil {
+			w.retryAt = now.Add(w.retry)
+			return w.fallback, nil
+		}
+	}
+	w.failed = false
+	w.errors, _ = w.primaryErrors()
+	w.switches++
+	return w.primary, &LogRecord{Level: INFO, Created: clockNow(), Source: "log4go/failover", Message: "failover: switching back to the primary writer"}
+}
+
+// The errors of the primary so far, if it counts them
+func (w *FailoverLogWriter) primaryErrors() (uint64, bool) {
+	sw, ok := w.primary.(StatsWriter)
+	if !ok {
+		return 0, false
+	}
+	return sw.Stats().Errors, true
+}
+
+// Close closes the primary and the fallback writers.
+func (w *FailoverLogWriter) Close() {
+	w.primary.Close()
+	w.fallback.Close()
+}
+
+// Flush flushes the writers which buffer the records, see Flusher.
+func (w *FailoverLogWriter) Flush() {
+	for _, writer := range []LogWriter{w.primary, w.fallback} {
+		if f, ok := writer.(Flusher); ok {
+			f.Flush()
+		}
+	}
+}
+
+// Ready returns a channel closed once the writers which need a warm-up are
+// ready, see ReadyWriter.
+func (w *FailoverLogWriter) Ready() <-chan struct{} {
+	return readyOf([]LogWriter{w.primary, w.fallback})
+}
+
+// Stats returns the sums of the counters of the writers which keep some.
+func (w *FailoverLogWriter) Stats() WriterStats {
+	return NewTeeLogWriter(w.primary, w.fallback).Stats()
+}
+
+// FailedOver returns whether the records go to the fallback, and how many
+// times the writer switched from one to the other.
+func (w *FailoverLogWriter) FailedOver() (failed bool, switches uint64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.failed, w.switches
+}
+
+// Probe checks that the endpoint accepts connections, without touching the
+// connection of the writer.
+func (w *SocketLogWriter) Probe() error {
+	sock, err := net.DialTimeout(w.proto, w.hostport, time.Second)
+	if err != nil {
+		return err
+	}
+	return sock.Close()
+}
+
+// Build the writers of a failover filter from its properties: the primary
+// writer starts at <property name="primary">type</property> and takes the
+// properties up to <property name="fallback">type</property>, which starts the
+// fallback writer, e.g.
+//
+//	<property name="retry">1m</property>
+//	<property name="primary">socket</property>
+//	<property name="endpoint">collector:5140</property>
+//	<property name="fallback">file</property>
+//	<property name="filename">spool.log</property>
+//
+// retry, the interval between the attempts to go back to the primary, comes
+// before the writers.
+func xmlToFailoverLogWriter(excludes []string, props []Property, enabled bool) (*FailoverLogWriter, bool) {
+	retry := FailoverRetryInterval
+	var types [2]string
+	var children [2][]Property
+	child := -1
+
+	// Parse properties
+	for _, prop := range props {
+		switch {
+		case prop.Name == "primary":
+			child = 0
+			types[child] = strings.Trim(prop.Value, " \r\n")
+		case prop.Name == "fallback":
+			child = 1
+			types[child] = strings.Trim(prop.Value, " \r\n")
+		case child >= 0:
+			children[child] = append(children[child], prop)
+		case prop.Name == "retry":
+			d, err := time.ParseDuration(strings.Trim(prop.Value, " \r\n"))
+			if err != nil || d <= 0 {
+				fmt.Fprintf(configOut, "LoadConfiguration: Error: Invalid property \"%s\" for failover filter: %s\n", "retry", prop.Value)
+				return nil, false
+			}
+			retry = d
+		default:
+			fmt.Fprintf(configOut, "LoadConfiguration: Warning: Unknown property \"%s\" for failover filter\n", prop.Name)
+		}
+	}
+
+	// Check properties
+	for i, name := range []string{"primary", "fallback"} {
+		if types[i] == "" {
+			fmt.Fprintf(configOut, "LoadConfiguration: Error: Required property \"%s\" for failover filter\n", name)
+			return nil, false
+		}
+	}
+
+	primary, ok := xmlToChildWriter("failover", "primary", types[0], excludes, children[0], enabled)
+	if !ok {
+		return nil, false
+	}
+	fallback, ok := xmlToChildWriter("failover", "fallback", types[1], excludes, children[1], enabled)
+	if !ok {
+		if enabled {
+			primary.Close()
+		}
+		return nil, false
+	}
+
+	// If it's disabled, we're just checking syntax
+	if !enabled {
+		return nil, true
+	}
+	return NewFailoverLogWriter(primary, fallback).SetRetryInterval(retry), true
+}
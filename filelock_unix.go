@@ -0,0 +1,28 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+//go:build !windows
+// +build !windows
+
+package log4go
+
+import (
+	"os"
+	"syscall"
+)
+
+// Take an exclusive lock on the file name, created if needed, waiting for the
+// other processes to release it.  The lock is released by the returned func.
+func lockFile(name string) (unlock func(), err error) {
+	fd, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0660)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(fd.Fd()), syscall.LOCK_EX); err != nil {
+		fd.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(fd.Fd()), syscall.LOCK_UN)
+		fd.Close()
+	}, nil
+}
@@ -0,0 +1,12 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"errors"
+)
+
+// Shared files can't be rotated on Windows, which doesn't rename open files
+func lockFile(name string) (unlock func(), err error) {
+	return nil, errors.New("shared log files can't be rotated on windows")
+}
@@ -3,23 +3,69 @@
 package log4go
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
 	"github.com/kimiazhu/log4go/support"
+	"io"
 	"os"
+	"sync"
 	"time"
 )
 
+// SharedCheckInterval is how often a FileLogWriter with a shared file checks
+// whether another process rotated it, see SetShared.
+var SharedCheckInterval = time.Second
+
+// FileMode is the default permissions of the files created by the
+// FileLogWriters, see SetFileMode.
+var FileMode os.FileMode = 0660
+
+// FileBatchSize specifies how many of the records queued a FileLogWriter
+// writes to its file at once at most, see SetBatch.
+var FileBatchSize = 64
+
 // This log writer sends output to a file
 type FileLogWriter struct {
-	rec chan *LogRecord
-	rot chan bool
+	rec   chan *LogRecord
+	rot   chan bool
+	flush chan chan struct{}
+	done  chan struct{}
 
-	// The opened file
+	// Guards the settings below and the file, so that the Set* methods can be
+	// called while records are being written
+	mu sync.Mutex
+
+	// The opened file, and the permissions of the new files
 	filename string
 	file     *os.File
-
-	// The logging format
-	format string
+	filemode os.FileMode
+
+	// The buffer of the writes to the file, if any, and how often it's
+	// written out
+	buf           *bufio.Writer
+	flushInterval time.Duration
+
+	// The records queued are written at once, batchSize at most, waiting
+	// batchLatency at most for more: the batch is formatted into batch, unless
+	// there is a buffer
+	batchSize    int
+	batchLatency time.Duration
+	batching     bool
+	batch        bytes.Buffer
+
+	// The logging format, and the time format of %Z, unless there is a layout
+	format     string
+	timeformat string
+	layout     Layout
+	utc        bool
+	fmtbuf     bytes.Buffer
+
+	// The character encoding of the file, UTF-8 if nil, whether the lines end
+	// with CRLF rather than LF, and whether a new file starts with a UTF-8 BOM
+	transcoder Transcoder
+	crlf       bool
+	bom        bool
 
 	// File header/trailer
 	header, trailer string
@@ -40,16 +86,60 @@ type FileLogWriter struct {
 	// Keep old logfiles (.001, .002, etc)
 	rotate    bool
 	maxbackup int
+
+	// Whether other processes append to the file too, and when it was last
+	// checked for a rotation by one of them
+	shared     bool
+	sharedLast time.Time
+
+	// Whether each write to the shared file takes its lock, see
+	// SetLockWrites, and whether this writer holds it (while rotating)
+	lockWrites bool
+	lockHeld   bool
+
+	// The lowest level written plus one while the disk guard drops the
+	// records (see GuardDisk), 0 otherwise.  Accessed atomically.
+	diskMin int32
+
+	// The callbacks of the rotations, see OnRotate, and those still running
+	onRotate []func(oldPath, newPath string)
+	rotating sync.WaitGroup
+
+	writerStats
 }
 
 // This is the FileLogWriter's output method
 func (w *FileLogWriter) LogWrite(rec *LogRecord) {
+	if w.diskDrops(rec) {
+		releaseRecord(rec)
+		w.drop(1)
+		return
+	}
 	w.rec <- rec
 }
 
+func (w *FileLogWriter) releasesRecords() {}
+
+func (w *FileLogWriter) queued() (int, int) {
+	return len(w.rec), cap(w.rec)
+}
+
+// Close writes the records still queued and the buffer, closes the file, and
+// waits for the OnRotate callbacks still running.
 func (w *FileLogWriter) Close() {
 	close(w.rec)
-	w.file.Sync()
+	<-w.done
+	w.rotating.Wait()
+}
+
+// Flush writes the records queued so far and the buffer to the file.
+func (w *FileLogWriter) Flush() {
+	done := make(chan struct{})
+	select {
+	case w.flush <- done:
+		<-done
+	case <-w.done:
+	}
 }
 
 // NewFileLogWriter creates a new LogWriter which writes to the given file and
@@ -65,69 +155,105 @@ func NewFileLogWriter(fname string, rotate, daily bool) *FileLogWriter {
 	w := &FileLogWriter{
 		rec:       make(chan *LogRecord, LogBufferLength),
 		rot:       make(chan bool),
+		flush:     make(chan chan struct{}),
+		done:      make(chan struct{}),
 		filename:  fname,
+		filemode:  FileMode,
+		batchSize: FileBatchSize,
 		format:    "[%D %T] [%L] (%S) %M",
 		rotate:    rotate,
 		daily:     daily,
 		maxbackup: 999,
 	}
 
-	if _, err := os.Lstat(w.filename); err == nil {
-		_, ctime, _, err := support.GetStatTime(w.filename)
+	// Only a regular file can be reused and rotated: the size and line
+	// count of a device or a pipe are meaningless, and reading them may
+	// never end
+	if fi, err := os.Lstat(w.filename); err == nil && fi.Mode().IsRegular() {
+		// The day of the file is that of its last write, so that a file
+		// left from the day before is rotated at startup: the ctime changes
+		// with a chmod or a chown, and is the creation on windows
+		times, err := support.GetFileTimes(w.filename)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, err)
+			ReportError(fmt.Sprintf("FileLogWriter(%q)", w.filename), err)
 			return nil
 		}
-		w.daily_opendaystr = ctime.Format("2006-01-02")
-		w.maxlines_curlines = support.GetLines(w.filename)
-		w.maxsize_cursize = support.GetSize(w.filename)
+		w.daily_opendaystr = times.Modify.Format("2006-01-02")
 	}
 
 	// open the file for the first time
 	if err := w.intRotate(); err != nil {
-		fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, err)
+		ReportError(fmt.Sprintf("FileLogWriter(%q)", w.filename), err)
 		return nil
 	}
 
 	go func() {
 		defer func() {
+			w.mu.Lock()
 			if w.file != nil {
-				fmt.Fprint(w.file, FormatLogRecord(w.trailer, &LogRecord{Created: time.Now()}))
+				w.writeHeadFoot(w.trailer)
+				w.flushBuffer()
+				w.file.Sync()
 				w.file.Close()
 			}
+			w.mu.Unlock()
+			close(w.done)
+		}()
+
+		// The buffer is written out every flushInterval, from the first
+		// record after it's set
+		var ticker *time.Ticker
+		var tick <-chan time.Time
+		every := time.Duration(0)
+		retick := func() {
+			w.mu.Lock()
+			interval := w.flushInterval
+			if w.buf == nil {
+				interval = 0
+			}
+			w.mu.Unlock()
+			if interval == every {
+				return
+			}
+			if ticker != nil {
+				ticker.Stop()
+				ticker, tick = nil, nil
+			}
+			if every = interval; every > 0 {
+				ticker = time.NewTicker(every)
+				tick = ticker.C
+			}
+		}
+		defer func() {
+			if ticker != nil {
+				ticker.Stop()
+			}
 		}()
 
 		for {
 			select {
 			case <-w.rot:
+				w.mu.Lock()
 				if err := w.intRotate(); err != nil {
-					fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, err)
-					return
+					ReportError(fmt.Sprintf("FileLogWriter(%q)", w.filename), err)
+					w.failed()
 				}
+				w.mu.Unlock()
+			case done := <-w.flush:
+				w.mu.Lock()
+				w.flushQueued(done)
+				w.mu.Unlock()
+			case <-tick:
+				w.mu.Lock()
+				w.flushBuffer()
+				w.mu.Unlock()
+				retick()
 			case rec, ok := <-w.rec:
 				if !ok {
 					return
 				}
-				now := time.Now()
-				if (w.maxlines > 0 && w.maxlines_curlines > w.maxlines) ||
-					(w.maxsize > 0 && w.maxsize_cursize > w.maxsize) ||
-					(w.daily && now.Format("2006-01-02") != w.daily_opendaystr) {
-					if err := w.intRotate(); err != nil {
-						fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, err)
-						return
-					}
-				}
-
-				// Perform the write
-				n, err := fmt.Fprint(w.file, FormatLogRecord(w.format, rec))
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, err)
-					return
-				}
-
-				// Update the counts
-				w.maxlines_curlines++
-				w.maxsize_cursize += int64(n)
+				w.writeBatch(rec)
+				retick()
 			}
 		}
 	}()
@@ -135,16 +261,160 @@ func NewFileLogWriter(fname string, rotate, daily bool) *FileLogWriter {
 	return w
 }
 
+// Write a record and the ones queued after it, up to the batch size, in a
+// single write to the file
+func (w *FileLogWriter) writeBatch(rec *LogRecord) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	size, latency := w.batchSize, w.batchLatency
+	w.batching = size > 1
+	w.write(rec)
+
+	// The settings are those at the start of the batch, they may change
+	// while it waits for more records
+	var timer *time.Timer
+batch:
+	for n := 1; n < size; n++ {
+		select {
+		case rec, ok := <-w.rec:
+			if !ok {
+				break batch
+			}
+			w.write(rec)
+			continue
+		default:
+		}
+		if latency <= 0 {
+			break
+		}
+		if timer == nil {
+			timer = time.NewTimer(latency)
+			defer timer.Stop()
+		}
+		w.mu.Unlock()
+		select {
+		case rec, ok := <-w.rec:
+			w.mu.Lock()
+			if !ok {
+				break batch
+			}
+			w.write(rec)
+		case done := <-w.flush:
+			w.mu.Lock()
+			w.flushQueued(done)
+			break batch
+		case <-timer.C:
+			w.mu.Lock()
+			break batch
+		}
+	}
+	w.flushBatch()
+	w.batching = false
+}
+
+// Write the records queued before a call to Flush, then the buffer, and
+// release the caller.  Must be called with w.mu held.
+func (w *FileLogWriter) flushQueued(done chan struct{}) {
+	for n := len(w.rec); n > 0; n-- {
+		rec, ok := <-w.rec
+		if !ok {
+			break
+		}
+		w.write(rec)
+	}
+	w.flushBuffer()
+	close(done)
+}
+
+// Write a record, rotating first if needed, and release it.  Must be called
+// with w.mu held.
+func (w *FileLogWriter) write(rec *LogRecord) {
+	defer releaseRecord(rec)
+	now := clockNow()
+	if w.shared && now.Sub(w.sharedLast) >= SharedCheckInterval {
+		w.sharedLast = now
+		if err := w.followShared(); err != nil {
+			ReportError(fmt.Sprintf("FileLogWriter(%q)", w.filename), err)
+			w.failed()
+		}
+	}
+	if (w.maxlines > 0 && w.maxlines_curlines > w.maxlines) ||
+		(w.maxsize > 0 && w.maxsize_cursize > w.maxsize) ||
+		(w.daily && now.Format("2006-01-02") != w.daily_opendaystr) {
+		if err := w.intRotate(); err != nil {
+			ReportError(fmt.Sprintf("FileLogWriter(%q)", w.filename), err)
+			w.failed()
+		}
+	}
+
+	// Perform the write.  On failure (e.g. disk full) the record is lost,
+	// but keep consuming so that callers never block
+	var out []byte
+	var err error
+	if w.utc {
+		rec = utcRecord(rec)
+	}
+	if w.layout != nil {
+		out = w.layout.Format(rec)
+	} else {
+		// The buffer is reused for all the records, unless one was huge
+		if w.fmtbuf.Cap() > 64<<10 {
+			w.fmtbuf = bytes.Buffer{}
+		}
+		w.fmtbuf.Reset()
+		writeLogRecord(&w.fmtbuf, w.format, w.timeformat, rec)
+		out = w.fmtbuf.Bytes()
+	}
+	if w.crlf {
+		out = toCRLF(out)
+	}
+	if w.transcoder != nil {
+		if out, err = w.transcoder.Transcode(out); err != nil {
+			ReportError(fmt.Sprintf("FileLogWriter(%q)", w.filename), err)
+			w.drop(1)
+			return
+		}
+	}
+	n, err := w.writeOut(out)
+	if err != nil {
+		ReportError(fmt.Sprintf("FileLogWriter(%q)", w.filename), err)
+		w.failed()
+		return
+	}
+
+	// Update the counts
+	w.maxlines_curlines++
+	w.maxsize_cursize += int64(n)
+	w.wrote(1, n)
+}
+
 // Request that the logs rotate
 func (w *FileLogWriter) Rotate() {
 	w.rot <- true
 }
 
-// If this is called in a threaded context, it MUST be synchronized
+// If this is called in a threaded context, it MUST be synchronized (by w.mu)
 func (w *FileLogWriter) intRotate() error {
+	// A shared file is rotated by a single process: the first one to get the
+	// lock, the others only reopen the new file
+	if w.shared && w.file != nil {
+		unlock, err := lockFile(w.filename + ".lock")
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		w.lockHeld = true
+		defer func() { w.lockHeld = false }()
+		if w.replaced() {
+			return w.reopen()
+		}
+	}
+
 	// Close any log file that may be open
+	reopen := w.file != nil
 	if w.file != nil {
-		fmt.Fprint(w.file, FormatLogRecord(w.trailer, &LogRecord{Created: time.Now()}))
+		w.writeHeadFoot(w.trailer)
+		w.flushBuffer()
 		w.file.Close()
 	}
 
@@ -154,7 +424,7 @@ func (w *FileLogWriter) intRotate() error {
 		if err == nil { // file exists
 			num := 1
 			fname := ""
-			todayDate := time.Now().Format("2006-01-02")
+			todayDate := clockNow().Format("2006-01-02")
 			if w.daily && todayDate != w.daily_opendaystr {
 				// another day, rename all old log file
 				for ; err == nil && num <= 999; num++ {
@@ -195,87 +465,453 @@ func (w *FileLogWriter) intRotate() error {
 				if err != nil {
 					return fmt.Errorf("Rotate: %s\n", err)
 				}
+				w.notifyRotate(fname)
 			}
 		}
 	}
 
 	// Open the log file
-	fd, err := os.OpenFile(w.filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0660)
+	fd, err := os.OpenFile(w.filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, w.filemode)
 	if err != nil {
 		return err
 	}
 	w.file = fd
+	if w.buf != nil {
+		w.buf.Reset(w.fileOut())
+	}
+	if reopen {
+		w.rotated()
+	}
 
-	now := time.Now()
-	fmt.Fprint(w.file, FormatLogRecord(w.header, &LogRecord{Created: now}))
+	// What the file already holds when it's reused, e.g. after a restart,
+	// counts towards maxsize and maxlines.  Not after a rotation: a file that
+	// wasn't renamed (no rotate, or a single backup) would be over the limits
+	// again, and rotated at each record
+	var cursize int64
+	var curlines int
+	if fi, err := fd.Stat(); err == nil && fi.Size() > 0 && !reopen {
+		cursize = fi.Size()
+		curlines = support.CountLines(w.filename)
+	}
+
+	now := clockNow()
+	w.writeBOM()
+	w.writeHeadFoot(w.header)
 
 	// Set the daily open date to the current date
 	//	w.daily_opendate = now.Day()
 	w.daily_opendaystr = now.Format("2006-01-02")
 
 	// initialize rotation values
+	w.maxlines_curlines = curlines
+	w.maxsize_cursize = cursize
+
+	return nil
+}
+
+// Run the OnRotate callbacks for the file renamed to newPath, in the order
+// they were added, on a goroutine of their own.  Must be called with w.mu held.
+func (w *FileLogWriter) notifyRotate(newPath string) {
+	if len(w.onRotate) == 0 {
+		return
+	}
+	oldPath, callbacks := w.filename, w.onRotate
+	w.rotating.Add(1)
+	go func() {
+		defer w.rotating.Done()
+		for _, fn := range callbacks {
+			fn(oldPath, newPath)
+		}
+	}()
+}
+
+// Whether the file at w.filename is no longer the opened one, i.e. another
+// process rotated it.  Must be called with w.mu held.
+func (w *FileLogWriter) replaced() bool {
+	fi, err := os.Stat(w.filename)
+	if err != nil {
+		return true
+	}
+	opened, err := w.file.Stat()
+	return err != nil || !os.SameFile(fi, opened)
+}
+
+// Open the file another process rotated, and take its size.  Must be called
+// with w.mu held.
+func (w *FileLogWriter) reopen() error {
+	w.flushBuffer()
+	w.file.Close()
+	fd, err := os.OpenFile(w.filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, w.filemode)
+	if err != nil {
+		w.file = nil
+		return err
+	}
+	w.file = fd
+	if w.buf != nil {
+		w.buf.Reset(w.fileOut())
+	}
+	w.daily_opendaystr = clockNow().Format("2006-01-02")
 	w.maxlines_curlines = 0
 	w.maxsize_cursize = 0
+	if fi, err := fd.Stat(); err == nil {
+		w.maxsize_cursize = fi.Size()
+	}
+	return nil
+}
 
+// Follow a shared file: reopen it if another process rotated it, otherwise
+// take its size, which the other processes grow too.  Must be called with w.mu
+// held.
+func (w *FileLogWriter) followShared() error {
+	if w.replaced() {
+		return w.reopen()
+	}
+	w.flushBuffer()
+	if fi, err := w.file.Stat(); err == nil {
+		w.maxsize_cursize = fi.Size()
+	}
 	return nil
 }
 
-// Set the logging format (chainable).  Must be called before the first log
-// message is written.
+// The record the header and the trailer are formatted from.  Must be called
+// with w.mu held.
+func (w *FileLogWriter) headFootRecord() *LogRecord {
+	now := clockNow()
+	if w.utc {
+		now = now.UTC()
+	}
+	return &LogRecord{Created: now}
+}
+
+// Write the header or the trailer.  Must be called with w.mu held.
+func (w *FileLogWriter) writeHeadFoot(format string) {
+	out := []byte(FormatLogRecord(format, w.headFootRecord()))
+	if w.crlf {
+		out = toCRLF(out)
+	}
+	w.writeOut(out)
+}
+
+// The UTF-8 byte order mark
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// Start the file with a BOM if it's wanted and the file is still empty.  Must
+// be called with w.mu held.
+func (w *FileLogWriter) writeBOM() {
+	if !w.bom || w.transcoder != nil {
+		return
+	}
+	w.flushBuffer()
+	if fi, err := w.file.Stat(); err != nil || fi.Size() != 0 {
+		return
+	}
+	w.output().Write(utf8BOM)
+}
+
+// Write out to the file, through the buffer or the batch if any.  With
+// SetLockWrites, the buffer is written out first if out doesn't fit in, so that
+// each write to the file holds whole records.  Must be called with w.mu held.
+func (w *FileLogWriter) writeOut(out []byte) (int, error) {
+	if w.lockWrites && w.buf != nil && w.buf.Buffered() > 0 && len(out) > w.buf.Available() {
+		w.flushBuffer()
+	}
+	return w.output().Write(out)
+}
+
+// The file, or with SetLockWrites a writer taking the lock of the shared file
+// for each write.  Must be called with w.mu held.
+func (w *FileLogWriter) fileOut() io.Writer {
+	if w.lockWrites {
+		return lockedFile{w}
+	}
+	return w.file
+}
+
+// Writes to the file of a FileLogWriter under the lock of the shared file, the
+// one of the rotations, unless the writer holds it already.  Used with w.mu
+// held.
+type lockedFile struct {
+	w *FileLogWriter
+}
+
+func (f lockedFile) Write(p []byte) (int, error) {
+	if !f.w.lockHeld {
+		unlock, err := lockFile(f.w.filename + ".lock")
+		if err != nil {
+			return 0, err
+		}
+		defer unlock()
+	}
+	return f.w.file.Write(p)
+}
+
+// Where to write: the buffer if there is one, otherwise the file.  Must be
+// called with w.mu held.
+func (w *FileLogWriter) output() io.Writer {
+	if w.buf != nil {
+		return w.buf
+	}
+	if w.batching {
+		return &w.batch
+	}
+	return w.fileOut()
+}
+
+// Write the batch out to the file.  On failure, its content is lost.  Must be
+// called with w.mu held.
+func (w *FileLogWriter) flushBatch() {
+	if w.batch.Len() == 0 {
+		return
+	}
+	if _, err := w.fileOut().Write(w.batch.Bytes()); err != nil {
+		ReportError(fmt.Sprintf("FileLogWriter(%q)", w.filename), err)
+		w.failed()
+	}
+
+	// The batch is reused, unless it was huge
+	if w.batch.Cap() > 1<<20 {
+		w.batch = bytes.Buffer{}
+	}
+	w.batch.Reset()
+}
+
+// Write the batch and the buffer out to the file.  On failure, their content is
+// lost.  Must be called with w.mu held.
+func (w *FileLogWriter) flushBuffer() {
+	w.flushBatch()
+	if w.buf == nil || w.buf.Buffered() == 0 {
+		return
+	}
+	if err := w.buf.Flush(); err != nil {
+		ReportError(fmt.Sprintf("FileLogWriter(%q)", w.filename), err)
+		w.failed()
+		w.buf.Reset(w.fileOut())
+	}
+}
+
+// Convert the line endings to CRLF, leaving those which already are alone
+func toCRLF(b []byte) []byte {
+	if bytes.IndexByte(b, '\n') < 0 {
+		return b
+	}
+	b = bytes.Replace(b, []byte("\r\n"), []byte("\n"), -1)
+	return bytes.Replace(b, []byte("\n"), []byte("\r\n"), -1)
+}
+
+// The Set* methods of a FileLogWriter can be called at any time, e.g. on a
+// configuration reload: the new settings apply from the next record.
+
+// Set the logging format (chainable).
 func (w *FileLogWriter) SetFormat(format string) *FileLogWriter {
+	w.mu.Lock()
 	w.format = format
+	w.mu.Unlock()
+	return w
+}
+
+// Set the time format of %Z, a preset name or a layout (see FormatTime)
+// (chainable).
+func (w *FileLogWriter) SetTimeFormat(timeformat string) *FileLogWriter {
+	w.mu.Lock()
+	w.timeformat = timeformat
+	w.mu.Unlock()
+	return w
+}
+
+// Set the layout of the records, which replaces the format (chainable).
+func (w *FileLogWriter) SetLayout(layout Layout) *FileLogWriter {
+	w.mu.Lock()
+	w.layout = layout
+	w.mu.Unlock()
+	return w
+}
+
+// Set the character encoding of the records, UTF-8 if nil (chainable).  The
+// header and the trailer aren't converted.
+func (w *FileLogWriter) SetTranscoder(t Transcoder) *FileLogWriter {
+	w.mu.Lock()
+	w.transcoder = t
+	w.mu.Unlock()
+	return w
+}
+
+// Print the times in UTC rather than in the local time zone (chainable).
+func (w *FileLogWriter) SetUTC(utc bool) *FileLogWriter {
+	w.mu.Lock()
+	w.utc = utc
+	w.mu.Unlock()
 	return w
 }
 
-// Set the logfile header and footer (chainable).  Must be called before the first log
-// message is written.  These are formatted similar to the FormatLogRecord (e.g.
-// you can use %D and %T in your header/footer for date and time).
+// Set the logfile header and footer (chainable).  The header is written right
+// away if nothing was written to the file yet, otherwise from the next file.
+// These are formatted similar to the FormatLogRecord (e.g. you can use %D and
+// %T in your header/footer for date and time).
 func (w *FileLogWriter) SetHeadFoot(head, foot string) *FileLogWriter {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 	w.header, w.trailer = head, foot
 	if w.maxlines_curlines == 0 {
-		fmt.Fprint(w.file, FormatLogRecord(w.header, &LogRecord{Created: time.Now()}))
+		w.writeHeadFoot(w.header)
 	}
 	return w
 }
 
-// Set rotate at linecount (chainable). Must be called before the first log
-// message is written.
+// End the lines with CRLF rather than LF (chainable), for the tools which
+// misread LF-only files.  This applies to the records, the header and the
+// trailer.
+func (w *FileLogWriter) SetCRLF(crlf bool) *FileLogWriter {
+	w.mu.Lock()
+	w.crlf = crlf
+	w.mu.Unlock()
+	return w
+}
+
+// Start the new files with a UTF-8 byte order mark (chainable).  It's written
+// right away if the file is still empty, so call it before SetHeadFoot.  There
+// is no BOM with a transcoder: the file isn't UTF-8.
+func (w *FileLogWriter) SetBOM(bom bool) *FileLogWriter {
+	w.mu.Lock()
+	w.bom = bom
+	w.writeBOM()
+	w.mu.Unlock()
+	return w
+}
+
+// Set rotate at linecount (chainable).
 func (w *FileLogWriter) SetRotateLines(maxlines int) *FileLogWriter {
 	//fmt.Fprintf(os.Stderr, "FileLogWriter.SetRotateLines: %v\n", maxlines)
+	w.mu.Lock()
 	w.maxlines = maxlines
+	w.mu.Unlock()
 	return w
 }
 
-// Set rotate at size (chainable). Must be called before the first log message
-// is written.
+// Set rotate at size (chainable).
 func (w *FileLogWriter) SetRotateSize(maxsize int64) *FileLogWriter {
 	//fmt.Fprintf(os.Stderr, "FileLogWriter.SetRotateSize: %v\n", maxsize)
+	w.mu.Lock()
 	w.maxsize = maxsize
+	w.mu.Unlock()
 	return w
 }
 
-// Set rotate daily (chainable). Must be called before the first log message is
-// written.
+// Set rotate daily (chainable).
 func (w *FileLogWriter) SetRotateDaily(daily bool) *FileLogWriter {
 	//fmt.Fprintf(os.Stderr, "FileLogWriter.SetRotateDaily: %v\n", daily)
+	w.mu.Lock()
 	w.daily = daily
+	w.mu.Unlock()
 	return w
 }
 
-// Set max backup files. Must be called before the first log message
-// is written.
+// Set max backup files (chainable).
 func (w *FileLogWriter) SetRotateMaxBackup(maxbackup int) *FileLogWriter {
+	w.mu.Lock()
 	w.maxbackup = maxbackup
+	w.mu.Unlock()
+	return w
+}
+
+// Share the file with other processes appending to it (chainable), e.g. the
+// workers of a server.  They rotate it exactly once: the first process to take
+// a lock on the file name plus ".lock" rotates the file, the others only
+// reopen the new one, as they also do within SharedCheckInterval when they
+// notice the rotation.  The rotation by size is on the size of the file, the
+// one by lines on the records of the process.  Not supported on Windows.
+func (w *FileLogWriter) SetShared(shared bool) *FileLogWriter {
+	w.mu.Lock()
+	w.shared = shared
+	w.mu.Unlock()
+	return w
+}
+
+// Lock the shared file for each write (chainable), with the lock of its
+// rotations, so that the writes of the processes sharing it never interleave,
+// even on the file systems where appends aren't atomic, and never land in a
+// file being rotated.  A buffer is written out at the boundaries of the
+// records.  It makes the file shared (see SetShared) and costs a lock per
+// write, or per flush of the buffer or the batch.  Not supported on Windows.
+func (w *FileLogWriter) SetLockWrites(lock bool) *FileLogWriter {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.flushBuffer()
+	w.lockWrites = lock
+	if lock {
+		w.shared = true
+	}
+	if w.buf != nil {
+		w.buf.Reset(w.fileOut())
+	}
+	return w
+}
+
+// Set the permissions of the files (chainable), e.g. 0600 to keep them from
+// the group.  The opened file is changed right away, the files opened by the
+// rotations are created with them.  The umask still applies to the new files.
+func (w *FileLogWriter) SetFileMode(mode os.FileMode) *FileLogWriter {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.filemode = mode.Perm()
+	if w.file != nil {
+		if err := w.file.Chmod(w.filemode); err != nil {
+			ReportError(fmt.Sprintf("FileLogWriter(%q)", w.filename), err)
+		}
+	}
+	return w
+}
+
+// Buffer the writes to the file, up to size bytes, and write the buffer out at
+// least every interval (chainable): at a high volume of records, a write per
+// record is the main cost of the writer.  The buffer is also written out when
+// it's full, on a rotation, Flush and Close; the records in it are lost if the
+// program crashes.  A size of 0 writes each record right away, the default;
+// an interval of 0 only writes the buffer out on the events above.
+func (w *FileLogWriter) SetBuffer(size int, interval time.Duration) *FileLogWriter {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.flushBuffer()
+	w.buf = nil
+	if size > 0 && w.file != nil {
+		w.buf = bufio.NewWriterSize(w.fileOut(), size)
+	}
+	w.flushInterval = interval
 	return w
 }
 
-// SetRotate changes whether or not the old logs are kept. (chainable) Must be
-// called before the first log message is written.  If rotate is false, the
-// files are overwritten; otherwise, they are rotated to another file before the
-// new log is opened.
+// Set how many of the records queued are written at once at most, and how long
+// to wait for more records to write them with, 0 not to wait (chainable).  A
+// size of 1 writes every record on its own.  The records of a batch are lost
+// if the program crashes meanwhile.  By default the records already queued are
+// written together, up to FileBatchSize, without waiting.
+func (w *FileLogWriter) SetBatch(size int, latency time.Duration) *FileLogWriter {
+	w.mu.Lock()
+	w.batchSize, w.batchLatency = size, latency
+	w.mu.Unlock()
+	return w
+}
+
+// SetRotate changes whether or not the old logs are kept. (chainable) If
+// rotate is false, the files are overwritten; otherwise, they are rotated to
+// another file before the new log is opened.
 func (w *FileLogWriter) SetRotate(rotate bool) *FileLogWriter {
 	//fmt.Fprintf(os.Stderr, "FileLogWriter.SetRotate: %v\n", rotate)
+	w.mu.Lock()
 	w.rotate = rotate
+	w.mu.Unlock()
+	return w
+}
+
+// OnRotate adds a function called each time the log file is rotated, with its
+// path and the one it was renamed to, e.g. to compress or upload the rotated
+// file right away (chainable).  The callbacks run on a goroutine of their own,
+// so they don't hold up the writes and may call the methods of the writer;
+// Close waits for them.  Only the rotations of this
+// writer are reported, not those of the other processes of a shared file.
+func (w *FileLogWriter) OnRotate(fn func(oldPath, newPath string)) *FileLogWriter {
+	w.mu.Lock()
+	w.onRotate = append(w.onRotate, fn)
+	w.mu.Unlock()
 	return w
 }
 
@@ -289,3 +925,17 @@ func NewXMLLogWriter(fname string, rotate, daily bool) *FileLogWriter {
 		<message>%M</message>
 	</record>`).SetHeadFoot("<log created=\"%D %T\">", "</log>")
 }
+
+// NewAccessLogWriter creates a FileLogWriter for an access log, e.g. the
+// filter of AddAccessFilter: format is common or combined (see AccessLayout),
+// json (see JSONLayout), or else a pattern such as FORMAT_DEFAULT.
+func NewAccessLogWriter(fname, format string) *FileLogWriter {
+	w := NewFileLogWriter(fname, false, false)
+	if w == nil {
+		return nil
+	}
+	if layout := namedLayout(format, ""); layout != nil {
+		return w.SetLayout(layout)
+	}
+	return w.SetFormat(format)
+}
@@ -0,0 +1,349 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+//go:build !log4go_nogelf
+// +build !log4go_nogelf
+
+package log4go
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+func init() {
+	writerFactories["gelf"] = func(excludes []string, props []Property, enabled bool) (LogWriter, bool) {
+		return xmlToGELFLogWriter(excludes, props, enabled)
+	}
+}
+
+// GELF chunking constants, see http://docs.graylog.org/en/latest/pages/gelf.html
+const (
+	gelfChunkMagic0     = 0x1e
+	gelfChunkMagic1     = 0x0f
+	gelfChunkHeader     = 12
+	gelfMaxChunks       = 128
+	GELFChunkSizeWAN    = 1420
+	GELFChunkSizeLAN    = 8154
+	gelfDefaultFacility = "log4go"
+)
+
+// This log writer sends the records to a Graylog server in the GELF format,
+// over UDP (chunked and optionally gzipped) or TCP (null byte delimited).
+type GELFLogWriter struct {
+	rec  chan *LogRecord
+	done chan struct{}
+
+	proto, hostport string
+	conn            net.Conn
+	ready           *readiness
+
+	host      string
+	compress  bool
+	chunksize int
+
+	writerStats
+}
+
+// NewGELFLogWriter creates a new LogWriter which sends the records to a GELF
+// input on the given endpoint, proto being "udp" or "tcp".  The host field of
+// the messages is the hostname of the current identity (see
+// SetIdentityProvider) unless set with SetHost; UDP messages are not compressed
+// and are chunked for WAN links by default, see the Set* methods.
+func NewGELFLogWriter(proto, hostport string) *GELFLogWriter {
+	w := &GELFLogWriter{
+		rec:       make(chan *LogRecord, LogBufferLength),
+		done:      make(chan struct{}),
+		proto:     proto,
+		hostport:  hostport,
+		ready:     newReadiness(),
+		chunksize: GELFChunkSizeWAN,
+	}
+	go w.run()
+	return w
+}
+
+// This is the GELFLogWriter's output method.  This will block if the output
+// buffer is full.
+func (w *GELFLogWriter) LogWrite(rec *LogRecord) {
+	w.rec <- rec
+}
+
+func (w *GELFLogWriter) queued() (int, int) {
+	return len(w.rec), cap(w.rec)
+}
+
+// Ready returns a channel closed once the writer has connected, or after
+// WarmupTimeout.  The records are held back until then.
+func (w *GELFLogWriter) Ready() <-chan struct{} {
+	return w.ready.ch
+}
+
+// Close sends the queued records and closes the connection.
+func (w *GELFLogWriter) Close() {
+	close(w.rec)
+	<-w.done
+}
+
+func (w *GELFLogWriter) run() {
+	defer func() {
+		if w.conn != nil {
+			w.conn.Close()
+		}
+		close(w.done)
+	}()
+
+	for _, rec := range w.warmup() {
+		w.write(rec)
+	}
+	for rec := range w.rec {
+		w.write(rec)
+	}
+}
+
+// Connect for the first time, holding the records back meanwhile rather than
+// dropping them, until the writer is ready.  Returns the records held back.
+func (w *GELFLogWriter) warmup() (held []*LogRecord) {
+	retry := time.NewTimer(0)
+	defer retry.Stop()
+	for !w.ready.done() {
+		select {
+		case <-retry.C:
+			conn, err := net.DialTimeout(w.proto, w.hostport, WarmupTimeout)
+			if err == nil {
+				w.conn = conn
+				w.ready.mark()
+				break
+			}
+			retry.Reset(SocketMinBackoff)
+		case rec, ok := <-w.rec:
+			if !ok {
+				return held
+			}
+			if len(held) >= SocketMaxBuffered {
+				held[0] = nil
+				held = held[1:]
+				w.drop(1)
+			}
+			held = append(held, rec)
+		case <-w.ready.ch:
+		}
+	}
+	return held
+}
+
+func (w *GELFLogWriter) write(rec *LogRecord) {
+	if err := w.send(rec); err != nil {
+		ReportError(fmt.Sprintf("GELFLogWriter(%q)", w.hostport), err)
+		w.failed()
+	}
+}
+
+// Send a record, (re)connecting if needed
+func (w *GELFLogWriter) send(rec *LogRecord) error {
+	msg, err := json.Marshal(w.message(rec))
+	if err != nil {
+		return err
+	}
+
+	if w.conn == nil {
+		if w.conn, err = net.Dial(w.proto, w.hostport); err != nil {
+			w.conn = nil
+			return err
+		}
+	}
+
+	if w.proto == "udp" {
+		err = w.sendUDP(msg)
+	} else {
+		_, err = w.conn.Write(append(msg, 0))
+	}
+	if err != nil {
+		w.conn.Close()
+		w.conn = nil
+		return err
+	}
+	w.wrote(1, len(msg))
+	return nil
+}
+
+func (w *GELFLogWriter) sendUDP(msg []byte) error {
+	if w.compress {
+		buf := new(bytes.Buffer)
+		zw := gzip.NewWriter(buf)
+		zw.Write(msg)
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		msg = buf.Bytes()
+	}
+
+	if len(msg) <= w.chunksize {
+		_, err := w.conn.Write(msg)
+		return err
+	}
+
+	size := w.chunksize - gelfChunkHeader
+	count := (len(msg) + size - 1) / size
+	if count > gelfMaxChunks {
+		return fmt.Errorf("message of %d bytes needs more than %d chunks", len(msg), gelfMaxChunks)
+	}
+
+	chunk := make([]byte, gelfChunkHeader, w.chunksize)
+	chunk[0], chunk[1] = gelfChunkMagic0, gelfChunkMagic1
+	if _, err := rand.Read(chunk[2:10]); err != nil {
+		return err
+	}
+	chunk[11] = byte(count)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * size
+		if end > len(msg) {
+			end = len(msg)
+		}
+		chunk[10] = byte(i)
+		if _, err := w.conn.Write(append(chunk[:gelfChunkHeader], msg[i*size:end]...)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Map a record to a GELF 1.1 message
+func (w *GELFLogWriter) message(rec *LogRecord) map[string]interface{} {
+	short := rec.Message
+	if i := strings.IndexByte(short, '\n'); i >= 0 {
+		short = short[:i]
+	}
+
+	host := w.host
+	if host == "" {
+		host = CurrentIdentity().Hostname
+	}
+
+	msg := map[string]interface{}{
+		"version":       "1.1",
+		"host":          host,
+		"short_message": short,
+		"timestamp":     float64(rec.Created.UnixNano()/1e6) / 1e3,
+		"level":         gelfLevel(rec.Level),
+		"_facility":     gelfDefaultFacility,
+		"_level_name":   rec.Level.String(),
+		"_source":       rec.Source,
+	}
+	if short != rec.Message {
+		msg["full_message"] = rec.Message
+	}
+	for _, field := range rec.Fields {
+		key := "_" + field.Key
+		if key == "_id" {
+			// reserved by GELF
+			key = "_id_"
+		}
+		if _, ok := msg[key]; !ok {
+			msg[key] = field.Value
+		}
+	}
+	return msg
+}
+
+// Map a log level to a syslog severity
+func gelfLevel(lvl Level) int {
+	switch {
+	case lvl >= CRITICAL:
+		return 2
+	case lvl == ERROR:
+		return 3
+	case lvl == WARNING:
+		return 4
+	case lvl == INFO, lvl == ACCESS:
+		return 6
+	default:
+		return 7
+	}
+}
+
+// Set the host field of the messages (chainable).  Must be called before the
+// first log message is written.
+func (w *GELFLogWriter) SetHost(host string) *GELFLogWriter {
+	w.host = host
+	return w
+}
+
+// Gzip the UDP messages (chainable).  Must be called before the first log
+// message is written.
+func (w *GELFLogWriter) SetCompress(compress bool) *GELFLogWriter {
+	w.compress = compress
+	return w
+}
+
+// Set the maximum size of the UDP datagrams (chainable), larger messages are
+// chunked.  Use GELFChunkSizeLAN on local networks.  Must be called before the
+// first log message is written.
+func (w *GELFLogWriter) SetChunkSize(chunksize int) *GELFLogWriter {
+	if chunksize <= gelfChunkHeader {
+		chunksize = GELFChunkSizeWAN
+	}
+	w.chunksize = chunksize
+	return w
+}
+
+func xmlToGELFLogWriter(exclude []string, props []Property, enabled bool) (*GELFLogWriter, bool) {
+	endpoint := ""
+	protocol := "udp"
+	host := ""
+	compress := false
+	chunksize := GELFChunkSizeWAN
+
+	// Parse properties
+	for _, prop := range props {
+		value := strings.Trim(prop.Value, " \r\n")
+		switch prop.Name {
+		case "endpoint":
+			endpoint = value
+		case "protocol":
+			protocol = value
+			if protocol != "udp" && protocol != "tcp" {
+				fmt.Fprintf(configOut, "LoadConfiguration: Error: Unknown protocol \"%s\" for gelf filter, expect udp or tcp\n", protocol)
+				return nil, false
+			}
+		case "host":
+			host = value
+		case "compress":
+			compress = value != "false"
+		case "chunksize":
+			chunksize = strToNumSuffix(value, 1024)
+		default:
+			fmt.Fprintf(configOut, "LoadConfiguration: Warning: Unknown property \"%s\" for gelf filter\n", prop.Name)
+		}
+	}
+
+	// Check properties
+	if len(endpoint) == 0 {
+		fmt.Fprintf(configOut, "LoadConfiguration: Error: Required property \"%s\" for gelf filter\n", "endpoint")
+		return nil, false
+	}
+
+	// If it's disabled, we're just checking syntax
+	if !enabled {
+		return nil, true
+	}
+
+	glw := NewGELFLogWriter(protocol, endpoint).SetCompress(compress).SetChunkSize(chunksize)
+	if host != "" {
+		glw.SetHost(host)
+	}
+	return glw, true
+}
+
+// HealthCheck checks that the GELF input accepts connections.
+func (w *GELFLogWriter) HealthCheck() error {
+	if writerDone(w.done) {
+		return errWriterClosed
+	}
+	return checkDial(w.proto, w.hostport)
+}
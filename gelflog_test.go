@@ -0,0 +1,119 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+//go:build !log4go_nogelf
+// +build !log4go_nogelf
+
+package log4go
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGELFLogWriter(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	w := NewGELFLogWriter("udp", conn.LocalAddr().String()).SetHost("test").SetCompress(true).SetChunkSize(100)
+	defer w.Close()
+
+	rec := newLogRecord(ERROR, "source", "short\n"+strings.Repeat("full message ", 50))
+	rec.Fields = []Field{F("id", 7), F("user", "bob")}
+	w.LogWrite(rec)
+
+	// Reassemble the chunks
+	var chunks [][]byte
+	buf := make([]byte, 1024)
+	for count := -1; count != len(chunks); {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("read: %s", err)
+		}
+		if buf[0] != gelfChunkMagic0 || buf[1] != gelfChunkMagic1 {
+			t.Fatalf("GELFLogWriter: expected a chunked message, got %q", buf[:n])
+		}
+		if count < 0 {
+			count = int(buf[11])
+			chunks = make([][]byte, 0, count)
+		}
+		chunks = append(chunks, append([]byte(nil), buf[gelfChunkHeader:n]...))
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(bytes.Join(chunks, nil)))
+	if err != nil {
+		t.Fatalf("gzip: %s", err)
+	}
+	var msg map[string]interface{}
+	if err := json.NewDecoder(zr).Decode(&msg); err != nil {
+		t.Fatalf("decode: %s", err)
+	}
+
+	for key, want := range map[string]interface{}{
+		"version":       "1.1",
+		"host":          "test",
+		"short_message": "short",
+		"full_message":  rec.Message,
+		"level":         float64(3),
+		"_source":       "source",
+		"_id_":          float64(7),
+		"_user":         "bob",
+	} {
+		if msg[key] != want {
+			t.Errorf("GELFLogWriter: %s got %v, want %v", key, msg[key], want)
+		}
+	}
+}
+
+func TestGELFWarmup(t *testing.T) {
+	defer func(backoff time.Duration) { SocketMinBackoff = backoff }(SocketMinBackoff)
+	SocketMinBackoff = 10 * time.Millisecond
+
+	// Nothing listens yet on the address
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	w := NewGELFLogWriter("tcp", addr)
+	defer w.Close()
+	log := NewLogger().SetFilter("gelf", &Filter{Level: INFO, LogWriter: w})
+	log.Info("early")
+	select {
+	case <-log.Ready():
+		t.Fatalf("Ready: ready before the first connection")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if ln, err = net.Listen("tcp", addr); err != nil {
+		t.Skipf("listen again on %s: %s", addr, err)
+	}
+	defer ln.Close()
+	select {
+	case <-log.Ready():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Ready: not ready after the connection")
+	}
+
+	// The record logged before is held back, not dropped
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("accept: %s", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	if err != nil || !bytes.Contains(buf[:n], []byte(`"short_message":"early"`)) {
+		t.Errorf("GELFLogWriter: received %q, %v, want the early record", buf[:n], err)
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+// Package grpclog4go logs the gRPC calls through log4go, with interceptors
+// for the servers and the clients:
+//
+//	i := grpclog4go.New(nil)
+//	s := grpc.NewServer(
+//		grpc.UnaryInterceptor(i.UnaryServer()),
+//		grpc.StreamInterceptor(i.StreamServer()))
+//	conn, err := grpc.NewClient(target,
+//		grpc.WithUnaryInterceptor(i.UnaryClient()),
+//		grpc.WithStreamInterceptor(i.StreamClient()))
+//
+// Each call is logged once it's finished, with the message
+// "grpc server /pkg.Service/Method OK" and the fields grpc_kind (server or
+// client), grpc_type (unary or stream), grpc_method, peer, grpc_code,
+// duration_ms and error.  The level depends on the status code, see
+// DefaultLevel.  NewLoggerV2 makes the logs of gRPC itself go to log4go too:
+//
+//	grpclog.SetLoggerV2(grpclog4go.NewLoggerV2(nil, 0))
+package grpclog4go
+
+import (
+	"context"
+	"fmt"
+	log "github.com/kimiazhu/log4go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"io"
+	"sync"
+	"time"
+)
+
+// DefaultLevel is the level of the calls finished with code: INFO for OK,
+// WARNING for the errors of the caller (e.g. InvalidArgument, NotFound,
+// PermissionDenied, Canceled) and ERROR for the others, those of the server
+// (e.g. Internal, Unavailable, DeadlineExceeded).
+func DefaultLevel(code codes.Code) log.Level {
+	switch code {
+	case codes.OK:
+		return log.INFO
+	case codes.Canceled, codes.InvalidArgument, codes.NotFound, codes.AlreadyExists,
+		codes.PermissionDenied, codes.Unauthenticated, codes.ResourceExhausted,
+		codes.FailedPrecondition, codes.Aborted, codes.OutOfRange:
+		return log.WARNING
+	}
+	return log.ERROR
+}
+
+// An Interceptor logs the gRPC calls to a logger, at the level of their
+// status code.
+type Interceptor struct {
+	logger *log.Logger
+	level  func(code codes.Code) log.Level
+}
+
+// New creates an Interceptor logging to logger, or to the global logger if
+// it's nil, at the levels of DefaultLevel.
+func New(logger *log.Logger) *Interceptor {
+	return &Interceptor{logger: logger, level: DefaultLevel}
+}
+
+// Set the level of the calls by status code (chainable).  Must be called
+// before the interceptors are used.
+func (i *Interceptor) SetLevel(level func(code codes.Code) log.Level) *Interceptor {
+	i.level = level
+	return i
+}
+
+// UnaryServer returns the interceptor of the unary calls of a server.
+func (i *Interceptor) UnaryServer() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		i.logCall("server", "unary", info.FullMethod, peerAddr(ctx), start, err)
+		return resp, err
+	}
+}
+
+// StreamServer returns the interceptor of the streaming calls of a server.
+func (i *Interceptor) StreamServer() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		i.logCall("server", "stream", info.FullMethod, peerAddr(ss.Context()), start, err)
+		return err
+	}
+}
+
+// UnaryClient returns the interceptor of the unary calls of a client.
+func (i *Interceptor) UnaryClient() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		i.logCall("client", "unary", method, cc.Target(), start, err)
+		return err
+	}
+}
+
+// StreamClient returns the interceptor of the streaming calls of a client.  A
+// stream is logged once it's finished: when it fails to open, or when a
+// receive returns io.EOF or an error.
+func (i *Interceptor) StreamClient() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		start := time.Now()
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			i.logCall("client", "stream", method, cc.Target(), start, err)
+			return nil, err
+		}
+		return &clientStream{ClientStream: cs, done: func(err error) {
+			i.logCall("client", "stream", method, cc.Target(), start, err)
+		}}, nil
+	}
+}
+
+// Log a finished call
+func (i *Interceptor) logCall(kind, typ, method, peer string, start time.Time, err error) {
+	code := status.Code(err)
+	logger := log.Global
+	if i.logger != nil {
+		logger = *i.logger
+	}
+	logger.LogcFields(i.level(code), func() (string, []log.Field) {
+		fields := []log.Field{
+			{Key: "grpc_kind", Value: kind},
+			{Key: "grpc_type", Value: typ},
+			{Key: "grpc_method", Value: method},
+			{Key: "peer", Value: peer},
+			{Key: "grpc_code", Value: code.String()},
+			{Key: "duration_ms", Value: float64(time.Since(start).Microseconds()) / 1000},
+		}
+		if err != nil {
+			fields = append(fields, log.Field{Key: "error", Value: status.Convert(err).Message()})
+		}
+		return fmt.Sprintf("grpc %s %s %s", kind, method, code), fields
+	})
+}
+
+// The address of the peer of a call, "" if unknown
+func peerAddr(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return p.Addr.String()
+	}
+	return ""
+}
+
+// A stream of a client, which reports when it's finished
+type clientStream struct {
+	grpc.ClientStream
+	once sync.Once
+	done func(err error)
+}
+
+func (s *clientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil {
+		s.once.Do(func() {
+			if err == io.EOF {
+				s.done(nil)
+			} else {
+				s.done(err)
+			}
+		})
+	}
+	return err
+}
@@ -0,0 +1,89 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package grpclog4go
+
+import (
+	"context"
+	log "github.com/kimiazhu/log4go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/grpclog"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"strings"
+	"testing"
+)
+
+var _ grpclog.LoggerV2 = (*LoggerV2)(nil)
+
+func TestInterceptors(t *testing.T) {
+	mlw := log.NewMemoryLogWriter(10)
+	logger := log.NewLogger().AddFilter("memory", log.INFO, mlw)
+	i := New(&logger)
+
+	lis := bufconn.Listen(1 << 16)
+	s := grpc.NewServer(grpc.UnaryInterceptor(i.UnaryServer()), grpc.StreamInterceptor(i.StreamServer()))
+	healthpb.RegisterHealthServer(s, health.NewServer())
+	go s.Serve(lis)
+	defer s.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(i.UnaryClient()))
+	if err != nil {
+		t.Fatalf("NewClient: %s", err)
+	}
+	defer conn.Close()
+
+	client := healthpb.NewHealthClient(conn)
+	client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "missing"})
+
+	var got []string
+	for _, rec := range mlw.Records() {
+		got = append(got, rec.Level.String()+" "+rec.Message)
+	}
+	want := []string{
+		"INFO grpc server /grpc.health.v1.Health/Check OK",
+		"INFO grpc client /grpc.health.v1.Health/Check OK",
+		"WARN grpc server /grpc.health.v1.Health/Check NotFound",
+		"WARN grpc client /grpc.health.v1.Health/Check NotFound",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Interceptors: got records\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if recs := mlw.Records(); len(recs) == 4 {
+		fields := make(map[string]interface{})
+		for _, f := range recs[2].Fields {
+			fields[f.Key] = f.Value
+		}
+		if fields["grpc_type"] != "unary" || fields["peer"] == "" || fields["error"] != "unknown service" {
+			t.Errorf("Interceptors: got fields %v", recs[2].Fields)
+		}
+	}
+}
+
+func TestLoggerV2(t *testing.T) {
+	mlw := log.NewMemoryLogWriter(10)
+	logger := log.NewLogger().AddFilter("memory", log.WARNING, mlw)
+	l := NewLoggerV2(&logger, 1)
+
+	l.Info("not logged")
+	l.Warningf("retrying %d", 3)
+	l.Errorln("failed", 2)
+	if !l.V(1) || l.V(2) {
+		t.Errorf("LoggerV2: V is wrong for the verbosity 1")
+	}
+
+	var got []string
+	for _, rec := range mlw.Records() {
+		got = append(got, rec.Level.String()+" "+rec.Source+" "+rec.Message)
+	}
+	want := "WARN google.golang.org/grpc retrying 3\nEROR google.golang.org/grpc failed 2"
+	if strings.Join(got, "\n") != want {
+		t.Errorf("LoggerV2: got %q, want %q", strings.Join(got, "\n"), want)
+	}
+}
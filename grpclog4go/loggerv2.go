@@ -0,0 +1,93 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package grpclog4go
+
+import (
+	"fmt"
+	log "github.com/kimiazhu/log4go"
+	"strings"
+)
+
+// The source of the records of gRPC
+const grpcSource = "google.golang.org/grpc"
+
+// A LoggerV2 implements grpclog.LoggerV2 with a log4go logger: the infos of
+// gRPC are logged at the INFO level, its warnings at WARNING, its errors at
+// ERROR and its fatal errors at CRITICAL before the program exits (see
+// log4go.Logger.Fatal).
+type LoggerV2 struct {
+	logger    *log.Logger
+	verbosity int
+}
+
+// NewLoggerV2 creates a LoggerV2 logging to logger, or to the global logger
+// if it's nil.  The verbose logs of gRPC are enabled up to verbosity, like
+// GRPC_GO_LOG_VERBOSITY_LEVEL.
+func NewLoggerV2(logger *log.Logger, verbosity int) *LoggerV2 {
+	return &LoggerV2{logger: logger, verbosity: verbosity}
+}
+
+func (l *LoggerV2) current() log.Logger {
+	if l.logger == nil {
+		return log.Global
+	}
+	return *l.logger
+}
+
+func (l *LoggerV2) Info(args ...interface{}) {
+	l.current().Log(log.INFO, grpcSource, fmt.Sprint(args...))
+}
+
+func (l *LoggerV2) Infoln(args ...interface{}) {
+	l.current().Log(log.INFO, grpcSource, sprintln(args))
+}
+
+func (l *LoggerV2) Infof(format string, args ...interface{}) {
+	l.current().Log(log.INFO, grpcSource, fmt.Sprintf(format, args...))
+}
+
+func (l *LoggerV2) Warning(args ...interface{}) {
+	l.current().Log(log.WARNING, grpcSource, fmt.Sprint(args...))
+}
+
+func (l *LoggerV2) Warningln(args ...interface{}) {
+	l.current().Log(log.WARNING, grpcSource, sprintln(args))
+}
+
+func (l *LoggerV2) Warningf(format string, args ...interface{}) {
+	l.current().Log(log.WARNING, grpcSource, fmt.Sprintf(format, args...))
+}
+
+func (l *LoggerV2) Error(args ...interface{}) {
+	l.current().Log(log.ERROR, grpcSource, fmt.Sprint(args...))
+}
+
+func (l *LoggerV2) Errorln(args ...interface{}) {
+	l.current().Log(log.ERROR, grpcSource, sprintln(args))
+}
+
+func (l *LoggerV2) Errorf(format string, args ...interface{}) {
+	l.current().Log(log.ERROR, grpcSource, fmt.Sprintf(format, args...))
+}
+
+func (l *LoggerV2) Fatal(args ...interface{}) {
+	l.current().Fatalf("%s", fmt.Sprint(args...))
+}
+
+func (l *LoggerV2) Fatalln(args ...interface{}) {
+	l.current().Fatalf("%s", sprintln(args))
+}
+
+func (l *LoggerV2) Fatalf(format string, args ...interface{}) {
+	l.current().Fatalf(format, args...)
+}
+
+// V reports whether the verbose logs of level are enabled.
+func (l *LoggerV2) V(level int) bool {
+	return level <= l.verbosity
+}
+
+// Like fmt.Sprintln without the newline
+func sprintln(args []interface{}) string {
+	return strings.TrimSuffix(fmt.Sprintln(args...), "\n")
+}
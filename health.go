@@ -0,0 +1,209 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HealthCheckTimeout specifies how long the health checks of the network
+// writers wait for their endpoint.
+var HealthCheckTimeout = 2 * time.Second
+
+var errWriterClosed = errors.New("writer closed")
+
+// The writers which can check that they still work implement this: the file
+// and audit writers check that their file is still the one at their path and
+// that it's writable, the socket, gelf and http writers that their endpoint
+// accepts connections (a UDP endpoint always does), and the writers of other
+// writers check these.
+type HealthChecker interface {
+	HealthCheck() error
+}
+
+// A HealthError holds the errors of the writers which failed their health
+// check, by filter tag.
+type HealthError map[string]error
+
+func (e HealthError) Error() string {
+	tags := make([]string, 0, len(e))
+	for tag := range e {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	msgs := make([]string, len(tags))
+	for i, tag := range tags {
+		msgs[i] = fmt.Sprintf("%s: %s", tag, e[tag])
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// HealthCheck checks the writers of the logger which can (see HealthChecker),
+// concurrently, and returns a HealthError with those which failed, or nil,
+// e.g. for a readiness probe:
+//
+//	http.HandleFunc("/ready", func(rw http.ResponseWriter, req *http.Request) {
+//		if err := log.HealthCheck(); err != nil {
+//			http.Error(rw, err.Error(), http.StatusServiceUnavailable)
+//		}
+//	})
+//
+// A writer which died, e.g. whose file was deleted or whose collector went
+// away, shows here rather than when the records are found missing.
+func (log Logger) HealthCheck() error {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	failed := make(HealthError)
+	for tag, filt := range log.filters() {
+		hc, ok := filt.LogWriter.(HealthChecker)
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func(tag string, hc HealthChecker) {
+			defer wg.Done()
+			if err := hc.HealthCheck(); err != nil {
+				mu.Lock()
+				failed[tag] = err
+				mu.Unlock()
+			}
+		}(tag, hc)
+	}
+	wg.Wait()
+	if len(failed) == 0 {
+		return nil
+	}
+	return failed
+}
+
+// Whether done is closed, i.e. the goroutine of the writer returned
+func writerDone(done chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Check that the file open at path is still there and can be written
+func checkFile(file *os.File, path string) error {
+	if file == nil {
+		return fmt.Errorf("%s: not open", path)
+	}
+	open, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	cur, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !os.SameFile(open, cur) {
+		return fmt.Errorf("%s: replaced by another file", path)
+	}
+	fd, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	return fd.Close()
+}
+
+// Check that a connection to the endpoint can be made
+func checkDial(proto, hostport string) error {
+	sock, err := net.DialTimeout(proto, hostport, HealthCheckTimeout)
+	if err != nil {
+		return err
+	}
+	return sock.Close()
+}
+
+// HealthCheck checks that the file is open, is still the one at its path (not
+// deleted or moved away by something else than the writer) and can be written
+// to, and that the disk guard doesn't stop the writes.
+func (w *FileLogWriter) HealthCheck() error {
+	if writerDone(w.done) {
+		return errWriterClosed
+	}
+	if atomic.LoadInt32(&w.diskMin) == math.MaxInt32 {
+		return fmt.Errorf("%s: writes stopped by the disk guard", w.filename)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return checkFile(w.file, w.filename)
+}
+
+// HealthCheck checks that the file is open, is still the one at its path and
+// can be written to.
+func (w *AuditLogWriter) HealthCheck() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return checkFile(w.file, w.filename)
+}
+
+// HealthCheck checks that the endpoint accepts connections, without touching
+// the connection of the writer.
+func (w *SocketLogWriter) HealthCheck() error {
+	if writerDone(w.done) {
+		return errWriterClosed
+	}
+	return checkDial(w.proto, w.hostport)
+}
+
+// HealthCheck checks the writers which can, and returns the errors of those
+// which failed.
+func (w *TeeLogWriter) HealthCheck() error {
+	var msgs []string
+	for i, writer := range w.writers {
+		if hc, ok := writer.(HealthChecker); ok {
+			if err := hc.HealthCheck(); err != nil {
+				msgs = append(msgs, fmt.Sprintf("writer %d: %s", i, err))
+			}
+		}
+	}
+	if len(msgs) > 0 {
+		return errors.New(strings.Join(msgs, "; "))
+	}
+	return nil
+}
+
+// HealthCheck checks the writer queued for.
+func (w *AsyncWriter) HealthCheck() error {
+	if writerDone(w.done) {
+		return errWriterClosed
+	}
+	if hc, ok := w.inner.(HealthChecker); ok {
+		return hc.HealthCheck()
+	}
+	return nil
+}
+
+// HealthCheck checks the primary and the fallback: the writer is healthy as
+// long as one of them is, since it fails over to the fallback.
+func (w *FailoverLogWriter) HealthCheck() error {
+	var msgs []string
+	for _, writer := range []struct {
+		name   string
+		writer LogWriter
+	}{{"primary", w.primary}, {"fallback", w.fallback}} {
+		hc, ok := writer.writer.(HealthChecker)
+		if !ok {
+			return nil
+		}
+		err := hc.HealthCheck()
+		if err == nil {
+			return nil
+		}
+		msgs = append(msgs, fmt.Sprintf("%s: %s", writer.name, err))
+	}
+	return errors.New(strings.Join(msgs, "; "))
+}
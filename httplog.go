@@ -0,0 +1,383 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+//go:build !log4go_nohttp
+// +build !log4go_nohttp
+
+package log4go
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	writerFactories["http"] = func(excludes []string, props []Property, enabled bool) (LogWriter, bool) {
+		return xmlToHTTPLogWriter(excludes, props, enabled)
+	}
+}
+
+// This log writer POSTs batches of records to a HTTP(S) endpoint, e.g. the
+// ingestion API of Loki or Elasticsearch.
+type HTTPLogWriter struct {
+	rec   chan *LogRecord
+	done  chan struct{}
+	start sync.Once
+
+	endpoint string
+	client   *http.Client
+	header   http.Header
+
+	// Encode the batch as newline delimited JSON instead of a JSON array
+	ndjson bool
+
+	// Send when the batch is full or every interval
+	batchsize int
+	interval  time.Duration
+
+	// Retry failed requests with exponential backoff, as long as the records
+	// haven't expired
+	retries    int
+	minbackoff time.Duration
+	maxbackoff time.Duration
+	ttl        recordTTL
+
+	writerStats
+}
+
+// NewHTTPLogWriter creates a new LogWriter which POSTs the records to endpoint
+// as a JSON array, in batches of up to 100 records sent at least every second.
+// A failed request is retried 3 times, waiting 500ms, then 1s, then 2s.
+//
+// The Set* methods can be used to change these defaults before the first log
+// message is written.
+func NewHTTPLogWriter(endpoint string) *HTTPLogWriter {
+	return &HTTPLogWriter{
+		rec:        make(chan *LogRecord, LogBufferLength),
+		done:       make(chan struct{}),
+		endpoint:   endpoint,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		header:     make(http.Header),
+		batchsize:  100,
+		interval:   time.Second,
+		retries:    3,
+		minbackoff: 500 * time.Millisecond,
+		maxbackoff: 30 * time.Second,
+	}
+}
+
+// This is the HTTPLogWriter's output method.  This will block if the output
+// buffer is full.
+func (w *HTTPLogWriter) LogWrite(rec *LogRecord) {
+	w.start.Do(func() { go w.run() })
+	w.rec <- rec
+}
+
+func (w *HTTPLogWriter) queued() (int, int) {
+	return len(w.rec), cap(w.rec)
+}
+
+// Close sends the pending batch and waits for it to be delivered or to fail.
+func (w *HTTPLogWriter) Close() {
+	w.start.Do(func() { go w.run() })
+	close(w.rec)
+	<-w.done
+}
+
+func (w *HTTPLogWriter) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	batch := make([]*LogRecord, 0, w.batchsize)
+	for {
+		select {
+		case rec, ok := <-w.rec:
+			if !ok {
+				w.send(batch)
+				return
+			}
+			batch = append(batch, rec)
+			if len(batch) < w.batchsize {
+				continue
+			}
+		case <-ticker.C:
+		}
+		w.send(batch)
+		batch = batch[:0]
+	}
+}
+
+// Encode a batch and deliver it, retrying as configured
+func (w *HTTPLogWriter) send(batch []*LogRecord) {
+	if len(batch) == 0 {
+		return
+	}
+
+	body, err := w.encode(batch)
+	if err != nil {
+		ReportError(fmt.Sprintf("HTTPLogWriter(%q)", w.endpoint), err)
+		w.failed()
+		w.drop(len(batch))
+		return
+	}
+
+	backoff := w.minbackoff
+	for attempt := 0; ; attempt++ {
+		retry, err := w.post(body)
+		if err == nil {
+			w.wrote(len(batch), len(body))
+			return
+		}
+		w.failed()
+		if !retry || attempt >= w.retries {
+			ReportError(fmt.Sprintf("HTTPLogWriter(%q)", w.endpoint), fmt.Errorf("dropping %d records: %s", len(batch), err))
+			w.drop(len(batch))
+			return
+		}
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > w.maxbackoff {
+			backoff = w.maxbackoff
+		}
+
+		// Don't retry the records which expired in the meantime
+		if kept := w.ttl.unexpired(batch, clockNow()); len(kept) < len(batch) {
+			w.drop(len(batch) - len(kept))
+			batch = kept
+			if len(batch) == 0 {
+				return
+			}
+			if body, err = w.encode(batch); err != nil {
+				ReportError(fmt.Sprintf("HTTPLogWriter(%q)", w.endpoint), err)
+				w.drop(len(batch))
+				return
+			}
+		}
+	}
+}
+
+func (w *HTTPLogWriter) encode(batch []*LogRecord) ([]byte, error) {
+	if !w.ndjson {
+		return json.Marshal(batch)
+	}
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	for _, rec := range batch {
+		if err := enc.Encode(rec); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// POST a body once, and report whether a failure is worth a retry
+func (w *HTTPLogWriter) post(body []byte) (retry bool, err error) {
+	req, err := http.NewRequest("POST", w.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	for name, values := range w.header {
+		req.Header[name] = values
+	}
+	if req.Header.Get("Content-Type") == "" {
+		if w.ndjson {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		} else {
+			req.Header.Set("Content-Type", "application/json")
+		}
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	retry = resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("unexpected status %s", resp.Status)
+}
+
+// Set a header sent with every request (chainable), e.g. Authorization.  Must
+// be called before the first log message is written.
+func (w *HTTPLogWriter) SetHeader(name, value string) *HTTPLogWriter {
+	w.header.Set(name, value)
+	return w
+}
+
+// Send newline delimited JSON instead of a JSON array (chainable).  Must be
+// called before the first log message is written.
+func (w *HTTPLogWriter) SetNDJSON(ndjson bool) *HTTPLogWriter {
+	w.ndjson = ndjson
+	return w
+}
+
+// Set the maximum number of records per request (chainable).  Must be called
+// before the first log message is written.
+func (w *HTTPLogWriter) SetBatchSize(batchsize int) *HTTPLogWriter {
+	if batchsize < 1 {
+		batchsize = 1
+	}
+	w.batchsize = batchsize
+	return w
+}
+
+// Set how often a partial batch is sent (chainable).  Must be called before
+// the first log message is written.  A zero or negative interval is ignored.
+func (w *HTTPLogWriter) SetFlushInterval(interval time.Duration) *HTTPLogWriter {
+	if interval > 0 {
+		w.interval = interval
+	}
+	return w
+}
+
+// Set how many times a failed request is retried, and the bounds of the delay
+// between the attempts (chainable).  Must be called before the first log
+// message is written.
+func (w *HTTPLogWriter) SetRetry(retries int, minbackoff, maxbackoff time.Duration) *HTTPLogWriter {
+	w.retries, w.minbackoff, w.maxbackoff = retries, minbackoff, maxbackoff
+	return w
+}
+
+// Set how long the records at lvl and above stay worth retrying (chainable):
+// the records which expired while a failed request was waiting for its next
+// attempt are dropped from the retried batch.  0 means forever, the default.
+// See SocketLogWriter.SetRecordTTL.  Must be called before the first log
+// message is written.
+func (w *HTTPLogWriter) SetRecordTTL(lvl Level, ttl time.Duration) *HTTPLogWriter {
+	w.ttl.set(lvl, ttl)
+	return w
+}
+
+// Set the timeout of each request (chainable).  Must be called before the
+// first log message is written.
+func (w *HTTPLogWriter) SetTimeout(timeout time.Duration) *HTTPLogWriter {
+	w.client.Timeout = timeout
+	return w
+}
+
+func xmlToHTTPLogWriter(exclude []string, props []Property, enabled bool) (*HTTPLogWriter, bool) {
+	endpoint := ""
+	ndjson := false
+	header := make(http.Header)
+	batchsize := 100
+	var interval, timeout time.Duration
+	retries := -1
+	var ttl recordTTL
+
+	// Parse properties
+	for _, prop := range props {
+		value := strings.Trim(prop.Value, " \r\n")
+		switch prop.Name {
+		case "endpoint":
+			endpoint = value
+		case "format":
+			switch value {
+			case "json":
+				ndjson = false
+			case "ndjson":
+				ndjson = true
+			default:
+				fmt.Fprintf(configOut, "LoadConfiguration: Error: Unknown format \"%s\" for http filter, expect json or ndjson\n", value)
+				return nil, false
+			}
+		case "header":
+			i := strings.Index(value, ":")
+			if i <= 0 {
+				fmt.Fprintf(configOut, "LoadConfiguration: Error: Invalid property \"%s\" for http filter, expect \"Name: value\"\n", "header")
+				return nil, false
+			}
+			header.Add(strings.TrimSpace(value[:i]), strings.TrimSpace(value[i+1:]))
+		case "batchsize":
+			batchsize = strToNumSuffix(value, 1000)
+		case "retries":
+			var err error
+			if retries, err = strconv.Atoi(value); err != nil || retries < 0 {
+				fmt.Fprintf(configOut, "LoadConfiguration: Error: Invalid property \"%s\" for http filter: %s, expect a number of retries\n", "retries", value)
+				return nil, false
+			}
+		case "ttl":
+			var ok bool
+			if ttl, ok = xmlToRecordTTL(value, "http"); !ok {
+				return nil, false
+			}
+		case "flushinterval", "timeout":
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				fmt.Fprintf(configOut, "LoadConfiguration: Error: Invalid property \"%s\" for http filter: %s\n", prop.Name, err)
+				return nil, false
+			}
+			if d <= 0 {
+				fmt.Fprintf(configOut, "LoadConfiguration: Error: Invalid property \"%s\" for http filter: %s, expect a positive duration\n", prop.Name, value)
+				return nil, false
+			}
+			if prop.Name == "timeout" {
+				timeout = d
+			} else {
+				interval = d
+			}
+		default:
+			fmt.Fprintf(configOut, "LoadConfiguration: Warning: Unknown property \"%s\" for http filter\n", prop.Name)
+		}
+	}
+
+	// Check properties
+	if len(endpoint) == 0 {
+		fmt.Fprintf(configOut, "LoadConfiguration: Error: Required property \"%s\" for http filter\n", "endpoint")
+		return nil, false
+	}
+
+	// If it's disabled, we're just checking syntax
+	if !enabled {
+		return nil, true
+	}
+
+	hlw := NewHTTPLogWriter(endpoint).SetNDJSON(ndjson).SetBatchSize(batchsize)
+	hlw.ttl = ttl
+	// A repeated header keeps all its values
+	for name, values := range header {
+		hlw.header[name] = values
+	}
+	if interval > 0 {
+		hlw.SetFlushInterval(interval)
+	}
+	if timeout > 0 {
+		hlw.SetTimeout(timeout)
+	}
+	if retries >= 0 {
+		hlw.SetRetry(retries, hlw.minbackoff, hlw.maxbackoff)
+	}
+	return hlw, true
+}
+
+// HealthCheck checks that the endpoint answers a HEAD request, whatever its
+// status: the server is up, which is what the writer needs to know before it
+// POSTs.
+func (w *HTTPLogWriter) HealthCheck() error {
+	if writerDone(w.done) {
+		return errWriterClosed
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), HealthCheckTimeout)
+	defer cancel()
+	req, err := http.NewRequest("HEAD", w.endpoint, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := w.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
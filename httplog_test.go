@@ -0,0 +1,86 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+//go:build !log4go_nohttp
+// +build !log4go_nohttp
+
+package log4go
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHTTPLogWriter(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	failures := 1
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if failures > 0 {
+			failures--
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if got := req.Header.Get("X-Scope-OrgID"); got != "tenant" {
+			t.Errorf("HTTPLogWriter: header got %q, want %q", got, "tenant")
+		}
+		body, _ := ioutil.ReadAll(req.Body)
+		bodies = append(bodies, string(body))
+	}))
+	defer srv.Close()
+
+	w := NewHTTPLogWriter(srv.URL).SetNDJSON(true).SetBatchSize(2).
+		SetHeader("X-Scope-OrgID", "tenant").SetRetry(1, time.Millisecond, time.Millisecond)
+	w.LogWrite(newLogRecord(INFO, "source", "one"))
+	w.LogWrite(newLogRecord(INFO, "source", "two"))
+	w.LogWrite(newLogRecord(INFO, "source", "three"))
+	w.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bodies) != 2 {
+		t.Fatalf("HTTPLogWriter: expected 2 batches, got %d: %q", len(bodies), bodies)
+	}
+	if lines := strings.Split(strings.TrimSpace(bodies[0]), "\n"); len(lines) != 2 {
+		t.Errorf("HTTPLogWriter: expected 2 records in the first batch, got %q", bodies[0])
+	}
+	if !strings.Contains(bodies[1], `"Message":"three"`) {
+		t.Errorf("HTTPLogWriter: unexpected last batch %q", bodies[1])
+	}
+}
+
+func TestHTTPLogWriterConfig(t *testing.T) {
+	defer func(out io.Writer) { configOut = out }(configOut)
+	buf := new(bytes.Buffer)
+	configOut = buf
+
+	for _, prop := range []Property{{"retries", "three"}, {"retries", "-1"}, {"flushinterval", "0s"}, {"timeout", "-1s"}} {
+		buf.Reset()
+		props := []Property{{"endpoint", "http://localhost:1"}, prop}
+		if _, ok := xmlToHTTPLogWriter(nil, props, false); ok || !strings.Contains(buf.String(), `Invalid property "`+prop.Name+`"`) {
+			t.Errorf("xmlToHTTPLogWriter: %s=%s gave %v, %q", prop.Name, prop.Value, ok, buf.String())
+		}
+	}
+
+	// A repeated header keeps all its values
+	props := []Property{{"endpoint", "http://localhost:1"}, {"header", "X-Tag: a"}, {"header", "x-tag: b"}}
+	w, ok := xmlToHTTPLogWriter(nil, props, true)
+	if !ok || strings.Join(w.header["X-Tag"], ",") != "a,b" {
+		t.Errorf("xmlToHTTPLogWriter: headers %v, %v", w, ok)
+	} else {
+		w.Close()
+	}
+
+	// A ticker can't tick every 0s
+	if w := NewHTTPLogWriter("http://localhost:1").SetFlushInterval(0); w.interval != time.Second {
+		t.Errorf("SetFlushInterval(0): interval %s", w.interval)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Identity tells where the records come from.  Empty values are unknown.
+type Identity struct {
+	Hostname   string `json:"hostname,omitempty"`
+	InstanceID string `json:"instance_id,omitempty"`
+	Region     string `json:"region,omitempty"`
+}
+
+// An IdentityProvider looks up the identity of the running program, e.g. from
+// the metadata service of a cloud provider.  The identity is cached, so the
+// lookup may be slow.
+type IdentityProvider interface {
+	Identity() (Identity, error)
+}
+
+// IdentityFunc adapts a function to an IdentityProvider
+type IdentityFunc func() (Identity, error)
+
+func (f IdentityFunc) Identity() (Identity, error) {
+	return f()
+}
+
+// The default provider, which only knows the hostname
+type hostnameProvider struct{}
+
+func (hostnameProvider) Identity() (Identity, error) {
+	host, err := os.Hostname()
+	return Identity{Hostname: host}, err
+}
+
+// The identity cache.  The identity is looked up again in the background when
+// it's older than identityRefresh, the stale one is used meanwhile.
+var (
+	identityMu         sync.Mutex
+	identityProvider   IdentityProvider = hostnameProvider{}
+	identityRefresh                     = 5 * time.Minute
+	identityCache      atomic.Value     // Identity
+	identityExpires    int64            // unix nanoseconds
+	identityRefreshing int32
+)
+
+// SetIdentityProvider replaces the provider of the identity, which is looked
+// up right away, then again every refresh (never if refresh <= 0).  The
+// identity feeds the %H, %I and %R pattern codes, the identity keys of the
+// JSON and logfmt layouts, and the host of the GELF messages.
+func SetIdentityProvider(provider IdentityProvider, refresh time.Duration) {
+	identityMu.Lock()
+	identityProvider, identityRefresh = provider, refresh
+	identityMu.Unlock()
+	refreshIdentity()
+}
+
+// CurrentIdentity returns the cached identity, looking it up on the first call.
+func CurrentIdentity() Identity {
+	id, ok := identityCache.Load().(Identity)
+	if !ok {
+		return refreshIdentity()
+	}
+	if expires := atomic.LoadInt64(&identityExpires); expires > 0 && time.Now().UnixNano() > expires {
+		if atomic.CompareAndSwapInt32(&identityRefreshing, 0, 1) {
+			go func() {
+				defer atomic.StoreInt32(&identityRefreshing, 0)
+				refreshIdentity()
+			}()
+		}
+	}
+	return id
+}
+
+// Look up the identity and cache it.  On error the cached identity is kept,
+// and the lookup is tried again on the next refresh.
+func refreshIdentity() Identity {
+	identityMu.Lock()
+	defer identityMu.Unlock()
+
+	id, err := identityProvider.Identity()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "IdentityProvider: %s\n", err)
+		if cached, ok := identityCache.Load().(Identity); ok {
+			id = cached
+		}
+	}
+	identityCache.Store(id)
+
+	expires := int64(0)
+	if identityRefresh > 0 {
+		expires = time.Now().Add(identityRefresh).UnixNano()
+	}
+	atomic.StoreInt64(&identityExpires, expires)
+	return id
+}
@@ -0,0 +1,107 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"sort"
+	"sync/atomic"
+)
+
+// The environment variables through which the worker processes inherit the
+// configuration of their parent, see Logger.Env
+const (
+	EnvConfig   = "LOG4GO_CONFIG"
+	EnvWorkerID = "LOG4GO_WORKER_ID"
+)
+
+// The id of the worker process, added to the records as a "worker_id" field if
+// it isn't empty
+var workerID atomic.Value // string
+
+// SetWorkerID tags the records of the process with a "worker_id" field, e.g.
+// the index of a pre-forked worker.  "" removes it.
+func SetWorkerID(id string) {
+	workerID.Store(id)
+}
+
+// Append the worker id to the fields of rec, if there is one
+func addWorkerID(rec *LogRecord) {
+	if id, _ := workerID.Load().(string); id != "" {
+		rec.Fields = append(rec.Fields[:len(rec.Fields):len(rec.Fields)], Field{"worker_id", id})
+	}
+}
+
+// Env returns the effective configuration of the logger as environment
+// variables, for the worker processes to call InheritFromEnv with:
+//
+//	cmd := exec.Command(os.Args[0], "worker")
+//	env, err := log.Global.Env()
+//	...
+//	cmd.Env = append(append(os.Environ(), env...), log.EnvWorkerID+"=3")
+//
+// Only the filters created from a configuration (LoadConfiguration, Config,
+// ApplyConfig) can be described; the levels are the current ones.  Env returns
+// an error naming the first filter added in code.  The workers open the
+// destinations themselves: they should not rotate the files their parent
+// rotates.
+func (log Logger) Env() ([]string, error) {
+	catalogs.Lock()
+	lc := &LoggerConfig{Locale: catalogs.locale}
+	catalogs.Unlock()
+
+	filters := log.filters()
+	tags := make([]string, 0, len(filters))
+	for tag := range filters {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	// The routes of each configuration, once
+	routed := make(map[*RouteConfig]bool)
+	for _, tag := range tags {
+		filt := filters[tag]
+		if filt.config == nil {
+			return nil, fmt.Errorf("log4go: filter %q was not created from a configuration", tag)
+		}
+		fc := *filt.config
+		fc.Level = levelName(filt.CurrentLevel())
+		lc.Filter = append(lc.Filter, fc)
+		if len(filt.merged) > 0 {
+			lc.Filter = append(lc.Filter, filt.merged...)
+			lc.Duplicates = "tee"
+		}
+		if len(filt.routes) > 0 && !routed[&filt.routes[0]] {
+			routed[&filt.routes[0]] = true
+			lc.Route = append(lc.Route, filt.routes...)
+		}
+	}
+
+	config, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"logging"`
+		*LoggerConfig
+	}{LoggerConfig: lc})
+	if err != nil {
+		return nil, err
+	}
+	return []string{EnvConfig + "=" + string(config)}, nil
+}
+
+// InheritFromEnv replaces the filters of the logger with the configuration
+// passed by the parent process (see Env), and tags the records with the worker
+// id it passed, if any.  It returns false, leaving the logger alone, if there
+// is no such configuration.  As with Config, the errors are fatal.
+func (log Logger) InheritFromEnv() bool {
+	config := os.Getenv(EnvConfig)
+	if config == "" {
+		return false
+	}
+	log.Close()
+	log.Config([]byte(config))
+	if id := os.Getenv(EnvWorkerID); id != "" {
+		SetWorkerID(id)
+	}
+	return true
+}
@@ -0,0 +1,83 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"errors"
+	"sync"
+)
+
+// The loggers created by NewLoggerFromConfig and not closed since, which Exit
+// and the like close along with their own
+var isolatedLoggers = struct {
+	sync.Mutex
+	m map[*loggerFilters]bool
+}{m: make(map[*loggerFilters]bool)}
+
+// NewLoggerFromConfig creates a logger with the filters of the configuration
+// file filename, independent from Global: a library embedded in a program can
+// log to its own destinations, whatever the program does with Global and its
+// configuration.
+//
+//	logger, err := log4go.NewLoggerFromConfig("/etc/mylib/log4go.xml")
+//	if err != nil {
+//	    return err
+//	}
+//	defer logger.Close()
+//
+// The errors aren't fatal, unlike LoadConfiguration: they are returned (and
+// also reported to stderr).  The locale of the configuration is ignored, the
+// messages of the catalogs being global.  Reload loads the file again, and
+// Exit, Fatal and the like close the logger before the program exits.
+func NewLoggerFromConfig(filename string) (Logger, error) {
+	log := NewLogger()
+	log.fs.config = filename
+	if err := log.ReloadConfiguration(filename); err != nil {
+		return Logger{}, err
+	}
+	isolatedLoggers.Lock()
+	isolatedLoggers.m[log.fs] = true
+	isolatedLoggers.Unlock()
+	return log, nil
+}
+
+// Reload loads the configuration file of a logger created by
+// NewLoggerFromConfig again, e.g. on SIGHUP, see ReloadConfiguration.  A
+// closed logger is open again.
+func (log Logger) Reload() error {
+	if log.fs == nil || log.fs.config == "" {
+		return errors.New("log4go: the logger was not created from a configuration file")
+	}
+	if err := log.ReloadConfiguration(log.fs.config); err != nil {
+		return err
+	}
+	isolatedLoggers.Lock()
+	isolatedLoggers.m[log.fs] = true
+	isolatedLoggers.Unlock()
+	return nil
+}
+
+// Report whether the logger was created by NewLoggerFromConfig
+func (log Logger) isolated() bool {
+	return log.fs != nil && log.fs.config != ""
+}
+
+// Forget a closed logger created by NewLoggerFromConfig
+func forgetIsolated(log Logger) {
+	isolatedLoggers.Lock()
+	delete(isolatedLoggers.m, log.fs)
+	isolatedLoggers.Unlock()
+}
+
+// Close the loggers created by NewLoggerFromConfig, when the program exits
+func closeIsolated() {
+	isolatedLoggers.Lock()
+	loggers := make([]Logger, 0, len(isolatedLoggers.m))
+	for fs := range isolatedLoggers.m {
+		loggers = append(loggers, Logger{fs})
+	}
+	isolatedLoggers.Unlock()
+	for _, log := range loggers {
+		log.Close()
+	}
+}
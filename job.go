@@ -0,0 +1,146 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// JobErrorSamples specifies how many distinct errors, the most frequent
+	// first, are reported in the summary of a JobLogger.
+	JobErrorSamples = 5
+
+	// JobMaxDistinctErrors bounds how many distinct error messages a
+	// JobLogger counts; further new messages are only counted as failures.
+	JobMaxDistinctErrors = 100
+)
+
+// A JobLogger accumulates counters and errors during a batch run, and logs a
+// single summary record when the job is done, instead of a record per item:
+//
+//      job := log4go.NewJob("nightly-import")
+//      for _, item := range items {
+//          if err := process(item); err != nil {
+//              job.Failed(err)
+//          } else {
+//              job.Processed(1)
+//          }
+//      }
+//      job.Done()
+//
+// The summary is logged at INFO, or at WARNING if anything failed, with the
+// fields job, duration, processed, failed, one field per counter and errors.
+// A JobLogger is safe for use by multiple goroutines.
+type JobLogger struct {
+	log     Logger
+	name    string
+	started time.Time
+
+	mu        sync.Mutex
+	processed int64
+	failed    int64
+	counters  map[string]int64
+	keys      []string
+	errors    map[string]int64
+}
+
+// NewJob starts a job named name whose summary is logged to log.
+func (log Logger) NewJob(name string) *JobLogger {
+	return &JobLogger{
+		log:      log,
+		name:     name,
+		started:  clockNow(),
+		counters: make(map[string]int64),
+		errors:   make(map[string]int64),
+	}
+}
+
+// Processed adds n to the number of successfully processed items.
+func (j *JobLogger) Processed(n int64) {
+	j.mu.Lock()
+	j.processed += n
+	j.mu.Unlock()
+}
+
+// Failed counts a failed item, and keeps err as a sample for the summary.
+func (j *JobLogger) Failed(err error) {
+	j.mu.Lock()
+	j.failed++
+	if err != nil {
+		msg := err.Error()
+		if _, ok := j.errors[msg]; ok || len(j.errors) < JobMaxDistinctErrors {
+			j.errors[msg]++
+		}
+	}
+	j.mu.Unlock()
+}
+
+// Count adds n to the custom counter key, which is reported as a field of the
+// summary.
+func (j *JobLogger) Count(key string, n int64) {
+	j.mu.Lock()
+	if _, ok := j.counters[key]; !ok {
+		j.keys = append(j.keys, key)
+	}
+	j.counters[key] += n
+	j.mu.Unlock()
+}
+
+// Done logs the summary of the job.  The JobLogger should not be used
+// afterwards.
+func (j *JobLogger) Done() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	fields := []Field{
+		{"job", j.name},
+		{"duration", clockNow().Sub(j.started).Round(time.Millisecond)},
+		{"processed", j.processed},
+		{"failed", j.failed},
+	}
+	for _, key := range j.keys {
+		fields = append(fields, Field{key, j.counters[key]})
+	}
+
+	lvl := INFO
+	if j.failed > 0 {
+		lvl = WARNING
+		if samples := j.errorSamples(); len(samples) > 0 {
+			fields = append(fields, Field{"errors", samples})
+		}
+	}
+
+	j.log.intLogFields(lvl, fields, fmt.Sprintf("job %s finished", j.name))
+}
+
+// Format the most frequent errors as "msg (xN); ..."
+func (j *JobLogger) errorSamples() string {
+	msgs := make([]string, 0, len(j.errors))
+	for msg := range j.errors {
+		msgs = append(msgs, msg)
+	}
+	sort.Slice(msgs, func(a, b int) bool {
+		if j.errors[msgs[a]] != j.errors[msgs[b]] {
+			return j.errors[msgs[a]] > j.errors[msgs[b]]
+		}
+		return msgs[a] < msgs[b]
+	})
+	if len(msgs) > JobErrorSamples {
+		msgs = msgs[:JobErrorSamples]
+	}
+	for i, msg := range msgs {
+		msgs[i] = fmt.Sprintf("%q (x%d)", msg, j.errors[msg])
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Start a job whose summary is logged to the global logger
+// Wrapper for (*Logger).NewJob
+func NewJob(name string) *JobLogger {
+	return Global.NewJob(name)
+}
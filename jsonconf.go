@@ -0,0 +1,144 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+func init() {
+	RegisterConfigFormat(".json", ParseJSONConfig)
+}
+
+// A filter of the JSON configuration
+type jsonFilter struct {
+	Enabled    *bool          `json:"enabled"`
+	Tag        string         `json:"tag"`
+	Level      string         `json:"level"`
+	Type       string         `json:"type"`
+	Properties jsonProperties `json:"properties"`
+	Exclude    []string       `json:"exclude"`
+	Access     string         `json:"access"`
+	Async      bool           `json:"async"`
+	Audit      bool           `json:"audit"`
+}
+
+// A route of the JSON configuration
+type jsonRoute struct {
+	Match  string         `json:"match"`
+	Fields jsonProperties `json:"fields"`
+	To     []string       `json:"to"`
+	Final  bool           `json:"final"`
+}
+
+type jsonConfig struct {
+	Locale     string       `json:"locale"`
+	PathBase   string       `json:"path_base"`
+	Filters    []jsonFilter `json:"filters"`
+	Routes     []jsonRoute  `json:"routes"`
+	Duplicates string       `json:"duplicates"`
+}
+
+// ParseJSONConfig parses a JSON configuration, with the schema of the XML
+// one, see ApplyConfig:
+//
+//	{
+//	  "filters": [
+//	    {"tag": "stdout", "type": "console", "level": "DEBUG"},
+//	    {"tag": "file", "type": "file", "level": "FINEST",
+//	     "properties": {"filename": "test.log", "rotate": true, "maxsize": "10M"}},
+//	    {"tag": "shipper", "enabled": false, "type": "http", "level": "INFO",
+//	     "properties": {"endpoint": "https://logs.example.com/ingest",
+//	                    "header": ["Authorization: Bearer secret", "X-Team: shop"]}}
+//	  ],
+//	  "routes": [
+//	    {"match": "(?i)payment", "fields": {"team": "billing"}, "to": ["file"], "final": true}
+//	  ]
+//	}
+//
+// A filter is enabled unless it says otherwise; a list as the value of a
+// property repeats the property.  LoadConfiguration reads the .json files
+// with it.
+func ParseJSONConfig(config []byte) (*LoggerConfig, error) {
+	var jc jsonConfig
+	if err := json.Unmarshal(config, &jc); err != nil {
+		return nil, err
+	}
+
+	lc := &LoggerConfig{Locale: jc.Locale, PathBase: jc.PathBase, Duplicates: jc.Duplicates}
+	for _, jf := range jc.Filters {
+		fc := FilterConfig{
+			Enabled:  "true",
+			Tag:      jf.Tag,
+			Level:    jf.Level,
+			Type:     jf.Type,
+			Property: jf.Properties,
+			Exclude:  jf.Exclude,
+			Access:   jf.Access,
+		}
+		if jf.Enabled != nil && !*jf.Enabled {
+			fc.Enabled = "false"
+		}
+		if jf.Async {
+			fc.Async = "true"
+		}
+		if jf.Audit {
+			fc.Audit = "true"
+		}
+		lc.Filter = append(lc.Filter, fc)
+	}
+	for _, jr := range jc.Routes {
+		rc := RouteConfig{Match: jr.Match, Field: jr.Fields, To: jr.To}
+		if jr.Final {
+			rc.Final = "true"
+		}
+		lc.Route = append(lc.Route, rc)
+	}
+	return lc, nil
+}
+
+// The properties of a filter, an object of scalars or arrays of scalars whose
+// order is kept
+type jsonProperties []Property
+
+func (props *jsonProperties) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if tok, err := dec.Token(); err != nil {
+		return err
+	} else if tok == nil {
+		return nil
+	} else if tok != json.Delim('{') {
+		return fmt.Errorf("properties must be an object")
+	}
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		name := tok.(string)
+
+		var value interface{}
+		if err := dec.Decode(&value); err != nil {
+			return err
+		}
+		values, ok := value.([]interface{})
+		if !ok {
+			values = []interface{}{value}
+		}
+		for _, v := range values {
+			switch v := v.(type) {
+			case string:
+				*props = append(*props, Property{Name: name, Value: v})
+			case json.Number, bool:
+				*props = append(*props, Property{Name: name, Value: fmt.Sprint(v)})
+			default:
+				return fmt.Errorf("property %q must be a scalar or an array of scalars", name)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,348 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+)
+
+// A Layout turns a record into the bytes written by a writer, including the
+// trailing newline if any.  Attach one to a writer with its SetLayout method,
+// it replaces the format of the writer.
+type Layout interface {
+	Format(rec *LogRecord) []byte
+}
+
+// PatternLayout formats records with a pattern such as "[%D %T] [%L] (%S) %M",
+// see FormatLogRecord.  %Z is printed in TimeFormat.
+type PatternLayout struct {
+	Pattern    string
+	TimeFormat string
+}
+
+func (l PatternLayout) Format(rec *LogRecord) []byte {
+	return []byte(formatLogRecord(l.Pattern, l.TimeFormat, rec))
+}
+
+// JSONLayout formats records as one JSON object per line:
+//   {"time":"...","level":"INFO","source":"...","message":"...","key":"value"}
+// The fields of the record follow the message; a field named like one of the
+// keys before gets an underscore appended.  The time is printed in TimeFormat,
+// rfc3339nano by default, as a number for the epoch formats.  With Identity,
+// the keys of the identity (hostname, instance_id, region) which are known
+// follow the time.  The name of a NamedLogger follows the level, as logger.
+// With FieldsKey, the fields are grouped in an object under that key instead:
+//   {"time":"...",...,"message":"...","fields":{"key":"value"}}
+// With SourceFormat, the source is printed in that style of %S{...}, e.g.
+// short.
+type JSONLayout struct {
+	TimeFormat   string
+	Identity     bool
+	FieldsKey    string
+	SourceFormat string
+}
+
+func (l JSONLayout) Format(rec *LogRecord) []byte {
+	timeformat := l.TimeFormat
+	if timeformat == "" {
+		timeformat = "rfc3339nano"
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, 128))
+	out.WriteString(`{"time":`)
+	if ts := FormatTime(rec.Created, timeformat); isNumber(ts) {
+		out.WriteString(ts)
+	} else {
+		writeJSON(out, ts)
+	}
+	if l.Identity {
+		for _, kv := range identityKeys() {
+			out.WriteByte(',')
+			writeJSON(out, kv.Key)
+			out.WriteByte(':')
+			writeJSON(out, kv.Value)
+		}
+	}
+	out.WriteString(`,"level":`)
+	writeJSON(out, rec.Level.String())
+	if rec.Name != "" {
+		out.WriteString(`,"logger":`)
+		writeJSON(out, rec.Name)
+	}
+	out.WriteString(`,"source":`)
+	writeJSON(out, formatSource(rec.Source, l.SourceFormat))
+	out.WriteString(`,"message":`)
+	writeJSON(out, rec.Message)
+	if l.FieldsKey != "" {
+		if len(rec.Fields) > 0 {
+			out.WriteByte(',')
+			writeJSON(out, l.FieldsKey)
+			out.WriteByte(':')
+			writeJSONObject(out, rec.Fields)
+		}
+	} else {
+		for _, field := range rec.Fields {
+			key := field.Key
+			switch key {
+			case "time", "level", "logger", "source", "message", "hostname", "instance_id", "region":
+				key += "_"
+			}
+			out.WriteByte(',')
+			writeJSON(out, key)
+			out.WriteByte(':')
+			writeJSONValue(out, field.Value)
+		}
+	}
+	out.WriteString("}\n")
+	return out.Bytes()
+}
+
+// Write the fields as a JSON object
+func writeJSONObject(out *bytes.Buffer, fields []Field) {
+	out.WriteByte('{')
+	for i, field := range fields {
+		if i > 0 {
+			out.WriteByte(',')
+		}
+		writeJSON(out, field.Key)
+		out.WriteByte(':')
+		writeJSONValue(out, field.Value)
+	}
+	out.WriteByte('}')
+}
+
+// Write the value of a field as JSON, errors as their message
+func writeJSONValue(out *bytes.Buffer, v interface{}) {
+	if err, ok := v.(error); ok {
+		writeJSON(out, err.Error())
+	} else {
+		writeJSON(out, v)
+	}
+}
+
+// The known parts of the current identity, as fields
+func identityKeys() []Field {
+	id := CurrentIdentity()
+	fields := make([]Field, 0, 3)
+	if id.Hostname != "" {
+		fields = append(fields, F("hostname", id.Hostname))
+	}
+	if id.InstanceID != "" {
+		fields = append(fields, F("instance_id", id.InstanceID))
+	}
+	if id.Region != "" {
+		fields = append(fields, F("region", id.Region))
+	}
+	return fields
+}
+
+// Write v as JSON, or its string form if it can't be marshalled
+func writeJSON(out *bytes.Buffer, v interface{}) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		js, _ = json.Marshal(fmt.Sprint(v))
+	}
+	out.Write(js)
+}
+
+func isNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// LogfmtLayout formats records as logfmt, one line of key=value pairs:
+//   time=... level=INFO source=... msg="a message" key=value
+// Values with spaces, quotes, = or control characters are quoted; in keys,
+// these characters are replaced with underscores.  It's selected in the
+// configuration with <property name="format">logfmt</property>.  The time is
+// printed in TimeFormat, rfc3339nano by default.  With Identity, the keys of
+// the identity (hostname, instance_id, region) which are known follow the time.
+// The name of a NamedLogger follows the level, as logger.  With SourceFormat,
+// the source is printed in that style of %S{...}, e.g. short.
+type LogfmtLayout struct {
+	TimeFormat   string
+	Identity     bool
+	SourceFormat string
+}
+
+func (l LogfmtLayout) Format(rec *LogRecord) []byte {
+	timeformat := l.TimeFormat
+	if timeformat == "" {
+		timeformat = "rfc3339nano"
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, 128))
+	writeLogfmt(out, "time", FormatTime(rec.Created, timeformat))
+	if l.Identity {
+		for _, kv := range identityKeys() {
+			out.WriteByte(' ')
+			writeLogfmt(out, kv.Key, kv.Value.(string))
+		}
+	}
+	out.WriteByte(' ')
+	writeLogfmt(out, "level", rec.Level.String())
+	if rec.Name != "" {
+		out.WriteByte(' ')
+		writeLogfmt(out, "logger", rec.Name)
+	}
+	out.WriteByte(' ')
+	writeLogfmt(out, "source", formatSource(rec.Source, l.SourceFormat))
+	out.WriteByte(' ')
+	writeLogfmt(out, "msg", rec.Message)
+	for _, field := range rec.Fields {
+		out.WriteByte(' ')
+		writeLogfmt(out, field.Key, fmt.Sprint(field.Value))
+	}
+	out.WriteByte('\n')
+	return out.Bytes()
+}
+
+// Write the fields as space separated logfmt pairs
+func writeLogfmtFields(out *bytes.Buffer, fields []Field) {
+	for i, field := range fields {
+		if i > 0 {
+			out.WriteByte(' ')
+		}
+		writeLogfmt(out, field.Key, fmt.Sprint(field.Value))
+	}
+}
+
+// Write key=value, quoting the value if needed
+func writeLogfmt(out *bytes.Buffer, key, value string) {
+	if key == "" {
+		key = "_"
+	}
+	if needsQuoting(key) {
+		for _, c := range key {
+			if logfmtSpecial(c) {
+				c = '_'
+			}
+			out.WriteRune(c)
+		}
+	} else {
+		out.WriteString(key)
+	}
+	out.WriteByte('=')
+	if needsQuoting(value) {
+		out.WriteString(strconv.Quote(value))
+	} else {
+		out.WriteString(value)
+	}
+}
+
+func needsQuoting(s string) bool {
+	if s == "" {
+		return true
+	}
+	for _, c := range s {
+		if logfmtSpecial(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// Report whether c can't appear as is in a logfmt key or value
+func logfmtSpecial(c rune) bool {
+	return c <= ' ' || c == '=' || c == '"' || c == '\\' || c == utf8.RuneError || c == 0x7f
+}
+
+// AccessLayout formats the records of AccessHandler in the Common Log Format
+// of NCSA and Apache, or the Combined one, which adds the referer and the user
+// agent, for the log analyzers which read them:
+//   127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /a.gif HTTP/1.0" 200 2326 "http://example.com/" "Mozilla/4.08"
+// It's selected in the configuration with <property name="format">common</property>
+// or combined.  The other records are formatted with FORMAT_DEFAULT.
+type AccessLayout struct {
+	Combined bool
+}
+
+func (l AccessLayout) Format(rec *LogRecord) []byte {
+	if accessField(rec, "method") == nil {
+		return []byte(formatLogRecord(FORMAT_DEFAULT, "", rec))
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, 160))
+	writeCLF(out, accessField(rec, "remote_addr"))
+	out.WriteString(" - ")
+	writeCLF(out, accessField(rec, "user"))
+	out.WriteString(rec.Created.Format(" [02/Jan/2006:15:04:05 -0700] "))
+	writeCLFQuoted(out, rec.Message)
+	out.WriteByte(' ')
+	writeCLF(out, accessField(rec, "status"))
+	out.WriteByte(' ')
+	if n, _ := accessField(rec, "bytes").(int64); n > 0 {
+		out.WriteString(strconv.FormatInt(n, 10))
+	} else {
+		out.WriteByte('-')
+	}
+	if l.Combined {
+		for _, key := range []string{"referer", "user_agent"} {
+			out.WriteByte(' ')
+			if v, _ := accessField(rec, key).(string); v != "" {
+				writeCLFQuoted(out, v)
+			} else {
+				out.WriteString(`"-"`)
+			}
+		}
+	}
+	out.WriteByte('\n')
+	return out.Bytes()
+}
+
+// The value of the field of a record named key, nil if there is none
+func accessField(rec *LogRecord, key string) interface{} {
+	for _, field := range rec.Fields {
+		if field.Key == key {
+			return field.Value
+		}
+	}
+	return nil
+}
+
+// Write a value of the Common Log Format, - if it's missing or empty
+func writeCLF(out *bytes.Buffer, v interface{}) {
+	s := ""
+	if v != nil {
+		s = fmt.Sprint(v)
+	}
+	if s == "" {
+		out.WriteByte('-')
+		return
+	}
+	for _, c := range s {
+		if c <= ' ' || c == 0x7f {
+			c = '_'
+		}
+		out.WriteRune(c)
+	}
+}
+
+// Write a quoted value of the Common Log Format, escaping the quotes,
+// backslashes and control characters like Apache
+func writeCLFQuoted(out *bytes.Buffer, s string) {
+	out.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			out.WriteByte('\\')
+			out.WriteByte(c)
+		case c < ' ' || c == 0x7f:
+			fmt.Fprintf(out, "\\x%02x", c)
+		default:
+			out.WriteByte(c)
+		}
+	}
+	out.WriteByte('"')
+}
@@ -0,0 +1,75 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Lazy defers an expensive value, e.g. the dump of a large struct, until it's
+// needed.  As an argument of a message, it's computed when the message is
+// formatted, that is if a filter takes the level of the record:
+//
+//	log.Debug("state: %+v", log.Lazy(func() interface{} { return dump(state) }))
+//
+// As the value of a field, it's computed once a filter takes the record, and
+// only once whatever the number of writers:
+//
+//	log.Event("config.loaded", log.F("config", log.Lazy(cfg.Dump)))
+type Lazy func() interface{}
+
+// Format formats the value, with the flags, width and precision of the verb.
+func (l Lazy) Format(f fmt.State, verb rune) {
+	if l == nil {
+		fmt.Fprint(f, "<nil>")
+		return
+	}
+	fmt.Fprintf(f, formatDirective(f, verb), l())
+}
+
+// String returns the value formatted with %v.
+func (l Lazy) String() string {
+	return fmt.Sprint(l)
+}
+
+// The directive for verb with the flags, width and precision of f
+func formatDirective(f fmt.State, verb rune) string {
+	directive := []byte{'%'}
+	for _, flag := range "+-# 0" {
+		if f.Flag(int(flag)) {
+			directive = append(directive, byte(flag))
+		}
+	}
+	if width, ok := f.Width(); ok {
+		directive = strconv.AppendInt(directive, int64(width), 10)
+	}
+	if prec, ok := f.Precision(); ok {
+		directive = append(directive, '.')
+		directive = strconv.AppendInt(directive, int64(prec), 10)
+	}
+	return string(append(directive, string(verb)...))
+}
+
+// Compute the Lazy values of the fields of rec, in a copy of the fields: the
+// caller may log the same fields again, e.g. those of a context
+func resolveLazy(rec *LogRecord) {
+	var fields []Field
+	for i, f := range rec.Fields {
+		l, ok := f.Value.(Lazy)
+		if !ok {
+			continue
+		}
+		if fields == nil {
+			fields = append([]Field(nil), rec.Fields...)
+		}
+		if l == nil {
+			fields[i].Value = nil
+		} else {
+			fields[i].Value = l()
+		}
+	}
+	if fields != nil {
+		rec.Fields = fields
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The levels added by RegisterLevel
+var customLevels = struct {
+	sync.RWMutex
+	names  map[Level]string // The names, e.g. NOTICE
+	abbrev map[Level]string // The names for %L, e.g. NOTI
+	byName map[string]Level // By name in upper case
+}{
+	names:  make(map[Level]string),
+	abbrev: make(map[Level]string),
+	byName: make(map[string]Level),
+}
+
+// RegisterLevel adds a level named name, e.g. NOTICE or SECURITY, which
+// the configuration and the admin API then accept like the builtin ones.  Its
+// value orders it among the others: the records at a level go to the filters
+// whose level is the same or below.  The builtin levels take the values from
+// ACCESS (0) to FATAL (9), so a level of 10 or more is above all of them and a
+// negative one below all of them:
+//
+//	var SECURITY = log.RegisterLevel(20, "SECURITY")
+//	...
+//	log.Logf(SECURITY, "login failed for %s", user)
+//
+// %L prints the first four letters of the name, like the abbreviations of the
+// builtin levels, and the JSON and logfmt layouts too.  The levels must be
+// registered before they are used, usually from a var or init: it panics if
+// value is that of a builtin level, or if value, name or the abbreviation is
+// already registered for another level.  RegisterLevelAbbrev gives another
+// abbreviation, e.g. to NOTIFY next to NOTICE.
+func RegisterLevel(value int, name string) Level {
+	abbrev := name
+	if len(abbrev) > 4 {
+		abbrev = abbrev[:4]
+	}
+	return RegisterLevelAbbrev(value, name, abbrev)
+}
+
+// RegisterLevelAbbrev adds a level like RegisterLevel, which %L prints as
+// abbrev rather than as the first four letters of name:
+//
+//	var NOTIFY = log.RegisterLevelAbbrev(-2, "NOTIFY", "NTFY")
+func RegisterLevelAbbrev(value int, name, abbrev string) Level {
+	lvl := Level(value)
+	if name == "" || abbrev == "" {
+		panic(fmt.Sprintf("log4go: RegisterLevel(%d, %q, %q): empty name or abbreviation", value, name, abbrev))
+	}
+	if lvl >= ACCESS && lvl <= FATAL {
+		panic(fmt.Sprintf("log4go: RegisterLevel(%d, %q): %d is the builtin level %s", value, name, value, levelName(lvl)))
+	}
+	if builtin, err := ParseLevel(name); err == nil && builtin >= ACCESS && builtin <= FATAL {
+		panic(fmt.Sprintf("log4go: RegisterLevel(%d, %q): %s is a builtin level", value, name, name))
+	}
+
+	customLevels.Lock()
+	defer customLevels.Unlock()
+	if old, ok := customLevels.names[lvl]; ok && old != name {
+		panic(fmt.Sprintf("log4go: RegisterLevel(%d, %q): %d is already the level %s", value, name, value, old))
+	}
+	if old, ok := customLevels.byName[strings.ToUpper(name)]; ok && old != lvl {
+		panic(fmt.Sprintf("log4go: RegisterLevel(%d, %q): %s is already the level %d", value, name, name, old))
+	}
+
+	// %L must tell the levels apart
+	for i, builtin := range levelStrings {
+		if strings.EqualFold(abbrev, builtin) {
+			panic(fmt.Sprintf("log4go: RegisterLevel(%d, %q): %s is the abbreviation of the builtin level %s", value, name, abbrev, levelName(Level(i))))
+		}
+	}
+	for old, other := range customLevels.abbrev {
+		if old != lvl && strings.EqualFold(abbrev, other) {
+			panic(fmt.Sprintf("log4go: RegisterLevel(%d, %q): %s is already the abbreviation of the level %s, see RegisterLevelAbbrev", value, name, abbrev, customLevels.names[old]))
+		}
+	}
+	customLevels.names[lvl] = name
+	customLevels.abbrev[lvl] = abbrev
+	customLevels.byName[strings.ToUpper(name)] = lvl
+	return lvl
+}
+
+// ParseLevel returns the level named s, in any case: the names of the
+// configuration (e.g. "WARNING"), the abbreviations printed by %L (e.g.
+// "WARN"), and the names of the levels added by RegisterLevel.  It also takes
+// the value of a level, e.g. "6" for WARNING, so that the levels can come from
+// a flag or the environment as they are:
+//
+//	lvl, err := log.ParseLevel(os.Getenv("LOG_LEVEL"))
+func ParseLevel(s string) (Level, error) {
+	name := strings.ToUpper(strings.TrimSpace(s))
+	if lvl, ok := builtinLevelByName(name); ok {
+		return lvl, nil
+	}
+	for i, abbrev := range levelStrings {
+		if name == abbrev {
+			return Level(i), nil
+		}
+	}
+	if lvl, ok := customLevelByName(name); ok {
+		return lvl, nil
+	}
+	if value, err := strconv.Atoi(name); err == nil {
+		lvl := Level(value)
+		if lvl >= ACCESS && lvl <= FATAL || customLevelName(lvl) != "" {
+			return lvl, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown level %q", s)
+}
+
+// The abbreviation of a registered level, "" for an unknown one
+func customLevelString(lvl Level) string {
+	customLevels.RLock()
+	defer customLevels.RUnlock()
+	return customLevels.abbrev[lvl]
+}
+
+// The name of a registered level, "" for an unknown one
+func customLevelName(lvl Level) string {
+	customLevels.RLock()
+	defer customLevels.RUnlock()
+	return customLevels.names[lvl]
+}
+
+// The registered level named name, in upper case
+func customLevelByName(name string) (Level, bool) {
+	customLevels.RLock()
+	defer customLevels.RUnlock()
+	lvl, ok := customLevels.byName[name]
+	return lvl, ok
+}
@@ -28,12 +28,15 @@
 //   output, but the FileLogWriter does.
 // - The utility functions (Info, Debug, Warn, etc) derive their source from the
 //   calling function, and this incurs extra overhead.
+// - The filters of a Logger can be added and removed (AddFilter, RemoveFilter,
+//   LoadConfiguration) while other goroutines log through it.
 //
 // Changes from 2.0:
 // - The external interface has remained mostly stable, but a lot of the
 //   internals have been changed, so if you depended on any of this or created
 //   your own LogWriter, then you will probably have to update your code.  In
-//   particular, Logger is now a map and ConsoleLogWriter is now a channel
+//   particular, Logger is now a handle on a set of filters swapped atomically
+//   on each change (it was a map), ConsoleLogWriter is now a channel
 //   behind-the-scenes, and the LogWrite method no longer has return values.
 //
 // Future work: (please let me know if you think I should work on any of these particularly)
@@ -52,12 +55,15 @@
 package log4go
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
-	. "github.com/kimiazhu/golib/stack"
+	"github.com/kimiazhu/log4go/stack"
 	"os"
 	"runtime"
-	"strings"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -89,11 +95,14 @@ const (
 
 // Logging level strings
 var (
-	levelStrings = [...]string{"ACCE", "FNST", "FINE", "DEBG", "TRAC", "INFO", "WARN", "EROR", "CRIT"}
+	levelStrings = [...]string{"ACCE", "FNST", "FINE", "DEBG", "TRAC", "INFO", "WARN", "EROR", "CRIT", "FATL"}
 )
 
 func (l Level) String() string {
-	if l < 0 || int(l) > len(levelStrings) {
+	if l < 0 || int(l) >= len(levelStrings) {
+		if s := customLevelString(l); s != "" {
+			return s
+		}
 		return "UNKNOWN"
 	}
 	return levelStrings[int(l)]
@@ -114,6 +123,34 @@ type LogRecord struct {
 	Created time.Time // The time at which the log message was created (nanoseconds)
 	Source  string    // The message source
 	Message string    // The log message
+	Fields  []Field   // Additional key/value pairs, may be nil
+
+	// The id of the logging goroutine, only set when a format prints it
+	Goroutine int64 `json:",omitempty"`
+
+	// The nested diagnostic context, outermost first (see PushContext)
+	NDC []string `json:",omitempty"`
+
+	// The mapped diagnostic context, see MDCSet.  It must not be modified.
+	MDC map[string]string `json:",omitempty"`
+
+	// The name of the NamedLogger which logged the record, if any
+	Name string `json:",omitempty"`
+
+	// The writers still to release the record, see recordPool
+	refs int32
+}
+
+// A Field is a key/value pair attached to a LogRecord in addition to the
+// message, e.g. the remaining deadline of a context.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F is a shorthand for Field{key, value}.
+func F(key string, value interface{}) Field {
+	return Field{key, value}
 }
 
 /****** LogWriter ******/
@@ -135,19 +172,150 @@ type LogWriter interface {
 type Filter struct {
 	Level Level
 	LogWriter
+
+	// The prefixes of the sources whose records are left out.  Whether they
+	// match is cached per call site: set another slice to change them, rather
+	// than its elements.
 	Excludes []string
+	Access   AccessMode
+
+	// The records at or above this level get the call stack appended to their
+	// message, like Critical does.  ACCESS, the zero value, appends none.
+	// The stack is printed in StackFormat, with StackDepth frames at most
+	// (all of them if 0).
+	StackLevel  Level
+	StackFormat stack.Format
+	StackDepth  int
+
+	// The sampler which decides which of the accepted records are written, all
+	// of them if nil
+	Sampler Sampler
+
+	// The redactor which scrubs the records before they are written, none if
+	// nil
+	Redactor *Redactor
+
+	// An audit filter only gets the records of Logger.Audit, whatever its
+	// level
+	Audit bool
+
+	// The level set by SetLevel plus one, 0 if it was never called
+	override int64
+
+	// The *excludeSet of Excludes, see excluded
+	excludes atomic.Value
+
+	// The Predicate set by SetPredicate
+	predicate atomic.Value
+
+	// The configuration the filter was created from, nil if it was added in
+	// code
+	config *FilterConfig
+
+	// The routes of the configuration, if they concern the filter
+	routes []RouteConfig
+
+	// The configurations of the filters with the same tag merged into this
+	// one, see LoggerConfig.Duplicates
+	merged []FilterConfig
+}
+
+// SetLevel changes the level of the filter while records are being logged,
+// e.g. from the admin API.  Setting Level directly is only safe before the
+// filter is in use.
+func (f *Filter) SetLevel(lvl Level) {
+	atomic.StoreInt64(&f.override, int64(lvl)+1)
+}
+
+// CurrentLevel returns the level of the filter, as changed by SetLevel, or else
+// by OverrideLevel.
+func (f *Filter) CurrentLevel() Level {
+	if o := atomic.LoadInt64(&f.override); o != 0 {
+		return Level(o - 1)
+	}
+	if lvl, ok := overriddenLevel(); ok {
+		return lvl
+	}
+	return f.Level
+}
+
+// How a filter treats the ACCESS records
+type AccessMode int
+
+const (
+	// ACCESS records are written if the level of the filter is ACCESS, like
+	// the other records.  A filter tagged "access" is AccessOnly though.
+	AccessInclude AccessMode = iota
+
+	// Only the ACCESS records are written, whatever the level: an access log
+	AccessOnly
+
+	// ACCESS records are never written: an application log, which keeps the
+	// lowest level without being flooded by the access log
+	AccessExclude
+)
+
+// The name of the mode in the configuration, see <access>
+func (m AccessMode) String() string {
+	switch m {
+	case AccessInclude:
+		return "include"
+	case AccessOnly:
+		return "only"
+	case AccessExclude:
+		return "exclude"
+	}
+	return fmt.Sprintf("AccessMode(%d)", int(m))
+}
+
+// Report whether the filter tagged tag accepts a record at lvl, before the
+// excludes.  An audit filter only gets the audit records, see Logger.Audit.
+func (f *Filter) accepts(tag string, lvl Level) bool {
+	if f.Audit {
+		return false
+	}
+	mode := f.Access
+	if mode == AccessInclude && tag == "access" {
+		mode = AccessOnly
+	}
+	switch mode {
+	case AccessOnly:
+		return lvl == ACCESS
+	case AccessExclude:
+		return lvl != ACCESS && lvl >= f.CurrentLevel()
+	}
+	return lvl >= f.CurrentLevel()
 }
 
 // A Logger represents a collection of Filters through which log messages are
-// written.
-type Logger map[string]*Filter
+// written.  A Logger is a handle on its filters: the copies of a Logger share
+// them, and they can be added, replaced and removed while other goroutines log
+// through it.  The logging doesn't lock: it goes through the filters of the
+// moment, which a change replaces as a whole.  The zero Logger has no filters
+// and can't be changed, use NewLogger.
+type Logger struct {
+	fs *loggerFilters
+}
 
-// Create a new logger.
-//
-// DEPRECATED: Use make(Logger) instead.
+// The filters of a Logger
+type loggerFilters struct {
+	mu      sync.Mutex   // serializes the changes
+	current atomic.Value // *filterSet
+	config  string       // the file of a logger made by NewLoggerFromConfig
+}
+
+// The filters of a Logger at some point, by tag.  A set is never modified once
+// in use, a change makes a new one.
+type filterSet struct {
+	filters map[string]*Filter
+	active  int32 // the records being dispatched to the filters
+}
+
+// Create a new logger, without filters.
 func NewLogger() Logger {
-	os.Stderr.WriteString("warning: use of deprecated NewLogger\n")
-	return make(Logger)
+	fs := new(loggerFilters)
+	fs.current.Store(&filterSet{filters: make(map[string]*Filter)})
+	return Logger{fs}
 }
 
 // Create a new logger with a "stdout" filter configured to send log messages at
@@ -156,17 +324,63 @@ func NewLogger() Logger {
 // DEPRECATED: use NewDefaultLogger instead.
 func NewConsoleLogger(lvl Level) Logger {
 	os.Stderr.WriteString("warning: use of deprecated NewConsoleLogger\n")
-	return Logger{
-		"stdout": &Filter{lvl, NewConsoleLogWriter(), nil},
-	}
+	return NewDefaultLogger(lvl)
 }
 
 // Create a new logger with a "stdout" filter configured to send log messages at
 // or above lvl to standard output.
 func NewDefaultLogger(lvl Level) Logger {
-	return Logger{
-		"stdout": &Filter{lvl, NewConsoleLogWriter(), nil},
+	return NewLogger().AddFilter("stdout", lvl, NewConsoleLogWriter())
+}
+
+// The current filters, by tag, which must not be modified
+func (log Logger) filters() map[string]*Filter {
+	if log.fs == nil {
+		return nil
+	}
+	return log.fs.current.Load().(*filterSet).filters
+}
+
+// The current filters, held until release so that a change doesn't close them
+// meanwhile
+func (log Logger) acquire() *filterSet {
+	for {
+		set := log.fs.current.Load().(*filterSet)
+		atomic.AddInt32(&set.active, 1)
+		if log.fs.current.Load() == set {
+			return set
+		}
+		atomic.AddInt32(&set.active, -1)
+	}
+}
+
+func (set *filterSet) release() {
+	atomic.AddInt32(&set.active, -1)
+}
+
+// Change the filters: change modifies a copy of the current filters, and
+// returns the filters it took out.  They are returned once no record is on
+// its way to them anymore, ready to be closed.
+func (log Logger) change(change func(filters map[string]*Filter) []*Filter) []*Filter {
+	if log.fs == nil {
+		panic("log4go: the zero Logger can't be changed, use NewLogger")
+	}
+	log.fs.mu.Lock()
+	defer log.fs.mu.Unlock()
+
+	old := log.fs.current.Load().(*filterSet)
+	filters := make(map[string]*Filter, len(old.filters))
+	for tag, filt := range old.filters {
+		filters[tag] = filt
+	}
+	retired := change(filters)
+	log.fs.current.Store(&filterSet{filters: filters})
+
+	// Every change waits, so only the previous set can still be in use
+	for atomic.LoadInt32(&old.active) > 0 {
+		time.Sleep(100 * time.Microsecond)
 	}
+	return retired
 }
 
 // Closes all log writers in preparation for exiting the program or a
@@ -174,43 +388,245 @@ func NewDefaultLogger(lvl Level) Logger {
 // you want to guarantee that all log messages are written.  Close removes
 // all filters (and thus all LogWriters) from the logger.
 func (log Logger) Close() {
-	// Close all open loggers
-	for name, filt := range log {
+	if log.fs == nil {
+		return
+	}
+	retired := log.change(func(filters map[string]*Filter) []*Filter {
+		var retired []*Filter
+		for name, filt := range filters {
+			retired = append(retired, filt)
+			delete(filters, name)
+		}
+		return retired
+	})
+	for _, filt := range retired {
 		filt.Close()
-		delete(log, name)
+	}
+	if log.isolated() {
+		forgetIsolated(log)
+	}
+}
+
+// Flush writes out the records buffered by the writers of the logger, see
+// Flusher.
+func (log Logger) Flush() {
+	for _, filt := range log.filters() {
+		if f, ok := filt.LogWriter.(Flusher); ok {
+			f.Flush()
+		}
 	}
 }
 
 // Add a new LogWriter to the Logger which will only log messages at lvl or
-// higher.  This function should not be called from multiple goroutines.
-// Returns the logger for chaining.
+// higher.  A filter with the same name is replaced, but not closed.  Returns
+// the logger for chaining.
 func (log Logger) AddFilter(name string, lvl Level, writer LogWriter) Logger {
-	log[name] = &Filter{lvl, writer, nil}
+	return log.SetFilter(name, &Filter{Level: lvl, LogWriter: writer})
+}
+
+// Add a LogWriter which only logs the ACCESS records, i.e. an access log.
+// Combine with AccessExclude on the other filters to keep the access records
+// out of the application logs.  Returns the logger for chaining.
+func (log Logger) AddAccessFilter(name string, writer LogWriter) Logger {
+	return log.SetFilter(name, &Filter{Level: ACCESS, LogWriter: writer, Access: AccessOnly})
+}
+
+// Add a filter tagged tag, or replace the filter with that tag, which isn't
+// closed.  Returns the logger for chaining.
+func (log Logger) SetFilter(tag string, filt *Filter) Logger {
+	log.change(func(filters map[string]*Filter) []*Filter {
+		filters[tag] = filt
+		return nil
+	})
 	return log
 }
 
+// RemoveFilter takes the filter tagged tag out of the logger, and returns it,
+// nil if there is none.  It isn't closed: no record goes to it anymore once
+// RemoveFilter returns, so it can be closed then.
+func (log Logger) RemoveFilter(tag string) *Filter {
+	retired := log.change(func(filters map[string]*Filter) []*Filter {
+		filt, ok := filters[tag]
+		if !ok {
+			return nil
+		}
+		delete(filters, tag)
+		return []*Filter{filt}
+	})
+	if len(retired) == 0 {
+		return nil
+	}
+	return retired[0]
+}
+
+// ReplaceFilters replaces all the filters of the logger with filters at once,
+// and returns the previous ones by tag.  They aren't closed: no record goes to
+// them anymore once ReplaceFilters returns, and they can be put back the same
+// way, e.g. after a test captured the records.
+func (log Logger) ReplaceFilters(filters map[string]*Filter) map[string]*Filter {
+	previous := make(map[string]*Filter)
+	log.change(func(current map[string]*Filter) []*Filter {
+		for tag, filt := range current {
+			previous[tag] = filt
+			delete(current, tag)
+		}
+		for tag, filt := range filters {
+			current[tag] = filt
+		}
+		return nil
+	})
+	return previous
+}
+
+// Filter returns the filter tagged tag, nil if there is none.
+func (log Logger) Filter(tag string) *Filter {
+	return log.filters()[tag]
+}
+
+// Filters returns the filters of the logger by tag, a copy which the changes
+// of the logger don't affect.
+func (log Logger) Filters() map[string]*Filter {
+	filters := make(map[string]*Filter)
+	for tag, filt := range log.filters() {
+		filters[tag] = filt
+	}
+	return filters
+}
+
 /******* Logging *******/
-// Send a formatted log message internally
-func (log Logger) intLogf(lvl Level, format string, args ...interface{}) {
-	skip := true
+// Report whether no filter would accept a record at lvl
+func (log Logger) skip(lvl Level) bool {
+	for tag, filt := range log.filters() {
+		if filt.accepts(tag, lvl) {
+			return false
+		}
+	}
+	return true
+}
 
-	// Determine if any logging will be done
-	for _, filt := range log {
-		if lvl == ACCESS || lvl >= filt.Level {
-			skip = false
-			break
+// Dispatch a record to every filter which accepts it, with the context of the
+// caller
+func (log Logger) dispatch(rec *LogRecord) {
+	if log.fs == nil {
+		return
+	}
+	if rec.Goroutine == 0 && atomic.LoadInt32(&goroutineIDWanted) != 0 {
+		rec.Goroutine = goroutineID()
+	}
+	if rec.MDC == nil {
+		rec.MDC = currentMDC()
+	}
+	addWorkerID(rec)
+	log.dispatchRecord(rec, true)
+}
+
+// Forward logs a record made elsewhere, e.g. received from another process
+// (see Collector), as it is: its time, source, fields and context are kept,
+// only the filters of the logger apply.  The record must not be used after.
+func (log Logger) Forward(rec *LogRecord) {
+	if log.fs == nil || log.skip(rec.Level) {
+		return
+	}
+	log.dispatchRecord(rec, false)
+}
+
+// Dispatch a record, complete, to the filters, with the call stack for those
+// which want it if stacks is true
+func (log Logger) dispatchRecord(rec *LogRecord, stacks bool) {
+	// The filters which take the record, and the copy of the record with the
+	// call stack, made for the first filter which wants it.  Everything is
+	// decided before the first write: a writer may give the record back to the
+	// pool as soon as it has it.
+	var targetsBuf [8]dispatchTarget
+	targets := targetsBuf[:0]
+	var frames []stack.Frame
+	var stacked []stackedRecord
+	var site *sourceSite
+	plain, releasing := 0, true
+	set := log.acquire()
+	defer set.release()
+	for tag, filt := range set.filters {
+		if !filt.accepts(tag, rec.Level) || filt.excluded(rec.Source, &site) {
+			continue
+		}
+		if !filt.keeps(rec) {
+			continue
+		}
+		if filt.Sampler != nil && !filt.Sampler.Keep(rec) {
+			continue
+		}
+		if len(targets) == 0 {
+			resolveLazy(rec)
 		}
+		target := dispatchTarget{tag, filt, rec}
+		if stacks && filt.wantsStack(rec.Level) {
+			if frames == nil {
+				frames = callerFrames()
+			}
+			target.rec, stacked = withStack(rec, filt, frames, stacked)
+		}
+		if filt.Redactor != nil {
+			target.rec = filt.Redactor.Redact(target.rec)
+		}
+		if target.rec == rec {
+			plain++
+			if _, ok := filt.LogWriter.(recordReleaser); !ok {
+				releasing = false
+			}
+		}
+		targets = append(targets, target)
+	}
+	if len(targets) > 0 {
+		account(rec)
+		indexError(rec)
+	}
+
+	pooled := rec.refs < 0
+	switch {
+	case !pooled:
+	case plain > 0 && releasing:
+		rec.refs = int32(plain)
+	default:
+		rec.refs = 0
 	}
-	if skip {
+	for _, target := range targets {
+		target.filt.write(target.tag, target.rec)
+	}
+	if pooled && plain == 0 {
+		*rec = LogRecord{}
+		recordPool.Put(rec)
+	}
+}
+
+// A filter a record is dispatched to, with the record it gets
+type dispatchTarget struct {
+	tag  string
+	filt *Filter
+	rec  *LogRecord
+}
+
+// The id of the current goroutine, from the header of its stack trace:
+// "goroutine 42 [running]:"
+func goroutineID() int64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	b = bytes.TrimPrefix(b, []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i > 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseInt(string(b), 10, 64)
+	return id
+}
+
+// Send a formatted log message internally
+func (log Logger) intLogf(lvl Level, format string, args ...interface{}) {
+	// Determine if any logging will be done
+	if log.skip(lvl) {
 		return
 	}
 
 	// Determine caller func
-	pc, _, lineno, ok := runtime.Caller(2)
-	src := ""
-	if ok {
-		src = fmt.Sprintf("%s:%d", runtime.FuncForPC(pc).Name(), lineno)
-	}
+	src := callerSource(2)
 
 	msg := format
 	if len(args) > 0 {
@@ -218,94 +634,145 @@ func (log Logger) intLogf(lvl Level, format string, args ...interface{}) {
 	}
 
 	// Make the log record
-	rec := &LogRecord{
-		Level:   lvl,
-		Created: time.Now(),
-		Source:  src,
-		Message: msg,
-	}
-
-	// Dispatch the logs
-	for tag, filt := range log {
-		if lvl == ACCESS && tag == "access" && !(filt.excluded(src)) {
-			filt.LogWrite(rec)
-		} else if tag != "access" && lvl >= filt.Level && (!filt.excluded(src)) {
-			filt.LogWrite(rec)
-		}
-	}
+	rec := newRecord(lvl, src, msg)
+
+	log.dispatch(rec)
 }
 
 // Send a closure log message internally
 func (log Logger) intLogc(lvl Level, closure func() string) {
-	skip := true
+	// Determine if any logging will be done
+	if log.skip(lvl) {
+		return
+	}
 
+	// Determine caller func
+	src := callerSource(2)
+
+	// Make the log record
+	rec := newRecord(lvl, src, closure())
+
+	log.dispatch(rec)
+}
+
+// Send a closure log message with fields internally
+func (log Logger) intLogcFields(lvl Level, closure func() (string, []Field)) {
 	// Determine if any logging will be done
-	for _, filt := range log {
-		if lvl == ACCESS || lvl >= filt.Level {
-			skip = false
-			break
-		}
+	if log.skip(lvl) {
+		return
 	}
-	if skip {
+
+	// Determine caller func
+	src := callerSource(2)
+
+	// Make the log record
+	rec := newRecord(lvl, src, "")
+	rec.Message, rec.Fields = closure()
+
+	log.dispatch(rec)
+}
+
+// Send the arguments formatted like Sprintln internally
+func (log Logger) intLogln(lvl Level, args ...interface{}) {
+	// Determine if any logging will be done
+	if log.skip(lvl) {
 		return
 	}
 
 	// Determine caller func
-	pc, _, lineno, ok := runtime.Caller(2)
-	src := ""
-	if ok {
-		src = fmt.Sprintf("%s:%d", runtime.FuncForPC(pc).Name(), lineno)
+	src := callerSource(2)
+
+	// Make the log record
+	rec := newRecord(lvl, src, sprintln(args...))
+
+	log.dispatch(rec)
+}
+
+// Format the arguments like fmt.Sprintln, without the trailing newline
+func sprintln(args ...interface{}) string {
+	msg := fmt.Sprintln(args...)
+	return msg[:len(msg)-1]
+}
+
+// Send a log message built from the arguments of Debug and the like
+// internally, see argsMessage.  A closure is only called if the message will
+// be logged.
+func (log Logger) intLogv(lvl Level, arg0 interface{}, args []interface{}) {
+	// Determine if any logging will be done
+	if log.skip(lvl) {
+		return
 	}
 
+	// Determine caller func
+	src := callerSource(2)
+
 	// Make the log record
-	rec := &LogRecord{
-		Level:   lvl,
-		Created: time.Now(),
-		Source:  src,
-		Message: closure(),
-	}
-
-	// Dispatch the logs
-	for tag, filt := range log {
-		if lvl == ACCESS && tag == "access" && !(filt.excluded(src)) {
-			filt.LogWrite(rec)
-		} else if tag != "access" && lvl >= filt.Level && (!filt.excluded(src)) {
-			filt.LogWrite(rec)
+	rec := newRecord(lvl, src, argsMessage(arg0, args))
+
+	log.dispatch(rec)
+}
+
+// Build the message from the arguments of Debug and the like:
+//   - a string is a format for the other arguments (used as is without them)
+//   - a func() string returns the message, the other arguments are ignored
+//   - a func(interface{}) string is called with the first of the other
+//     arguments (nil if there is none)
+//   - anything else is printed with the other arguments like Sprintln, that
+//     is always separated by spaces
+func argsMessage(arg0 interface{}, args []interface{}) string {
+	switch first := arg0.(type) {
+	case string:
+		if len(args) == 0 {
+			return first
+		}
+		return fmt.Sprintf(first, args...)
+	case func() string:
+		if first == nil {
+			return "<nil>"
 		}
+		return first()
+	case func(interface{}) string:
+		if first == nil {
+			return "<nil>"
+		}
+		var arg interface{}
+		if len(args) > 0 {
+			arg = args[0]
+		}
+		return first(arg)
+	default:
+		return sprintln(append([]interface{}{arg0}, args...)...)
 	}
 }
 
+// Send a log message with fields internally
+func (log Logger) intLogFields(lvl Level, fields []Field, msg string) {
+	// Determine if any logging will be done
+	if log.skip(lvl) {
+		return
+	}
+
+	// Determine caller func
+	src := callerSource(2)
+
+	// Make the log record
+	rec := newRecord(lvl, src, msg)
+	rec.Fields = fields
+
+	log.dispatch(rec)
+}
+
 // Send a log message with manual level, source, and message.
 func (log Logger) Log(lvl Level, source, message string) {
-	skip := true
-
 	// Determine if any logging will be done
-	for _, filt := range log {
-		if lvl == ACCESS || lvl >= filt.Level {
-			skip = false
-			break
-		}
-	}
-	if skip {
+	if log.skip(lvl) {
 		return
 	}
 
 	// Make the log record
-	rec := &LogRecord{
-		Level:   lvl,
-		Created: time.Now(),
-		Source:  source,
-		Message: message,
-	}
-
-	// Dispatch the logs
-	for tag, filt := range log {
-		if lvl == ACCESS && tag == "access" && !(filt.excluded(source)) {
-			filt.LogWrite(rec)
-		} else if tag != "access" && lvl >= filt.Level && (!filt.excluded(source)) {
-			filt.LogWrite(rec)
-		}
-	}
+	rec := newRecord(lvl, source, message)
+
+	log.dispatch(rec)
 }
 
 // Logf logs a formatted log message at the given log level, using the caller as
@@ -320,210 +787,328 @@ func (log Logger) Logc(lvl Level, closure func() string) {
 	log.intLogc(lvl, closure)
 }
 
+// LogcFields logs the message and the fields returned by the closure at the
+// given log level, using the caller as its source.  If no log message would be
+// written, the closure is never called, so it is the place to build expensive
+// structured payloads:
+//
+//	log.LogcFields(DEBUG, func() (string, []Field) {
+//		return "cache state", []Field{F("entries", cache.Dump())}
+//	})
+func (log Logger) LogcFields(lvl Level, closure func() (string, []Field)) {
+	log.intLogcFields(lvl, closure)
+}
+
 // Finest logs a message at the finest log level.
 // See Debug for an explanation of the arguments.
 func (log Logger) Finest(arg0 interface{}, args ...interface{}) {
-	const (
-		lvl = FINEST
-	)
-	switch first := arg0.(type) {
-	case string:
-		// Use the string as a format string
-		log.intLogf(lvl, first, args...)
-	case func() string:
-		// Log the closure (no other arguments used)
-		log.intLogc(lvl, first)
-	default:
-		// Build a format string so that it will be similar to Sprint
-		log.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
-	}
+	log.intLogv(FINEST, arg0, args)
 }
 
 // Fine logs a message at the fine log level.
 // See Debug for an explanation of the arguments.
 func (log Logger) Fine(arg0 interface{}, args ...interface{}) {
-	const (
-		lvl = FINE
-	)
-	switch first := arg0.(type) {
-	case string:
-		// Use the string as a format string
-		log.intLogf(lvl, first, args...)
-	case func() string:
-		// Log the closure (no other arguments used)
-		log.intLogc(lvl, first)
-	default:
-		// Build a format string so that it will be similar to Sprint
-		log.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
-	}
+	log.intLogv(FINE, arg0, args)
 }
 
 // Debug is a utility method for debug log messages.
 // The behavior of Debug depends on the first argument:
-// - arg0 is a string
-//   When given a string as the first argument, this behaves like Logf but with
-//   the DEBUG log level: the first argument is interpreted as a format for the
-//   latter arguments.
-// - arg0 is a func()string
-//   When given a closure of type func()string, this logs the string returned by
-//   the closure iff it will be logged.  The closure runs at most one time.
-// - arg0 is interface{}
-//   When given anything else, the log message will be each of the arguments
-//   formatted with %v and separated by spaces (ala Sprint).
+//   - arg0 is a string
+//     When given a string as the first argument, this behaves like Logf but with
+//     the DEBUG log level: the first argument is interpreted as a format for the
+//     latter arguments.  Without latter arguments, the string is logged as is.
+//   - arg0 is a func()string
+//     When given a closure of type func()string, this logs the string returned by
+//     the closure iff it will be logged.  The closure runs at most one time.
+//   - arg0 is a func(interface{})string
+//     Same as a func()string, called with the second argument (or nil).
+//   - arg0 is interface{}
+//     When given anything else, the log message will be each of the arguments
+//     formatted with %v and separated by spaces (ala Sprintln).
 func (log Logger) Debug(arg0 interface{}, args ...interface{}) {
-	const (
-		lvl = DEBUG
-	)
-	switch first := arg0.(type) {
-	case string:
-		// Use the string as a format string
-		log.intLogf(lvl, first, args...)
-	case func() string:
-		// Log the closure (no other arguments used)
-		log.intLogc(lvl, first)
-	default:
-		// Build a format string so that it will be similar to Sprint
-		log.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
-	}
+	log.intLogv(DEBUG, arg0, args)
 }
 
 // Trace logs a message at the trace log level.
 // See Debug for an explanation of the arguments.
 func (log Logger) Trace(arg0 interface{}, args ...interface{}) {
-	const (
-		lvl = TRACE
-	)
-	switch first := arg0.(type) {
-	case string:
-		// Use the string as a format string
-		log.intLogf(lvl, first, args...)
-	case func() string:
-		// Log the closure (no other arguments used)
-		log.intLogc(lvl, first)
-	default:
-		// Build a format string so that it will be similar to Sprint
-		log.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
-	}
+	log.intLogv(TRACE, arg0, args)
 }
 
 // Info logs a message at the info log level.
 // See Debug for an explanation of the arguments.
 func (log Logger) Info(arg0 interface{}, args ...interface{}) {
-	const (
-		lvl = INFO
-	)
-	switch first := arg0.(type) {
-	case string:
-		// Use the string as a format string
-		log.intLogf(lvl, first, args...)
-	case func() string:
-		// Log the closure (no other arguments used)
-		log.intLogc(lvl, first)
-	default:
-		// Build a format string so that it will be similar to Sprint
-		log.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
-	}
+	log.intLogv(INFO, arg0, args)
 }
 
 // Info logs a message at the Access log level.
 // See Debug for an explanation of the arguments.
 // The tag of access log MUST be <tag>access</tag>
 func (log Logger) Access(arg0 interface{}, args ...interface{}) {
-	const (
-		lvl = ACCESS
-	)
-	switch first := arg0.(type) {
-	case string:
-		// Use the string as a format string
-		log.intLogf(lvl, first, args...)
-	case func() string:
-		// Log the closure (no other arguments used)
-		log.intLogc(lvl, first)
-	default:
-		// Build a format string so that it will be similar to Sprint
-		log.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
-	}
+	log.intLogv(ACCESS, arg0, args)
 }
 
-// Warn logs a message at the warning log level and returns the formatted error.
-// At the warning level and higher, there is no performance benefit if the
-// message is not actually logged, because all formats are processed and all
-// closures are executed to format the error message.
+// Warn logs a message at the warning log level and returns the formatted error,
+// which wraps the first of the arguments which is an error, if any, for
+// errors.Is and errors.As.  At the warning level and higher, there is no
+// performance benefit if the message is not actually logged, because all
+// formats are processed and all closures are executed to format the error
+// message.
 // See Debug for further explanation of the arguments.
 func (log Logger) Warn(arg0 interface{}, args ...interface{}) error {
-	const (
-		lvl = WARNING
-	)
-	var msg string
-	switch first := arg0.(type) {
-	case string:
-		// Use the string as a format string
-		msg = fmt.Sprintf(first, args...)
-	case func() string:
-		// Log the closure (no other arguments used)
-		msg = first()
-	default:
-		// Build a format string so that it will be similar to Sprint
-		msg = fmt.Sprintf(fmt.Sprint(first)+strings.Repeat(" %v", len(args)), args...)
-	}
-	log.intLogf(lvl, msg)
-	return errors.New(msg)
+	msg := argsMessage(arg0, args)
+	log.intLogv(WARNING, msg, nil)
+	return argsError(msg, arg0, args)
 }
 
 // Error logs a message at the error log level and returns the formatted error,
 // See Warn for an explanation of the performance and Debug for an explanation
 // of the parameters.
 func (log Logger) Error(arg0 interface{}, args ...interface{}) error {
-	const (
-		lvl = ERROR
-	)
-	var msg string
-	switch first := arg0.(type) {
-	case string:
-		// Use the string as a format string
-		msg = fmt.Sprintf(first, args...)
-	case func() string:
-		// Log the closure (no other arguments used)
-		msg = first()
-	default:
-		// Build a format string so that it will be similar to Sprint
-		msg = fmt.Sprintf(fmt.Sprint(first)+strings.Repeat(" %v", len(args)), args...)
-	}
-	log.intLogf(lvl, msg)
-	return errors.New(msg)
+	msg := argsMessage(arg0, args)
+	log.intLogv(ERROR, msg, nil)
+	return argsError(msg, arg0, args)
 }
 
 // Critical logs a message at the critical log level and returns the formatted error,
 // See Warn for an explanation of the performance and Debug for an explanation
 // of the parameters. This method will log the error stacks
 func (log Logger) Critical(arg0 interface{}, args ...interface{}) error {
-	const (
-		lvl = CRITICAL
-	)
-	var msg string
-	switch first := arg0.(type) {
-	case string:
-		// Use the string as a format string
-		msg = fmt.Sprintf(first+"\n%s", args, CallStack(3))
-	case func() string:
-		// Log the closure (no other arguments used)
-		//msg = first()
-		msg = fmt.Sprintf("%s\n%s", first(), CallStack(3))
-	default:
-		// Build a format string so that it will be similar to Sprint
-		msg = fmt.Sprintf("%s\n%s",fmt.Sprintf(fmt.Sprint(first)+strings.Repeat(" %v", len(args))+"\n%s", args...),CallStack(3))
+	msg := argsMessage(arg0, args)
+	if !log.skip(CRITICAL) {
+		log.intLogv(CRITICAL, msg+"\n"+callStack(), nil)
 	}
-	log.intLogf(lvl, msg)
+	return argsError(msg, arg0, args)
+}
+
+/******* Fatal and Panic *******/
+// These match the functions of the standard log package: the arguments are
+// formatted like Sprintln (without the newline) or Sprintf, and logged at the
+// critical level.
+
+// Fatal logs the arguments, runs the exit hooks (see AddExitHook), closes the
+// logger so that the records get written, and exits with status 1.
+func (log Logger) Fatal(args ...interface{}) {
+	log.intLogln(CRITICAL, args...)
+	log.crashDump(sprintln(args...))
+	log.exit(1)
+}
+
+// Fatalf logs the formatted message, runs the exit hooks (see AddExitHook),
+// closes the logger so that the records get written, and exits with status 1.
+func (log Logger) Fatalf(format string, args ...interface{}) {
+	log.intLogf(CRITICAL, format, args...)
+	log.crashDump(fmt.Sprintf(format, args...))
+	log.exit(1)
+}
+
+// Panic logs the arguments and panics with the message.  The logger stays
+// open, the panic may be recovered.
+func (log Logger) Panic(args ...interface{}) {
+	msg := sprintln(args...)
+	log.intLogv(CRITICAL, msg, nil)
+	log.crashDump(msg)
+	panic(msg)
+}
+
+// Panicf logs the formatted message and panics with it.  The logger stays
+// open, the panic may be recovered.
+func (log Logger) Panicf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	log.intLogv(CRITICAL, msg, nil)
+	log.crashDump(msg)
+	panic(msg)
+}
+
+/******* Explicit variants *******/
+// Unlike Debug and the like, which guess from the type of their first argument
+// whether it's a format, a closure or a value, the variants below say what
+// they expect: f for a format (checked by go vet), ln for values and c for a
+// closure.
+
+// Finestf logs a message at the finest log level, formatted with fmt.Sprintf.
+func (log Logger) Finestf(format string, args ...interface{}) {
+	log.intLogf(FINEST, format, args...)
+}
+
+// Finestln logs the arguments at the finest log level, formatted with
+// fmt.Sprintln (without the newline).
+func (log Logger) Finestln(args ...interface{}) {
+	log.intLogln(FINEST, args...)
+}
+
+// Finestc logs the string returned by the closure at the finest log level.  The
+// closure is only called if the message will be logged.
+func (log Logger) Finestc(closure func() string) {
+	log.intLogc(FINEST, closure)
+}
+
+// Finef logs a message at the fine log level, formatted with fmt.Sprintf.
+func (log Logger) Finef(format string, args ...interface{}) {
+	log.intLogf(FINE, format, args...)
+}
+
+// Fineln logs the arguments at the fine log level, formatted with
+// fmt.Sprintln (without the newline).
+func (log Logger) Fineln(args ...interface{}) {
+	log.intLogln(FINE, args...)
+}
+
+// Finec logs the string returned by the closure at the fine log level.  The
+// closure is only called if the message will be logged.
+func (log Logger) Finec(closure func() string) {
+	log.intLogc(FINE, closure)
+}
+
+// Debugf logs a message at the debug log level, formatted with fmt.Sprintf.
+func (log Logger) Debugf(format string, args ...interface{}) {
+	log.intLogf(DEBUG, format, args...)
+}
+
+// Debugln logs the arguments at the debug log level, formatted with
+// fmt.Sprintln (without the newline).
+func (log Logger) Debugln(args ...interface{}) {
+	log.intLogln(DEBUG, args...)
+}
+
+// Debugc logs the string returned by the closure at the debug log level.  The
+// closure is only called if the message will be logged.
+func (log Logger) Debugc(closure func() string) {
+	log.intLogc(DEBUG, closure)
+}
+
+// Tracef logs a message at the trace log level, formatted with fmt.Sprintf.
+func (log Logger) Tracef(format string, args ...interface{}) {
+	log.intLogf(TRACE, format, args...)
+}
+
+// Traceln logs the arguments at the trace log level, formatted with
+// fmt.Sprintln (without the newline).
+func (log Logger) Traceln(args ...interface{}) {
+	log.intLogln(TRACE, args...)
+}
+
+// Tracec logs the string returned by the closure at the trace log level.  The
+// closure is only called if the message will be logged.
+func (log Logger) Tracec(closure func() string) {
+	log.intLogc(TRACE, closure)
+}
+
+// Infof logs a message at the info log level, formatted with fmt.Sprintf.
+func (log Logger) Infof(format string, args ...interface{}) {
+	log.intLogf(INFO, format, args...)
+}
+
+// Infoln logs the arguments at the info log level, formatted with
+// fmt.Sprintln (without the newline).
+func (log Logger) Infoln(args ...interface{}) {
+	log.intLogln(INFO, args...)
+}
+
+// Infoc logs the string returned by the closure at the info log level.  The
+// closure is only called if the message will be logged.
+func (log Logger) Infoc(closure func() string) {
+	log.intLogc(INFO, closure)
+}
+
+// Accessf logs a message at the access log level, formatted with fmt.Sprintf.  The tag of the access log MUST be <tag>access</tag>.
+func (log Logger) Accessf(format string, args ...interface{}) {
+	log.intLogf(ACCESS, format, args...)
+}
+
+// Accessln logs the arguments at the access log level, formatted with
+// fmt.Sprintln (without the newline).
+func (log Logger) Accessln(args ...interface{}) {
+	log.intLogln(ACCESS, args...)
+}
+
+// Accessc logs the string returned by the closure at the access log level.  The
+// closure is only called if the message will be logged.
+func (log Logger) Accessc(closure func() string) {
+	log.intLogc(ACCESS, closure)
+}
+
+// Warnf logs a message at the warning log level, formatted with fmt.Sprintf,
+// and returns it as an error.
+func (log Logger) Warnf(format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	log.intLogv(WARNING, msg, nil)
+	return argsError(msg, nil, args)
+}
+
+// Warnln logs the arguments at the warning log level, formatted with
+// fmt.Sprintln (without the newline), and returns them as an error.
+func (log Logger) Warnln(args ...interface{}) error {
+	msg := sprintln(args...)
+	log.intLogv(WARNING, msg, nil)
+	return argsError(msg, nil, args)
+}
+
+// Warnc logs the string returned by the closure at the warning log level, and
+// returns it as an error.  The closure is always called.
+func (log Logger) Warnc(closure func() string) error {
+	msg := closure()
+	log.intLogv(WARNING, msg, nil)
 	return errors.New(msg)
 }
 
-func (f *Filter) excluded(src string) bool {
-	if f.Excludes != nil {
-		for _, ex := range f.Excludes {
-			if strings.HasPrefix(src, ex) {
-				return true
-			}
-		}
+// Errorf logs a message at the error log level, formatted with fmt.Sprintf,
+// and returns it as an error.
+func (log Logger) Errorf(format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	log.intLogv(ERROR, msg, nil)
+	return argsError(msg, nil, args)
+}
+
+// Errorln logs the arguments at the error log level, formatted with
+// fmt.Sprintln (without the newline), and returns them as an error.
+func (log Logger) Errorln(args ...interface{}) error {
+	msg := sprintln(args...)
+	log.intLogv(ERROR, msg, nil)
+	return argsError(msg, nil, args)
+}
+
+// Errorc logs the string returned by the closure at the error log level, and
+// returns it as an error.  The closure is always called.
+func (log Logger) Errorc(closure func() string) error {
+	msg := closure()
+	log.intLogv(ERROR, msg, nil)
+	return errors.New(msg)
+}
+
+// Criticalf logs a message at the critical log level, formatted with fmt.Sprintf,
+// and returns it as an error.  The message is followed by the call stack.
+func (log Logger) Criticalf(format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	if !log.skip(CRITICAL) {
+		log.intLogv(CRITICAL, msg+"\n"+callStack(), nil)
 	}
-	return false
+	return argsError(msg, nil, args)
 }
+
+// Criticalln logs the arguments at the critical log level, formatted with
+// fmt.Sprintln (without the newline), and returns them as an error.  The message is followed by the call stack.
+func (log Logger) Criticalln(args ...interface{}) error {
+	msg := sprintln(args...)
+	if !log.skip(CRITICAL) {
+		log.intLogv(CRITICAL, msg+"\n"+callStack(), nil)
+	}
+	return argsError(msg, nil, args)
+}
+
+// Criticalc logs the string returned by the closure at the critical log level, and
+// returns it as an error.  The closure is always called.  The message is followed by the call stack.
+func (log Logger) Criticalc(closure func() string) error {
+	msg := closure()
+	if !log.skip(CRITICAL) {
+		log.intLogv(CRITICAL, msg+"\n"+callStack(), nil)
+	}
+	return errors.New(msg)
+}
+
+// Report whether a record at lvl gets the call stack.  CRITICAL records have
+// it already.
+func (f *Filter) wantsStack(lvl Level) bool {
+	return f.StackLevel != ACCESS && lvl >= f.StackLevel && lvl < CRITICAL
+}
+
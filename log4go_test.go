@@ -3,13 +3,30 @@
 package log4go
 
 import (
+	"bytes"
+	"context"
 	"crypto/md5"
 	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"flag"
 	"fmt"
+	"github.com/kimiazhu/log4go/stack"
+	"github.com/kimiazhu/log4go/support"
 	"io"
 	"io/ioutil"
+	stdlog "log"
+	"net"
 	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
 	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -115,6 +132,26 @@ func TestConsoleLogWriter(t *testing.T) {
 	}
 }
 
+func TestConsoleLogWriterTo(t *testing.T) {
+	r, w := io.Pipe()
+	console := NewConsoleLogWriterTo(w)
+	defer console.Close()
+
+	buf := make([]byte, 1024)
+
+	for _, test := range logRecordWriteTests {
+		name := test.Test
+
+		console.LogWrite(test.Record)
+		n, _ := r.Read(buf)
+
+		if got, want := string(buf[:n]), test.Console; got != want {
+			t.Errorf("%s:  got %q", name, got)
+			t.Errorf("%s: want %q", name, want)
+		}
+	}
+}
+
 func TestFileLogWriter(t *testing.T) {
 	defer func(buflen int) {
 		LogBufferLength = buflen
@@ -178,30 +215,27 @@ func TestXMLLogWriter(t *testing.T) {
 
 func TestLogger(t *testing.T) {
 	sl := NewDefaultLogger(WARNING)
-	if sl == nil {
-		t.Fatalf("NewDefaultLogger should never return nil")
-	}
-	if lw, exist := sl["stdout"]; lw == nil || exist != true {
+	if lw := sl.Filter("stdout"); lw == nil {
 		t.Fatalf("NewDefaultLogger produced invalid logger (DNE or nil)")
 	}
-	if sl["stdout"].Level != WARNING {
+	if sl.Filter("stdout").Level != WARNING {
 		t.Fatalf("NewDefaultLogger produced invalid logger (incorrect level)")
 	}
-	if len(sl) != 1 {
+	if len(sl.Filters()) != 1 {
 		t.Fatalf("NewDefaultLogger produced invalid logger (incorrect map count)")
 	}
 
 	//func (l *Logger) AddFilter(name string, level int, writer LogWriter) {}
-	l := make(Logger)
+	l := NewLogger()
 	l.AddFilter("stdout", DEBUG, NewConsoleLogWriter())
 	l.Info("Test log something")
-	if lw, exist := l["stdout"]; lw == nil || exist != true {
+	if lw := l.Filter("stdout"); lw == nil {
 		t.Fatalf("AddFilter produced invalid logger (DNE or nil)")
 	}
-	if l["stdout"].Level != DEBUG {
+	if l.Filter("stdout").Level != DEBUG {
 		t.Fatalf("AddFilter produced invalid logger (incorrect level)")
 	}
-	if len(l) != 1 {
+	if len(l.Filters()) != 1 {
 		t.Fatalf("AddFilter produced invalid logger (incorrect map count)")
 	}
 
@@ -242,7 +276,7 @@ func TestLogOutput(t *testing.T) {
 	}(LogBufferLength)
 	LogBufferLength = 0
 
-	l := make(Logger)
+	l := NewLogger()
 
 	// Delete and open the output log without a timestamp (for a constant md5sum)
 	l.AddFilter("file", FINEST, NewFileLogWriter(testLogFile, false, false).SetFormat("[%L] %M"))
@@ -342,17 +376,17 @@ func TestXMLConfig(t *testing.T) {
 	fmt.Fprintln(fd, "    <level>FINEST</level>")
 	fmt.Fprintln(fd, "    <property name=\"filename\">test.log</property>")
 	fmt.Fprintln(fd, "    <!--")
-	fmt.Fprintln(fd, "       %T - Time (15:04:05.123456789 MST)")
-	fmt.Fprintln(fd, "       %t - Time (15:04)")
-	fmt.Fprintln(fd, "       %D - Date (2006/01/02)")
-	fmt.Fprintln(fd, "       %d - Date (01/02/06)")
-	fmt.Fprintln(fd, "       %L - Level (FNST, FINE, DEBG, TRAC, WARN, EROR, CRIT)")
-	fmt.Fprintln(fd, "       %S - Source")
-	fmt.Fprintln(fd, "       %M - Message")
+	fmt.Fprintf(fd, "       %%T - Time (15:04:05.123456789 MST)\n")
+	fmt.Fprintf(fd, "       %%t - Time (15:04)\n")
+	fmt.Fprintf(fd, "       %%D - Date (2006/01/02)\n")
+	fmt.Fprintf(fd, "       %%d - Date (01/02/06)\n")
+	fmt.Fprintf(fd, "       %%L - Level (FNST, FINE, DEBG, TRAC, WARN, EROR, CRIT)\n")
+	fmt.Fprintf(fd, "       %%S - Source\n")
+	fmt.Fprintf(fd, "       %%M - Message\n")
 	fmt.Fprintln(fd, "       It ignores unknown format strings (and removes them)")
-	fmt.Fprintln(fd, "       Recommended: \"[%D %T] [%L] (%S) %M\"")
+	fmt.Fprintf(fd, "       Recommended: \"[%%D %%T] [%%L] (%%S) %%M\"\n")
 	fmt.Fprintln(fd, "    -->")
-	fmt.Fprintln(fd, "    <property name=\"format\">[%D %T] [%L] (%S) %M</property>")
+	fmt.Fprintf(fd, "    <property name=\"format\">[%%D %%T] [%%L] (%%S) %%M</property>\n")
 	fmt.Fprintln(fd, "    <property name=\"rotate\">false</property> <!-- true enables log rotation, otherwise append -->")
 	fmt.Fprintln(fd, "    <property name=\"maxsize\">0M</property> <!-- \\d+[KMG]? Suffixes are in terms of 2**10 -->")
 	fmt.Fprintln(fd, "    <property name=\"maxlines\">0K</property> <!-- \\d+[KMG]? Suffixes are in terms of thousands -->")
@@ -378,57 +412,57 @@ func TestXMLConfig(t *testing.T) {
 	fmt.Fprintln(fd, "</logging>")
 	fd.Close()
 
-	log := make(Logger)
+	log := NewLogger()
 	log.LoadConfiguration(configfile)
 	defer os.Remove("trace.xml")
 	defer os.Remove("test.log")
 	defer log.Close()
 
 	// Make sure we got all loggers
-	if len(log) != 3 {
-		t.Fatalf("XMLConfig: Expected 3 filters, found %d", len(log))
+	if len(log.Filters()) != 3 {
+		t.Fatalf("XMLConfig: Expected 3 filters, found %d", len(log.Filters()))
 	}
 
 	// Make sure they're the right keys
-	if _, ok := log["stdout"]; !ok {
+	if log.Filter("stdout") == nil {
 		t.Errorf("XMLConfig: Expected stdout logger")
 	}
-	if _, ok := log["file"]; !ok {
+	if log.Filter("file") == nil {
 		t.Fatalf("XMLConfig: Expected file logger")
 	}
-	if _, ok := log["xmllog"]; !ok {
+	if log.Filter("xmllog") == nil {
 		t.Fatalf("XMLConfig: Expected xmllog logger")
 	}
 
 	// Make sure they're the right type
-	if _, ok := log["stdout"].LogWriter.(*ConsoleLogWriter); !ok {
-		t.Fatalf("XMLConfig: Expected stdout to be ConsoleLogWriter, found %T", log["stdout"].LogWriter)
+	if _, ok := log.Filter("stdout").LogWriter.(*ConsoleLogWriter); !ok {
+		t.Fatalf("XMLConfig: Expected stdout to be ConsoleLogWriter, found %T", log.Filter("stdout").LogWriter)
 	}
-	if _, ok := log["file"].LogWriter.(*FileLogWriter); !ok {
-		t.Fatalf("XMLConfig: Expected file to be *FileLogWriter, found %T", log["file"].LogWriter)
+	if _, ok := log.Filter("file").LogWriter.(*FileLogWriter); !ok {
+		t.Fatalf("XMLConfig: Expected file to be *FileLogWriter, found %T", log.Filter("file").LogWriter)
 	}
-	if _, ok := log["xmllog"].LogWriter.(*FileLogWriter); !ok {
-		t.Fatalf("XMLConfig: Expected xmllog to be *FileLogWriter, found %T", log["xmllog"].LogWriter)
+	if _, ok := log.Filter("xmllog").LogWriter.(*FileLogWriter); !ok {
+		t.Fatalf("XMLConfig: Expected xmllog to be *FileLogWriter, found %T", log.Filter("xmllog").LogWriter)
 	}
 
 	// Make sure levels are set
-	if lvl := log["stdout"].Level; lvl != DEBUG {
+	if lvl := log.Filter("stdout").Level; lvl != DEBUG {
 		t.Errorf("XMLConfig: Expected stdout to be set to level %d, found %d", DEBUG, lvl)
 	}
-	if lvl := log["file"].Level; lvl != FINEST {
+	if lvl := log.Filter("file").Level; lvl != FINEST {
 		t.Errorf("XMLConfig: Expected file to be set to level %d, found %d", FINEST, lvl)
 	}
-	if lvl := log["xmllog"].Level; lvl != TRACE {
+	if lvl := log.Filter("xmllog").Level; lvl != TRACE {
 		t.Errorf("XMLConfig: Expected xmllog to be set to level %d, found %d", TRACE, lvl)
 	}
 
 	// Make sure the w is open and points to the right file
-	if fname := log["file"].LogWriter.(*FileLogWriter).file.Name(); fname != "test.log" {
+	if fname := log.Filter("file").LogWriter.(*FileLogWriter).file.Name(); fname != "test.log" {
 		t.Errorf("XMLConfig: Expected file to have opened %s, found %s", "test.log", fname)
 	}
 
 	// Make sure the XLW is open and points to the right file
-	if fname := log["xmllog"].LogWriter.(*FileLogWriter).file.Name(); fname != "trace.xml" {
+	if fname := log.Filter("xmllog").LogWriter.(*FileLogWriter).file.Name(); fname != "trace.xml" {
 		t.Errorf("XMLConfig: Expected xmllog to have opened %s, found %s", "trace.xml", fname)
 	}
 
@@ -437,6 +471,7 @@ func TestXMLConfig(t *testing.T) {
 }
 
 func BenchmarkFormatLogRecord(b *testing.B) {
+	b.ReportAllocs()
 	const updateEvery = 1
 	rec := &LogRecord{
 		Level:   CRITICAL,
@@ -455,6 +490,7 @@ func BenchmarkFormatLogRecord(b *testing.B) {
 }
 
 func BenchmarkConsoleLog(b *testing.B) {
+	b.ReportAllocs()
 	/* This doesn't seem to work on OS X
 	sink, err := os.Open(os.DevNull)
 	if err != nil {
@@ -473,6 +509,7 @@ func BenchmarkConsoleLog(b *testing.B) {
 }
 
 func BenchmarkConsoleNotLogged(b *testing.B) {
+	b.ReportAllocs()
 	sl := NewDefaultLogger(INFO)
 	for i := 0; i < b.N; i++ {
 		sl.Log(DEBUG, "here", "This is a log message")
@@ -480,6 +517,7 @@ func BenchmarkConsoleNotLogged(b *testing.B) {
 }
 
 func BenchmarkConsoleUtilLog(b *testing.B) {
+	b.ReportAllocs()
 	sl := NewDefaultLogger(INFO)
 	for i := 0; i < b.N; i++ {
 		sl.Info("%s is a log message", "This")
@@ -487,6 +525,7 @@ func BenchmarkConsoleUtilLog(b *testing.B) {
 }
 
 func BenchmarkConsoleUtilNotLog(b *testing.B) {
+	b.ReportAllocs()
 	sl := NewDefaultLogger(INFO)
 	for i := 0; i < b.N; i++ {
 		sl.Debug("%s is a log message", "This")
@@ -494,7 +533,8 @@ func BenchmarkConsoleUtilNotLog(b *testing.B) {
 }
 
 func BenchmarkFileLog(b *testing.B) {
-	sl := make(Logger)
+	b.ReportAllocs()
+	sl := NewLogger()
 	b.StopTimer()
 	sl.AddFilter("file", INFO, NewFileLogWriter("benchlog.log", false, false))
 	b.StartTimer()
@@ -506,7 +546,8 @@ func BenchmarkFileLog(b *testing.B) {
 }
 
 func BenchmarkFileNotLogged(b *testing.B) {
-	sl := make(Logger)
+	b.ReportAllocs()
+	sl := NewLogger()
 	b.StopTimer()
 	sl.AddFilter("file", INFO, NewFileLogWriter("benchlog.log", false, false))
 	b.StartTimer()
@@ -518,7 +559,8 @@ func BenchmarkFileNotLogged(b *testing.B) {
 }
 
 func BenchmarkFileUtilLog(b *testing.B) {
-	sl := make(Logger)
+	b.ReportAllocs()
+	sl := NewLogger()
 	b.StopTimer()
 	sl.AddFilter("file", INFO, NewFileLogWriter("benchlog.log", false, false))
 	b.StartTimer()
@@ -530,7 +572,8 @@ func BenchmarkFileUtilLog(b *testing.B) {
 }
 
 func BenchmarkFileUtilNotLog(b *testing.B) {
-	sl := make(Logger)
+	b.ReportAllocs()
+	sl := NewLogger()
 	b.StopTimer()
 	sl.AddFilter("file", INFO, NewFileLogWriter("benchlog.log", false, false))
 	b.StartTimer()
@@ -550,3 +593,3759 @@ func BenchmarkFileUtilNotLog(b *testing.B) {
 //elog.BenchmarkFileNotLogged       2000000         821 ns/op
 //elog.BenchmarkFileUtilLog           50000       33945 ns/op
 //elog.BenchmarkFileUtilNotLog      1000000        1258 ns/op
+
+// A LogWriter which keeps the records in memory, for inspection by tests
+type testWriter struct {
+	recs []*LogRecord
+}
+
+func (w *testWriter) LogWrite(rec *LogRecord) { w.recs = append(w.recs, rec) }
+func (w *testWriter) Close()                  {}
+
+func TestContextFields(t *testing.T) {
+	w := &testWriter{}
+	l := NewLogger()
+	l.AddFilter("test", DEBUG, w)
+
+	l.InfoCtx(context.Background(), "no fields")
+	if got := w.recs[0].Fields; len(got) != 0 {
+		t.Errorf("InfoCtx(Background): expected no fields, got %v", got)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	l.DebugCtx(ctx, "%d fields", 1)
+	if got := w.recs[1].Fields; len(got) != 1 || got[0].Key != "ctx_deadline" {
+		t.Errorf("DebugCtx(WithTimeout): expected ctx_deadline field, got %v", got)
+	}
+	cancel()
+
+	ctx, cancelCause := context.WithCancelCause(context.Background())
+	cancelCause(errors.New("upstream gone"))
+	if err := l.ErrorCtx(ctx, "request failed"); err.Error() != "request failed" {
+		t.Errorf("ErrorCtx returned invalid error: %s", err)
+	}
+	want := "[EROR] request failed ctx_err=context canceled ctx_cause=upstream gone\n"
+	if got := FormatLogRecord("[%L] %M", w.recs[2]); got != want {
+		t.Errorf("ErrorCtx(WithCancelCause):  got %q", got)
+		t.Errorf("ErrorCtx(WithCancelCause): want %q", want)
+	}
+
+	l.InfoCtxf(ctx, "%d%% done", 50)
+	if err := l.WarnCtxf(ctx, "%d left", 2); err.Error() != "2 left" {
+		t.Errorf("WarnCtxf returned invalid error: %s", err)
+	}
+	if got, want := FormatLogRecord("[%L] %M", w.recs[3]), "[INFO] 50% done ctx_err=context canceled ctx_cause=upstream gone\n"; got != want {
+		t.Errorf("InfoCtxf: got %q, want %q", got, want)
+	}
+	if !strings.Contains(w.recs[4].Source, "TestContextFields") {
+		t.Errorf("WarnCtxf: source is %q", w.recs[4].Source)
+	}
+}
+
+func TestSocketLogWriterReconnect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+	addr := ln.Addr().String()
+
+	w := NewSocketLogWriter("tcp", addr).SetReconnectBackoff(10*time.Millisecond, 50*time.Millisecond)
+	defer w.Close()
+
+	// Receive the first record, then kill the collector
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("accept: %s", err)
+	}
+	dec := json.NewDecoder(conn)
+	w.LogWrite(newLogRecord(INFO, "source", "before"))
+	var rec LogRecord
+	if err := dec.Decode(&rec); err != nil || rec.Message != "before" {
+		t.Fatalf("first record: %v (%s)", rec, err)
+	}
+	conn.Close()
+	ln.Close()
+
+	// Log during the outage until the writer notices the broken connection
+	for i := 0; i < 20; i++ {
+		w.LogWrite(newLogRecord(INFO, "source", "during"))
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Restart the collector, the buffered records must be delivered
+	if ln, err = net.Listen("tcp", addr); err != nil {
+		t.Skipf("cannot listen on %s again: %s", addr, err)
+	}
+	defer ln.Close()
+	if conn, err = ln.Accept(); err != nil {
+		t.Fatalf("accept: %s", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	dec = json.NewDecoder(conn)
+	if err := dec.Decode(&rec); err != nil || rec.Message != "during" {
+		t.Errorf("record after reconnect: %v (%s)", rec, err)
+	}
+}
+
+func TestSocketLogWriterZeroBackoff(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+	w := NewSocketLogWriter("tcp", ln.Addr().String()).SetReconnectBackoff(0, 0)
+	defer w.Close()
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("accept: %s", err)
+	}
+	conn.Close()
+	ln.Close()
+
+	// The endpoint is dead: the attempts are spaced by SocketMinBackoff at
+	// least, not made in a loop
+	for i := 0; i < 10; i++ {
+		w.LogWrite(newLogRecord(INFO, "source", "during"))
+	}
+	time.Sleep(3 * SocketMinBackoff)
+	if n := w.Stats().Errors; n > 10 {
+		t.Errorf("SetReconnectBackoff(0, 0): %d failures in %s", n, 3*SocketMinBackoff)
+	}
+}
+
+func TestWireFormats(t *testing.T) {
+	created := time.Date(2017, 3, 4, 5, 6, 7, 89, time.UTC)
+	rec := &LogRecord{
+		Level:   ERROR,
+		Created: created,
+		Source:  "source",
+		Message: strings.Repeat("long message ", 10),
+		Fields: []Field{
+			F("int", -300), F("uint", uint16(4464)), F("float", 1.5), F("bool", true),
+			F("nil", nil), F("string", "value"), F("duration", time.Second), F("struct", struct{ A int }{1}),
+		},
+		Goroutine: 42,
+		NDC:       []string{"request=1"},
+		MDC:       map[string]string{"user": "alice", "tenant": "acme"},
+		Name:      "db",
+	}
+	empty := &LogRecord{Level: FINEST, Created: created, Message: "empty"}
+
+	for _, test := range []struct {
+		format WireFormat
+		values []interface{} // Of the fields, as decoded
+	}{
+		{WireJSON, []interface{}{-300.0, 4464.0, 1.5, true, nil, "value", 1e9, map[string]interface{}{"A": 1.0}}},
+		{WireMsgpack, []interface{}{int64(-300), int64(4464), 1.5, true, nil, "value", "1s", "{1}"}},
+		{WireProtobuf, []interface{}{int64(-300), uint64(4464), 1.5, true, nil, "value", "1s", "{1}"}},
+		{WireBinary, []interface{}{-300.0, 4464.0, 1.5, true, nil, "value", 1e9, map[string]interface{}{"A": 1.0}}},
+	} {
+		var stream []byte
+		for _, r := range []*LogRecord{rec, empty} {
+			if layout := test.format.Layout(); layout != nil {
+				stream = append(stream, layout.Format(r)...)
+			} else {
+				stream = append(stream, marshalRecord(r)...)
+			}
+		}
+
+		dec := NewWireDecoder(bytes.NewReader(stream), test.format)
+		got, err := dec.Decode()
+		if err != nil {
+			t.Errorf("%s: Decode: %s", test.format, err)
+			continue
+		}
+		if got.Level != rec.Level || !got.Created.Equal(created) || got.Source != rec.Source || got.Message != rec.Message ||
+			got.Goroutine != 42 || !reflect.DeepEqual(got.NDC, rec.NDC) || !reflect.DeepEqual(got.MDC, rec.MDC) || got.Name != "db" {
+			t.Errorf("%s: got %+v, want %+v", test.format, got, rec)
+		}
+		if len(got.Fields) != len(rec.Fields) {
+			t.Errorf("%s: got the fields %v", test.format, got.Fields)
+		} else {
+			for i, f := range got.Fields {
+				if f.Key != rec.Fields[i].Key || !reflect.DeepEqual(f.Value, test.values[i]) {
+					t.Errorf("%s: field %s = %#v, want %#v", test.format, f.Key, f.Value, test.values[i])
+				}
+			}
+		}
+		if got, err := dec.Decode(); err != nil || got.Message != "empty" || got.Level != FINEST || len(got.Fields) != 0 {
+			t.Errorf("%s: second record %+v (%v)", test.format, got, err)
+		}
+		if _, err := dec.Decode(); err != io.EOF {
+			t.Errorf("%s: Decode at the end: %v, want EOF", test.format, err)
+		}
+		if test.format != WireJSON {
+			if _, err := NewWireDecoder(bytes.NewReader(stream[:len(stream)-1]), test.format).Decode(); err != nil {
+				t.Errorf("%s: Decode of the first record of a cut stream: %s", test.format, err)
+			}
+			dec := NewWireDecoder(bytes.NewReader(stream[:len(stream)-1]), test.format)
+			dec.Decode()
+			if _, err := dec.Decode(); err != io.ErrUnexpectedEOF {
+				t.Errorf("%s: Decode of a cut record: %v, want ErrUnexpectedEOF", test.format, err)
+			}
+		}
+	}
+
+	// From the configuration, over a socket
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+	defer ln.Close()
+	w, ok := xmlToSocketLogWriter(nil, []Property{
+		{Name: "endpoint", Value: ln.Addr().String()},
+		{Name: "protocol", Value: "tcp"},
+		{Name: "format", Value: "protobuf"},
+	}, true)
+	if !ok {
+		t.Fatalf("xmlToSocketLogWriter failed")
+	}
+	defer w.Close()
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("accept: %s", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	w.LogWrite(newLogRecord(WARNING, "source", "over the wire"))
+	if got, err := NewWireDecoder(conn, WireProtobuf).Decode(); err != nil || got.Message != "over the wire" || got.Level != WARNING {
+		t.Errorf("protobuf over a socket: %+v (%v)", got, err)
+	}
+}
+
+func TestCollector(t *testing.T) {
+	mem := NewMemoryLogWriter(10)
+	l := NewLogger().AddFilter("mem", INFO, mem)
+	c := NewCollector(l, WireMsgpack)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+	served := make(chan error, 2)
+	go func() { served <- c.Serve(ln) }()
+	go func() { served <- c.ServePacket(pc) }()
+
+	// The records keep their time and source, the filters of the logger apply
+	created := time.Date(2017, 3, 4, 5, 6, 7, 0, time.UTC)
+	for _, addr := range []net.Addr{ln.Addr(), pc.LocalAddr()} {
+		w := NewSocketLogWriter(addr.Network(), addr.String()).SetWireFormat(WireMsgpack)
+		for _, lvl := range []Level{DEBUG, WARNING} {
+			rec := newLogRecord(lvl, "remote.go:42", "from "+addr.Network())
+			rec.Created = created
+			w.LogWrite(rec)
+		}
+		w.Close()
+	}
+	for deadline := time.Now().Add(5 * time.Second); len(mem.Records()) < 2 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	recs := mem.Records()
+	if len(recs) != 2 {
+		t.Fatalf("Collector: got %d records, want 2", len(recs))
+	}
+	for _, rec := range recs {
+		if rec.Level != WARNING || rec.Source != "remote.go:42" || !rec.Created.Equal(created) || !strings.HasPrefix(rec.Message, "from ") {
+			t.Errorf("Collector: got %+v", rec)
+		}
+	}
+	if received, invalid := c.Received(); received != 4 || invalid != 0 {
+		t.Errorf("Received: %d and %d invalid, want 4 and 0", received, invalid)
+	}
+
+	c.Close()
+	for i := 0; i < 2; i++ {
+		if err := <-served; err != nil {
+			t.Errorf("Serve after Close: %s", err)
+		}
+	}
+}
+
+func TestSocketUnix(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix sockets are not supported on windows")
+	}
+	dir, err := ioutil.TempDir("", "socklog")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Datagrams
+	dgram := filepath.Join(dir, "agent.dgram")
+	pc, err := net.ListenPacket("unixgram", dgram)
+	if err != nil {
+		t.Fatalf("listen unixgram: %s", err)
+	}
+	defer pc.Close()
+	w, ok := xmlToSocketLogWriter(nil, []Property{{"endpoint", dgram}, {"protocol", "unixgram"}}, true)
+	if !ok {
+		t.Fatalf("unixgram socket filter rejected")
+	}
+	w.LogWrite(newLogRecord(INFO, "source", "datagram"))
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 4096)
+	n, _, err := pc.ReadFrom(buf)
+	var rec LogRecord
+	if err != nil || json.Unmarshal(buf[:n], &rec) != nil || rec.Message != "datagram" {
+		t.Errorf("unixgram record: %q (%v)", buf[:n], err)
+	}
+	w.Close()
+
+	// A stream
+	stream := filepath.Join(dir, "agent.sock")
+	ln, err := net.Listen("unix", stream)
+	if err != nil {
+		t.Fatalf("listen unix: %s", err)
+	}
+	defer ln.Close()
+	w, ok = xmlToSocketLogWriter(nil, []Property{{"endpoint", stream}, {"protocol", "unix"}}, true)
+	if !ok {
+		t.Fatalf("unix socket filter rejected")
+	}
+	defer w.Close()
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("accept: %s", err)
+	}
+	defer conn.Close()
+	w.LogWrite(newLogRecord(INFO, "source", "stream"))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if err := json.NewDecoder(conn).Decode(&rec); err != nil || rec.Message != "stream" {
+		t.Errorf("unix record: %v (%s)", rec, err)
+	}
+
+	// Not a protocol of net.Dial
+	configOut = ioutil.Discard
+	defer func() { configOut = os.Stderr }()
+	if _, ok := xmlToSocketLogWriter(nil, []Property{{"endpoint", stream}, {"protocol", "pipe"}}, false); ok {
+		t.Errorf("protocol pipe accepted")
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "health")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+	defer ln.Close()
+
+	fname := filepath.Join(dir, "health.log")
+	log := NewLogger()
+	log.AddFilter("file", FINEST, NewFileLogWriter(fname, false, false))
+	log.AddFilter("socket", FINEST, NewSocketLogWriter("tcp", ln.Addr().String()))
+	log.AddFilter("test", FINEST, &testWriter{})
+	defer log.Close()
+
+	if err := log.HealthCheck(); err != nil {
+		t.Fatalf("HealthCheck: %s", err)
+	}
+
+	// The file deleted behind the writer's back, and the collector gone
+	os.Remove(fname)
+	ln.Close()
+	err = log.HealthCheck()
+	failed, ok := err.(HealthError)
+	if !ok || len(failed) != 2 || failed["file"] == nil || failed["socket"] == nil {
+		t.Fatalf("HealthCheck: got %v, want the file and the socket", err)
+	}
+	if !strings.HasPrefix(err.Error(), "file: ") || !strings.Contains(err.Error(), "; socket: ") {
+		t.Errorf("HealthError: %q", err)
+	}
+
+	// A failover writer is fine as long as its fallback is
+	spool := filepath.Join(dir, "spool.log")
+	fw := NewFailoverLogWriter(NewSocketLogWriter("tcp", ln.Addr().String()), NewFileLogWriter(spool, false, false))
+	defer fw.Close()
+	if err := fw.HealthCheck(); err != nil {
+		t.Errorf("failover HealthCheck: %s", err)
+	}
+	os.Remove(spool)
+	if err := fw.HealthCheck(); err == nil || !strings.Contains(err.Error(), "fallback: ") {
+		t.Errorf("failover HealthCheck: got %v, want the primary and the fallback", err)
+	}
+}
+
+func TestOnceEvery(t *testing.T) {
+	mem := NewMemoryLogWriter(100)
+	log := NewLogger().SetFilter("mem", &Filter{Level: INFO, LogWriter: mem})
+
+	for i := 0; i < 10; i++ {
+		log.Once(WARNING, "once %d", i)
+		log.EveryN(3, INFO, "every 3rd %d", i)
+		log.Every(time.Hour, ERROR, "hourly %d", i)
+	}
+	// The same message from another call site has its own count
+	log.Once(WARNING, "once %d", 10)
+
+	// The calls filtered out don't count
+	for i := 0; i < 2; i++ {
+		log.Once(DEBUG, "debug once %d", i)
+		log.Filter("mem").SetLevel(DEBUG)
+	}
+
+	var got []string
+	for _, rec := range mem.Records() {
+		got = append(got, rec.Message)
+		if !strings.Contains(rec.Source, "TestOnceEvery") {
+			t.Errorf("%q: source %s, want the caller", rec.Message, rec.Source)
+		}
+	}
+	want := []string{
+		"once 0", "every 3rd 0", "hourly 0", "every 3rd 3", "every 3rd 6", "every 3rd 9",
+		"once 10", "debug once 1",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Once/EveryN/Every: got %q, want %q", got, want)
+	}
+}
+
+func TestLazy(t *testing.T) {
+	calls := 0
+	lazy := Lazy(func() interface{} {
+		calls++
+		return struct{ A, B int }{1, 2}
+	})
+
+	mem := NewMemoryLogWriter(10)
+	log := NewLogger().SetFilter("mem", &Filter{Level: INFO, LogWriter: mem})
+	log.AddFilter("json", INFO, NewMemoryLogWriter(10))
+
+	// Not computed for the records no filter takes
+	log.Debug("state %v", lazy)
+	log.LogcFields(DEBUG, func() (string, []Field) { return "fields", []Field{F("state", lazy)} })
+	log.Filter("mem").Excludes = []string{"excluded"}
+	log.Filter("json").Excludes = []string{"excluded"}
+	log.dispatch(&LogRecord{Level: INFO, Source: "excluded", Fields: []Field{F("state", lazy)}})
+	if calls != 0 {
+		t.Fatalf("Lazy: computed %d times for nothing", calls)
+	}
+
+	// In a message, with the flags of the verb
+	log.Info("state %+v, %5s|", lazy, Lazy(func() interface{} { return "x" }))
+	if calls != 1 || mem.Records()[0].Message != "state {A:1 B:2},     x|" {
+		t.Errorf("Lazy: %q after %d calls", mem.Records()[0].Message, calls)
+	}
+
+	// In the fields, once for all the writers, the fields of the caller kept
+	fields := []Field{F("state", lazy)}
+	log.LogcFields(INFO, func() (string, []Field) { return "fields", fields })
+	if calls != 2 || !reflect.DeepEqual(mem.Records()[1].Fields, []Field{F("state", struct{ A, B int }{1, 2})}) {
+		t.Errorf("Lazy: fields %+v after %d calls", mem.Records()[1].Fields, calls)
+	}
+	if _, ok := fields[0].Value.(Lazy); !ok {
+		t.Errorf("Lazy: the fields of the caller were changed")
+	}
+	if s := fmt.Sprint(Lazy(nil)); s != "<nil>" {
+		t.Errorf("Lazy(nil) = %q", s)
+	}
+}
+
+func TestErrorWrapping(t *testing.T) {
+	w := &testWriter{}
+	log := NewLogger().SetFilter("test", &Filter{Level: INFO, LogWriter: w})
+
+	_, cause := os.Open(filepath.Join(os.TempDir(), "does", "not", "exist"))
+	for _, err := range []error{
+		log.Warn(cause),
+		log.Error("open failed: %v", cause),
+		log.Errorf("open failed: %v", cause),
+		log.Warnln("open failed:", cause),
+		log.Named("db").Error("open failed: %s", cause),
+		log.ErrorCtx(context.Background(), "open failed: %v", cause),
+		log.ErrorErr(cause, "loading %s", "config"),
+	} {
+		var pathErr *os.PathError
+		if !errors.Is(err, os.ErrNotExist) || !errors.As(err, &pathErr) {
+			t.Errorf("%q doesn't wrap %v", err, cause)
+		}
+	}
+
+	rec := w.recs[len(w.recs)-1]
+	if want := "loading config: " + cause.Error(); rec.Message != want || rec.Level != ERROR {
+		t.Errorf("ErrorErr: logged %q at %s, want %q", rec.Message, rec.Level, want)
+	}
+	if !strings.Contains(rec.Source, "TestErrorWrapping") {
+		t.Errorf("ErrorErr: source is %q", rec.Source)
+	}
+	wantFields := []Field{{"error", cause.Error()}, {"error_chain", []string{"*fs.PathError", "syscall.Errno"}}}
+	if !reflect.DeepEqual(rec.Fields, wantFields) {
+		t.Errorf("ErrorErr: fields %#v, want %#v", rec.Fields, wantFields)
+	}
+	if err := log.Error("no error %d", 1); errors.Unwrap(err) != nil || err.Error() != "no error 1" {
+		t.Errorf("Error without an error argument returned %#v", err)
+	}
+	if err := log.ErrorErr(nil, "nothing wrong"); err.Error() != "nothing wrong" {
+		t.Errorf("ErrorErr(nil) = %q", err)
+	}
+}
+
+func TestSourceFormats(t *testing.T) {
+	w := &testWriter{}
+	NewLogger().SetFilter("test", &Filter{Level: INFO, LogWriter: w}).Info("where")
+	rec := w.recs[0]
+	line := rec.Source[strings.LastIndex(rec.Source, ":"):]
+	_, file, _, _ := runtime.Caller(0)
+
+	for format, want := range map[string]string{
+		"%S":        "github.com/kimiazhu/log4go.TestSourceFormats" + line,
+		"%s":        "log4go.TestSourceFormats" + line,
+		"%S{short}": "log4go.TestSourceFormats" + line,
+		"%S{func}":  "log4go.TestSourceFormats",
+		"%S{file}":  "log4go_test.go" + line,
+		"%S{long}":  file + line,
+		"%S{x} %M":  rec.Source + " where",
+	} {
+		if got := FormatLogRecord(format, rec); got != want+"\n" {
+			t.Errorf("%s: got %q, want %q", format, got, want)
+		}
+	}
+
+	// A source given to Log has no file
+	manual := newLogRecord(INFO, "example.com/app/db.Query:12", "m")
+	if got := FormatLogRecord("%S{file} %S{long} %S{func}", manual); got != "db.Query:12 db.Query:12 db.Query\n" {
+		t.Errorf("source without a file: got %q", got)
+	}
+
+	js := string(JSONLayout{SourceFormat: "file"}.Format(rec))
+	lf := string(LogfmtLayout{SourceFormat: "func"}.Format(rec))
+	if !strings.Contains(js, `"source":"log4go_test.go`+line+`"`) || !strings.Contains(lf, " source=log4go.TestSourceFormats ") {
+		t.Errorf("SourceFormat: got %q and %q", js, lf)
+	}
+}
+
+func TestExcludeCache(t *testing.T) {
+	mem := NewMemoryLogWriter(10)
+	log := NewLogger().SetFilter("mem", &Filter{Level: INFO, LogWriter: mem, Excludes: []string{"github.com/kimiazhu/log4go.TestExcludeCache"}})
+	defer log.Close()
+
+	logAt := func() { log.Info("excluded") }
+	for i := 0; i < 3; i++ {
+		logAt()
+	}
+	if n := len(mem.Records()); n != 0 {
+		t.Fatalf("Excludes: %d records written", n)
+	}
+
+	// Another slice is matched again, from the cached site
+	log.Filter("mem").Excludes = []string{"github.com/example"}
+	logAt()
+	recs := mem.Records()
+	if len(recs) != 1 || sourceSiteOf(recs[0].Source) == nil {
+		t.Fatalf("Excludes: got %+v", recs)
+	}
+
+	// The site forgot the result of the previous slice
+	if cached, _ := sourceSiteOf(recs[0].Source).excluded.Load().(*siteExcludes); cached == nil || len(cached.results) != 1 {
+		t.Errorf("Excludes: the site caches %+v", cached)
+	}
+	log.Filter("mem").Excludes = nil
+	logAt()
+	if n := len(mem.Records()); n != 2 {
+		t.Errorf("Excludes: %d records written without excludes", n)
+	}
+
+	// The sources of no call site are matched each time
+	log.Filter("mem").Excludes = []string{"remote"}
+	log.Forward(&LogRecord{Level: INFO, Source: "remote.Handler:12", Message: "forwarded"})
+	log.Forward(&LogRecord{Level: INFO, Source: "local.Handler:12", Message: "forwarded"})
+	if recs := mem.Records(); len(recs) != 3 || recs[2].Source != "local.Handler:12" {
+		t.Errorf("Excludes: forwarded %+v", recs)
+	}
+}
+
+func TestPredicate(t *testing.T) {
+	healthz := &testWriter{}
+	other := &testWriter{}
+	log := NewLogger().
+		SetFilter("app", &Filter{Level: INFO, LogWriter: healthz}).
+		SetFilter("other", &Filter{Level: INFO, LogWriter: other})
+	noHealthz := func(rec *LogRecord) bool { return !strings.Contains(rec.Message, "/healthz") }
+	log.Filter("app").SetPredicate(noHealthz)
+	log.Info("GET /healthz 200")
+	log.Info("GET /orders 200")
+	if len(healthz.recs) != 1 || healthz.recs[0].Message != "GET /orders 200" || len(other.recs) != 2 {
+		t.Fatalf("SetPredicate: got %d and %d records", len(healthz.recs), len(other.recs))
+	}
+	log.Filter("app").SetPredicate(nil)
+	log.Info("GET /healthz 200")
+	if len(healthz.recs) != 2 {
+		t.Errorf("SetPredicate(nil): the record was dropped")
+	}
+
+	// Through the configuration, all of the named predicates must keep the
+	// record
+	RegisterPredicate("no_healthz", noHealthz)
+	RegisterPredicate("no_debug_source", func(rec *LogRecord) bool { return !strings.HasPrefix(rec.Source, "debug.") })
+	defer RegisterPredicate("no_healthz", nil)
+	defer RegisterPredicate("no_debug_source", nil)
+	l := NewLogger()
+	l.Config([]byte(`<logging><filter enabled="true"><tag>a</tag><type>memory</type><level>INFO</level>
+		<property name="predicate">no_healthz, no_debug_source</property></filter></logging>`))
+	defer l.Close()
+	l.Info("GET /healthz 200")
+	l.Log(INFO, "debug.Handler:10", "dumped")
+	l.Log(INFO, "app.Handler:10", "served")
+	if recs := l.Filter("a").LogWriter.(*MemoryLogWriter).Records(); len(recs) != 1 || recs[0].Message != "served" {
+		t.Errorf("predicate: got %+v", recs)
+	}
+
+	defer func(out io.Writer) { configOut = out }(configOut)
+	buf := new(bytes.Buffer)
+	configOut = buf
+	xc := new(LoggerConfig)
+	xml.Unmarshal([]byte(`<logging><filter enabled="true"><tag>a</tag><type>memory</type><level>INFO</level>
+		<property name="predicate">unknown</property></filter></logging>`), xc)
+	if err := NewLogger().ReplaceConfig(xc); err == nil || !strings.Contains(buf.String(), `unknown predicate "unknown"`) {
+		t.Errorf("predicate: unknown name gave %q", buf.String())
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	parse := func(config string) *LoggerConfig {
+		xc := new(LoggerConfig)
+		if err := xml.Unmarshal([]byte(config), xc); err != nil {
+			t.Fatalf("Routes: %s", err)
+		}
+		return xc
+	}
+	const filters = `<filter enabled="true"><tag>app</tag><type>memory</type><level>INFO</level></filter>
+		<filter enabled="true"><tag>payments</tag><type>memory</type><level>INFO</level></filter>
+		<filter enabled="true"><tag>billing</tag><type>memory</type><level>INFO</level></filter>`
+	messages := func(l Logger, tag string) string {
+		var msgs []string
+		for _, rec := range l.Filter(tag).LogWriter.(*MemoryLogWriter).Records() {
+			msgs = append(msgs, rec.Message)
+		}
+		return strings.Join(msgs, "|")
+	}
+
+	l := NewLogger()
+	defer l.Close()
+	err := l.ReplaceConfig(parse(`<logging>` + filters + `
+		<route><match>(?i)payment</match><to>payments</to></route>
+		<route final="true"><field name="team">billing</field><to>billing</to></route></logging>`))
+	if err != nil {
+		t.Fatalf("Routes: %s", err)
+	}
+	l.Info("Payment of order 42 accepted")
+	l.Info("order 43 shipped")
+	billing := func(msg string) {
+		l.LogcFields(INFO, func() (string, []Field) { return msg, []Field{F("team", "billing")} })
+	}
+	billing("invoice sent")
+	billing("payment refunded")
+	if got := messages(l, "app"); got != "Payment of order 42 accepted|order 43 shipped" {
+		t.Errorf("Routes: app wrote %q", got)
+	}
+	if got := messages(l, "payments"); got != "Payment of order 42 accepted" {
+		t.Errorf("Routes: payments wrote %q", got)
+	}
+	if got := messages(l, "billing"); got != "invoice sent|payment refunded" {
+		t.Errorf("Routes: billing wrote %q", got)
+	}
+
+	// Passed on to the workers
+	env, err := l.Env()
+	if err != nil || !strings.Contains(env[0], `<match>(?i)payment</match><to>payments</to>`) || !strings.Contains(env[0], `<field name="team">billing</field><to>billing</to>`) {
+		t.Errorf("Routes: Env gave %q, %v", env, err)
+	}
+
+	// The errors
+	defer func(out io.Writer) { configOut = out }(configOut)
+	for _, test := range []struct{ route, err string }{
+		{`<route><match>(</match><to>app</to></route>`, "Invalid child <match> for route"},
+		{`<route><match>x</match></route>`, "Required child <to> for route"},
+		{`<route><match>x</match><to>nowhere</to></route>`, `Route to unknown filter "nowhere"`},
+		{`<route final="yes"><match>x</match><to>app</to></route>`, "Invalid attribute final for route"},
+	} {
+		buf := new(bytes.Buffer)
+		configOut = buf
+		if err := NewLogger().ReplaceConfig(parse(`<logging>` + filters + test.route + `</logging>`)); err == nil || !strings.Contains(buf.String(), test.err) {
+			t.Errorf("Routes: %s gave %q", test.route, buf.String())
+		}
+	}
+
+	// And in JSON
+	lc, err := ParseJSONConfig([]byte(`{"routes": [{"match": "payment", "fields": {"team": "billing"}, "to": ["payments"], "final": true}]}`))
+	want := []RouteConfig{{Final: "true", Match: "payment", Field: []Property{{"team", "billing"}}, To: []string{"payments"}}}
+	if err != nil || !reflect.DeepEqual(lc.Route, want) {
+		t.Errorf("Routes: JSON gave %+v, %v", lc.Route, err)
+	}
+}
+
+func TestNewLoggerFromConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log4go-isolated")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "lib.xml")
+	write := func(level string) {
+		config := `<logging locale="fr"><filter enabled="true"><tag>lib</tag><type>memory</type><level>` + level + `</level></filter></logging>`
+		if err := ioutil.WriteFile(filename, []byte(config), 0644); err != nil {
+			t.Fatalf("WriteFile: %s", err)
+		}
+	}
+	write("INFO")
+
+	saved := Global
+	defer func() { Global = saved }()
+	global := &testWriter{}
+	Global = NewLogger().SetFilter("global", &Filter{Level: DEBUG, LogWriter: global})
+	defer func(out io.Writer) { configOut = out }(configOut)
+	buf := new(bytes.Buffer)
+	configOut = buf
+
+	lib, err := NewLoggerFromConfig(filename)
+	if err != nil {
+		t.Fatalf("NewLoggerFromConfig: %s", err)
+	}
+	lib.Info("from the library")
+	Info("from the program")
+	mem := lib.Filter("lib").LogWriter.(*MemoryLogWriter)
+	if len(mem.Records()) != 1 || len(global.recs) != 1 || Global.Filter("lib") != nil {
+		t.Errorf("NewLoggerFromConfig: %d records in the library, %d in Global", len(mem.Records()), len(global.recs))
+	}
+	catalogs.RLock()
+	locale := catalogs.locale
+	catalogs.RUnlock()
+	if locale == "fr" || !strings.Contains(buf.String(), "Locale fr ignored") {
+		t.Errorf("NewLoggerFromConfig: the locale of the library was applied, %q", buf.String())
+	}
+
+	// Reloaded from its file, closed by Exit
+	write("ERROR")
+	if err := lib.Reload(); err != nil || lib.Filter("lib").Level != ERROR {
+		t.Errorf("Reload: %v", err)
+	}
+	if err := NewLogger().Reload(); err == nil {
+		t.Errorf("Reload: no error without a file")
+	}
+	defer SetExitFunc(nil)
+	SetExitFunc(func(code int) {})
+	Exit()
+	isolatedLoggers.Lock()
+	open := isolatedLoggers.m[lib.fs]
+	isolatedLoggers.Unlock()
+	if open || len(lib.Filters()) != 0 {
+		t.Errorf("Exit: the library logger is still open")
+	}
+
+	write("NOPE")
+	if _, err := NewLoggerFromConfig(filename); err == nil {
+		t.Errorf("NewLoggerFromConfig: no error for a bad level")
+	}
+}
+
+func TestDuplicateTags(t *testing.T) {
+	defer func(out io.Writer) { configOut = out }(configOut)
+	config := func(duplicates string) *LoggerConfig {
+		xc := new(LoggerConfig)
+		xml.Unmarshal([]byte(`<logging duplicates="`+duplicates+`">
+			<filter enabled="true"><tag>mem</tag><type>memory</type><level>INFO</level><property name="format">first %M</property></filter>
+			<filter enabled="false"><tag>mem</tag><type>memory</type><level>INFO</level></filter>
+			<filter enabled="true"><tag>mem</tag><type>memory</type><level>DEBUG</level><property name="format">second %M</property></filter>
+		</logging>`), xc)
+		return xc
+	}
+	format := func(w LogWriter) string { return w.(*MemoryLogWriter).format }
+
+	// The last one wins, with a warning
+	buf := new(bytes.Buffer)
+	configOut = buf
+	l := NewLogger()
+	defer l.Close()
+	if err := l.ReplaceConfig(config("")); err != nil || format(l.Filter("mem").LogWriter) != "second %M" || !strings.Contains(buf.String(), `Warning: Duplicate tag "mem"`) {
+		t.Errorf("duplicates: last gave %v, %q", err, buf.String())
+	}
+
+	// An error, the logger is left alone
+	err := l.ReplaceConfig(config("error"))
+	if dup, ok := err.(*DuplicateTagError); !ok || dup.Tag != "mem" || format(l.Filter("mem").LogWriter) != "second %M" {
+		t.Errorf("duplicates: error gave %v", err)
+	}
+
+	// Merged in a tee, at the level of the first
+	buf.Reset()
+	if err := l.ReplaceConfig(config("tee")); err != nil {
+		t.Fatalf("duplicates: tee gave %v", err)
+	}
+	filt := l.Filter("mem")
+	tee, ok := filt.LogWriter.(*TeeLogWriter)
+	if !ok || len(tee.Writers()) != 2 || filt.Level != INFO || !strings.Contains(buf.String(), "merged at level INFO") {
+		t.Fatalf("duplicates: tee gave %#v, %q", filt.LogWriter, buf.String())
+	}
+	l.Info("both")
+	for _, w := range tee.Writers() {
+		if recs := w.(*MemoryLogWriter).Records(); len(recs) != 1 {
+			t.Errorf("duplicates: %q got %d records", format(w), len(recs))
+		}
+	}
+	env, err := l.Env()
+	if err != nil || !strings.Contains(env[0], `duplicates="tee"`) || !strings.Contains(env[0], "second %M") {
+		t.Errorf("duplicates: Env gave %q, %v", env, err)
+	}
+
+	// Through the file of a logger
+	filename := filepath.Join(os.TempDir(), fmt.Sprintf("log4go-dup-%d.xml", os.Getpid()))
+	defer os.Remove(filename)
+	contents, _ := xml.Marshal(struct {
+		XMLName xml.Name `xml:"logging"`
+		*LoggerConfig
+	}{LoggerConfig: config("error")})
+	ioutil.WriteFile(filename, contents, 0644)
+	var dup *DuplicateTagError
+	if _, err := NewLoggerFromConfig(filename); !errors.As(err, &dup) || dup.Tag != "mem" {
+		t.Errorf("duplicates: NewLoggerFromConfig gave %v", err)
+	}
+
+	if err := l.ReplaceConfig(config("first")); err == nil || !strings.Contains(buf.String(), "expect error, tee or last") {
+		t.Errorf("duplicates: an unknown value gave %v", err)
+	}
+
+	// A duplicate with a redactor of its own can't go through the first
+	// filter, which has none
+	redacted := config("tee")
+	redacted.Filter[2].Property = append(redacted.Filter[2].Property, Property{"redact_field", "password"})
+	buf.Reset()
+	if err := l.ReplaceConfig(redacted); err == nil || !strings.Contains(buf.String(), `Duplicate tag "mem" can't be merged`) {
+		t.Errorf("duplicates: tee with different redactors gave %v, %q", err, buf.String())
+	}
+	if errs := validateConfig(redacted); len(errs) != 1 || !strings.Contains(errs[0].Error(), "can't be merged") {
+		t.Errorf("duplicates: validateConfig gave %v", errs)
+	}
+}
+
+func TestApplyConfigDelta(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log4go-delta")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	filter := func(tag, level, extra string) string {
+		return `<filter enabled="true"><tag>` + tag + `</tag><type>file</type><level>` + level + `</level>
+			<property name="filename">` + filepath.Join(dir, tag+".log") + `</property>` + extra + `</filter>`
+	}
+
+	coded := &testWriter{}
+	l := NewLogger().SetFilter("coded", &Filter{Level: INFO, LogWriter: coded})
+	defer l.Close()
+	if err := l.ApplyConfigDelta([]byte(`<logging>` + filter("app", "INFO", "") + filter("audit", "INFO", "") + filter("old", "INFO", "") + `</logging>`)); err != nil {
+		t.Fatalf("ApplyConfigDelta: %s", err)
+	}
+	app, audit := l.Filter("app"), l.Filter("audit")
+
+	// app is kept with its file open, audit changes, old goes, new comes
+	err = l.ApplyConfigDelta([]byte(`<logging>` + filter("app", "INFO", "") + filter("audit", "DEBUG", "") + filter("new", "INFO", "") + `</logging>`))
+	if err != nil {
+		t.Fatalf("ApplyConfigDelta: %s", err)
+	}
+	if l.Filter("app") != app || l.Filter("audit") == audit || l.Filter("audit").Level != DEBUG {
+		t.Errorf("ApplyConfigDelta: app or audit not as expected")
+	}
+	if l.Filter("old") != nil || l.Filter("new") == nil || l.Filter("coded") == nil {
+		t.Errorf("ApplyConfigDelta: got filters %v", l.Filters())
+	}
+	l.Info("after the delta")
+	l.Flush()
+	if contents, _ := ioutil.ReadFile(filepath.Join(dir, "app.log")); !strings.Contains(string(contents), "after the delta") {
+		t.Errorf("ApplyConfigDelta: the kept file got %q", contents)
+	}
+
+	// A route to a filter changes it
+	err = l.ApplyConfigDelta([]byte(`<logging>` + filter("app", "INFO", "") + filter("audit", "DEBUG", "") + filter("new", "INFO", "") +
+		`<route><match>payment</match><to>app</to></route></logging>`))
+	if err != nil || l.Filter("app") == app || !l.Filter("app").hasPredicate() {
+		t.Errorf("ApplyConfigDelta: a route kept the filter, %v", err)
+	}
+
+	// An error leaves the logger alone
+	defer func(out io.Writer) { configOut = out }(configOut)
+	configOut = ioutil.Discard
+	before := l.Filter("app")
+	if err := l.ApplyConfigDelta([]byte(`<logging>` + filter("app", "LOUD", "") + `</logging>`)); err == nil || l.Filter("app") != before || l.Filter("audit") == nil {
+		t.Errorf("ApplyConfigDelta: a bad level gave %v", err)
+	}
+	if err := l.ApplyConfigDelta([]byte(`<logging>`)); err == nil {
+		t.Errorf("ApplyConfigDelta: no error for bad XML")
+	}
+}
+
+func TestClock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log4go-clock")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := NewManualClock(time.Date(2017, 3, 1, 23, 59, 0, 0, time.Local))
+	SetClock(c)
+	defer SetClock(nil)
+
+	// The times of the records and the daily rotation follow the clock
+	filename := filepath.Join(dir, "app.log")
+	w := NewFileLogWriter(filename, true, true).SetFormat("[%D %T] %M")
+	l := NewLogger().SetFilter("file", &Filter{Level: INFO, LogWriter: w})
+	l.Info("before midnight")
+	l.Flush()
+	c.Advance(2 * time.Minute)
+	l.Info("after midnight")
+	l.Close()
+	if contents, err := ioutil.ReadFile(filename + ".2017-03-01"); err != nil || !strings.HasPrefix(string(contents), "[2017/03/01 23:59:00") || !strings.Contains(string(contents), "before midnight") {
+		t.Errorf("Clock: the file of the first day has %q, %v", contents, err)
+	}
+	if contents, err := ioutil.ReadFile(filename); err != nil || !strings.HasPrefix(string(contents), "[2017/03/02 00:01:00") || !strings.Contains(string(contents), "after midnight") {
+		t.Errorf("Clock: the file of the second day has %q, %v", contents, err)
+	}
+
+	// The rate limits follow it too
+	every := NewMemoryLogWriter(10)
+	l = NewLogger().SetFilter("mem", &Filter{Level: INFO, LogWriter: every})
+	for i := 0; i < 3; i++ {
+		l.Every(time.Minute, INFO, "every minute")
+		c.Advance(30 * time.Second)
+	}
+	if n := len(every.Records()); n != 2 {
+		t.Errorf("Clock: Every logged %d times in 90s, want 2", n)
+	}
+
+	// A function as a clock, then the system clock again
+	at := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	SetClock(ClockFunc(func() time.Time { return at }))
+	mem := NewMemoryLogWriter(10)
+	l = NewLogger().SetFilter("mem", &Filter{Level: INFO, LogWriter: mem})
+	l.Info("at")
+	SetClock(nil)
+	l.Info("now")
+	if recs := mem.Records(); len(recs) != 2 || !recs[0].Created.Equal(at) || time.Since(recs[1].Created) > time.Minute {
+		t.Errorf("Clock: got %+v", recs)
+	}
+}
+
+func TestRecordTTL(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+	defer ln.Close()
+
+	w := NewSocketLogWriter("tcp", ln.Addr().String()).SetRecordTTL(FINEST, time.Hour).SetRecordTTL(ERROR, 24*time.Hour)
+	defer w.Close()
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("accept: %s", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	// Records held back for two hours: the INFO one is stale, not the ERROR one
+	for _, rec := range []*LogRecord{
+		newLogRecord(INFO, "source", "stale info"),
+		newLogRecord(ERROR, "source", "old error"),
+		newLogRecord(INFO, "source", "fresh info"),
+	} {
+		rec.Created = time.Now()
+		if rec.Message != "fresh info" {
+			rec.Created = rec.Created.Add(-2 * time.Hour)
+		}
+		w.LogWrite(rec)
+	}
+
+	dec := json.NewDecoder(conn)
+	for _, want := range []string{"old error", "fresh info"} {
+		var rec LogRecord
+		if err := dec.Decode(&rec); err != nil || rec.Message != want {
+			t.Fatalf("RecordTTL: got %v (%v), want %q", rec.Message, err, want)
+		}
+	}
+	if n := w.Dropped(); n != 1 {
+		t.Errorf("RecordTTL: %d records dropped, want 1", n)
+	}
+
+	// The configuration syntax
+	ttl, ok := xmlToRecordTTL(" 1h, ERROR=24h ", "socket")
+	if !ok || ttl[ACCESS] != time.Hour || ttl[WARNING] != time.Hour || ttl[ERROR] != 24*time.Hour || ttl[CRITICAL] != 24*time.Hour {
+		t.Errorf("xmlToRecordTTL: got %v (%v)", ttl, ok)
+	}
+	if _, ok := xmlToRecordTTL("LOUD=1h", "socket"); ok {
+		t.Errorf("xmlToRecordTTL: accepted an unknown level")
+	}
+}
+
+func TestWriterStats(t *testing.T) {
+	defer func(buflen int) {
+		LogBufferLength = buflen
+	}(LogBufferLength)
+	LogBufferLength = 0
+
+	fw := NewFileLogWriter(testLogFile, false, false).SetFormat("%M")
+	if fw == nil {
+		t.Fatalf("Invalid return: w should not be nil")
+	}
+	defer os.Remove(testLogFile)
+
+	for i := 0; i < 3; i++ {
+		fw.LogWrite(newLogRecord(INFO, "source", "message"))
+	}
+	fw.Rotate()
+	fw.LogWrite(newLogRecord(INFO, "source", "message"))
+	fw.Rotate()
+
+	log := NewLogger().
+		SetFilter("file", &Filter{Level: INFO, LogWriter: fw}).
+		SetFilter("memory", &Filter{Level: INFO, LogWriter: NewMemoryLogWriter(10)})
+	defer log.Close()
+
+	// The last rotation may still be in progress
+	want := WriterStats{Written: 4, Bytes: 4 * uint64(len("message\n")), Rotations: 2}
+	var stats map[string]WriterStats
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if stats = log.Stats(); stats["file"] == want {
+			break
+		}
+	}
+	if len(stats) != 1 {
+		t.Errorf("Stats: got %v, want the file writer only", stats)
+	}
+	if got := stats["file"]; got != want {
+		t.Errorf("Stats: got %+v, want %+v", got, want)
+	}
+}
+
+func TestErrorHandler(t *testing.T) {
+	defer SetErrorHandler(nil)
+
+	type failure struct {
+		writer string
+		err    error
+	}
+	failures := make(chan failure, 10)
+	SetErrorHandler(func(writer string, err error) { failures <- failure{writer, err} })
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	// Nothing listens: the first connection fails
+	w := NewSocketLogWriter("tcp", addr).SetReconnectBackoff(time.Hour, time.Hour)
+	defer w.Close()
+	select {
+	case f := <-failures:
+		if f.writer != fmt.Sprintf("SocketLogWriter(%q)", addr) || f.err == nil {
+			t.Errorf("ErrorHandler: got %q, %v", f.writer, f.err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("ErrorHandler: the failure wasn't reported")
+	}
+	if n := w.Stats().Errors; n != 1 {
+		t.Errorf("ErrorHandler: %d errors counted, want 1", n)
+	}
+}
+
+func TestJobLogger(t *testing.T) {
+	w := &testWriter{}
+	l := NewLogger()
+	l.AddFilter("test", DEBUG, w)
+
+	job := l.NewJob("import")
+	job.Processed(3)
+	job.Count("skipped", 2)
+	job.Failed(errors.New("timeout"))
+	job.Failed(errors.New("bad row"))
+	job.Failed(errors.New("timeout"))
+	job.Done()
+
+	if len(w.recs) != 1 {
+		t.Fatalf("JobLogger: expected a single summary record, got %d", len(w.recs))
+	}
+	rec := w.recs[0]
+	if rec.Level != WARNING {
+		t.Errorf("JobLogger: expected level %s, got %s", WARNING, rec.Level)
+	}
+	got := map[string]interface{}{}
+	for _, f := range rec.Fields {
+		got[f.Key] = f.Value
+	}
+	if got["job"] != "import" || got["processed"] != int64(3) || got["failed"] != int64(3) || got["skipped"] != int64(2) {
+		t.Errorf("JobLogger: unexpected fields %v", rec.Fields)
+	}
+	if want := `"timeout" (x2); "bad row" (x1)`; got["errors"] != want {
+		t.Errorf("JobLogger: errors got %q, want %q", got["errors"], want)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	defer func(interval time.Duration) {
+		ProgressInterval = interval
+	}(ProgressInterval)
+	ProgressInterval = time.Hour
+
+	w := &testWriter{}
+	l := NewLogger()
+	l.AddFilter("test", DEBUG, w)
+
+	for i := 1; i <= 1000; i++ {
+		l.Progress("copy", i, 1000)
+	}
+	if len(w.recs) != 1 {
+		t.Fatalf("Progress: expected only the completion to be logged, got %d records", len(w.recs))
+	}
+	if got, want := w.recs[0].Message, "copy: 1000/1000 (100.0%)"; got != want {
+		t.Errorf("Progress: got %q, want %q", got, want)
+	}
+
+	ProgressInterval = 0
+	l.Progress("scan", 1, 10)
+	l.Progress("scan", 2, 10)
+	if len(w.recs) != 3 {
+		t.Fatalf("Progress: expected every call to be logged, got %d records", len(w.recs))
+	}
+}
+
+func TestProgressSource(t *testing.T) {
+	defer func(global Logger) {
+		Global = global
+	}(Global)
+	w := &testWriter{}
+	Global = NewLogger()
+	Global.AddFilter("test", DEBUG, w)
+
+	Progress("source", 1, 1)
+	if len(w.recs) != 1 || !strings.Contains(w.recs[0].Source, "TestProgressSource") {
+		t.Errorf("Progress: expected the caller as source, got %v", w.recs)
+	}
+}
+
+func TestEvent(t *testing.T) {
+	w := &testWriter{}
+	l := NewLogger()
+	l.AddFilter("test", DEBUG, w)
+
+	RegisterEvent("user.login", RequiredFields("user_id", "ip"))
+	RegisterEvent("user.locked", RequiredFields("user_id"), EventLevel(WARNING))
+
+	if err := l.Event("user.login", F("user_id", 42), F("ip", "10.0.0.1")); err != nil {
+		t.Errorf("Event: unexpected error %s", err)
+	}
+	if err := l.Event("user.locked", F("user_id", 42)); err != nil {
+		t.Errorf("Event: unexpected error %s", err)
+	}
+	for _, bad := range [][]Field{
+		{F("user_id", 42)},
+		{F("user_id", 42), F("ip", "10.0.0.1"), F("ip", "10.0.0.2")},
+	} {
+		if err := l.Event("user.login", bad...); err == nil {
+			t.Errorf("Event(%v): expected an error", bad)
+		}
+	}
+	if err := l.Event("user.logout"); err == nil {
+		t.Errorf("Event: expected an error for an unknown event")
+	}
+
+	if len(w.recs) != 2 {
+		t.Fatalf("Event: expected 2 records, got %d", len(w.recs))
+	}
+	if rec := w.recs[0]; rec.Level != INFO || rec.Message != "user.login" || len(rec.Fields) != 2 {
+		t.Errorf("Event: unexpected record %+v", rec)
+	}
+	if rec := w.recs[1]; rec.Level != WARNING {
+		t.Errorf("Event: expected level %s, got %s", WARNING, rec.Level)
+	}
+}
+
+func TestMessageCatalog(t *testing.T) {
+	defer SetLocale(DefaultLocale)
+	RegisterCatalog("en", map[string]string{"disk.full": "disk %s is full", "disk.ok": "disk %s is fine"})
+	RegisterCatalog("de", map[string]string{"disk.full": "Datenträger %s ist voll"})
+
+	w := &testWriter{}
+	l := NewLogger()
+	l.AddFilter("test", DEBUG, w)
+
+	SetLocale("de-AT")
+	l.LogMsg(WARNING, "disk.full", "/data")
+	l.Info(Msg("disk.ok", "/tmp"))
+	l.Info(Msg("disk.unknown", "/tmp"))
+
+	for i, want := range []string{"Datenträger /data ist voll", "disk /tmp is fine", "disk.unknown /tmp"} {
+		if got := w.recs[i].Message; got != want {
+			t.Errorf("Catalog: record %d got %q, want %q", i, got, want)
+		}
+	}
+	if fields := w.recs[0].Fields; len(fields) != 1 || fields[0] != F("msg_key", "disk.full") {
+		t.Errorf("Catalog: expected the msg_key field, got %v", fields)
+	}
+}
+
+func TestTopTalkers(t *testing.T) {
+	ResetTalkers()
+	l := NewLogger()
+	l.AddFilter("test", INFO, &testWriter{})
+
+	// Nothing is counted unless turned on, nor records which aren't written
+	l.Log(INFO, "example.com/a.F:1", "off")
+	SetCostAccounting(true)
+	defer SetCostAccounting(false)
+	l.Log(DEBUG, "example.com/a.F:1", "filtered")
+
+	l.Log(INFO, "example.com/a.F:1", "abc")
+	l.Log(INFO, "example.com/a.(*T).M:2", "abcdef")
+	l.Log(INFO, "main.main:3", "ab")
+
+	got := TopTalkers(0)
+	want := []Talker{{"example.com/a", 2, 9}, {"main", 1, 2}}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("TopTalkers(0) = %+v, want %+v", got, want)
+	}
+	if got := TopTalkers(1); len(got) != 1 || got[0] != want[0] {
+		t.Errorf("TopTalkers(1) = %+v", got)
+	}
+}
+
+func TestMemoryLogWriter(t *testing.T) {
+	mlw := NewMemoryLogWriter(3).SetFormat("%M")
+	l := NewLogger()
+	l.AddFilter("memory", DEBUG, mlw)
+	l.AddFilter("test", INFO, &testWriter{})
+
+	for i := 0; i < 5; i++ {
+		l.Debug("debug %d", i)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := l.DumpMemory(buf); err != nil {
+		t.Fatalf("DumpMemory: %s", err)
+	}
+	if got, want := buf.String(), "debug 2\ndebug 3\ndebug 4\n"; got != want {
+		t.Errorf("DumpMemory: got %q, want %q", got, want)
+	}
+
+	mlw.Reset()
+	l.Info("after reset")
+	if recs := mlw.Records(); len(recs) != 1 || recs[0].Message != "after reset" {
+		t.Errorf("Records: got %d records after Reset", len(recs))
+	}
+}
+
+func TestFlightRecorder(t *testing.T) {
+	crashfile := "_crash.log"
+	defer os.Remove(crashfile)
+
+	saved := Global
+	defer func() { Global = saved }()
+	mlw := NewMemoryLogWriter(10).SetFormat("%M").SetCrashFile(crashfile, time.Minute)
+	Global = NewLogger().SetFilter("memory", &Filter{Level: FINE, LogWriter: mlw})
+
+	mlw.LogWrite(&LogRecord{Level: DEBUG, Created: time.Now().Add(-time.Hour), Message: "too old"})
+	Debug("detail before the crash")
+	func() {
+		defer Recover("recovered")
+		panic("boom")
+	}()
+
+	contents, err := ioutil.ReadFile(crashfile)
+	if err != nil {
+		t.Fatalf("FlightRecorder: %s", err)
+	}
+	for _, want := range []string{"Crash at", ": boom\n", "TestFlightRecorder", "detail before the crash\n", "recovered\nboom\n"} {
+		if !strings.Contains(string(contents), want) {
+			t.Errorf("FlightRecorder: crash file doesn't contain %q:\n%s", want, contents)
+		}
+	}
+	if strings.Contains(string(contents), "too old") {
+		t.Errorf("FlightRecorder: crash file contains records out of the window:\n%s", contents)
+	}
+}
+
+func TestTimeFormat(t *testing.T) {
+	rec := &LogRecord{Level: INFO, Created: now, Message: "message"}
+	for timeformat, want := range map[string]string{
+		"":                    "2009/02/13 23:31:30.123456789 UTC message\n",
+		"iso8601":             "2009-02-13T23:31:30.123Z message\n",
+		"rfc3339":             "2009-02-13T23:31:30Z message\n",
+		"rfc3339nano":         "2009-02-13T23:31:30.123456789Z message\n",
+		"epoch":               "1234567890 message\n",
+		"epochmillis":         "1234567890123 message\n",
+		"epochnanos":          "1234567890123456789 message\n",
+		"2006-01-02 15:04:05": "2009-02-13 23:31:30 message\n",
+	} {
+		if got := formatLogRecord("%Z %M", timeformat, rec); got != want {
+			t.Errorf("TimeFormat(%q): got %q, want %q", timeformat, got, want)
+		}
+	}
+	if validTimeFormat("rfc3399") {
+		t.Errorf("TimeFormat: a typo must not be a valid time format")
+	}
+
+	mlw := NewMemoryLogWriter(1).SetFormat("%Z %M").SetTimeFormat("epoch")
+	mlw.LogWrite(rec)
+	buf := new(bytes.Buffer)
+	mlw.Dump(buf)
+	if got, want := buf.String(), "1234567890 message\n"; got != want {
+		t.Errorf("TimeFormat: MemoryLogWriter got %q, want %q", got, want)
+	}
+}
+
+func TestRegisterWriterType(t *testing.T) {
+	var got []Property
+	w := &testWriter{}
+	RegisterWriterType("test", func(props []Property) (LogWriter, error) {
+		got = props
+		return w, nil
+	})
+	defer delete(writerFactories, "test")
+
+	l := NewLogger()
+	l.Config([]byte(`<logging>
+  <filter enabled="true">
+    <tag>mine</tag>
+    <type>test</type>
+    <level>WARNING</level>
+    <property name="answer">42</property>
+  </filter>
+</logging>`))
+	defer l.Close()
+
+	if len(got) != 1 || got[0] != (Property{"answer", "42"}) {
+		t.Errorf("RegisterWriterType: factory got properties %v", got)
+	}
+	if filt := l.Filter("mine"); filt == nil || filt.LogWriter != LogWriter(w) || filt.Level != WARNING {
+		t.Fatalf("RegisterWriterType: filter not configured: %v", l.Filters())
+	}
+	l.Info("filtered")
+	l.Warn("written")
+	if len(w.recs) != 1 || w.recs[0].Message != "written" {
+		t.Errorf("RegisterWriterType: writer got %d records", len(w.recs))
+	}
+}
+
+func TestLayouts(t *testing.T) {
+	rec := &LogRecord{
+		Level:   WARNING,
+		Created: now,
+		Source:  "source",
+		Message: `disk "data" full`,
+		Fields:  []Field{F("free", 0), F("level", "high"), F("err", errors.New("ENOSPC"))},
+	}
+	for _, test := range []struct {
+		Layout Layout
+		Want   string
+	}{
+		{PatternLayout{"[%Z] [%L] %M", "rfc3339"}, `[2009-02-13T23:31:30Z] [WARN] disk "data" full free=0 level=high err=ENOSPC` + "\n"},
+		{JSONLayout{}, `{"time":"2009-02-13T23:31:30.123456789Z","level":"WARN","source":"source","message":"disk \"data\" full","free":0,"level_":"high","err":"ENOSPC"}` + "\n"},
+		{JSONLayout{TimeFormat: "epochmillis"}, `{"time":1234567890123,"level":"WARN","source":"source","message":"disk \"data\" full","free":0,"level_":"high","err":"ENOSPC"}` + "\n"},
+		{LogfmtLayout{TimeFormat: "rfc3339"}, `time=2009-02-13T23:31:30Z level=WARN source=source msg="disk \"data\" full" free=0 level=high err=ENOSPC` + "\n"},
+		{JSONLayout{TimeFormat: "epoch", FieldsKey: "fields"}, `{"time":1234567890,"level":"WARN","source":"source","message":"disk \"data\" full","fields":{"free":0,"level":"high","err":"ENOSPC"}}` + "\n"},
+		{PatternLayout{"[%L] %M | %F", ""}, `[WARN] disk "data" full | free=0 level=high err=ENOSPC` + "\n"},
+		{PatternLayout{"%F{logfmt} %M", ""}, `free=0 level=high err=ENOSPC disk "data" full` + "\n"},
+		{PatternLayout{"%M %F{json}", ""}, `disk "data" full {"free":0,"level":"high","err":"ENOSPC"}` + "\n"},
+	} {
+		if got := string(test.Layout.Format(rec)); got != test.Want {
+			t.Errorf("%T.Format:\n got %s\nwant %s", test.Layout, got, test.Want)
+		}
+	}
+
+	mlw := NewMemoryLogWriter(1).SetLayout(JSONLayout{TimeFormat: "epoch"})
+	mlw.LogWrite(&LogRecord{Level: INFO, Created: now, Message: "m"})
+	buf := new(bytes.Buffer)
+	mlw.Dump(buf)
+	if got, want := buf.String(), `{"time":1234567890,"level":"INFO","source":"","message":"m"}`+"\n"; got != want {
+		t.Errorf("SetLayout: got %q, want %q", got, want)
+	}
+
+	// Records without fields
+	if got, want := FormatLogRecord("%M %F{json} %F.", &LogRecord{Message: "m"}), "m {} .\n"; got != want {
+		t.Errorf("FieldsVerb: got %q, want %q", got, want)
+	}
+	if got, want := string(JSONLayout{TimeFormat: "epoch", FieldsKey: "fields"}.Format(&LogRecord{Created: now, Message: "m"})), `{"time":1234567890,"level":"ACCE","source":"","message":"m"}`+"\n"; got != want {
+		t.Errorf("FieldsKey: got %q, want %q", got, want)
+	}
+}
+
+func TestIdentityProvider(t *testing.T) {
+	defer SetIdentityProvider(hostnameProvider{}, 5*time.Minute)
+
+	calls := 0
+	SetIdentityProvider(IdentityFunc(func() (Identity, error) {
+		if calls++; calls > 1 {
+			return Identity{}, errors.New("metadata service down")
+		}
+		return Identity{"web-1", "i-0123", "eu-west-1"}, nil
+	}), 0)
+
+	rec := &LogRecord{Level: INFO, Created: now, Message: "m"}
+	if got, want := FormatLogRecord("%H %I %R %M", rec), "web-1 i-0123 eu-west-1 m\n"; got != want {
+		t.Errorf("Identity: got %q, want %q", got, want)
+	}
+	if got, want := string(LogfmtLayout{TimeFormat: "epoch", Identity: true}.Format(rec)), "time=1234567890 hostname=web-1 instance_id=i-0123 region=eu-west-1 level=INFO source=\"\" msg=m\n"; got != want {
+		t.Errorf("Identity: got %q, want %q", got, want)
+	}
+
+	// A failed lookup keeps the last identity
+	refreshIdentity()
+	if id := CurrentIdentity(); id.Hostname != "web-1" || calls != 2 {
+		t.Errorf("Identity: got %+v after %d lookups", id, calls)
+	}
+}
+
+func TestLogfmtConfig(t *testing.T) {
+	l := NewLogger()
+	l.Config([]byte(`<logging>
+  <filter enabled="true">
+    <tag>memory</tag>
+    <type>memory</type>
+    <level>INFO</level>
+    <property name="format">logfmt</property>
+    <property name="timeformat">epoch</property>
+  </filter>
+</logging>`))
+	defer l.Close()
+
+	mlw := l.Filter("memory").LogWriter.(*MemoryLogWriter)
+	mlw.LogWrite(&LogRecord{Level: INFO, Created: now, Source: "src", Message: "", Fields: []Field{F("user id", `a"b`), F("", 1)}})
+	buf := new(bytes.Buffer)
+	mlw.Dump(buf)
+	if got, want := buf.String(), `time=1234567890 level=INFO source=src msg="" user_id="a\"b" _=1`+"\n"; got != want {
+		t.Errorf("Logfmt: got %s, want %s", got, want)
+	}
+}
+
+func TestFileLogWriterSetWhileWriting(t *testing.T) {
+	const n = 2000
+	w := NewFileLogWriter(testLogFile, false, false).SetFormat("A %M")
+	if w == nil {
+		t.Fatalf("Invalid return: w should not be nil")
+	}
+	defer os.Remove(testLogFile)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < n; i++ {
+			w.LogWrite(newLogRecord(INFO, "source", "message"))
+		}
+	}()
+	for i := 0; ; i++ {
+		select {
+		case <-done:
+		default:
+			if i%2 == 0 {
+				w.SetFormat("B %M").SetRotateSize(1 << 30).SetTimeFormat("epoch")
+			} else {
+				w.SetFormat("A %M").SetRotateLines(1 << 30).SetLayout(nil)
+			}
+			continue
+		}
+		break
+	}
+	w.Close()
+
+	// The writer goroutine may still be writing
+	var lines []string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		contents, _ := ioutil.ReadFile(testLogFile)
+		if lines = strings.Split(strings.TrimSuffix(string(contents), "\n"), "\n"); len(lines) >= n {
+			break
+		}
+	}
+	if len(lines) != n {
+		t.Fatalf("SetWhileWriting: got %d lines, want %d", len(lines), n)
+	}
+	for i, line := range lines {
+		if line != "A message" && line != "B message" {
+			t.Fatalf("SetWhileWriting: line %d is %q", i, line)
+		}
+	}
+}
+
+func TestPatternVerbs(t *testing.T) {
+	os.Setenv("LOG4GO_TEST_ZONE", "zone-a")
+	defer os.Unsetenv("LOG4GO_TEST_ZONE")
+
+	rec := &LogRecord{Level: INFO, Created: now, Message: "m"}
+	want := fmt.Sprintf("%d zone-a [{] m\n", os.Getpid())
+	if got := FormatLogRecord("%P %E{LOG4GO_TEST_ZONE}%E{UNSET_LOG4GO_VAR} [%E{] %M", rec); got != want {
+		t.Errorf("PatternVerbs: got %q, want %q", got, want)
+	}
+
+	// The goroutine id is captured once a format asked for it
+	w := &testWriter{}
+	l := NewLogger().SetFilter("test", &Filter{Level: INFO, LogWriter: w})
+	FormatLogRecord("%G", rec)
+	l.Info("m")
+	if got, want := w.recs[0].Goroutine, goroutineID(); got != want || got == 0 {
+		t.Errorf("PatternVerbs: goroutine %d, want %d", got, want)
+	}
+	if got, want := FormatLogRecord("%G", w.recs[0]), fmt.Sprintf("%d\n", goroutineID()); got != want {
+		t.Errorf("PatternVerbs: got %q, want %q", got, want)
+	}
+}
+
+func TestTimeLayoutVerbs(t *testing.T) {
+	rec := &LogRecord{Level: INFO, Created: now.In(time.FixedZone("CET", 3600)), Message: "m"}
+	tests := map[string]string{
+		"%D{2006-01-02T15:04:05.000Z07:00} %M":      "2009-02-14T00:31:30.123+01:00 m",
+		"%D{2006-01-02T15:04:05.000000Z07:00}{UTC}": "2009-02-13T23:31:30.123456Z",
+		"[%T{15:04:05.000}] [%D{UTC}]":              "[00:31:30.123] [2009/02/13]",
+		"%T{UTC}":                                   "23:31:30.123456789 UTC",
+		"%D{rfc3339nano}{UTC}{x}":                   "2009-02-13T23:31:30.123456789Z{x}",
+		"%D %T":                                     "2009/02/14 00:31:30.123456789 CET",
+	}
+	for format, want := range tests {
+		if got := FormatLogRecord(format, rec); got != want+"\n" {
+			t.Errorf("TimeLayoutVerbs: %q gives %q, want %q", format, got, want)
+		}
+	}
+}
+
+func TestLogcFields(t *testing.T) {
+	w := &testWriter{}
+	l := NewLogger().SetFilter("test", &Filter{Level: INFO, LogWriter: w})
+
+	l.LogcFields(DEBUG, func() (string, []Field) {
+		t.Errorf("LogcFields called the closure below the level")
+		return "", nil
+	})
+	l.LogcFields(WARNING, func() (string, []Field) {
+		return "payload", []Field{F("size", 3)}
+	})
+
+	if len(w.recs) != 1 {
+		t.Fatalf("LogcFields: got %d records, want 1", len(w.recs))
+	}
+	rec := w.recs[0]
+	if rec.Level != WARNING || rec.Message != "payload" || len(rec.Fields) != 1 || rec.Fields[0] != F("size", 3) {
+		t.Errorf("LogcFields: unexpected record %+v", rec)
+	}
+	if !strings.Contains(rec.Source, "TestLogcFields") {
+		t.Errorf("LogcFields: source is %q", rec.Source)
+	}
+}
+
+func TestUTCWriters(t *testing.T) {
+	os.Remove(testLogFile)
+	defer os.Remove(testLogFile)
+
+	rec := &LogRecord{Level: INFO, Created: now.In(time.FixedZone("CET", 3600)), Message: "m"}
+
+	flw := NewFileLogWriter(testLogFile, false, false).SetFormat("%D %T %M").SetUTC(true)
+	flw.LogWrite(rec)
+	mlw := NewMemoryLogWriter(10).SetFormat("%D %T %M").SetUTC(true)
+	mlw.LogWrite(rec)
+	flw.Close()
+	runtime.Gosched()
+	time.Sleep(50 * time.Millisecond)
+
+	want := "2009/02/13 23:31:30.123456789 UTC m\n"
+	if contents, err := ioutil.ReadFile(testLogFile); err != nil {
+		t.Fatalf("UTCWriters: %s", err)
+	} else if string(contents) != want {
+		t.Errorf("UTCWriters: file got %q, want %q", contents, want)
+	}
+	buf := new(bytes.Buffer)
+	mlw.Dump(buf)
+	if buf.String() != want {
+		t.Errorf("UTCWriters: memory got %q, want %q", buf.String(), want)
+	}
+
+	// The record shared with the other writers keeps its time zone
+	if _, off := rec.Created.Zone(); off != 3600 {
+		t.Errorf("UTCWriters: record changed to %s", rec.Created)
+	}
+
+	// And the property of the configuration
+	l := NewLogger()
+	l.Config([]byte(`<logging><filter enabled="true"><tag>mem</tag><type>memory</type><level>INFO</level><property name="format">%T</property><property name="utc">true</property></filter></logging>`))
+	defer l.Close()
+	l.Filter("mem").LogWrite(rec)
+	buf.Reset()
+	l.DumpMemory(buf)
+	if got := buf.String(); got != "23:31:30.123456789 UTC\n" {
+		t.Errorf("UTCWriters: configured memory got %q", got)
+	}
+}
+
+func TestAccessRouting(t *testing.T) {
+	app, access, all, tagged := &testWriter{}, &testWriter{}, &testWriter{}, &testWriter{}
+	l := NewLogger().
+		SetFilter("app", &Filter{Level: ACCESS, LogWriter: app, Access: AccessExclude}).
+		SetFilter("all", &Filter{Level: ACCESS, LogWriter: all}).
+		SetFilter("access", &Filter{Level: ACCESS, LogWriter: tagged})
+	l.AddAccessFilter("requests", access)
+
+	l.Access("GET /")
+	l.Info("started")
+
+	counts := []struct {
+		name string
+		w    *testWriter
+		want []string
+	}{
+		{"app", app, []string{"started"}},
+		{"requests", access, []string{"GET /"}},
+		{"access", tagged, []string{"GET /"}},
+		{"all", all, []string{"GET /", "started"}},
+	}
+	for _, c := range counts {
+		var got []string
+		for _, rec := range c.w.recs {
+			got = append(got, rec.Message)
+		}
+		if strings.Join(got, ",") != strings.Join(c.want, ",") {
+			t.Errorf("AccessRouting: %s got %q, want %q", c.name, got, c.want)
+		}
+	}
+
+	// Without any filter taking them, the access records are skipped early
+	l = NewLogger().SetFilter("app", &Filter{Level: ACCESS, LogWriter: app, Access: AccessExclude})
+	l.Access(func() string { t.Errorf("AccessRouting: closure called"); return "" })
+
+	// And through the configuration
+	l = NewLogger()
+	l.Config([]byte(`<logging><filter enabled="true"><tag>a</tag><type>memory</type><level>INFO</level><access>only</access></filter></logging>`))
+	if l.Filter("a").Access != AccessOnly {
+		t.Errorf("AccessRouting: configured access mode is %d", l.Filter("a").Access)
+	}
+}
+
+func TestStackLevel(t *testing.T) {
+	file, console := &testWriter{}, &testWriter{}
+	l := NewLogger().
+		SetFilter("file", &Filter{Level: INFO, LogWriter: file, StackLevel: ERROR}).
+		SetFilter("console", &Filter{Level: INFO, LogWriter: console})
+
+	l.Warn("slow")
+	l.Error("failed")
+	l.Errorf("failed %d", 2)
+
+	if len(file.recs) != 3 || len(console.recs) != 3 {
+		t.Fatalf("StackLevel: got %d and %d records", len(file.recs), len(console.recs))
+	}
+	for i, rec := range console.recs {
+		if strings.Contains(rec.Message, "\n") {
+			t.Errorf("StackLevel: console record %d has a stack: %q", i, rec.Message)
+		}
+	}
+	if file.recs[0].Message != "slow" {
+		t.Errorf("StackLevel: warning has a stack: %q", file.recs[0].Message)
+	}
+	for _, rec := range file.recs[1:] {
+		lines := strings.SplitN(rec.Message, "\n", 3)
+		if len(lines) < 2 || !strings.HasPrefix(lines[0], "failed") || !strings.Contains(lines[1], "log4go_test.go") {
+			t.Errorf("StackLevel: no stack from the caller in %q", rec.Message)
+		}
+	}
+
+	// Condensed on one line, and cut to the caller
+	short, one := &testWriter{}, &testWriter{}
+	l = NewLogger().
+		SetFilter("short", &Filter{Level: INFO, LogWriter: short, StackLevel: ERROR, StackFormat: stack.Condensed}).
+		SetFilter("one", &Filter{Level: INFO, LogWriter: one, StackLevel: ERROR, StackFormat: stack.Condensed, StackDepth: 1})
+	l.Named("db").Errorf("failed %d", 3)
+	lines := strings.Split(short.recs[0].Message, "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[1], "log4go.TestStackLevel(log4go_test.go:") || !strings.Contains(lines[1], ") < testing.tRunner(") {
+		t.Errorf("StackLevel: condensed stack %q", short.recs[0].Message)
+	}
+	if got := one.recs[0].Message; !strings.HasPrefix(got, "failed 3\nlog4go.TestStackLevel(") || strings.Contains(got, " < ") {
+		t.Errorf("StackLevel: stack of depth 1 %q", got)
+	}
+
+	// And through the configuration, which doesn't pass the properties on to
+	// the writer
+	l = NewLogger()
+	l.Config([]byte(`<logging><filter enabled="true"><tag>mem</tag><type>memory</type><level>INFO</level><property name="stacktrace_level">ERROR</property><property name="stacktrace_format">condensed</property><property name="stacktrace_depth">5</property></filter></logging>`))
+	if filt := l.Filter("mem"); filt.StackLevel != ERROR || filt.StackFormat != stack.Condensed || filt.StackDepth != 5 {
+		t.Errorf("StackLevel: configured %s, %s and %d", filt.StackLevel, filt.StackFormat, filt.StackDepth)
+	}
+}
+
+func TestBridgeWriter(t *testing.T) {
+	w := &testWriter{}
+	l := NewLogger().SetFilter("test", &Filter{Level: FINEST, LogWriter: w})
+
+	c := NewClassifier(INFO).
+		AddPrefix("http: TLS handshake error", DEBUG).
+		AddRegexp(regexp.MustCompile(`^http: panic`), CRITICAL)
+	std := l.StdLogger("http", c)
+	std.Print("http: TLS handshake error from 10.0.0.1: EOF")
+	std.Print("http: panic serving 10.0.0.1: boom\ngoroutine 1 [running]:")
+	std.Print("http: Accept error: too many open files; retrying")
+
+	def := NewBridgeWriter(l, "grpc", nil)
+	fmt.Fprintln(def, "WARNING: transport is closing")
+	fmt.Fprintln(def, "ERROR: connection refused")
+	fmt.Fprintln(def, "listening on :443")
+	fmt.Fprintln(def, "")
+
+	want := []struct {
+		lvl Level
+		src string
+		msg string
+	}{
+		{DEBUG, "http", "http: TLS handshake error from 10.0.0.1: EOF"},
+		{CRITICAL, "http", "http: panic serving 10.0.0.1: boom\ngoroutine 1 [running]:"},
+		{INFO, "http", "http: Accept error: too many open files; retrying"},
+		{WARNING, "grpc", "WARNING: transport is closing"},
+		{ERROR, "grpc", "ERROR: connection refused"},
+		{INFO, "grpc", "listening on :443"},
+	}
+	if len(w.recs) != len(want) {
+		t.Fatalf("BridgeWriter: got %d records, want %d", len(w.recs), len(want))
+	}
+	for i, rec := range w.recs {
+		if rec.Level != want[i].lvl || rec.Source != want[i].src || rec.Message != want[i].msg {
+			t.Errorf("BridgeWriter: record %d is %s %q %q, want %s %q %q", i, rec.Level, rec.Source, rec.Message, want[i].lvl, want[i].src, want[i].msg)
+		}
+	}
+}
+
+func TestHijackStdLog(t *testing.T) {
+	defer func(global Logger) {
+		Global = global
+	}(Global)
+	w := &testWriter{}
+	Global = NewLogger().SetFilter("test", &Filter{Level: FINEST, LogWriter: w})
+
+	restore := HijackStdLog(WARNING)
+	stdlog.SetPrefix("client: ")
+	stdlog.Printf("retrying in %ds", 5)
+	restore()
+
+	// Restored, the standard logger writes to its own output again
+	stdlog.SetOutput(ioutil.Discard)
+	stdlog.Print("not hijacked")
+	stdlog.SetOutput(os.Stderr)
+
+	if len(w.recs) != 1 {
+		t.Fatalf("HijackStdLog: got %d records, want 1", len(w.recs))
+	}
+	rec := w.recs[0]
+	if rec.Level != WARNING || !strings.HasPrefix(rec.Source, "log4go_test.go:") || rec.Message != "client: retrying in 5s" {
+		t.Errorf("HijackStdLog: got %s %q %q", rec.Level, rec.Source, rec.Message)
+	}
+}
+
+func TestNDC(t *testing.T) {
+	w := &testWriter{}
+	l := NewLogger().SetFilter("test", &Filter{Level: FINEST, LogWriter: w})
+
+	ctx := PushContext(context.Background(), "request 42")
+	batch7 := PushContext(ctx, "batch 7")
+	batch8 := PushContext(ctx, "batch 8")
+	l.InfoCtx(batch7, "m")
+	l.InfoCtx(batch8, "m")
+	l.InfoCtx(PopContext(batch7), "m")
+	l.InfoCtx(PopContext(ctx), "m")
+	l.Info("m")
+
+	want := []string{"[request 42 batch 7] m", "[request 42 batch 8] m", "[request 42] m", "[] m", "[] m"}
+	if len(w.recs) != len(want) {
+		t.Fatalf("NDC: got %d records, want %d", len(w.recs), len(want))
+	}
+	for i, rec := range w.recs {
+		if got := FormatLogRecord("[%x] %M", rec); got != want[i]+"\n" {
+			t.Errorf("NDC: record %d is %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestRegisterLevel(t *testing.T) {
+	security := RegisterLevel(20, "SECURITY")
+	if again := RegisterLevel(20, "SECURITY"); again != security {
+		t.Errorf("RegisterLevel: got %d registering again", again)
+	}
+	for _, bad := range []struct {
+		value int
+		name  string
+	}{{5, "NOTICE"}, {21, "SECURITY"}, {20, "AUDIT2"}, {30, "WARNING"}, {25, "TRACING"}, {26, "SECURE"}, {27, "FATLY"}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("RegisterLevel(%d, %q): didn't panic", bad.value, bad.name)
+				}
+			}()
+			RegisterLevel(bad.value, bad.name)
+		}()
+	}
+
+	mlw := NewMemoryLogWriter(10).SetFormat("[%L] %M")
+	l := NewLogger().SetFilter("memory", &Filter{Level: CRITICAL, LogWriter: mlw})
+	l.Logf(security, "login failed for %s", "root")
+	l.Error("not critical")
+	buf := new(bytes.Buffer)
+	mlw.Dump(buf)
+	if got, want := buf.String(), "[SECU] login failed for root\n"; got != want {
+		t.Errorf("RegisterLevel: got %q, want %q", got, want)
+	}
+
+	if lvl, bad := convertLevel("SECURITY"); bad || lvl != security || levelName(lvl) != "SECURITY" || security.String() != "SECU" {
+		t.Errorf("RegisterLevel: the configuration got %d for SECURITY", lvl)
+	}
+	if s := Level(42).String(); s != "UNKNOWN" {
+		t.Errorf("RegisterLevel: an unknown level prints as %q", s)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for s, want := range map[string]Level{
+		"WARNING":  WARNING,
+		"warning":  WARNING,
+		" Warn ":   WARNING,
+		"debg":     DEBUG,
+		"critical": CRITICAL,
+		"access":   ACCESS,
+		"7":        ERROR,
+		"0":        ACCESS,
+		"fatal":    FATAL,
+		"9":        FATAL,
+	} {
+		if got, err := ParseLevel(s); err != nil || got != want {
+			t.Errorf("ParseLevel(%q): got %v, %v, want %v", s, got, err, want)
+		}
+	}
+	if name := levelName(FATAL); name != "FATAL" || FATAL.String() != "FATL" {
+		t.Errorf("FATAL: named %q, printed %q", name, FATAL.String())
+	}
+	for _, s := range []string{"", "verbose", "42", "-1", "10"} {
+		if got, err := ParseLevel(s); err == nil {
+			t.Errorf("ParseLevel(%q): got %v, want an error", s, got)
+		}
+	}
+
+	notice := RegisterLevel(-3, "Notice")
+	if got, err := ParseLevel("NOTICE"); err != nil || got != notice {
+		t.Errorf("ParseLevel: got %v, %v for a registered level", got, err)
+	}
+	if got, err := ParseLevel("-3"); err != nil || got != notice {
+		t.Errorf("ParseLevel: got %v, %v for the value of a registered level", got, err)
+	}
+
+	// NOTIFY would print as NOTI too, it needs an abbreviation of its own
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("RegisterLevel(-4, %q): didn't panic", "NOTIFY")
+			}
+		}()
+		RegisterLevel(-4, "NOTIFY")
+	}()
+	if notify := RegisterLevelAbbrev(-4, "NOTIFY", "NTFY"); notify.String() != "NTFY" || notice.String() != "Noti" {
+		t.Errorf("RegisterLevelAbbrev: got %s and %s", notify, notice)
+	}
+	if lvl, bad := convertLevel("info"); bad || lvl != INFO {
+		t.Errorf("ParseLevel: the configuration got %v for info", lvl)
+	}
+}
+
+func TestOverrideLevel(t *testing.T) {
+	defer ResetLevelOverride()
+	w := &testWriter{}
+	filt := &Filter{Level: ERROR, LogWriter: w}
+	l := NewLogger().SetFilter("test", filt)
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	BindFlags(fs)
+	if err := fs.Parse([]string{"-log4go.level", "verbose"}); err == nil {
+		t.Errorf("BindFlags: an unknown level was accepted")
+	}
+	if err := fs.Parse([]string{"-log4go.level=debug"}); err != nil {
+		t.Fatalf("BindFlags: %s", err)
+	}
+	l.Debug("overridden")
+	if len(w.recs) != 1 || filt.CurrentLevel() != DEBUG || fs.Lookup("log4go.level").Value.String() != "DEBUG" {
+		t.Errorf("OverrideLevel: got %d records at %v", len(w.recs), filt.CurrentLevel())
+	}
+
+	// SetLevel wins, and the filters get their levels back
+	filt.SetLevel(WARNING)
+	l.Info("below the filter")
+	atomic.StoreInt64(&filt.override, 0)
+	ResetLevelOverride()
+	l.Warn("below the configuration")
+	if len(w.recs) != 1 || filt.CurrentLevel() != ERROR {
+		t.Errorf("ResetLevelOverride: got %d records at %v", len(w.recs), filt.CurrentLevel())
+	}
+}
+
+func TestMDC(t *testing.T) {
+	w := &testWriter{}
+	l := NewLogger().SetFilter("test", &Filter{Level: FINEST, LogWriter: w})
+
+	MDCSet("request_id", "42")
+	MDCSet("user", "ann")
+	l.Info("m")
+	done := make(chan struct{})
+	go func() {
+		l.Info("other goroutine")
+		close(done)
+	}()
+	<-done
+	MDCRemove("user")
+	l.InfoCtx(WithMDC(context.Background(), "user", "bob"), "m")
+	if got := MDCGet("request_id"); got != "42" {
+		t.Errorf("MDC: MDCGet is %q", got)
+	}
+	MDCClear()
+	l.Info("m")
+
+	want := []string{"[42 ann] request_id=42 user=ann m", "[ ]  other goroutine", "[42 bob] request_id=42 user=bob m", "[ ]  m"}
+	if len(w.recs) != len(want) {
+		t.Fatalf("MDC: got %d records, want %d", len(w.recs), len(want))
+	}
+	for i, rec := range w.recs {
+		if got := FormatLogRecord("[%X{request_id} %X{user}] %X %M", rec); got != want[i]+"\n" {
+			t.Errorf("MDC: record %d is %q, want %q", i, got, want[i])
+		}
+	}
+	if n := atomic.LoadInt32(&mdcGoroutines); n != 0 {
+		t.Errorf("MDC: %d goroutines left with a context", n)
+	}
+}
+
+func TestNamedLogger(t *testing.T) {
+	w := &testWriter{}
+	l := NewLogger().SetFilter("test", &Filter{Level: INFO, LogWriter: w})
+
+	db := l.Named("db")
+	pool := db.Named("pool")
+	db.Info("connected to %s", "primary")
+	pool.Debug(func() string { t.Errorf("NamedLogger: closure called below the level"); return "" })
+	if err := pool.Warn("exhausted"); err == nil || err.Error() != "exhausted" {
+		t.Errorf("NamedLogger: Warn returned %v", err)
+	}
+
+	if len(w.recs) != 2 {
+		t.Fatalf("NamedLogger: got %d records, want 2", len(w.recs))
+	}
+	if got, want := FormatLogRecord("[%N] %M", w.recs[0]), "[db] connected to primary\n"; got != want {
+		t.Errorf("NamedLogger: got %q, want %q", got, want)
+	}
+	if got, want := FormatLogRecord("[%N] %M", w.recs[1]), "[db.pool] exhausted\n"; got != want {
+		t.Errorf("NamedLogger: got %q, want %q", got, want)
+	}
+	if !strings.Contains(w.recs[1].Source, "TestNamedLogger") {
+		t.Errorf("NamedLogger: source is %q", w.recs[1].Source)
+	}
+
+	rec := &LogRecord{Level: INFO, Created: now, Message: "m", Name: "db"}
+	if got, want := string(JSONLayout{TimeFormat: "epoch"}.Format(rec)), `{"time":1234567890,"level":"INFO","logger":"db","source":"","message":"m"}`+"\n"; got != want {
+		t.Errorf("NamedLogger: got %q, want %q", got, want)
+	}
+	if got, want := string(LogfmtLayout{TimeFormat: "epoch"}.Format(rec)), `time=1234567890 level=INFO logger=db source="" msg=m`+"\n"; got != want {
+		t.Errorf("NamedLogger: got %q, want %q", got, want)
+	}
+
+	db.Infof("%d%% of the pool in use", 50)
+	pool.Debugf("below the level %d", 1)
+	if err := pool.Errorf("lost %d connections", 3); err == nil || err.Error() != "lost 3 connections" {
+		t.Errorf("NamedLogger: Errorf returned %v", err)
+	}
+	if len(w.recs) != 4 {
+		t.Fatalf("NamedLogger: got %d records, want 4", len(w.recs))
+	}
+	if got, want := FormatLogRecord("[%N] %M", w.recs[2]), "[db] 50% of the pool in use\n"; got != want {
+		t.Errorf("NamedLogger: got %q, want %q", got, want)
+	}
+	if !strings.Contains(w.recs[3].Source, "TestNamedLogger") || w.recs[3].Name != "db.pool" {
+		t.Errorf("NamedLogger: Errorf logged %+v", w.recs[3])
+	}
+}
+
+func TestPanic(t *testing.T) {
+	w := &testWriter{}
+	l := NewLogger().SetFilter("test", &Filter{Level: INFO, LogWriter: w})
+
+	for _, test := range []struct {
+		panic func()
+		want  string
+	}{
+		{func() { l.Panic("disk", 3, "full") }, "disk 3 full"},
+		{func() { l.Panicf("disk %d full", 3) }, "disk 3 full"},
+	} {
+		func() {
+			defer func() {
+				if got := recover(); got != test.want {
+					t.Errorf("Panic: recovered %v, want %q", got, test.want)
+				}
+			}()
+			test.panic()
+		}()
+	}
+
+	if len(w.recs) != 2 {
+		t.Fatalf("Panic: got %d records, want 2", len(w.recs))
+	}
+	for _, rec := range w.recs {
+		if rec.Level != CRITICAL || rec.Message != "disk 3 full" || !strings.Contains(rec.Source, "TestPanic") {
+			t.Errorf("Panic: unexpected record %+v", rec)
+		}
+	}
+	if l.Filter("test") == nil {
+		t.Errorf("Panic: the logger was closed")
+	}
+}
+
+// A bytes.Buffer safe for concurrent use
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func (b *syncBuffer) Reset() {
+	b.mu.Lock()
+	b.buf.Reset()
+	b.mu.Unlock()
+}
+
+// A writer which blocks until it's released
+type stuckWriter chan struct{}
+
+func (w stuckWriter) LogWrite(rec *LogRecord) { <-w }
+func (w stuckWriter) Close()                  {}
+
+func TestBlockWatchdog(t *testing.T) {
+	defer func(out io.Writer) { watchdogOut = out }(watchdogOut)
+	out := &syncBuffer{}
+	watchdogOut = out
+	SetBlockWatchdog(20 * time.Millisecond)
+	defer SetBlockWatchdog(0)
+
+	stuck := make(stuckWriter)
+	l := NewLogger().SetFilter("stuck", &Filter{Level: INFO, LogWriter: stuck})
+	done := make(chan struct{})
+	go func() {
+		l.Info("m")
+		close(done)
+	}()
+
+	for deadline := time.Now().Add(5 * time.Second); out.String() == "" && time.Now().Before(deadline); {
+		time.Sleep(5 * time.Millisecond)
+	}
+	close(stuck)
+	<-done
+
+	report := out.String()
+	if !strings.Contains(report, `writing to filter "stuck" (log4go.stuckWriter)`) || !strings.Contains(report, "TestBlockWatchdog") {
+		t.Errorf("BlockWatchdog: unexpected report %q", report)
+	}
+
+	// A writer which takes the records in time isn't reported
+	out.Reset()
+	w := &testWriter{}
+	l = NewLogger().SetFilter("test", &Filter{Level: INFO, LogWriter: w})
+	l.Info("m")
+	time.Sleep(40 * time.Millisecond)
+	if report := out.String(); report != "" {
+		t.Errorf("BlockWatchdog: unexpected report %q", report)
+	}
+}
+
+func TestExitFunc(t *testing.T) {
+	saved := Global
+	defer func() { Global = saved }()
+	defer SetExitFunc(nil)
+	defer func() { exiting.hooks = nil }()
+
+	var events []string
+	SetExitFunc(func(code int) { events = append(events, fmt.Sprint("exit ", code)) })
+	AddExitHook(func() { events = append(events, "hook 1") })
+	AddExitHook(func() { events = append(events, "hook 2") })
+
+	w := &testWriter{}
+	Global = NewLogger().SetFilter("test", &Filter{Level: INFO, LogWriter: w})
+	Exit("bye")
+	Global = NewLogger().SetFilter("test", &Filter{Level: INFO, LogWriter: w})
+	ExitWithf(3, "code %d", 3)
+	Global = NewLogger().SetFilter("test", &Filter{Level: INFO, LogWriter: w})
+	Fatal("fatal")
+
+	want := "hook 1,hook 2,exit 0,hook 1,hook 2,exit 3,hook 1,hook 2,exit 1"
+	if got := strings.Join(events, ","); got != want {
+		t.Errorf("ExitFunc: got %q, want %q", got, want)
+	}
+	if len(w.recs) != 3 || w.recs[0].Message != "bye" || w.recs[1].Message != "code 3" || w.recs[2].Level != CRITICAL {
+		t.Errorf("ExitFunc: unexpected records %v", w.recs)
+	}
+	if len(Global.Filters()) != 0 {
+		t.Errorf("ExitFunc: the logger wasn't closed")
+	}
+}
+
+func TestExplicitVariants(t *testing.T) {
+	w := &testWriter{}
+	l := NewLogger().SetFilter("test", &Filter{Level: FINEST, LogWriter: w})
+
+	l.Debugf("%d%%", 50)
+	l.Infoln("a", 1, 2, "b")
+	l.Tracec(func() string { return "closure" })
+	err := l.Errorf("failed: %s", "%d")
+	if err == nil || err.Error() != "failed: %d" {
+		t.Errorf("Errorf returned %v", err)
+	}
+	l.Warnln("w", 3)
+
+	want := []string{"50%", "a 1 2 b", "closure", "failed: %d", "w 3"}
+	if len(w.recs) != len(want) {
+		t.Fatalf("ExplicitVariants: got %d records, want %d", len(w.recs), len(want))
+	}
+	for i, rec := range w.recs {
+		if rec.Message != want[i] {
+			t.Errorf("ExplicitVariants: record %d is %q, want %q", i, rec.Message, want[i])
+		}
+		if !strings.Contains(rec.Source, "TestExplicitVariants") {
+			t.Errorf("ExplicitVariants: record %d has source %q", i, rec.Source)
+		}
+	}
+
+	// The closure isn't called when nothing is logged
+	l.Filter("test").Level = INFO
+	l.Debugc(func() string { t.Errorf("Debugc called the closure"); return "" })
+}
+
+func TestArgsMessage(t *testing.T) {
+	var nilClosure func() string
+	var nilRecover func(interface{}) string
+	tests := []struct {
+		arg0 interface{}
+		args []interface{}
+		want string
+	}{
+		{"100% sure", nil, "100% sure"},
+		{"%d-%s", []interface{}{1, "a"}, "1-a"},
+		{1, []interface{}{2, "%d", 3}, "1 2 %d 3"},
+		{"x", nil, "x"},
+		{errors.New("e"), []interface{}{"f"}, "e f"},
+		{nil, nil, "<nil>"},
+		{func() string { return "closure" }, nil, "closure"},
+		{nilClosure, nil, "<nil>"},
+		{nilRecover, []interface{}{1}, "<nil>"},
+		{func(v interface{}) string { return fmt.Sprint("got ", v) }, nil, "got <nil>"},
+		{func(v interface{}) string { return fmt.Sprint("got ", v) }, []interface{}{"err"}, "got err"},
+	}
+	for i, test := range tests {
+		if got := argsMessage(test.arg0, test.args); got != test.want {
+			t.Errorf("argsMessage: %d: got %q, want %q", i, got, test.want)
+		}
+	}
+
+	w := &testWriter{}
+	l := NewLogger().SetFilter("test", &Filter{Level: FINEST, LogWriter: w})
+	l.Info(1, 2)
+	if err := l.Critical(func(v interface{}) string { return fmt.Sprint(v) }); err == nil || err.Error() != "<nil>" {
+		t.Errorf("Critical returned %v", err)
+	}
+	if len(w.recs) != 2 || w.recs[0].Message != "1 2" || !strings.HasPrefix(w.recs[1].Message, "<nil>\n") {
+		t.Errorf("argsMessage: unexpected records %v", w.recs)
+	}
+}
+
+func TestDumpState(t *testing.T) {
+	saved := Global
+	defer func() { Global = saved }()
+	defer SetErrorHandler(nil)
+	SetErrorHandler(func(string, error) {})
+
+	Global = NewLogger().
+		SetFilter("memory", &Filter{Level: DEBUG, LogWriter: NewMemoryLogWriter(10), Access: AccessExclude, Excludes: []string{"example.com/noisy"}}).
+		SetFilter("test", &Filter{Level: INFO, LogWriter: &testWriter{}})
+	Global.Filter("test").SetLevel(WARNING)
+	ReportError(`SocketLogWriter("collector:9999")`, errors.New("connection refused"))
+
+	buf := new(bytes.Buffer)
+	if err := DumpState(buf); err != nil {
+		t.Fatalf("DumpState: %s", err)
+	}
+	for _, want := range []string{
+		"2 filters\n",
+		`filter "memory": *log4go.MemoryLogWriter, level DEBUG, access exclude, excludes ["example.com/noisy"]`,
+		`filter "test": *log4go.testWriter, level WARNING` + "\n",
+		`SocketLogWriter("collector:9999"): connection refused`,
+		"=== Goroutines\n",
+		"log4go.TestDumpState(",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("DumpState: missing %q in:\n%s", want, buf.String())
+		}
+	}
+
+	// On a signal
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatalf("FindProcess: %s", err)
+	}
+	out := &syncBuffer{}
+	stop := DumpStateOnSignal(out)
+	defer stop()
+	if err := p.Signal(syscall.SIGQUIT); err != nil {
+		t.Skipf("cannot send SIGQUIT: %s", err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); !strings.Contains(out.String(), "=== End of state"); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("DumpStateOnSignal: no dump after SIGQUIT")
+		}
+	}
+}
+
+// Converts to upper case, refusing the digits
+type upperTranscoder struct{}
+
+func (upperTranscoder) Transcode(b []byte) ([]byte, error) {
+	if bytes.ContainsAny(b, "0123456789") {
+		return nil, errors.New("unmappable digit")
+	}
+	return bytes.ToUpper(b), nil
+}
+
+func TestTranscoder(t *testing.T) {
+	defer SetErrorHandler(nil)
+	SetErrorHandler(func(string, error) {})
+	RegisterEncoding("X-Upper", func(unmappable string) (Transcoder, error) { return upperTranscoder{}, nil })
+	defer delete(encodings, "x-upper")
+
+	if tr, ok := xmlToTranscoder(" x-upper ", "", "file"); !ok || tr == nil {
+		t.Fatalf("xmlToTranscoder: x-upper not found")
+	}
+	if tr, ok := xmlToTranscoder("UTF-8", "", "file"); !ok || tr != nil {
+		t.Errorf("xmlToTranscoder: UTF-8 should need no Transcoder")
+	}
+	if _, ok := xmlToTranscoder("EBCDIC", "", "file"); ok {
+		t.Errorf("xmlToTranscoder: accepted an unknown encoding")
+	}
+	if _, ok := xmlToTranscoder("x-upper", "ignore", "file"); ok {
+		t.Errorf("xmlToTranscoder: accepted an unknown unmappable")
+	}
+
+	defer func(buflen int) {
+		LogBufferLength = buflen
+	}(LogBufferLength)
+	LogBufferLength = 0
+
+	w := NewFileLogWriter(testLogFile, false, false).SetFormat("%M").SetTranscoder(upperTranscoder{})
+	if w == nil {
+		t.Fatalf("Invalid return: w should not be nil")
+	}
+	defer os.Remove(testLogFile)
+	defer w.Close()
+	w.LogWrite(newLogRecord(INFO, "source", "converted"))
+	w.LogWrite(newLogRecord(INFO, "source", "dropped 42"))
+	w.LogWrite(newLogRecord(INFO, "source", "kept"))
+	w.Rotate() // waits for the writes
+
+	if contents, err := ioutil.ReadFile(testLogFile); err != nil {
+		t.Errorf("read(%q): %s", testLogFile, err)
+	} else if string(contents) != "CONVERTED\nKEPT\n" {
+		t.Errorf("Transcoder: file contains %q", contents)
+	}
+	if s := w.Stats(); s.Dropped != 1 {
+		t.Errorf("Transcoder: %d records dropped, want 1", s.Dropped)
+	}
+}
+
+func TestFileCRLFAndBOM(t *testing.T) {
+	defer func(buflen int) {
+		LogBufferLength = buflen
+	}(LogBufferLength)
+	LogBufferLength = 0
+
+	w := NewFileLogWriter(testLogFile, false, false).SetFormat("%M").SetCRLF(true).SetBOM(true).SetHeadFoot("head", "foot")
+	if w == nil {
+		t.Fatalf("Invalid return: w should not be nil")
+	}
+	defer os.Remove(testLogFile)
+	defer w.Close()
+	w.LogWrite(newLogRecord(INFO, "source", "two\nlines"))
+	w.LogWrite(newLogRecord(INFO, "source", "already\r\n"))
+	w.Rotate() // waits for the writes, and writes the trailer and the header again, without a BOM
+
+	want := "\xEF\xBB\xBFhead\r\n" + "two\r\nlines\r\n" + "already\r\n\r\n" + "foot\r\n" + "head\r\n"
+	if contents, err := ioutil.ReadFile(testLogFile); err != nil {
+		t.Errorf("read(%q): %s", testLogFile, err)
+	} else if string(contents) != want {
+		t.Errorf("CRLF and BOM: file contains %q, want %q", contents, want)
+	}
+
+	for _, newline := range []string{"lf", "CRLF"} {
+		if _, ok := xmlToFileLogWriter(nil, []Property{{"filename", "x.log"}, {"newline", newline}}, false); !ok {
+			t.Errorf("xmlToFileLogWriter: rejected newline %q", newline)
+		}
+	}
+	if _, ok := xmlToFileLogWriter(nil, []Property{{"filename", "x.log"}, {"newline", "cr"}}, false); ok {
+		t.Errorf("xmlToFileLogWriter: accepted newline %q", "cr")
+	}
+}
+
+const testJSONConfig = `{
+  "filters": [
+    {"tag": "memory", "type": "memory", "level": "DEBUG", "access": "exclude",
+     "exclude": ["github.com/example", "github.com/sample"],
+     "properties": {"size": 100, "format": "[%L] %M", "utc": true}},
+    {"tag": "shipper", "enabled": false, "type": "http", "level": "INFO",
+     "properties": {"endpoint": "https://logs.example.com/ingest",
+                    "header": ["Authorization: Bearer secret", "X-Team: shop"]}}
+  ]
+}`
+
+func TestJSONConfig(t *testing.T) {
+	lc, err := ParseJSONConfig([]byte(testJSONConfig))
+	if err != nil {
+		t.Fatalf("ParseJSONConfig: %s", err)
+	}
+	want := &LoggerConfig{Filter: []FilterConfig{{
+		Enabled:  "true",
+		Tag:      "memory",
+		Level:    "DEBUG",
+		Type:     "memory",
+		Property: []Property{{"size", "100"}, {"format", "[%L] %M"}, {"utc", "true"}},
+		Exclude:  []string{"github.com/example", "github.com/sample"},
+		Access:   "exclude",
+	}, {
+		Enabled: "false",
+		Tag:     "shipper",
+		Level:   "INFO",
+		Type:    "http",
+		Property: []Property{
+			{"endpoint", "https://logs.example.com/ingest"},
+			{"header", "Authorization: Bearer secret"},
+			{"header", "X-Team: shop"},
+		},
+	}}}
+	if !reflect.DeepEqual(lc, want) {
+		t.Errorf("ParseJSONConfig:\ngot  %+v\nwant %+v", lc, want)
+	}
+
+	for _, bad := range []string{
+		`{"filters": [{"tag": "bad", "properties": [1, 2]}]}`,
+		`{"filters": [{"tag": "bad", "properties": {"size": {"n": 1}}}]}`,
+	} {
+		if _, err := ParseJSONConfig([]byte(bad)); err == nil {
+			t.Errorf("ParseJSONConfig: accepted %s", bad)
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "jsonconf")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "log4go.JSON")
+	if err := ioutil.WriteFile(filename, []byte(testJSONConfig), 0644); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+
+	log := NewLogger()
+	log.LoadConfiguration(filename)
+	defer log.Close()
+	filt := log.Filter("memory")
+	if len(log.Filters()) != 1 || filt == nil {
+		t.Fatalf("LoadConfiguration: got filters %v, want memory only", log.Filters())
+	}
+	if mlw, ok := filt.LogWriter.(*MemoryLogWriter); !ok || len(mlw.recs) != 100 || filt.Level != DEBUG || filt.Access != AccessExclude {
+		t.Errorf("LoadConfiguration: unexpected filter %+v", filt)
+	}
+}
+
+func TestConfigBuilder(t *testing.T) {
+	defer SetErrorHandler(nil)
+	SetErrorHandler(func(string, error) {})
+
+	log := NewLogger()
+	defer log.Close()
+	custom := NewMemoryLogWriter(1)
+	err := NewConfig().
+		Memory(10, DEBUG, WithFormat("%M"), WithAccess(AccessExclude), WithExcludes("github.com/example")).
+		File(testLogFile, INFO, WithTag("file"), WithRotateSize(1024), WithMaxBackup(3), WithStackLevel(ERROR)).
+		Writer("custom", ACCESS, custom, WithAccess(AccessOnly)).
+		Apply(log)
+	defer os.Remove(testLogFile)
+	if err != nil {
+		t.Fatalf("Apply: %s", err)
+	}
+	if len(log.Filters()) != 3 {
+		t.Fatalf("Apply: got %d filters, want 3", len(log.Filters()))
+	}
+	if filt := log.Filter("memory"); filt.Level != DEBUG || filt.Access != AccessExclude || len(filt.Excludes) != 1 || filt.LogWriter.(*MemoryLogWriter).format != "%M" {
+		t.Errorf("Apply: unexpected memory filter %+v", filt)
+	}
+	if filt := log.Filter("file"); filt.Level != INFO || filt.StackLevel != ERROR {
+		t.Errorf("Apply: unexpected file filter %+v", filt)
+	} else if w := filt.LogWriter.(*FileLogWriter); !w.rotate || w.maxsize != 1024 || w.maxbackup != 3 || w.daily {
+		t.Errorf("Apply: unexpected file writer settings %+v", w)
+	}
+	if filt := log.Filter("custom"); filt.LogWriter != custom || filt.Access != AccessOnly {
+		t.Errorf("Apply: unexpected custom filter %+v", filt)
+	}
+
+	// Nothing changes on error
+	for _, b := range []*ConfigBuilder{
+		NewConfig().Memory(10, INFO).Memory(20, INFO),
+		NewConfig().Memory(10, INFO, WithTag("other")).File("no/such/dir/x.log", INFO),
+	} {
+		before := log.Filter("memory")
+		if err := b.Apply(log); err == nil {
+			t.Errorf("Apply: no error")
+		}
+		if len(log.Filters()) != 3 || log.Filter("memory") != before {
+			t.Errorf("Apply: the logger changed on error")
+		}
+	}
+}
+
+func TestInheritFromEnv(t *testing.T) {
+	defer SetWorkerID("")
+	defer os.Unsetenv(EnvConfig)
+	defer os.Unsetenv(EnvWorkerID)
+
+	parent := NewLogger()
+	defer parent.Close()
+	parent.Config([]byte(`<logging locale="en">
+  <filter enabled="true">
+    <tag>memory</tag>
+    <type>memory</type>
+    <level>DEBUG</level>
+    <access>exclude</access>
+    <exclude>github.com/example</exclude>
+    <property name="size">10</property>
+    <property name="format">[%L] %M</property>
+  </filter>
+</logging>`))
+	parent.Filter("memory").SetLevel(INFO)
+
+	env, err := parent.Env()
+	if err != nil {
+		t.Fatalf("Env: %s", err)
+	}
+	if len(env) != 1 || !strings.HasPrefix(env[0], EnvConfig+"=") {
+		t.Fatalf("Env: got %q", env)
+	}
+	os.Setenv(EnvConfig, strings.TrimPrefix(env[0], EnvConfig+"="))
+	os.Setenv(EnvWorkerID, "3")
+
+	worker := NewLogger()
+	defer worker.Close()
+	if !worker.InheritFromEnv() {
+		t.Fatalf("InheritFromEnv: nothing inherited")
+	}
+	filt := worker.Filter("memory")
+	if len(worker.Filters()) != 1 || filt == nil {
+		t.Fatalf("InheritFromEnv: got filters %v, want memory only", worker.Filters())
+	}
+	mlw, ok := filt.LogWriter.(*MemoryLogWriter)
+	if !ok || filt.Level != INFO || filt.Access != AccessExclude || len(filt.Excludes) != 1 || len(mlw.recs) != 10 || mlw.format != "[%L] %M" {
+		t.Fatalf("InheritFromEnv: unexpected filter %+v", filt)
+	}
+
+	worker.Info("from %s", "worker")
+	if recs := mlw.Records(); len(recs) != 1 || len(recs[0].Fields) != 1 || recs[0].Fields[0] != (Field{"worker_id", "3"}) {
+		t.Errorf("InheritFromEnv: records %+v, want one with the worker id", recs)
+	}
+
+	parent.AddFilter("code", INFO, NewMemoryLogWriter(1))
+	if _, err := parent.Env(); err == nil {
+		t.Errorf("Env: no error for a filter added in code")
+	}
+	os.Unsetenv(EnvConfig)
+	if worker.InheritFromEnv() {
+		t.Errorf("InheritFromEnv: inherited without a configuration")
+	}
+}
+
+func TestSharedRotation(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shared files are not supported on windows")
+	}
+	defer func(buflen int, interval time.Duration) {
+		LogBufferLength, SharedCheckInterval = buflen, interval
+	}(LogBufferLength, SharedCheckInterval)
+	LogBufferLength, SharedCheckInterval = 0, 0
+
+	// Two writers on the same file stand for two processes
+	os.Remove(testLogFile)
+	defer os.Remove(testLogFile)
+	defer os.Remove(testLogFile + ".001")
+	defer os.Remove(testLogFile + ".002")
+	defer os.Remove(testLogFile + ".lock")
+	w1 := NewFileLogWriter(testLogFile, true, false).SetFormat("%M").SetShared(true)
+	w2 := NewFileLogWriter(testLogFile, true, false).SetFormat("%M").SetShared(true)
+	if w1 == nil || w2 == nil {
+		t.Fatalf("Invalid return: w should not be nil")
+	}
+	defer w1.Close()
+	defer w2.Close()
+	w1.LogWrite(newLogRecord(INFO, "source", "before"))
+
+	// Both reach the limit, only the first one rotates
+	for _, w := range []*FileLogWriter{w1, w2} {
+		w.mu.Lock()
+		w.maxlines, w.maxlines_curlines = 1, 2
+		if err := w.intRotate(); err != nil {
+			t.Errorf("intRotate: %s", err)
+		}
+		w.maxlines = 0
+		w.mu.Unlock()
+	}
+	if _, err := os.Stat(testLogFile + ".002"); err == nil {
+		t.Errorf("SetShared: the file was rotated twice")
+	}
+	if contents, err := ioutil.ReadFile(testLogFile + ".001"); err != nil || string(contents) != "before\n" {
+		t.Errorf("SetShared: rotated file contains %q (%v)", contents, err)
+	}
+
+	w1.LogWrite(newLogRecord(INFO, "source", "after 1"))
+	w1.Rotate() // waits for the write
+	w2.LogWrite(newLogRecord(INFO, "source", "after 2"))
+	w2.Rotate()
+	if contents, err := ioutil.ReadFile(testLogFile); err != nil || string(contents) != "after 1\nafter 2\n" {
+		t.Errorf("SetShared: new file contains %q (%v)", contents, err)
+	}
+
+	// A process which didn't rotate follows the new file when it writes
+	os.Rename(testLogFile, testLogFile+".002")
+	w2.LogWrite(newLogRecord(INFO, "source", "followed"))
+	w2.Rotate()
+	if contents, err := ioutil.ReadFile(testLogFile); err != nil || string(contents) != "followed\n" {
+		t.Errorf("SetShared: followed file contains %q (%v)", contents, err)
+	}
+}
+
+func TestLockWrites(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shared files are not supported on windows")
+	}
+	os.Remove(testLogFile)
+	defer os.Remove(testLogFile)
+	defer os.Remove(testLogFile + ".lock")
+
+	w := NewFileLogWriter(testLogFile, false, false).SetFormat("%M").SetBuffer(16, time.Hour).SetLockWrites(true)
+	if w == nil {
+		t.Fatalf("Invalid return: w should not be nil")
+	}
+	if !w.shared {
+		t.Errorf("SetLockWrites: the file isn't shared")
+	}
+
+	// The buffer is written out before a record which doesn't fit in, so that
+	// no record is cut between two writes
+	w.mu.Lock()
+	w.write(newLogRecord(INFO, "source", "record 1"))
+	w.write(newLogRecord(INFO, "source", "record 2"))
+	contents, _ := ioutil.ReadFile(testLogFile)
+	w.mu.Unlock()
+	if string(contents) != "record 1\n" {
+		t.Errorf("SetLockWrites: file contains %q, want the first record only", contents)
+	}
+	if _, err := os.Stat(testLogFile + ".lock"); err != nil {
+		t.Errorf("SetLockWrites: no lock file: %s", err)
+	}
+
+	// The rotation holds the lock already when it writes the trailer
+	w.SetHeadFoot("", "end")
+	w.Rotate()
+	w.Close()
+	if contents, err := ioutil.ReadFile(testLogFile); err != nil || string(contents) != "record 1\nrecord 2\nend\nend\n" {
+		t.Errorf("SetLockWrites: file contains %q (%v)", contents, err)
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	os.Setenv("LOG4GO_TEST_DIR", "/srv/logs")
+	defer os.Unsetenv("LOG4GO_TEST_DIR")
+	os.Unsetenv("LOG4GO_TEST_UNSET")
+
+	for _, test := range []struct {
+		value, want string
+	}{
+		{"app.log", "app.log"},
+		{"${LOG4GO_TEST_DIR}/app.log", "/srv/logs/app.log"},
+		{"${LOG4GO_TEST_UNSET:-/var/log/app}/app.log", "/var/log/app/app.log"},
+		{"${LOG4GO_TEST_DIR:-/var/log/app}", "/srv/logs"},
+		{"http://${LOG4GO_TEST_UNSET:-localhost}:${LOG4GO_TEST_UNSET:-9000}/", "http://localhost:9000/"},
+		{"$${LOG4GO_TEST_DIR} costs $5", "${LOG4GO_TEST_DIR} costs $5"},
+	} {
+		if got, ok := expandEnv(test.value); !ok || got != test.want {
+			t.Errorf("expandEnv(%q) = %q, %v, want %q", test.value, got, ok, test.want)
+		}
+	}
+	if _, ok := expandEnv("${LOG4GO_TEST_DIR"); ok {
+		t.Errorf("expandEnv: accepted an unterminated reference")
+	}
+	if abs := filepath.Join(os.TempDir(), "app.log"); xmlToPath(abs) != abs {
+		t.Errorf("xmlToPath(%q) = %q, want it unchanged", abs, xmlToPath(abs))
+	}
+
+	log := NewLogger()
+	defer log.Close()
+	log.Config([]byte(`<logging>
+  <filter enabled="true">
+    <tag>memory</tag>
+    <type>memory</type>
+    <level>DEBUG</level>
+    <property name="size">${LOG4GO_TEST_UNSET:-7}</property>
+  </filter>
+</logging>`))
+	if mlw, ok := log.Filter("memory").LogWriter.(*MemoryLogWriter); !ok || len(mlw.recs) != 7 {
+		t.Errorf("Config: the property was not expanded")
+	}
+}
+
+func TestValidateConfiguration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "validate")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	readonly := filepath.Join(dir, "readonly")
+	os.Mkdir(readonly, 0555)
+
+	filename := filepath.Join(dir, "log4go.xml")
+	ioutil.WriteFile(filename, []byte(`<logging>
+  <filter enabled="true">
+    <tag>stdout</tag>
+    <type>console</type>
+    <level>DEBUG</level>
+  </filter>
+  <filter enabled="true">
+    <tag>file</tag>
+    <type>file</type>
+    <level>LOUD</level>
+    <property name="filename">`+filepath.Join(dir, "new", "app.log")+`</property>
+  </filter>
+  <filter enabled="false">
+    <tag>other</tag>
+    <type>file</type>
+    <level>INFO</level>
+    <property name="filename">`+filepath.Join(dir, "new", "other.log")+`</property>
+    <property name="colour">blue</property>
+  </filter>
+  <filter enabled="true">
+    <tag>stdout</tag>
+    <type>carrier-pigeon</type>
+    <level>INFO</level>
+  </filter>
+</logging>`), 0644)
+
+	errs := ValidateConfiguration(filename)
+	var msgs []string
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	want := []string{
+		`filter "file": Error: Required child <level> for filter has unknown value: LOUD`,
+		`filter "other": Warning: Unknown property "colour" for file filter`,
+		`filter "stdout": Error: Duplicate tag`,
+		`filter "stdout": Error: Could not load XML configuration: unknown filter type "carrier-pigeon"`,
+	}
+	if !reflect.DeepEqual(msgs, want) {
+		t.Errorf("ValidateConfiguration:\ngot  %q\nwant %q", msgs, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "new")); err == nil {
+		t.Errorf("ValidateConfiguration: created the directory of a file")
+	}
+
+	if os.Getuid() != 0 {
+		if err := checkWritable(filepath.Join(readonly, "sub", "app.log")); err == nil {
+			t.Errorf("checkWritable: no error for a read-only directory")
+		}
+	}
+	if err := checkWritable(filepath.Join(dir, "sub", "app.log")); err != nil {
+		t.Errorf("checkWritable: %s", err)
+	}
+	if errs := ValidateConfiguration(filepath.Join(dir, "missing.xml")); len(errs) != 1 {
+		t.Errorf("ValidateConfiguration: got %v for a missing file", errs)
+	}
+}
+
+func TestSamplers(t *testing.T) {
+	recs := make([]*LogRecord, 1000)
+	for i := range recs {
+		recs[i] = newLogRecord(DEBUG, "source", fmt.Sprintf("message %d", i))
+	}
+	decisions := func(s Sampler) (kept []bool, n int) {
+		for _, rec := range recs {
+			keep := s.Keep(rec)
+			kept = append(kept, keep)
+			if keep {
+				n++
+			}
+		}
+		return
+	}
+
+	// The same seed or salt gives the same decisions
+	for _, mk := range []func(seed int64) Sampler{
+		func(seed int64) Sampler { return NewRandomSampler(0.1, seed) },
+		func(seed int64) Sampler { return NewHashSampler(0.1, fmt.Sprint(seed)) },
+	} {
+		kept1, n := decisions(mk(42))
+		kept2, _ := decisions(mk(42))
+		kept3, _ := decisions(mk(43))
+		if !reflect.DeepEqual(kept1, kept2) {
+			t.Errorf("%T: different decisions with the same seed", mk(42))
+		}
+		if reflect.DeepEqual(kept1, kept3) {
+			t.Errorf("%T: same decisions with another seed", mk(42))
+		}
+		if n < 50 || n > 150 {
+			t.Errorf("%T: kept %d records out of 1000 at 0.1", mk(42), n)
+		}
+	}
+
+	s := SampleBelow(WARNING, NewRandomSampler(0, 1))
+	if s.Keep(newLogRecord(INFO, "source", "info")) || !s.Keep(newLogRecord(ERROR, "source", "error")) {
+		t.Errorf("SampleBelow: wrong decisions")
+	}
+
+	// Through the configuration
+	log := NewLogger()
+	defer log.Close()
+	log.Config([]byte(`<logging>
+  <filter enabled="true">
+    <tag>memory</tag>
+    <type>memory</type>
+    <level>DEBUG</level>
+    <property name="size">1000</property>
+    <property name="sample_rate">0.1</property>
+    <property name="sample_mode">hash</property>
+    <property name="sample_seed">42</property>
+  </filter>
+</logging>`))
+	for _, rec := range recs {
+		log.dispatch(rec)
+	}
+	log.Error("always kept")
+	mlw := log.Filter("memory").LogWriter.(*MemoryLogWriter)
+	_, n := decisions(NewHashSampler(0.1, "42"))
+	if got := len(mlw.Records()); got != n+1 {
+		t.Errorf("sample_rate: %d records written, want %d", got, n+1)
+	}
+
+	for _, props := range [][]Property{
+		{{"sample_rate", "2"}},
+		{{"sample_rate", "0.5"}, {"sample_mode", "every-other"}},
+		{{"sample_rate", "0.5"}, {"sample_seed", "x"}},
+	} {
+		configOut = ioutil.Discard
+		_, ok := configFilter(FilterConfig{Enabled: "true", Tag: "t", Type: "memory", Level: "INFO", Property: props}, false, &LoggerConfig{})
+		configOut = os.Stderr
+		if ok {
+			t.Errorf("configFilter: accepted %v", props)
+		}
+	}
+}
+
+func TestSplitLogWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "split")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	w := NewSplitLogWriter(filepath.Join(dir, "%s.log"), SplitByField("tenant")).SetFormat("%M").SetMaxOpen(2).SetIdleTimeout(0)
+	for _, tenant := range []string{"a", "b", "c", "a", "../etc/passwd", ""} {
+		rec := newLogRecord(INFO, "source", "for "+tenant)
+		rec.Fields = []Field{{"tenant", tenant}}
+		w.LogWrite(rec)
+	}
+	w.Close()
+
+	for name, want := range map[string]string{
+		"a.log":             "for a tenant=a\nfor a tenant=a\n",
+		"b.log":             "for b tenant=b\n",
+		"c.log":             "for c tenant=c\n",
+		".._etc_passwd.log": "for ../etc/passwd tenant=../etc/passwd\n",
+		"default.log":       "for  tenant=\n",
+	} {
+		if contents, err := ioutil.ReadFile(filepath.Join(dir, name)); err != nil || string(contents) != want {
+			t.Errorf("SplitLogWriter: %s contains %q (%v), want %q", name, contents, err, want)
+		}
+	}
+	if s := w.Stats(); s.Written != 6 || s.Evictions != 4 {
+		t.Errorf("SplitLogWriter: %d written, %d evictions, want 6 and 4", s.Written, s.Evictions)
+	}
+	if n := w.OpenFiles(); n != 0 {
+		t.Errorf("SplitLogWriter: %d files open after Close", n)
+	}
+
+	// The idle files are closed
+	w = NewSplitLogWriter(filepath.Join(dir, "%s.log"), SplitBySource).SetIdleTimeout(20 * time.Millisecond)
+	defer w.Close()
+	w.LogWrite(newLogRecord(INFO, "github.com/example/pkg.(*T).Method:42", "idle"))
+	for deadline := time.Now().Add(5 * time.Second); w.OpenFiles() != 0 || w.Stats().Written != 1; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("SplitLogWriter: %d files still open", w.OpenFiles())
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "github.com_example_pkg.log")); err != nil {
+		t.Errorf("SplitBySource: %s", err)
+	}
+}
+
+func TestPathBase(t *testing.T) {
+	cwd, _ := os.Getwd()
+	dir, err := ioutil.TempDir("", "pathbase")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	abs := filepath.Join(dir, "abs.log")
+
+	for _, test := range []struct {
+		value, base, want string
+	}{
+		{"app.log", "", "app.log"}, // joined with the directory of the program by xmlToPath
+		{"app.log", "exe-dir", "app.log"},
+		{"app.log", "cwd", filepath.Join(cwd, "app.log")},
+		{"log/app.log", "config-dir", filepath.Join(dir, "log", "app.log")},
+		{abs, "config-dir", abs},
+		{abs, "absolute", abs},
+	} {
+		if got, err := resolvePath(test.value, test.base, dir); err != nil || got != test.want {
+			t.Errorf("resolvePath(%q, %q) = %q, %v, want %q", test.value, test.base, got, err, test.want)
+		}
+	}
+	if _, err := resolvePath("app.log", "absolute", dir); err == nil {
+		t.Errorf("resolvePath: accepted a relative path with path_base absolute")
+	}
+	if _, err := resolvePath("app.log", "config-dir", ""); err == nil {
+		t.Errorf("resolvePath: accepted config-dir without a configuration file")
+	}
+
+	filename := filepath.Join(dir, "log4go.xml")
+	ioutil.WriteFile(filename, []byte(`<logging path_base="config-dir">
+  <filter enabled="true">
+    <tag>file</tag>
+    <type>file</type>
+    <level>INFO</level>
+    <property name="filename">log/app.log</property>
+  </filter>
+  <filter enabled="true">
+    <tag>cwd</tag>
+    <type>file</type>
+    <level>INFO</level>
+    <property name="path_base">cwd</property>
+    <property name="filename">`+testLogFile+`</property>
+  </filter>
+</logging>`), 0644)
+	defer os.Remove(testLogFile)
+
+	log := NewLogger()
+	log.LoadConfiguration(filename)
+	defer log.Close()
+	if got, want := log.Filter("file").LogWriter.(*FileLogWriter).filename, filepath.Join(dir, "log", "app.log"); got != want {
+		t.Errorf("path_base config-dir: opened %q, want %q", got, want)
+	}
+	if got, want := log.Filter("cwd").LogWriter.(*FileLogWriter).filename, filepath.Join(cwd, testLogFile); got != want {
+		t.Errorf("path_base cwd: opened %q, want %q", got, want)
+	}
+}
+
+func TestFileMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permissions are not supported on windows")
+	}
+	dir, err := ioutil.TempDir("", "filemode")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "log", "app.log")
+	flw, ok := xmlToFileLogWriter(nil, []Property{
+		{Name: "filename", Value: filename},
+		{Name: "filemode", Value: "0600"},
+		{Name: "dirmode", Value: "750"},
+	}, true)
+	if !ok || flw == nil {
+		t.Fatalf("xmlToFileLogWriter failed")
+	}
+	defer flw.Close()
+	if fi, err := os.Stat(filename); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("filemode: file is %v, %v, want 0600", fi.Mode().Perm(), err)
+	}
+	if fi, err := os.Stat(filepath.Dir(filename)); err != nil || fi.Mode().Perm() != 0750 {
+		t.Errorf("dirmode: directory is %v, %v, want 0750", fi.Mode().Perm(), err)
+	}
+
+	// The opened file is changed, and so are the files of the rotations
+	flw.SetFileMode(0640)
+	if fi, _ := os.Stat(filename); fi.Mode().Perm() != 0640 {
+		t.Errorf("SetFileMode: file is %v, want 0640", fi.Mode().Perm())
+	}
+	flw.SetFileMode(0600).SetRotate(false)
+	flw.Rotate()
+	if fi, _ := os.Stat(filename); fi.Mode().Perm() != 0600 {
+		t.Errorf("SetFileMode: rotated file is %v, want 0600", fi.Mode().Perm())
+	}
+
+	configOut = ioutil.Discard
+	defer func() { configOut = os.Stderr }()
+	for _, bad := range []string{"0800", "1777", "rw-r-----"} {
+		if _, ok := xmlToFileMode("filemode", bad, "file"); ok {
+			t.Errorf("xmlToFileMode(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestRedactor(t *testing.T) {
+	scrubbed, plain := &testWriter{}, &testWriter{}
+	l := NewLogger().
+		SetFilter("scrubbed", &Filter{Level: INFO, LogWriter: scrubbed, Redactor: DefaultRedactor().AddField("ssn")}).
+		SetFilter("plain", &Filter{Level: INFO, LogWriter: plain})
+
+	l.Info("paid with 4111 1111 1111 1111 by jane.doe@example.com")
+	l.Info("order 1234567890123 shipped")
+	l.intLogFields(INFO, []Field{{"auth", "Bearer abc.def-ghi"}, {"ssn", 123456789}, {"items", []string{"a"}}}, "login password=hunter2 ok")
+
+	want := []string{
+		"paid with [REDACTED] by [REDACTED]",
+		"order 1234567890123 shipped",
+		"login password=[REDACTED] ok auth=Bearer [REDACTED] ssn=[REDACTED] items=[a]",
+	}
+	for i, rec := range scrubbed.recs {
+		got := rec.Message
+		for _, f := range rec.Fields {
+			got += fmt.Sprintf(" %s=%v", f.Key, f.Value)
+		}
+		if i >= len(want) || got != want[i] {
+			t.Errorf("Redactor: record %d is %q", i, got)
+		}
+	}
+	if len(plain.recs) != 3 || plain.recs[0].Message != "paid with 4111 1111 1111 1111 by jane.doe@example.com" || plain.recs[2].Fields[1].Value != 123456789 {
+		t.Errorf("Redactor: the records of the other filter were changed")
+	}
+
+	// And through the configuration
+	l = NewLogger()
+	l.Config([]byte(`<logging><filter enabled="true"><tag>a</tag><type>memory</type><level>INFO</level>
+		<property name="redact">emails, tokens</property>
+		<property name="redact_pattern">\bacct-\d+</property>
+		<property name="redact_field">ssn</property></filter></logging>`))
+	r := l.Filter("a").Redactor
+	if r == nil {
+		t.Fatalf("Redactor: none configured")
+	}
+	if got := r.RedactString("acct-42 of a@b.io, 4111111111111111"); got != "[REDACTED] of [REDACTED], 4111111111111111" {
+		t.Errorf("Redactor: configured one gives %q", got)
+	}
+}
+
+func TestErrorSummary(t *testing.T) {
+	if got, want := messageTemplate("dial 10.0.0.1:5432: i/o timeout after 3s"), "dial #:#: i/o timeout after #"; got != want {
+		t.Errorf("messageTemplate = %q, want %q", got, want)
+	}
+
+	ResetErrorSummary()
+	defer ResetErrorSummary()
+	defer func(size int) { ErrorIndexSize = size }(ErrorIndexSize)
+	ErrorIndexSize = 2
+
+	log := NewLogger().SetFilter("test", &Filter{Level: INFO, LogWriter: &testWriter{}})
+	log.Log(ERROR, "example.com/db.Query:10", "query 1 failed")
+	log.Log(WARNING, "example.com/db.Query:10", "query 2 is slow")
+	log.Log(CRITICAL, "example.com/db.Query:12", "query 3 failed")
+	log.Log(ERROR, "example.com/http.Serve:5", "no handler for /x")
+
+	summary := log.ErrorSummary()
+	if len(summary) != 2 {
+		t.Fatalf("ErrorSummary: %d groups, want 2: %+v", len(summary), summary)
+	}
+	if g := summary[1]; g.Template != "query # failed" || g.Source != "example.com/db.Query" ||
+		g.Count != 2 || g.Level != "CRITICAL" || g.Message != "query 3 failed" || g.FirstSeen.After(g.LastSeen) {
+		t.Errorf("ErrorSummary: query group = %+v", g)
+	}
+	if g := summary[0]; g.Template != "no handler for /x" || g.Count != 1 {
+		t.Errorf("ErrorSummary: handler group = %+v", g)
+	}
+
+	// A third group drops the one seen the longest ago
+	log.Log(ERROR, "example.com/cache.Get:3", "miss")
+	for _, g := range log.ErrorSummary() {
+		if g.Source == "example.com/db.Query" {
+			t.Errorf("ErrorSummary: kept %+v beyond ErrorIndexSize", g)
+		}
+	}
+}
+
+func TestFileDailyRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filedaily")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A file last written yesterday, whose ctime is today (as after a chmod)
+	filename := filepath.Join(dir, "app.log")
+	if err := ioutil.WriteFile(filename, []byte("yesterday\n"), 0644); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	yesterday := time.Now().AddDate(0, 0, -1)
+	if err := os.Chtimes(filename, yesterday, yesterday); err != nil {
+		t.Fatalf("Chtimes: %s", err)
+	}
+	if times, err := support.GetFileTimes(filename); err != nil || times.Modify.Unix() != yesterday.Unix() {
+		t.Fatalf("GetFileTimes: mtime %v, %v, want %v", times.Modify, err, yesterday)
+	}
+
+	w := NewFileLogWriter(filename, true, true)
+	if w == nil {
+		t.Fatalf("NewFileLogWriter failed")
+	}
+	w.Close()
+	old := filename + "." + yesterday.Format("2006-01-02")
+	if contents, err := ioutil.ReadFile(old); err != nil || string(contents) != "yesterday\n" {
+		t.Errorf("the file of yesterday wasn't rotated to %s: %q, %v", old, contents, err)
+	}
+
+	// Restarting the same day reuses the file
+	os.Remove(old)
+	ioutil.WriteFile(filename, []byte("today\n"), 0644)
+	w = NewFileLogWriter(filename, true, true)
+	if w == nil {
+		t.Fatalf("NewFileLogWriter failed")
+	}
+	w.Close()
+	if contents, err := ioutil.ReadFile(filename); err != nil || string(contents) != "today\n" {
+		t.Errorf("the file of today wasn't reused: %q, %v", contents, err)
+	}
+}
+
+func TestFileRestartCounts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filerestart")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The 4 lines of before the restart count towards the 5 of the limit
+	filename := filepath.Join(dir, "app.log")
+	if err := ioutil.WriteFile(filename, []byte("1\n2\n3\n4\n"), 0644); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	w := NewFileLogWriter(filename, true, false)
+	if w == nil {
+		t.Fatalf("NewFileLogWriter failed")
+	}
+	w.SetFormat("%M").SetRotateLines(5)
+	if w.maxlines_curlines != 4 || w.maxsize_cursize != 8 {
+		t.Errorf("counts of the reused file: %d lines, %d bytes, want 4, 8", w.maxlines_curlines, w.maxsize_cursize)
+	}
+	for _, msg := range []string{"5", "6", "7"} {
+		w.LogWrite(newLogRecord(INFO, "source", msg))
+	}
+	w.Close()
+	if contents, err := ioutil.ReadFile(filename + ".001"); err != nil || string(contents) != "1\n2\n3\n4\n5\n6\n" {
+		t.Errorf("rotated file contains %q (%v)", contents, err)
+	}
+	if contents, err := ioutil.ReadFile(filename); err != nil || string(contents) != "7\n" {
+		t.Errorf("new file contains %q (%v)", contents, err)
+	}
+
+	if n := support.CountLines(filename + ".001"); n != 6 {
+		t.Errorf("CountLines: %d, want 6", n)
+	}
+	ioutil.WriteFile(filename, []byte("a\nb"), 0644)
+	if n := support.CountLines(filename); n != 2 {
+		t.Errorf("CountLines without a last newline: %d, want 2", n)
+	}
+}
+
+func TestFileRotateInPlace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fileinplace")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Without rotate, the file grows past the limit: it's only reopened once
+	// per 1024 bytes, not at each record
+	filename := filepath.Join(dir, "app.log")
+	w := NewFileLogWriter(filename, false, false)
+	if w == nil {
+		t.Fatalf("NewFileLogWriter failed")
+	}
+	w.SetFormat("%M").SetRotateSize(1024)
+	for i := 0; i < 5000; i++ {
+		w.LogWrite(newLogRecord(INFO, "source", "0123456789"))
+	}
+	w.Close()
+	if n := w.Stats().Rotations; n > 5000*11/1024+1 {
+		t.Errorf("Rotations: %d, want at most %d", n, 5000*11/1024+1)
+	}
+}
+
+func TestFileOnRotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fileonrotate")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "app.log")
+	var mu sync.Mutex
+	var events []string
+	w := NewFileLogWriter(filename, true, false).SetFormat("%M").SetRotateLines(1)
+	w.OnRotate(func(oldPath, newPath string) {
+		contents, _ := ioutil.ReadFile(newPath)
+		mu.Lock()
+		events = append(events, fmt.Sprintf("%s -> %s: %q", filepath.Base(oldPath), filepath.Base(newPath), contents))
+		mu.Unlock()
+	})
+	for _, msg := range []string{"1", "2", "3"} {
+		w.LogWrite(newLogRecord(INFO, "source", msg))
+	}
+	w.Close() // Waits for the callbacks
+
+	want := []string{`app.log -> app.log.001: "1\n2\n"`}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("OnRotate: got %q, want %q", events, want)
+	}
+}
+
+func TestGuardDisk(t *testing.T) {
+	defer func(interval time.Duration) {
+		DiskGuardInterval, diskFree = interval, diskFreeSpace
+	}(DiskGuardInterval)
+	var free uint64 = 1 << 30
+	DiskGuardInterval = 10 * time.Millisecond
+	diskFree = func(string) (uint64, error) { return atomic.LoadUint64(&free), nil }
+
+	dir, err := ioutil.TempDir("", "diskguard")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "app.log")
+	fw := NewFileLogWriter(filename, false, false).SetFormat("%M")
+	mem := NewMemoryLogWriter(10)
+	l := NewLogger().AddFilter("file", FINEST, fw).AddFilter("mem", INFO, mem)
+
+	// Wait for the record of the guard containing substr
+	waitFor := func(substr string) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			for _, rec := range mem.Records() {
+				if rec.Source == "log4go/diskguard" && strings.Contains(rec.Message, substr) {
+					return
+				}
+			}
+		}
+		t.Fatalf("GuardDisk: no record %q, got %v", substr, mem.Records())
+	}
+
+	stop := l.GuardDisk(1<<20, DiskDropDebug)
+	l.Debug("debug 1")
+	atomic.StoreUint64(&free, 1<<10)
+	waitFor("less than 1048576")
+	l.Debug("debug 2")
+	l.Info("info 2")
+	atomic.StoreUint64(&free, 1<<30)
+	waitFor("back to normal")
+	l.Debug("debug 3")
+	stop()
+	fw.Close()
+
+	contents, _ := ioutil.ReadFile(filename)
+	for _, want := range []string{"debug 1", "info 2", "debug 3"} {
+		if !strings.Contains(string(contents), want) {
+			t.Errorf("GuardDisk: %q not written, file contains %q", want, contents)
+		}
+	}
+	if strings.Contains(string(contents), "debug 2") {
+		t.Errorf("GuardDisk: the debug record was written while the disk was low: %q", contents)
+	}
+	if dropped := fw.Stats().Dropped; dropped != 1 {
+		t.Errorf("GuardDisk: %d records dropped, want 1", dropped)
+	}
+
+	// Stopping the guard restores the writers it stopped
+	mem.Reset()
+	fw = NewFileLogWriter(filename, false, false).SetFormat("%M")
+	defer fw.Close()
+	l.AddFilter("file", FINEST, fw)
+	atomic.StoreUint64(&free, 0)
+	stop = l.GuardDisk(1<<20, DiskStopWriting)
+	waitFor("stopping the writes")
+	if !fw.diskDrops(newLogRecord(CRITICAL, "source", "critical")) {
+		t.Errorf("GuardDisk: the file writer still takes the records")
+	}
+	stop()
+	if fw.diskDrops(newLogRecord(FINEST, "source", "finest")) {
+		t.Errorf("GuardDisk: the file writer still drops the records once stopped")
+	}
+}
+
+func TestFileBuffer(t *testing.T) {
+	os.Remove(testLogFile)
+	defer os.Remove(testLogFile)
+	w := NewFileLogWriter(testLogFile, false, false).SetFormat("%M").SetBuffer(4096, 0)
+	if w == nil {
+		t.Fatalf("Invalid return: w should not be nil")
+	}
+	log := NewLogger().SetFilter("file", &Filter{Level: INFO, LogWriter: w})
+	for i := 0; i < 10; i++ {
+		log.Info("record %d", i)
+	}
+	if contents, _ := ioutil.ReadFile(testLogFile); len(contents) != 0 {
+		t.Errorf("SetBuffer: wrote %q before a flush", contents)
+	}
+	log.Flush()
+	if contents, _ := ioutil.ReadFile(testLogFile); strings.Count(string(contents), "\n") != 10 {
+		t.Errorf("Flush: wrote %q, want 10 records", contents)
+	}
+
+	// The buffer is written out periodically, and on Close
+	w.SetBuffer(4096, 10*time.Millisecond)
+	log.Info("periodic")
+	deadline := time.Now().Add(5 * time.Second)
+	for contents, _ := ioutil.ReadFile(testLogFile); !strings.Contains(string(contents), "periodic"); contents, _ = ioutil.ReadFile(testLogFile) {
+		if time.Now().After(deadline) {
+			t.Fatalf("SetBuffer: the buffer wasn't written out after its interval")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	w.SetBuffer(4096, 0)
+	log.Info("last")
+	log.Close()
+	if contents, _ := ioutil.ReadFile(testLogFile); !strings.HasSuffix(string(contents), "last\n") {
+		t.Errorf("Close: wrote %q, want the buffered record last", contents)
+	}
+}
+
+func TestFileBatch(t *testing.T) {
+	os.Remove(testLogFile)
+	defer os.Remove(testLogFile)
+	w := NewFileLogWriter(testLogFile, false, false).SetFormat("%M").SetBatch(3, time.Hour)
+	if w == nil {
+		t.Fatalf("Invalid return: w should not be nil")
+	}
+	log := NewLogger().SetFilter("file", &Filter{Level: INFO, LogWriter: w})
+	lines := func() int {
+		contents, _ := ioutil.ReadFile(testLogFile)
+		return strings.Count(string(contents), "\n")
+	}
+
+	// A full batch is written right away
+	for i := 0; i < 3; i++ {
+		log.Info("record %d", i)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for lines() != 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("SetBatch: a full batch wasn't written, %d lines", lines())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Another waits for its latency, or a flush
+	log.Info("record 3")
+	time.Sleep(20 * time.Millisecond)
+	if n := lines(); n != 3 {
+		t.Errorf("SetBatch: %d lines before the batch is full", n)
+	}
+	log.Flush()
+	if n := lines(); n != 4 {
+		t.Errorf("Flush: %d lines, want the batch written", n)
+	}
+
+	w.SetBatch(1, 0)
+	log.Info("last")
+	log.Close()
+	if contents, _ := ioutil.ReadFile(testLogFile); string(contents) != "record 0\nrecord 1\nrecord 2\nrecord 3\nlast\n" {
+		t.Errorf("Close: wrote %q", contents)
+	}
+}
+
+func TestAuditLogWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "audit.log")
+	key := []byte("secret")
+
+	w := NewAuditLogWriter(fname, key)
+	for i := 0; i < 3; i++ {
+		rec := newLogRecord(WARNING, "source", fmt.Sprintf("change %d", i))
+		rec.Fields = []Field{{"seq", i}, {"who", "admin"}}
+		w.LogWrite(rec)
+	}
+	w.Close()
+
+	// Reopened, the chain goes on
+	w = NewAuditLogWriter(fname, key)
+	w.LogWrite(newLogRecord(WARNING, "source", "change 3"))
+	seq, chain := w.Chain()
+	w.Close()
+
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		t.Fatalf("ReadFile: %s", err)
+	}
+	report, err := VerifyAuditLog(bytes.NewReader(data), key)
+	if err != nil || report.Records != 6 || !report.Sealed || seq != 5 || report.Chain == chain {
+		t.Errorf("VerifyAuditLog: got %+v, %v for the log of %d records up to %s", report, err, seq, chain)
+	}
+
+	lines := strings.SplitAfter(string(data), "\n")
+	tampered := map[string]string{
+		"modified":  strings.Join(lines[:1], "") + strings.Replace(lines[1], "change 1", "change 9", 1) + strings.Join(lines[2:], ""),
+		"removed":   strings.Join(lines[:2], "") + strings.Join(lines[3:], ""),
+		"truncated": strings.Join(lines[:5], "") + lines[5][:10],
+	}
+	for name, log := range tampered {
+		if _, err := VerifyAuditLog(strings.NewReader(log), key); err == nil {
+			t.Errorf("VerifyAuditLog: %s log verified", name)
+		}
+	}
+	if _, err := VerifyAuditLog(bytes.NewReader(data), []byte("guess")); err == nil {
+		t.Errorf("VerifyAuditLog: verified with the wrong key")
+	} else if aerr, ok := err.(*AuditError); !ok || aerr.Line != 1 {
+		t.Errorf("VerifyAuditLog: got %v with the wrong key", err)
+	}
+
+	// The key from the environment
+	os.Setenv("LOG4GO_TEST_AUDIT_KEY", "secret")
+	defer os.Unsetenv("LOG4GO_TEST_AUDIT_KEY")
+	l := NewLogger()
+	l.Config([]byte(`<logging><filter enabled="true" audit="true"><tag>audit</tag><type>audit</type><level>INFO</level>
+		<property name="filename">` + fname + `</property>
+		<property name="key_env">LOG4GO_TEST_AUDIT_KEY</property></filter></logging>`))
+	l.Audit("admin", "level changed")
+	l.Close()
+	f, _ := os.Open(fname)
+	defer f.Close()
+	if report, err := VerifyAuditLog(f, key); err != nil || report.Records != 8 {
+		t.Errorf("VerifyAuditLog: got %+v, %v after the configured writer", report, err)
+	}
+
+	// The tag alone doesn't make an audit filter
+	plain := &testWriter{}
+	l = NewLogger().SetFilter("audit", &Filter{Level: INFO, LogWriter: plain})
+	l.Info("record")
+	l.Audit("admin", "level changed")
+	if len(plain.recs) != 2 {
+		t.Errorf("a filter tagged audit got %d records, want 2", len(plain.recs))
+	}
+}
+
+func TestTeeLogWriter(t *testing.T) {
+	text := NewMemoryLogWriter(10).SetFormat("[%L] %M")
+	json := NewMemoryLogWriter(10).SetLayout(JSONLayout{})
+	l := NewLogger()
+	l.SetFilter("tee", &Filter{Level: INFO, LogWriter: NewTeeLogWriter(text, json), Redactor: NewRedactor().AddField("password")})
+	l.Debug("too low")
+	l.LogcFields(INFO, func() (string, []Field) { return "login", []Field{F("password", "hunter2")} })
+
+	buf := new(bytes.Buffer)
+	text.Dump(buf)
+	if got, want := buf.String(), "[INFO] login password=[REDACTED]\n"; got != want {
+		t.Errorf("TeeLogWriter: text got %q, want %q", got, want)
+	}
+	buf.Reset()
+	json.Dump(buf)
+	if got := buf.String(); !strings.Contains(got, `"message":"login"`) || !strings.Contains(got, `"password":"[REDACTED]"`) || strings.Count(got, "\n") != 1 {
+		t.Errorf("TeeLogWriter: json got %q", got)
+	}
+
+	// From the configuration, the properties go to the writer before them
+	out := new(bytes.Buffer)
+	defer func(saved io.Writer) { configOut = saved }(configOut)
+	configOut = out
+	l = NewLogger()
+	l.Config([]byte(`<logging><filter enabled="true"><tag>tee</tag><type>tee</type><level>INFO</level>
+		<property name="writer">memory</property>
+		<property name="format">%M</property>
+		<property name="writer">memory</property>
+		<property name="format">json</property>
+		<property name="size">5</property></filter></logging>`))
+	l.Info("configured")
+	tee, ok := l.Filter("tee").LogWriter.(*TeeLogWriter)
+	if !ok || len(tee.Writers()) != 2 {
+		t.Fatalf("TeeLogWriter: configured %#v (%s)", l.Filter("tee"), out)
+	}
+	buf.Reset()
+	tee.Writers()[0].(*MemoryLogWriter).Dump(buf)
+	tee.Writers()[1].(*MemoryLogWriter).Dump(buf)
+	if got := buf.String(); !strings.HasPrefix(got, "configured\n{") || out.Len() != 0 {
+		t.Errorf("TeeLogWriter: configured writers got %q (%s)", got, out)
+	}
+
+	err := NewLogger().ReplaceConfig(&LoggerConfig{Filter: []FilterConfig{{Enabled: "true", Tag: "tee", Type: "tee", Level: "INFO",
+		Property: []Property{{"writer", "nosuch"}}}}})
+	if err == nil || !strings.Contains(out.String(), "unknown writer type") {
+		t.Errorf("TeeLogWriter: unknown writer type reported %q", out)
+	}
+}
+
+// A writer failing on demand, for the failover
+type flakyWriter struct {
+	testWriter
+	writerStats
+	probe error
+}
+
+func (w *flakyWriter) Probe() error { return w.probe }
+
+func TestFailoverLogWriter(t *testing.T) {
+	primary, fallback := &flakyWriter{probe: errors.New("connection refused")}, &testWriter{}
+	w := NewFailoverLogWriter(primary, fallback).SetRetryInterval(0)
+	l := NewLogger().SetFilter("failover", &Filter{Level: INFO, LogWriter: w})
+
+	l.Info("first")
+	primary.failed()
+	l.Info("second")
+	l.Info("third")
+	if len(primary.recs) != 1 || len(fallback.recs) != 3 || fallback.recs[0].Level != WARNING || fallback.recs[2].Message != "third" {
+		t.Fatalf("FailoverLogWriter: primary got %d records, fallback %d", len(primary.recs), len(fallback.recs))
+	}
+	if failed, switches := w.FailedOver(); !failed || switches != 1 {
+		t.Errorf("FailoverLogWriter: failed over %v after %d switches with a failing probe", failed, switches)
+	}
+
+	primary.probe = nil
+	l.Info("sixth")
+	if failed, switches := w.FailedOver(); failed || switches != 2 || len(primary.recs) != 3 || primary.recs[1].Source != "log4go/failover" || primary.recs[2].Message != "sixth" {
+		t.Errorf("FailoverLogWriter: failed over %v after %d switches, primary got %d records", failed, switches, len(primary.recs))
+	}
+
+	// From the configuration
+	out := new(bytes.Buffer)
+	defer func(saved io.Writer) { configOut = saved }(configOut)
+	configOut = out
+	l = NewLogger()
+	l.Config([]byte(`<logging><filter enabled="true"><tag>failover</tag><type>failover</type><level>INFO</level>
+		<property name="retry">1m</property>
+		<property name="primary">memory</property>
+		<property name="size">5</property>
+		<property name="fallback">memory</property>
+		<property name="format">%M</property></filter></logging>`))
+	if fw, ok := l.Filter("failover").LogWriter.(*FailoverLogWriter); !ok || fw.retry != time.Minute || fw.primary.(*MemoryLogWriter).format == "%M" || fw.fallback.(*MemoryLogWriter).format != "%M" || out.Len() != 0 {
+		t.Errorf("FailoverLogWriter: configured %#v (%s)", l.Filter("failover"), out)
+	}
+	err := NewLogger().ReplaceConfig(&LoggerConfig{Filter: []FilterConfig{{Enabled: "true", Tag: "failover", Type: "failover", Level: "INFO",
+		Property: []Property{{"primary", "memory"}}}}})
+	if err == nil || !strings.Contains(out.String(), `Required property "fallback"`) {
+		t.Errorf("FailoverLogWriter: missing fallback reported %q", out)
+	}
+}
+
+// A writer blocking until it's released, for the async writer
+type blockingWriter struct {
+	testWriter
+	started, release chan struct{}
+}
+
+func (w *blockingWriter) LogWrite(rec *LogRecord) {
+	if w.started != nil {
+		close(w.started)
+		w.started = nil
+		<-w.release
+	}
+	w.testWriter.LogWrite(rec)
+}
+
+func TestAsyncWriter(t *testing.T) {
+	for policy, want := range map[OverflowPolicy]string{
+		OverflowDropNewest: "1 2 3",
+		OverflowDropOldest: "1 4 5",
+	} {
+		inner := &blockingWriter{started: make(chan struct{}), release: make(chan struct{})}
+		started := inner.started
+		w := NewAsyncWriter(inner, 2, policy)
+		w.LogWrite(newLogRecord(INFO, "source", "1"))
+		<-started
+		for i := 2; i <= 5; i++ {
+			w.LogWrite(newLogRecord(INFO, "source", fmt.Sprint(i)))
+		}
+		close(inner.release)
+		w.Flush()
+
+		var got []string
+		for _, rec := range inner.recs {
+			got = append(got, rec.Message)
+		}
+		if strings.Join(got, " ") != want || w.Stats().Dropped != 2 {
+			t.Errorf("AsyncWriter(%s): got %q and %d dropped, want %q and 2", policy, got, w.Stats().Dropped, want)
+		}
+		w.Close()
+	}
+
+	// From the configuration
+	out := new(bytes.Buffer)
+	defer func(saved io.Writer) { configOut = saved }(configOut)
+	configOut = out
+	l := NewLogger()
+	l.Config([]byte(`<logging><filter enabled="true" async="true"><tag>async</tag><type>memory</type><level>INFO</level>
+		<property name="async_queue">100</property>
+		<property name="async_overflow">drop_oldest</property></filter></logging>`))
+	aw, ok := l.Filter("async").LogWriter.(*AsyncWriter)
+	if !ok || cap(aw.rec) != 100 || aw.policy != OverflowDropOldest || out.Len() != 0 {
+		t.Fatalf("AsyncWriter: configured %#v (%s)", l.Filter("async"), out)
+	}
+	l.Info("configured")
+	aw.Flush()
+	if recs := aw.Inner().(*MemoryLogWriter).Records(); len(recs) != 1 || recs[0].Message != "configured" {
+		t.Errorf("AsyncWriter: configured writer got %d records", len(recs))
+	}
+	l.Close()
+
+	err := NewLogger().ReplaceConfig(&LoggerConfig{Filter: []FilterConfig{{Enabled: "true", Async: "true", Tag: "async", Type: "memory", Level: "INFO",
+		Property: []Property{{"async_overflow", "sometimes"}}}}})
+	if err == nil || !strings.Contains(out.String(), "expect block, drop_newest or drop_oldest") {
+		t.Errorf("AsyncWriter: invalid policy reported %q", out)
+	}
+}
+
+func TestReady(t *testing.T) {
+	log := NewLogger().SetFilter("test", &Filter{Level: INFO, LogWriter: &testWriter{}})
+	select {
+	case <-log.Ready():
+	case <-time.After(time.Second):
+		t.Errorf("Ready: not ready without network writers")
+	}
+
+	// The socket writer is ready once it gives up on the first connection
+	defer func(timeout time.Duration) { WarmupTimeout = timeout }(WarmupTimeout)
+	WarmupTimeout = 10 * time.Millisecond
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	w := NewSocketLogWriter("tcp", addr).SetReconnectBackoff(time.Hour, time.Hour)
+	defer w.Close()
+	select {
+	case <-NewLogger().SetFilter("socket", &Filter{Level: INFO, LogWriter: w}).Ready():
+	case <-time.After(5 * time.Second):
+		t.Errorf("Ready: not ready after WarmupTimeout")
+	}
+}
+
+func TestReloadConfiguration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	configOut = ioutil.Discard
+	defer func() { configOut = os.Stderr }()
+
+	config := filepath.Join(dir, "log4go.xml")
+	filter := func(tag, typ string) string {
+		return `<filter enabled="true"><tag>` + tag + `</tag><type>` + typ + `</type><level>INFO</level>
+  <property name="filename">` + filepath.Join(dir, tag+".log") + `</property><property name="format">%M</property></filter>`
+	}
+
+	log := NewLogger()
+	defer log.Close()
+	ioutil.WriteFile(config, []byte(`<logging>`+filter("a", "file")+filter("b", "file")+`</logging>`), 0644)
+	if err := log.ReloadConfiguration(config); err != nil {
+		t.Fatalf("ReloadConfiguration: %s", err)
+	}
+	a := log.Filter("a")
+
+	// A bad configuration leaves the filters alone
+	ioutil.WriteFile(config, []byte(`<logging>`+filter("a", "file")+filter("c", "carrier-pigeon")+`</logging>`), 0644)
+	if err := log.ReloadConfiguration(config); err == nil {
+		t.Errorf("ReloadConfiguration: accepted an unknown type")
+	}
+	if len(log.Filters()) != 2 || log.Filter("a") != a || log.Filter("b") == nil {
+		t.Fatalf("ReloadConfiguration: changed the filters on an error: %v", log.Filters())
+	}
+	log.Info("kept")
+
+	// A good one replaces them all, and closes the old ones
+	ioutil.WriteFile(config, []byte(`<logging>`+filter("a", "file")+filter("c", "file")+`</logging>`), 0644)
+	if err := log.ReloadConfiguration(config); err != nil {
+		t.Fatalf("ReloadConfiguration: %s", err)
+	}
+	if len(log.Filters()) != 2 || log.Filter("a") == a || log.Filter("b") != nil || log.Filter("c") == nil {
+		t.Errorf("ReloadConfiguration: filters %v, want a new a and c", log.Filters())
+	}
+	if contents, _ := ioutil.ReadFile(filepath.Join(dir, "b.log")); string(contents) != "kept\n" {
+		t.Errorf("ReloadConfiguration: b.log is %q, want the record written before the reload", contents)
+	}
+}
+
+func TestRecordPool(t *testing.T) {
+	defer func(buflen int) {
+		LogBufferLength = buflen
+	}(LogBufferLength)
+	LogBufferLength = 0
+	os.Remove(testLogFile)
+	defer os.Remove(testLogFile)
+
+	// Nothing is allocated for a level no filter takes, nor for a record the
+	// file writer formats into its buffer once warm
+	w := NewFileLogWriter(testLogFile, false, false).SetFormat("%T %L %M")
+	log := NewLogger().SetFilter("file", &Filter{Level: INFO, LogWriter: w})
+	if n := testing.AllocsPerRun(100, func() { log.Debug("disabled %d", 42) }); n != 0 {
+		t.Errorf("Debug: %v allocations when disabled, want none", n)
+	}
+	if n := testing.AllocsPerRun(100, func() { log.Log(WARNING, "here", "pooled") }); n > 1 {
+		t.Errorf("Log: %v allocations to the file writer, want at most 1", n)
+	}
+
+	// A record kept by a writer isn't given back to the pool
+	tw := &testWriter{}
+	log.SetFilter("test", &Filter{Level: INFO, LogWriter: tw})
+	log.Info("kept %d", 1)
+	log.Info("kept %d", 2)
+	log.Close()
+	if len(tw.recs) != 2 || tw.recs[0].Message != "kept 1" || tw.recs[1].Message != "kept 2" {
+		t.Errorf("Info: the test writer has %v, want the records kept", tw.recs)
+	}
+	if contents, _ := ioutil.ReadFile(testLogFile); strings.Count(string(contents), "pooled") == 0 || !strings.HasSuffix(string(contents), "kept 2\n") {
+		t.Errorf("Log: wrote %q", contents)
+	}
+}
+
+// A Stringer counting how many times it is formatted
+type countingStringer struct{ n *int }
+
+func (s countingStringer) String() string {
+	*s.n++
+	return "formatted"
+}
+
+func TestWrapperLevelCheck(t *testing.T) {
+	saved := Global
+	defer func() { Global = saved }()
+	w := &testWriter{}
+	Global = NewLogger().SetFilter("test", &Filter{Level: WARNING, LogWriter: w})
+
+	n := 0
+	arg := countingStringer{&n}
+	Debug("debug %s", arg)
+	Debugf("debugf %s", arg)
+	Infoln("infoln", arg)
+	DebugCtx(context.Background(), "debugctx %s", arg)
+	if n != 0 || len(w.recs) != 0 {
+		t.Errorf("disabled levels: formatted %d times, wrote %d records", n, len(w.recs))
+	}
+	if IsInfoEnabled() || !IsWarnEnabled() {
+		t.Errorf("IsInfoEnabled %v, IsWarnEnabled %v, want false and true", IsInfoEnabled(), IsWarnEnabled())
+	}
+
+	// The errors are formatted once, whether logged or not
+	if err := Warnf("warnf %s", arg); n != 1 || err.Error() != "warnf formatted" {
+		t.Errorf("Warnf: formatted %d times, returned %v", n, err)
+	}
+	if len(w.recs) != 1 || w.recs[0].Message != "warnf formatted" {
+		t.Fatalf("Warnf: wrote %v", w.recs)
+	}
+	Global.Filter("test").Level = ERROR
+	if err := Warn("warn %s", arg); n != 2 || err == nil || len(w.recs) != 1 {
+		t.Errorf("Warn: formatted %d times, wrote %d records", n, len(w.recs))
+	}
+
+	// The call stack is only taken for a record logged
+	Global.Filter("test").Level = CRITICAL
+	Critical("critical %s", arg)
+	if len(w.recs) != 2 || !strings.HasPrefix(w.recs[1].Message, "critical formatted\n") {
+		t.Errorf("Critical: wrote %v, want the message and the call stack", w.recs)
+	}
+	Global = NewLogger()
+	if err := Critical("critical %s", arg); err.Error() != "critical formatted" {
+		t.Errorf("Critical: returned %v without filters", err)
+	}
+}
+
+// A writer counting the records it gets once closed
+type closingWriter struct {
+	closed, late int32
+}
+
+func (w *closingWriter) LogWrite(rec *LogRecord) {
+	if atomic.LoadInt32(&w.closed) != 0 {
+		atomic.AddInt32(&w.late, 1)
+	}
+}
+func (w *closingWriter) Close() { atomic.StoreInt32(&w.closed, 1) }
+
+func TestLoggerConcurrentChanges(t *testing.T) {
+	log := NewLogger()
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				log.Info("record")
+				log.Audit("tester", "changed something")
+			}
+		}()
+	}
+
+	// The filters come and go while the goroutines log: a removed writer can
+	// be closed as soon as RemoveFilter returns, it gets nothing more
+	var writers []*closingWriter
+	for i := 0; i < 200; i++ {
+		w, audit := &closingWriter{}, &closingWriter{}
+		writers = append(writers, w, audit)
+		log.AddFilter("test", INFO, w)
+		log.SetFilter("audit", &Filter{Level: INFO, LogWriter: audit, Audit: true})
+		if filt := log.RemoveFilter("test"); filt == nil || filt.LogWriter != LogWriter(w) {
+			t.Fatalf("RemoveFilter: got %v", filt)
+		}
+		w.Close()
+		if i%50 == 0 {
+			log.Close()
+		}
+	}
+	if log.RemoveFilter("test") != nil || log.Filter("test") != nil {
+		t.Errorf("RemoveFilter: the filter is still there")
+	}
+	if filters := log.Filters(); len(filters) != 1 || filters["audit"] == nil {
+		t.Errorf("Filters: got %v, want audit only", filters)
+	}
+	log.Close()
+	close(stop)
+	wg.Wait()
+	for _, w := range writers {
+		if w.late != 0 {
+			t.Fatalf("a closed writer got %d records", w.late)
+		}
+	}
+
+	// The zero Logger logs nothing
+	var zero Logger
+	zero.Info("nowhere")
+	zero.Close()
+	if len(zero.Filters()) != 0 {
+		t.Errorf("Filters: the zero Logger has filters")
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+// Package logtest helps the tests check what the code under test logs.
+// Capture replaces the filters of log4go.Global for the duration of a test
+// with one recording everything, and the assertions look for the records:
+//
+//	func TestCharge(t *testing.T) {
+//	    logtest.Capture(t)
+//	    charge(-1)
+//	    logtest.AssertLogged(t, log.ERROR, "negative amount")
+//	    logtest.AssertNotLogged(t, log.CRITICAL, "")
+//	}
+//
+// A RecordingWriter can also be added to a logger of its own, with the
+// assertions as its methods.  Since Global is shared by the whole package, the
+// tests capturing it must not run in parallel.
+package logtest
+
+import (
+	"fmt"
+	log "github.com/kimiazhu/log4go"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// A RecordingWriter keeps the records it gets in memory.
+type RecordingWriter struct {
+	mu   sync.Mutex
+	recs []*log.LogRecord
+}
+
+// NewRecordingWriter creates an empty RecordingWriter.
+func NewRecordingWriter() *RecordingWriter {
+	return &RecordingWriter{}
+}
+
+// This is the RecordingWriter's output method
+func (w *RecordingWriter) LogWrite(rec *log.LogRecord) {
+	w.mu.Lock()
+	w.recs = append(w.recs, rec)
+	w.mu.Unlock()
+}
+
+// Close does nothing, the records are kept.
+func (w *RecordingWriter) Close() {}
+
+// Records returns the records received, oldest first.
+func (w *RecordingWriter) Records() []*log.LogRecord {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]*log.LogRecord(nil), w.recs...)
+}
+
+// Reset discards the records received.
+func (w *RecordingWriter) Reset() {
+	w.mu.Lock()
+	w.recs = nil
+	w.mu.Unlock()
+}
+
+// Find returns the records at lvl whose message contains substr, oldest
+// first.
+func (w *RecordingWriter) Find(lvl log.Level, substr string) []*log.LogRecord {
+	var found []*log.LogRecord
+	for _, rec := range w.Records() {
+		if rec.Level == lvl && strings.Contains(rec.Message, substr) {
+			found = append(found, rec)
+		}
+	}
+	return found
+}
+
+// AssertLogged reports an error to t if no record at lvl has a message
+// containing substr, and returns the first one which has.
+func (w *RecordingWriter) AssertLogged(t testing.TB, lvl log.Level, substr string) *log.LogRecord {
+	t.Helper()
+	found := w.Find(lvl, substr)
+	if len(found) == 0 {
+		t.Errorf("logtest: no %s record containing %q, got:\n%s", lvl, substr, w.dump())
+		return nil
+	}
+	return found[0]
+}
+
+// AssertNotLogged reports an error to t if a record at lvl has a message
+// containing substr, e.g. "" for any record at lvl.
+func (w *RecordingWriter) AssertNotLogged(t testing.TB, lvl log.Level, substr string) {
+	t.Helper()
+	if found := w.Find(lvl, substr); len(found) > 0 {
+		t.Errorf("logtest: %d %s record(s) containing %q, got:\n%s", len(found), lvl, substr, w.dump())
+	}
+}
+
+// The records received, one per line, for the failure messages
+func (w *RecordingWriter) dump() string {
+	recs := w.Records()
+	if len(recs) == 0 {
+		return "\t(no records)"
+	}
+	var b strings.Builder
+	for _, rec := range recs {
+		fmt.Fprintf(&b, "\t[%s] (%s) %s\n", rec.Level, rec.Source, rec.Message)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// The writers of the tests which captured Global, by test
+var captures = struct {
+	sync.Mutex
+	m map[testing.TB]*RecordingWriter
+}{m: make(map[testing.TB]*RecordingWriter)}
+
+// Capture replaces the filters of log4go.Global with one sending every record,
+// at all levels, to a new RecordingWriter, until the end of the test, when the
+// previous filters are put back.  The filters are swapped at once, so the
+// goroutines logging through Global meanwhile are safe.  It returns the
+// writer, which AssertLogged and AssertNotLogged check.
+func Capture(t testing.TB) *RecordingWriter {
+	t.Helper()
+	w := NewRecordingWriter()
+	filt := &log.Filter{Level: log.ACCESS, LogWriter: w}
+	filt.SetLevel(log.ACCESS) // Whatever LOG4GO_LEVEL says
+	global := log.Global
+	saved := global.ReplaceFilters(map[string]*log.Filter{"logtest": filt})
+	captures.Lock()
+	captures.m[t] = w
+	captures.Unlock()
+
+	t.Cleanup(func() {
+		global.ReplaceFilters(saved)
+		captures.Lock()
+		delete(captures.m, t)
+		captures.Unlock()
+	})
+	return w
+}
+
+// The writer of Capture for t
+func captured(t testing.TB) *RecordingWriter {
+	t.Helper()
+	captures.Lock()
+	w := captures.m[t]
+	captures.Unlock()
+	if w == nil {
+		t.Fatalf("logtest: Capture wasn't called by the test")
+	}
+	return w
+}
+
+// AssertLogged reports an error to t if no record at lvl whose message
+// contains substr went to Global since Capture, and returns the first one
+// which did.
+func AssertLogged(t testing.TB, lvl log.Level, substr string) *log.LogRecord {
+	t.Helper()
+	return captured(t).AssertLogged(t, lvl, substr)
+}
+
+// AssertNotLogged reports an error to t if a record at lvl whose message
+// contains substr went to Global since Capture.
+func AssertNotLogged(t testing.TB, lvl log.Level, substr string) {
+	t.Helper()
+	captured(t).AssertNotLogged(t, lvl, substr)
+}
@@ -0,0 +1,80 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package logtest
+
+import (
+	"fmt"
+	log "github.com/kimiazhu/log4go"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// A testing.TB recording the errors rather than failing
+type fakeTB struct {
+	testing.TB
+	errors []string
+}
+
+func (tb *fakeTB) Helper() {}
+
+func (tb *fakeTB) Errorf(format string, args ...interface{}) {
+	tb.errors = append(tb.errors, fmt.Sprintf(format, args...))
+}
+
+func TestCapture(t *testing.T) {
+	saved := log.Global
+	filters := log.Global.Filters()
+	t.Run("captured", func(t *testing.T) {
+		w := Capture(t)
+		log.Error("charge of %d failed: negative amount", -1)
+		log.Finest("detail")
+
+		if rec := AssertLogged(t, log.ERROR, "negative amount"); rec == nil || !strings.Contains(rec.Source, "TestCapture") {
+			t.Errorf("Capture: found %+v", rec)
+		}
+		AssertLogged(t, log.FINEST, "detail")
+		AssertNotLogged(t, log.CRITICAL, "")
+
+		fake := &fakeTB{TB: t}
+		w.AssertLogged(fake, log.WARNING, "negative amount")
+		w.AssertNotLogged(fake, log.ERROR, "charge")
+		if len(fake.errors) != 2 || !strings.Contains(fake.errors[0], "[EROR]") || !strings.Contains(fake.errors[1], "1 EROR record(s)") {
+			t.Errorf("Capture: the failed assertions reported %q", fake.errors)
+		}
+
+		w.Reset()
+		AssertNotLogged(t, log.ERROR, "")
+	})
+	if log.Global != saved || !reflect.DeepEqual(log.Global.Filters(), filters) {
+		t.Errorf("Capture: the filters of Global weren't restored")
+	}
+}
+
+func TestCaptureConcurrent(t *testing.T) {
+	// Another goroutine logs through Global while it's captured and restored
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				log.Finest("background")
+			}
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		t.Run("captured", func(t *testing.T) {
+			Capture(t)
+			log.Error("foreground")
+			AssertLogged(t, log.ERROR, "foreground")
+		})
+	}
+	close(stop)
+	wg.Wait()
+}
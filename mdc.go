@@ -0,0 +1,159 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// The mapped diagnostic contexts of the goroutines, by goroutine id.  A map is
+// never modified once stored, a change stores a new one, so that the records
+// can share it.
+var mdcs = struct {
+	sync.RWMutex
+	m map[int64]map[string]string
+}{m: make(map[int64]map[string]string)}
+
+// How many goroutines have a mapped diagnostic context: the id of the
+// goroutine is only looked up for the records when one has
+var mdcGoroutines int32
+
+// MDCSet sets key to value in the mapped diagnostic context of the calling
+// goroutine, e.g. MDCSet("request_id", id): the records it logs carry the
+// context until the key is removed, which %X{request_id} prints.  The context
+// of a goroutine isn't inherited by the goroutines it starts.  A goroutine
+// must clear its context when it's done, usually with
+//
+//	log4go.MDCSet("request_id", id)
+//	defer log4go.MDCClear()
+func MDCSet(key, value string) {
+	id := goroutineID()
+	mdcs.Lock()
+	defer mdcs.Unlock()
+	old := mdcs.m[id]
+	m := make(map[string]string, len(old)+1)
+	for k, v := range old {
+		m[k] = v
+	}
+	m[key] = value
+	mdcs.m[id] = m
+	atomic.StoreInt32(&mdcGoroutines, int32(len(mdcs.m)))
+}
+
+// MDCGet returns the value of key in the mapped diagnostic context of the
+// calling goroutine, "" if it's not set.
+func MDCGet(key string) string {
+	return currentMDC()[key]
+}
+
+// MDCRemove removes key from the mapped diagnostic context of the calling
+// goroutine.
+func MDCRemove(key string) {
+	id := goroutineID()
+	mdcs.Lock()
+	defer mdcs.Unlock()
+	old, ok := mdcs.m[id]
+	if !ok {
+		return
+	}
+	m := make(map[string]string, len(old))
+	for k, v := range old {
+		if k != key {
+			m[k] = v
+		}
+	}
+	if len(m) == 0 {
+		delete(mdcs.m, id)
+	} else {
+		mdcs.m[id] = m
+	}
+	atomic.StoreInt32(&mdcGoroutines, int32(len(mdcs.m)))
+}
+
+// MDCClear removes the whole mapped diagnostic context of the calling
+// goroutine.
+func MDCClear() {
+	if atomic.LoadInt32(&mdcGoroutines) == 0 {
+		return
+	}
+	id := goroutineID()
+	mdcs.Lock()
+	delete(mdcs.m, id)
+	atomic.StoreInt32(&mdcGoroutines, int32(len(mdcs.m)))
+	mdcs.Unlock()
+}
+
+// The mapped diagnostic context of the calling goroutine, nil if it has none.
+// It must not be modified.
+func currentMDC() map[string]string {
+	if atomic.LoadInt32(&mdcGoroutines) == 0 {
+		return nil
+	}
+	id := goroutineID()
+	mdcs.RLock()
+	defer mdcs.RUnlock()
+	return mdcs.m[id]
+}
+
+type mdcKey struct{}
+
+// WithMDC returns a copy of ctx with key set to value in its mapped
+// diagnostic context, for the code which hands a context around rather than
+// staying on one goroutine: the records logged with it through the *Ctx
+// functions carry the context, over the one of the goroutine.
+func WithMDC(ctx context.Context, key, value string) context.Context {
+	old := ContextMDC(ctx)
+	m := make(map[string]string, len(old)+1)
+	for k, v := range old {
+		m[k] = v
+	}
+	m[key] = value
+	return context.WithValue(ctx, mdcKey{}, m)
+}
+
+// ContextMDC returns the mapped diagnostic context of ctx, set by WithMDC.
+// The map must not be modified.
+func ContextMDC(ctx context.Context) map[string]string {
+	if ctx == nil {
+		return nil
+	}
+	m, _ := ctx.Value(mdcKey{}).(map[string]string)
+	return m
+}
+
+// The context of the goroutine overridden by that of a context
+func mergeMDC(goroutine, ctx map[string]string) map[string]string {
+	if len(goroutine) == 0 {
+		return ctx
+	}
+	if len(ctx) == 0 {
+		return goroutine
+	}
+	m := make(map[string]string, len(goroutine)+len(ctx))
+	for k, v := range goroutine {
+		m[k] = v
+	}
+	for k, v := range ctx {
+		m[k] = v
+	}
+	return m
+}
+
+// The mapped diagnostic context of a record as key=value pairs sorted by key,
+// for %X
+func formatMDC(m map[string]string) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + m[k]
+	}
+	return strings.Join(pairs, " ")
+}
@@ -0,0 +1,212 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// This log writer keeps the last records in memory, in a ring buffer, until
+// they are dumped.  Add it with a lower level than the writers persisting the
+// records, to have the detailed context at hand when something goes wrong:
+//
+//   log.AddFilter("memory", DEBUG, NewMemoryLogWriter(1000))
+//   ...
+//   log.DumpMemory(os.Stderr)
+type MemoryLogWriter struct {
+	mu         sync.Mutex
+	format     string
+	timeformat string
+	layout     Layout
+	utc        bool
+	recs       []*LogRecord
+	next       int  // where the next record goes
+	full       bool // whether the buffer wrapped around
+
+	// Flight recorder: where to dump the records of the last window on a crash
+	crashfile string
+	window    time.Duration
+}
+
+// NewMemoryLogWriter creates a new LogWriter which keeps the last size
+// records.
+func NewMemoryLogWriter(size int) *MemoryLogWriter {
+	if size < 1 {
+		size = 1
+	}
+	return &MemoryLogWriter{
+		format: "[%D %T] [%L] (%S) %M",
+		recs:   make([]*LogRecord, size),
+	}
+}
+
+// This is the MemoryLogWriter's output method.  It never blocks on I/O.
+func (w *MemoryLogWriter) LogWrite(rec *LogRecord) {
+	w.mu.Lock()
+	w.recs[w.next] = rec
+	if w.next++; w.next == len(w.recs) {
+		w.next, w.full = 0, true
+	}
+	w.mu.Unlock()
+}
+
+// Close does nothing: the records stay available to Dump.
+func (w *MemoryLogWriter) Close() {}
+
+// Set the format used by Dump (chainable).
+func (w *MemoryLogWriter) SetFormat(format string) *MemoryLogWriter {
+	w.mu.Lock()
+	w.format = format
+	w.mu.Unlock()
+	return w
+}
+
+// Set the time format of %Z used by Dump, a preset name or a layout (see
+// FormatTime) (chainable).
+func (w *MemoryLogWriter) SetTimeFormat(timeformat string) *MemoryLogWriter {
+	w.mu.Lock()
+	w.timeformat = timeformat
+	w.mu.Unlock()
+	return w
+}
+
+// Set the layout used by Dump, which replaces the format (chainable).
+func (w *MemoryLogWriter) SetLayout(layout Layout) *MemoryLogWriter {
+	w.mu.Lock()
+	w.layout = layout
+	w.mu.Unlock()
+	return w
+}
+
+// Print the times in UTC rather than in the local time zone in Dump
+// (chainable).
+func (w *MemoryLogWriter) SetUTC(utc bool) *MemoryLogWriter {
+	w.mu.Lock()
+	w.utc = utc
+	w.mu.Unlock()
+	return w
+}
+
+// Turn the writer into a flight recorder (chainable): when the program
+// crashes through Crash, Crashf, Fatal, Panic or Recover, the records of the
+// last window (all of them if window is 0) are appended to filename, together
+// with the stack.  Must be called before the first log message is written.
+func (w *MemoryLogWriter) SetCrashFile(filename string, window time.Duration) *MemoryLogWriter {
+	w.mu.Lock()
+	w.crashfile, w.window = filename, window
+	w.mu.Unlock()
+	return w
+}
+
+// Records returns the buffered records, oldest first.
+func (w *MemoryLogWriter) Records() []*LogRecord {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var recs []*LogRecord
+	if w.full {
+		recs = append(recs, w.recs[w.next:]...)
+	}
+	return append(recs, w.recs[:w.next]...)
+}
+
+// Reset discards the buffered records.
+func (w *MemoryLogWriter) Reset() {
+	w.mu.Lock()
+	for i := range w.recs {
+		w.recs[i] = nil
+	}
+	w.next, w.full = 0, false
+	w.mu.Unlock()
+}
+
+// Dump writes the buffered records to out, oldest first.  The records are
+// kept.
+func (w *MemoryLogWriter) Dump(out io.Writer) error {
+	return w.dump(out, time.Time{})
+}
+
+// Write the records created at or after since
+func (w *MemoryLogWriter) dump(out io.Writer, since time.Time) error {
+	w.mu.Lock()
+	layout := w.layout
+	if layout == nil {
+		layout = PatternLayout{w.format, w.timeformat}
+	}
+	utc := w.utc
+	w.mu.Unlock()
+
+	for _, rec := range w.Records() {
+		if rec.Created.Before(since) {
+			continue
+		}
+		if utc {
+			rec = utcRecord(rec)
+		}
+		if _, err := out.Write(layout.Format(rec)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Append the reason, the stack and the records of the last window to the
+// crash file, if there is one
+func (w *MemoryLogWriter) crashDump(reason, stack string) error {
+	w.mu.Lock()
+	crashfile, window := w.crashfile, w.window
+	w.mu.Unlock()
+	if crashfile == "" {
+		return nil
+	}
+
+	fd, err := os.OpenFile(crashfile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, FileMode)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	now := clockNow()
+	since := time.Time{}
+	if window > 0 {
+		since = now.Add(-window)
+	}
+	fmt.Fprintf(fd, "=== Crash at %s: %s\n%s\n", now.Format("2006/01/02 15:04:05.000 MST"), reason, stack)
+	fmt.Fprintf(fd, "=== Records since %s\n", since.Format("2006/01/02 15:04:05.000 MST"))
+	if err := w.dump(fd, since); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(fd, "=== End of crash\n\n")
+	return err
+}
+
+// DumpMemory writes the records buffered by all the MemoryLogWriters of the
+// logger to out, e.g. from a crash handler or an admin endpoint.
+func (log Logger) DumpMemory(out io.Writer) error {
+	for _, filt := range log.filters() {
+		if mlw, ok := filt.LogWriter.(*MemoryLogWriter); ok {
+			if err := mlw.Dump(out); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Dump the flight recorders of the logger to their crash files.  Errors are
+// reported to the error handler, the program is crashing anyway.
+func (log Logger) crashDump(reason interface{}) {
+	stack := string(debug.Stack())
+	for _, filt := range log.filters() {
+		if mlw, ok := filt.LogWriter.(*MemoryLogWriter); ok {
+			if err := mlw.crashDump(fmt.Sprint(reason), stack); err != nil {
+				ReportError(fmt.Sprintf("MemoryLogWriter(%q)", mlw.crashfile), err)
+			}
+		}
+	}
+}
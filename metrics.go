@@ -0,0 +1,84 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"sync/atomic"
+)
+
+// WriterStats are the counters of a writer since it was created
+type WriterStats struct {
+	Written   uint64 `json:"written"`   // records written
+	Bytes     uint64 `json:"bytes"`     // bytes written, as formatted by the writer
+	Dropped   uint64 `json:"dropped"`   // records discarded on purpose, e.g. buffer full or expired
+	Errors    uint64 `json:"errors"`    // failed writes, connects or rotations
+	Rotations uint64 `json:"rotations"` // files rotated
+	Evictions uint64 `json:"evictions"` // files closed to stay within a file descriptor budget
+}
+
+// The writers which count what they do implement this: the console, file,
+// xml, socket, split, http, gelf, tee and failover writers
+type StatsWriter interface {
+	Stats() WriterStats
+}
+
+// The writers which buffer the records implement this, e.g. the file writer:
+// Flush returns once the records logged so far are written out.
+type Flusher interface {
+	Flush()
+}
+
+// The counters embedded in the writers, updated atomically
+type writerStats struct {
+	written, bytes, dropped, errors, rotations, evictions uint64
+}
+
+// Stats returns the counters of the writer.
+func (s *writerStats) Stats() WriterStats {
+	return WriterStats{
+		Written:   atomic.LoadUint64(&s.written),
+		Bytes:     atomic.LoadUint64(&s.bytes),
+		Dropped:   atomic.LoadUint64(&s.dropped),
+		Errors:    atomic.LoadUint64(&s.errors),
+		Rotations: atomic.LoadUint64(&s.rotations),
+		Evictions: atomic.LoadUint64(&s.evictions),
+	}
+}
+
+// Count recs records written in n bytes
+func (s *writerStats) wrote(recs, n int) {
+	atomic.AddUint64(&s.written, uint64(recs))
+	atomic.AddUint64(&s.bytes, uint64(n))
+}
+
+// Count recs records dropped
+func (s *writerStats) drop(recs int) {
+	atomic.AddUint64(&s.dropped, uint64(recs))
+}
+
+// Count an error
+func (s *writerStats) failed() {
+	atomic.AddUint64(&s.errors, 1)
+}
+
+// Count a rotation
+func (s *writerStats) rotated() {
+	atomic.AddUint64(&s.rotations, 1)
+}
+
+// Count an eviction
+func (s *writerStats) evicted() {
+	atomic.AddUint64(&s.evictions, 1)
+}
+
+// Stats returns the counters of the writers of the logger which keep some, by
+// filter tag.
+func (log Logger) Stats() map[string]WriterStats {
+	stats := make(map[string]WriterStats)
+	for tag, filt := range log.filters() {
+		if sw, ok := filt.LogWriter.(StatsWriter); ok {
+			stats[tag] = sw.Stats()
+		}
+	}
+	return stats
+}
@@ -0,0 +1,65 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+// Package echolog logs the requests served by echo and recovers the panics
+// of their handlers through log4go, like the middleware package does for
+// net/http:
+//
+//	e := echo.New()
+//	e.Use(echolog.Logger(nil), echolog.Recovery(nil))
+//
+// The logger is the global one if it's nil.
+package echolog
+
+import (
+	log "github.com/kimiazhu/log4go"
+	"github.com/kimiazhu/log4go/middleware"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"time"
+)
+
+// Logger returns an echo middleware logging the requests at the ACCESS
+// level, with the fields of log4go.AccessHandler.  The error of a handler is
+// handed to the error handler of echo first, so that the status logged is
+// that of the response it sends.
+func Logger(logger *log.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+			res := c.Response()
+			current(logger).AccessRequest(c.Request(), res.Status, res.Size, start)
+			return nil
+		}
+	}
+}
+
+// Recovery returns an echo middleware recovering the panics of the handlers:
+// the panic is logged at the CRITICAL level with the call stack, and returned
+// as an error answered with a 500.
+func Recovery(logger *log.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					if r == http.ErrAbortHandler {
+						panic(r)
+					}
+					middleware.LogPanic(logger, c.Request(), r)
+					err = echo.NewHTTPError(http.StatusInternalServerError)
+				}
+			}()
+			return next(c)
+		}
+	}
+}
+
+// The logger, the global one if it's nil
+func current(logger *log.Logger) log.Logger {
+	if logger == nil {
+		return log.Global
+	}
+	return *logger
+}
@@ -0,0 +1,47 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package echolog
+
+import (
+	"fmt"
+	log "github.com/kimiazhu/log4go"
+	"github.com/labstack/echo/v4"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEcho(t *testing.T) {
+	mlw := log.NewMemoryLogWriter(10)
+	logger := log.NewLogger().AddFilter("memory", log.ERROR, mlw)
+	logger.AddAccessFilter("access", mlw)
+
+	e := echo.New()
+	e.Use(Logger(&logger), Recovery(&logger))
+	e.GET("/hello", func(c echo.Context) error { return c.String(200, "hello") })
+	e.GET("/panic", func(c echo.Context) error { panic("boom") })
+
+	for _, path := range []string{"/hello", "/panic", "/missing"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	var got []string
+	for _, rec := range mlw.Records() {
+		line := strings.SplitN(rec.Message, "\n", 2)[0]
+		for _, f := range rec.Fields {
+			if f.Key == "status" {
+				line += fmt.Sprintf(" status=%v", f.Value)
+			}
+		}
+		got = append(got, line)
+	}
+	want := []string{
+		"GET /hello HTTP/1.1 status=200",
+		"panic serving GET /panic: boom",
+		"GET /panic HTTP/1.1 status=500",
+		"GET /missing HTTP/1.1 status=404",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Echo: got records\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
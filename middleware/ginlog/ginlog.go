@@ -0,0 +1,74 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+// Package ginlog logs the requests served by gin and recovers the panics of
+// their handlers through log4go, like the middleware package does for
+// net/http:
+//
+//	r := gin.New()
+//	r.Use(ginlog.Logger(nil), ginlog.Recovery(nil))
+//
+// The logger is the global one if it's nil.
+package ginlog
+
+import (
+	"github.com/gin-gonic/gin"
+	log "github.com/kimiazhu/log4go"
+	"github.com/kimiazhu/log4go/middleware"
+	"net/http"
+	"time"
+)
+
+// Logger returns a gin middleware logging the requests at the ACCESS level,
+// with the fields of log4go.AccessHandler.  Use it before Recovery, so that
+// the requests whose handler panics are logged with their 500.
+func Logger(logger *log.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		defer func() {
+			err := recover()
+			status := c.Writer.Status()
+			if err != nil && !c.Writer.Written() {
+				status = http.StatusInternalServerError
+			}
+			bytes := int64(c.Writer.Size())
+			if bytes < 0 {
+				bytes = 0
+			}
+			current(logger).AccessRequest(c.Request, status, bytes, start)
+			if err != nil {
+				panic(err)
+			}
+		}()
+		c.Next()
+	}
+}
+
+// Recovery returns a gin middleware recovering the panics of the handlers:
+// the panic is logged at the CRITICAL level with the call stack, and the
+// request aborted with a 500 unless the response was sent already.
+func Recovery(logger *log.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			if err := recover(); err != nil {
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+				middleware.LogPanic(logger, c.Request, err)
+				if c.Writer.Written() {
+					c.Abort()
+				} else {
+					c.AbortWithStatus(http.StatusInternalServerError)
+				}
+			}
+		}()
+		c.Next()
+	}
+}
+
+// The logger, the global one if it's nil
+func current(logger *log.Logger) log.Logger {
+	if logger == nil {
+		return log.Global
+	}
+	return *logger
+}
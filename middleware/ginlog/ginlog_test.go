@@ -0,0 +1,49 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package ginlog
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	log "github.com/kimiazhu/log4go"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mlw := log.NewMemoryLogWriter(10).SetFormat("%L %M")
+	logger := log.NewLogger().AddFilter("memory", log.ERROR, mlw)
+	logger.AddAccessFilter("access", mlw)
+
+	r := gin.New()
+	r.Use(Logger(&logger), Recovery(&logger))
+	r.GET("/hello", func(c *gin.Context) { c.String(200, "hello") })
+	r.GET("/panic", func(c *gin.Context) { panic("boom") })
+
+	for _, path := range []string{"/hello", "/panic", "/missing"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	var got []string
+	for _, rec := range mlw.Records() {
+		line := strings.SplitN(rec.Message, "\n", 2)[0]
+		for _, f := range rec.Fields {
+			if f.Key == "status" || f.Key == "bytes" {
+				line += " " + f.Key + "=" + fmt.Sprint(f.Value)
+			}
+		}
+		got = append(got, line)
+	}
+	want := []string{
+		"GET /hello HTTP/1.1 status=200 bytes=5",
+		"panic serving GET /panic: boom",
+		"GET /panic HTTP/1.1 status=500 bytes=0",
+		// gin writes the body of a 404 after the middlewares
+		"GET /missing HTTP/1.1 status=404 bytes=0",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Gin: got records\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
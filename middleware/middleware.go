@@ -0,0 +1,116 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+// Package middleware logs the requests served by net/http and recovers the
+// panics of their handlers through log4go:
+//
+//	http.ListenAndServe(":8080", middleware.Handler(nil, mux))
+//
+// Each request is logged at the ACCESS level, with the fields of
+// log4go.AccessHandler, so that an access filter writes it, e.g.
+// log4go.NewAccessLogWriter("access.log", "combined").  A panic is logged at
+// the CRITICAL level with the call stack, and answered with a 500.  The
+// subpackages ginlog and echolog do the same for gin and echo.
+package middleware
+
+import (
+	"bufio"
+	"errors"
+	log "github.com/kimiazhu/log4go"
+	"net"
+	"net/http"
+)
+
+// Handler serves the requests with next, logging them and recovering the
+// panics: Logging(logger) around Recovery(logger).  The logger is the global
+// one if it's nil.
+func Handler(logger *log.Logger, next http.Handler) http.Handler {
+	return Logging(logger)(Recovery(logger)(next))
+}
+
+// Logging returns a middleware logging the requests at the ACCESS level, see
+// log4go.AccessHandler.  The logger is the global one if it's nil.
+func Logging(logger *log.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			log.AccessHandler(current(logger), next).ServeHTTP(rw, req)
+		})
+	}
+}
+
+// Recovery returns a middleware recovering the panics of the handlers: the
+// panic is logged at the CRITICAL level with the call stack, and the request
+// answered with a 500 unless the handler sent its response already.  The
+// panics with http.ErrAbortHandler are let through, net/http aborts the
+// response quietly.  The logger is the global one if it's nil.
+func Recovery(logger *log.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rrw := &recoveryResponseWriter{ResponseWriter: rw}
+			defer func() {
+				if err := recover(); err != nil {
+					if err == http.ErrAbortHandler {
+						panic(err)
+					}
+					LogPanic(logger, req, err)
+					if !rrw.wrote {
+						http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+					}
+				}
+			}()
+			next.ServeHTTP(rrw, req)
+		})
+	}
+}
+
+// LogPanic logs the panic err of the handler of req at the CRITICAL level,
+// with the call stack, as Recovery does.  It's meant for the deferred
+// functions which recover the panics of other frameworks.  The logger is the
+// global one if it's nil.
+func LogPanic(logger *log.Logger, req *http.Request, err interface{}) {
+	current(logger).Critical("panic serving %s %s: %v", req.Method, req.RequestURI, err)
+}
+
+// The logger, the global one if it's nil
+func current(logger *log.Logger) log.Logger {
+	if logger == nil {
+		return log.Global
+	}
+	return *logger
+}
+
+// The ResponseWriter of Recovery, which knows whether the response was sent
+type recoveryResponseWriter struct {
+	http.ResponseWriter
+	wrote bool
+}
+
+func (w *recoveryResponseWriter) WriteHeader(status int) {
+	w.wrote = w.wrote || status >= 200
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recoveryResponseWriter) Write(b []byte) (int, error) {
+	w.wrote = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recoveryResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.wrote = true
+		f.Flush()
+	}
+}
+
+func (w *recoveryResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("middleware: the ResponseWriter doesn't support hijacking")
+	}
+	w.wrote = true
+	return h.Hijack()
+}
+
+// Unwrap returns the ResponseWriter wrapped, for http.ResponseController
+func (w *recoveryResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,62 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package middleware
+
+import (
+	log "github.com/kimiazhu/log4go"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	mlw := log.NewMemoryLogWriter(10)
+	logger := log.NewLogger().AddFilter("memory", log.ERROR, mlw)
+	logger.AddAccessFilter("access", mlw)
+	handler := Handler(&logger, http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/panic" {
+			panic("boom")
+		}
+		io.WriteString(rw, "hello")
+	}))
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest("GET", "/hello", nil))
+	if resp.Code != 200 || resp.Body.String() != "hello" {
+		t.Errorf("Handler: got %d %q for /hello", resp.Code, resp.Body.String())
+	}
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest("GET", "/panic", nil))
+	if resp.Code != 500 {
+		t.Errorf("Handler: got %d for /panic, want 500", resp.Code)
+	}
+
+	var got []string
+	for _, rec := range mlw.Records() {
+		got = append(got, rec.Level.String()+" "+strings.SplitN(rec.Message, "\n", 2)[0]+" "+status(rec))
+	}
+	want := []string{
+		"ACCE GET /hello HTTP/1.1 200",
+		"CRIT panic serving GET /panic: boom ",
+		"ACCE GET /panic HTTP/1.1 500",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Handler: got records\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if recs := mlw.Records(); len(recs) == 3 && !strings.Contains(recs[1].Message, "middleware_test.go") {
+		t.Errorf("Handler: no call stack in %q", recs[1].Message)
+	}
+}
+
+// The status field of an access record, "" if there is none
+func status(rec *log.LogRecord) string {
+	for _, f := range rec.Fields {
+		if f.Key == "status" {
+			return strconv.Itoa(f.Value.(int))
+		}
+	}
+	return ""
+}
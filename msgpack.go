@@ -0,0 +1,423 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// MsgpackLayout encodes a record as a MessagePack map with the keys of its
+// JSON (see WireJSON): Level, Created (a timestamp), Source, Message and Fields
+// (an array of maps with Key and Value), then Goroutine, NDC, MDC and Name if
+// they are set.  The values of the fields are encoded as their type says, those
+// which MessagePack has no type for as their text.
+type MsgpackLayout struct{}
+
+func (MsgpackLayout) Format(rec *LogRecord) []byte {
+	n := 5
+	if rec.Goroutine != 0 {
+		n++
+	}
+	if len(rec.NDC) > 0 {
+		n++
+	}
+	if len(rec.MDC) > 0 {
+		n++
+	}
+	if rec.Name != "" {
+		n++
+	}
+
+	b := make([]byte, 0, 128)
+	b = msgpackMap(b, n)
+	b = msgpackInt(msgpackString(b, "Level"), int64(rec.Level))
+	b = msgpackTime(msgpackString(b, "Created"), rec.Created)
+	b = msgpackString(msgpackString(b, "Source"), rec.Source)
+	b = msgpackString(msgpackString(b, "Message"), rec.Message)
+	b = msgpackString(b, "Fields")
+	if rec.Fields == nil {
+		b = append(b, 0xc0)
+	} else {
+		b = msgpackArray(b, len(rec.Fields))
+		for _, f := range rec.Fields {
+			b = msgpackMap(b, 2)
+			b = msgpackString(msgpackString(b, "Key"), f.Key)
+			b = msgpackValue(msgpackString(b, "Value"), wireValue(f.Value))
+		}
+	}
+	if rec.Goroutine != 0 {
+		b = msgpackInt(msgpackString(b, "Goroutine"), rec.Goroutine)
+	}
+	if len(rec.NDC) > 0 {
+		b = msgpackArray(msgpackString(b, "NDC"), len(rec.NDC))
+		for _, s := range rec.NDC {
+			b = msgpackString(b, s)
+		}
+	}
+	if len(rec.MDC) > 0 {
+		b = msgpackMap(msgpackString(b, "MDC"), len(rec.MDC))
+		for _, k := range sortedKeys(rec.MDC) {
+			b = msgpackString(msgpackString(b, k), rec.MDC[k])
+		}
+	}
+	if rec.Name != "" {
+		b = msgpackString(msgpackString(b, "Name"), rec.Name)
+	}
+	return b
+}
+
+// The keys of m in order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func msgpackValue(b []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case nil:
+		return append(b, 0xc0)
+	case bool:
+		if v {
+			return append(b, 0xc3)
+		}
+		return append(b, 0xc2)
+	case int64:
+		return msgpackInt(b, v)
+	case uint64:
+		return msgpackUint(b, v)
+	case float64:
+		b = append(b, 0xcb)
+		return binary.BigEndian.AppendUint64(b, math.Float64bits(v))
+	case string:
+		return msgpackString(b, v)
+	case []byte:
+		return append(msgpackHeader(b, len(v), 0xc4, 0xc5, 0xc6), v...)
+	case time.Time:
+		return msgpackTime(b, v)
+	}
+	return msgpackString(b, fmt.Sprint(v))
+}
+
+func msgpackInt(b []byte, v int64) []byte {
+	switch {
+	case v >= 0:
+		return msgpackUint(b, uint64(v))
+	case v >= -32:
+		return append(b, byte(v))
+	case v >= math.MinInt8:
+		return append(b, 0xd0, byte(v))
+	case v >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(v))
+	case v >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(v))
+	}
+	return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(v))
+}
+
+func msgpackUint(b []byte, v uint64) []byte {
+	switch {
+	case v <= 0x7f:
+		return append(b, byte(v))
+	case v <= math.MaxUint8:
+		return append(b, 0xcc, byte(v))
+	case v <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xcd), uint16(v))
+	case v <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, 0xce), uint32(v))
+	}
+	return binary.BigEndian.AppendUint64(append(b, 0xcf), v)
+}
+
+func msgpackString(b []byte, s string) []byte {
+	if len(s) < 32 {
+		return append(append(b, 0xa0|byte(len(s))), s...)
+	}
+	return append(msgpackHeader(b, len(s), 0xd9, 0xda, 0xdb), s...)
+}
+
+func msgpackArray(b []byte, n int) []byte {
+	if n < 16 {
+		return append(b, 0x90|byte(n))
+	}
+	return msgpackHeader(b, n, 0, 0xdc, 0xdd)
+}
+
+func msgpackMap(b []byte, n int) []byte {
+	if n < 16 {
+		return append(b, 0x80|byte(n))
+	}
+	return msgpackHeader(b, n, 0, 0xde, 0xdf)
+}
+
+// The header of a string, binary, array or map of size n, with the codes for a
+// size on 1, 2 or 4 bytes (0 if there is none)
+func msgpackHeader(b []byte, n int, code8, code16, code32 byte) []byte {
+	switch {
+	case code8 != 0 && n <= math.MaxUint8:
+		return append(b, code8, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, code16), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(b, code32), uint32(n))
+}
+
+// A time as the timestamp extension (-1) on 12 bytes
+func msgpackTime(b []byte, t time.Time) []byte {
+	b = append(b, 0xc7, 12, 0xff)
+	b = binary.BigEndian.AppendUint32(b, uint32(t.Nanosecond()))
+	return binary.BigEndian.AppendUint64(b, uint64(t.Unix()))
+}
+
+var errMsgpack = errors.New("msgpack: invalid record")
+
+// Read a record encoded by MsgpackLayout
+func decodeMsgpackRecord(r *bufio.Reader) (*LogRecord, error) {
+	v, err := msgpackDecode(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errMsgpack
+	}
+
+	rec := &LogRecord{}
+	for key, v := range m {
+		switch key {
+		case "Level":
+			n, ok := v.(int64)
+			if !ok {
+				return nil, errMsgpack
+			}
+			rec.Level = Level(n)
+		case "Created":
+			rec.Created, _ = v.(time.Time)
+		case "Source":
+			rec.Source, _ = v.(string)
+		case "Message":
+			rec.Message, _ = v.(string)
+		case "Fields":
+			fields, _ := v.([]interface{})
+			for _, f := range fields {
+				fm, ok := f.(map[string]interface{})
+				if !ok {
+					return nil, errMsgpack
+				}
+				key, _ := fm["Key"].(string)
+				rec.Fields = append(rec.Fields, Field{key, fm["Value"]})
+			}
+		case "Goroutine":
+			rec.Goroutine, _ = v.(int64)
+		case "NDC":
+			ndc, _ := v.([]interface{})
+			for _, s := range ndc {
+				s, _ := s.(string)
+				rec.NDC = append(rec.NDC, s)
+			}
+		case "MDC":
+			mdc, _ := v.(map[string]interface{})
+			rec.MDC = make(map[string]string, len(mdc))
+			for k, s := range mdc {
+				rec.MDC[k], _ = s.(string)
+			}
+		case "Name":
+			rec.Name, _ = v.(string)
+		}
+	}
+	return rec, nil
+}
+
+// Read a value: nil, a bool, an int64 (or a uint64 beyond), a float64, a
+// string, a []byte, a time.Time, a []interface{} or a map[string]interface{}.
+// Only the first byte may be the end of the stream.
+func msgpackDecode(r *bufio.Reader, depth int) (interface{}, error) {
+	if depth > 32 {
+		return nil, errMsgpack
+	}
+	c, err := r.ReadByte()
+	if err != nil {
+		if depth > 0 {
+			return nil, unexpectedEOF(err)
+		}
+		return nil, err
+	}
+
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xe0 == 0xa0:
+		return msgpackReadString(r, int(c&0x1f))
+	case c&0xf0 == 0x90:
+		return msgpackReadArray(r, int(c&0x0f), depth)
+	case c&0xf0 == 0x80:
+		return msgpackReadMap(r, int(c&0x0f), depth)
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		v, err := msgpackReadUint(r, 1<<(c-0xcc))
+		if err != nil {
+			return nil, err
+		}
+		if v <= math.MaxInt64 {
+			return int64(v), nil
+		}
+		return v, nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (c - 0xd0)
+		v, err := msgpackReadUint(r, size)
+		if err != nil {
+			return nil, err
+		}
+		shift := uint(64 - 8*size)
+		return int64(v<<shift) >> shift, nil
+	case 0xca:
+		v, err := msgpackReadUint(r, 4)
+		return float64(math.Float32frombits(uint32(v))), err
+	case 0xcb:
+		v, err := msgpackReadUint(r, 8)
+		return math.Float64frombits(v), err
+	case 0xd9, 0xda, 0xdb:
+		n, err := msgpackReadUint(r, 1<<(c-0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return msgpackReadString(r, int(n))
+	case 0xc4, 0xc5, 0xc6:
+		n, err := msgpackReadUint(r, 1<<(c-0xc4))
+		if err != nil {
+			return nil, err
+		}
+		return msgpackRead(r, int(n))
+	case 0xdc, 0xdd:
+		n, err := msgpackReadUint(r, 2<<(c-0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return msgpackReadArray(r, int(n), depth)
+	case 0xde, 0xdf:
+		n, err := msgpackReadUint(r, 2<<(c-0xde))
+		if err != nil {
+			return nil, err
+		}
+		return msgpackReadMap(r, int(n), depth)
+	case 0xd6, 0xd7, 0xc7:
+		return msgpackReadTime(r, c)
+	}
+	return nil, fmt.Errorf("msgpack: unsupported type 0x%02x", c)
+}
+
+func msgpackReadUint(r *bufio.Reader, size int) (uint64, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(r, buf[8-size:]); err != nil {
+		return 0, unexpectedEOF(err)
+	}
+	return binary.BigEndian.Uint64(buf[:]), nil
+}
+
+func msgpackRead(r *bufio.Reader, n int) ([]byte, error) {
+	if n > MaxWireRecord {
+		return nil, errWireTooLarge
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return b, nil
+}
+
+func msgpackReadString(r *bufio.Reader, n int) (interface{}, error) {
+	b, err := msgpackRead(r, n)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func msgpackReadArray(r *bufio.Reader, n int, depth int) (interface{}, error) {
+	if n > MaxWireRecord {
+		return nil, errWireTooLarge
+	}
+	a := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		v, err := msgpackDecode(r, depth+1)
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		a = append(a, v)
+	}
+	return a, nil
+}
+
+func msgpackReadMap(r *bufio.Reader, n int, depth int) (interface{}, error) {
+	if n > MaxWireRecord {
+		return nil, errWireTooLarge
+	}
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, err := msgpackDecode(r, depth+1)
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, errMsgpack
+		}
+		if m[key], err = msgpackDecode(r, depth+1); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+	}
+	return m, nil
+}
+
+// Read a timestamp extension, on 4, 8 or 12 bytes, after its code c
+func msgpackReadTime(r *bufio.Reader, c byte) (interface{}, error) {
+	size := map[byte]int{0xd6: 4, 0xd7: 8}[c]
+	if c == 0xc7 {
+		n, err := r.ReadByte()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		size = int(n)
+	}
+	typ, err := r.ReadByte()
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	data, err := msgpackRead(r, size)
+	if err != nil {
+		return nil, err
+	}
+	if int8(typ) != -1 {
+		return data, nil // An extension of another type, kept as bytes
+	}
+	switch size {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(data)), 0), nil
+	case 8:
+		v := binary.BigEndian.Uint64(data)
+		return time.Unix(int64(v&(1<<34-1)), int64(v>>34)), nil
+	case 12:
+		return time.Unix(int64(binary.BigEndian.Uint64(data[4:])), int64(binary.BigEndian.Uint32(data))), nil
+	}
+	return nil, errMsgpack
+}
@@ -0,0 +1,193 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"fmt"
+)
+
+// A NamedLogger logs through the filters of a Logger, and its records carry
+// its name, which %N prints, e.g. the component which logged them:
+//
+//	db := log.Named("db")
+//	db.Info("connected to %s", addr)
+//
+// The filters are shared: adding a filter to the Logger or reconfiguring it
+// applies to its NamedLoggers too.
+type NamedLogger struct {
+	log  Logger
+	name string
+}
+
+// Named returns a NamedLogger which logs through the filters of log.
+func (log Logger) Named(name string) NamedLogger {
+	return NamedLogger{log, name}
+}
+
+// Wrapper for (*Logger).Named
+func Named(name string) NamedLogger {
+	return Global.Named(name)
+}
+
+// Name returns the name of the logger.
+func (l NamedLogger) Name() string {
+	return l.name
+}
+
+// Named returns a child of the logger, named after both: "db" then "pool"
+// gives "db.pool".
+func (l NamedLogger) Named(name string) NamedLogger {
+	return NamedLogger{l.log, l.name + "." + name}
+}
+
+// Send a log message built from the arguments of Debug and the like
+// internally, see argsMessage
+func (l NamedLogger) intLogv(lvl Level, arg0 interface{}, args []interface{}) {
+	// Determine if any logging will be done
+	if l.log.skip(lvl) {
+		return
+	}
+
+	// Determine caller func
+	src := callerSource(2)
+
+	// Make the log record
+	rec := newRecord(lvl, src, argsMessage(arg0, args))
+	rec.Name = l.name
+
+	l.log.dispatch(rec)
+}
+
+// Finest logs a message at the finest log level, see Logger.Debug.
+func (l NamedLogger) Finest(arg0 interface{}, args ...interface{}) {
+	l.intLogv(FINEST, arg0, args)
+}
+
+// Fine logs a message at the fine log level, see Logger.Debug.
+func (l NamedLogger) Fine(arg0 interface{}, args ...interface{}) {
+	l.intLogv(FINE, arg0, args)
+}
+
+// Debug logs a message at the debug log level, see Logger.Debug.
+func (l NamedLogger) Debug(arg0 interface{}, args ...interface{}) {
+	l.intLogv(DEBUG, arg0, args)
+}
+
+// Trace logs a message at the trace log level, see Logger.Debug.
+func (l NamedLogger) Trace(arg0 interface{}, args ...interface{}) {
+	l.intLogv(TRACE, arg0, args)
+}
+
+// Info logs a message at the info log level, see Logger.Debug.
+func (l NamedLogger) Info(arg0 interface{}, args ...interface{}) {
+	l.intLogv(INFO, arg0, args)
+}
+
+// Access logs a message at the access log level, see Logger.Debug.
+func (l NamedLogger) Access(arg0 interface{}, args ...interface{}) {
+	l.intLogv(ACCESS, arg0, args)
+}
+
+// Warn logs a message at the warning log level and returns the formatted
+// error, see Logger.Warn.
+func (l NamedLogger) Warn(arg0 interface{}, args ...interface{}) error {
+	msg := argsMessage(arg0, args)
+	l.intLogv(WARNING, msg, nil)
+	return argsError(msg, arg0, args)
+}
+
+// Error logs a message at the error log level and returns the formatted
+// error, see Logger.Warn.
+func (l NamedLogger) Error(arg0 interface{}, args ...interface{}) error {
+	msg := argsMessage(arg0, args)
+	l.intLogv(ERROR, msg, nil)
+	return argsError(msg, arg0, args)
+}
+
+// Critical logs a message and the call stack at the critical log level and
+// returns the formatted error, see Logger.Warn.
+func (l NamedLogger) Critical(arg0 interface{}, args ...interface{}) error {
+	msg := argsMessage(arg0, args)
+	if !l.log.skip(CRITICAL) {
+		l.intLogv(CRITICAL, msg+"\n"+callStack(), nil)
+	}
+	return argsError(msg, arg0, args)
+}
+
+// Send a formatted log message internally
+func (l NamedLogger) intLogf(lvl Level, format string, args ...interface{}) {
+	// Determine if any logging will be done
+	if l.log.skip(lvl) {
+		return
+	}
+
+	// Determine caller func
+	src := callerSource(2)
+
+	msg := format
+	if len(args) > 0 {
+		msg = fmt.Sprintf(format, args...)
+	}
+
+	// Make the log record
+	rec := newRecord(lvl, src, msg)
+	rec.Name = l.name
+
+	l.log.dispatch(rec)
+}
+
+// Finestf logs a message at the finest log level, formatted with fmt.Sprintf.
+func (l NamedLogger) Finestf(format string, args ...interface{}) {
+	l.intLogf(FINEST, format, args...)
+}
+
+// Finef logs a message at the fine log level, formatted with fmt.Sprintf.
+func (l NamedLogger) Finef(format string, args ...interface{}) {
+	l.intLogf(FINE, format, args...)
+}
+
+// Debugf logs a message at the debug log level, formatted with fmt.Sprintf.
+func (l NamedLogger) Debugf(format string, args ...interface{}) {
+	l.intLogf(DEBUG, format, args...)
+}
+
+// Tracef logs a message at the trace log level, formatted with fmt.Sprintf.
+func (l NamedLogger) Tracef(format string, args ...interface{}) {
+	l.intLogf(TRACE, format, args...)
+}
+
+// Infof logs a message at the info log level, formatted with fmt.Sprintf.
+func (l NamedLogger) Infof(format string, args ...interface{}) {
+	l.intLogf(INFO, format, args...)
+}
+
+// Accessf logs a message at the access log level, formatted with fmt.Sprintf.
+func (l NamedLogger) Accessf(format string, args ...interface{}) {
+	l.intLogf(ACCESS, format, args...)
+}
+
+// Warnf logs a message at the warning log level, formatted with fmt.Sprintf,
+// and returns it as an error.
+func (l NamedLogger) Warnf(format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	l.intLogv(WARNING, msg, nil)
+	return argsError(msg, nil, args)
+}
+
+// Errorf logs a message at the error log level, formatted with fmt.Sprintf,
+// and returns it as an error.
+func (l NamedLogger) Errorf(format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	l.intLogv(ERROR, msg, nil)
+	return argsError(msg, nil, args)
+}
+
+// Criticalf logs a message and the call stack at the critical log level,
+// formatted with fmt.Sprintf, and returns it as an error.
+func (l NamedLogger) Criticalf(format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	if !l.log.skip(CRITICAL) {
+		l.intLogv(CRITICAL, msg+"\n"+callStack(), nil)
+	}
+	return argsError(msg, nil, args)
+}
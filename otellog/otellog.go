@@ -0,0 +1,224 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+// Package otellog connects log4go to OpenTelemetry.  Importing it adds the
+// ids of the current span to the records logged through the *Ctx functions,
+// as the fields trace_id and span_id, so that the logs can be correlated with
+// the traces (e.g. in Tempo or Jaeger):
+//
+//	import _ "github.com/kimiazhu/log4go/otellog"
+//
+//	log4go.InfoCtx(ctx, "charged %s", order)
+//
+// A Writer emits the records as OpenTelemetry logs, e.g. to an OTLP endpoint
+// through a LoggerProvider of the SDK.  The configuration gets it as
+// <type>otlp</type>:
+//
+//	<filter enabled="true">
+//	  <tag>otlp</tag>
+//	  <type>otlp</type>
+//	  <level>INFO</level>
+//	  <property name="endpoint">collector:4318</property>
+//	  <property name="insecure">true</property>
+//	  <property name="service_name">shop</property>
+//	  <property name="header">Authorization: Bearer secret</property>
+//	</filter>
+package otellog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	log "github.com/kimiazhu/log4go"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	otellog "go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"strings"
+	"time"
+)
+
+// The name of the instrumentation scope of the records
+const scopeName = "github.com/kimiazhu/log4go"
+
+func init() {
+	log.RegisterContextFields(TraceFields)
+	log.RegisterWriterType("otlp", newOTLPWriter)
+}
+
+// TraceFields returns the ids of the span of ctx as the fields trace_id and
+// span_id, none if ctx has no valid span.
+func TraceFields(ctx context.Context) []log.Field {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return nil
+	}
+	return []log.Field{
+		{Key: "trace_id", Value: sc.TraceID().String()},
+		{Key: "span_id", Value: sc.SpanID().String()},
+	}
+}
+
+// This log writer emits the records as OpenTelemetry logs through a
+// LoggerProvider.  The fields of a record are its attributes, except
+// trace_id and span_id (see TraceFields), which set the span of the log.
+type Writer struct {
+	logger   otellog.Logger
+	provider *sdklog.LoggerProvider // Shut down on Close if set
+}
+
+// NewWriter creates a Writer emitting the records through provider, which
+// the caller shuts down once the logger is closed.
+func NewWriter(provider otellog.LoggerProvider) *Writer {
+	return &Writer{logger: provider.Logger(scopeName)}
+}
+
+// This is the Writer's output method.
+func (w *Writer) LogWrite(rec *log.LogRecord) {
+	var r otellog.Record
+	r.SetTimestamp(rec.Created)
+	r.SetObservedTimestamp(time.Now())
+	r.SetSeverity(Severity(rec.Level))
+	r.SetSeverityText(rec.Level.String())
+	r.SetBody(otellog.StringValue(rec.Message))
+
+	var sc trace.SpanContextConfig
+	attrs := make([]otellog.KeyValue, 0, len(rec.Fields)+2)
+	if rec.Source != "" {
+		attrs = append(attrs, otellog.String("log4go.source", rec.Source))
+	}
+	if rec.Name != "" {
+		attrs = append(attrs, otellog.String("log4go.logger", rec.Name))
+	}
+	for _, f := range rec.Fields {
+		switch s, _ := f.Value.(string); {
+		case f.Key == "trace_id" && s != "":
+			sc.TraceID, _ = trace.TraceIDFromHex(s)
+		case f.Key == "span_id" && s != "":
+			sc.SpanID, _ = trace.SpanIDFromHex(s)
+		default:
+			attrs = append(attrs, otellog.KeyValue{Key: f.Key, Value: value(f.Value)})
+		}
+	}
+	r.AddAttributes(attrs...)
+
+	ctx := context.Background()
+	if span := trace.NewSpanContext(sc); span.IsValid() {
+		ctx = trace.ContextWithSpanContext(ctx, span)
+	}
+	w.logger.Emit(ctx, r)
+}
+
+// Close shuts down the LoggerProvider of a writer of the configuration,
+// which sends the records still batched.  Otherwise it does nothing, the
+// provider is the caller's.
+func (w *Writer) Close() {
+	if w.provider != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := w.provider.Shutdown(ctx); err != nil {
+			log.ReportError("otellog.Writer", err)
+		}
+	}
+}
+
+// Severity returns the OpenTelemetry severity of a level.
+func Severity(lvl log.Level) otellog.Severity {
+	switch lvl {
+	case log.FINEST:
+		return otellog.SeverityTrace1
+	case log.FINE:
+		return otellog.SeverityTrace2
+	case log.DEBUG:
+		return otellog.SeverityDebug1
+	case log.TRACE:
+		return otellog.SeverityDebug2
+	case log.ACCESS, log.INFO:
+		return otellog.SeverityInfo1
+	case log.WARNING:
+		return otellog.SeverityWarn1
+	case log.ERROR:
+		return otellog.SeverityError1
+	}
+	return otellog.SeverityFatal1
+}
+
+// The attribute value of a field
+func value(v interface{}) otellog.Value {
+	switch v := v.(type) {
+	case string:
+		return otellog.StringValue(v)
+	case bool:
+		return otellog.BoolValue(v)
+	case int:
+		return otellog.IntValue(v)
+	case int32:
+		return otellog.Int64Value(int64(v))
+	case int64:
+		return otellog.Int64Value(v)
+	case float32:
+		return otellog.Float64Value(float64(v))
+	case float64:
+		return otellog.Float64Value(v)
+	case time.Duration:
+		return otellog.StringValue(v.String())
+	case error:
+		return otellog.StringValue(v.Error())
+	case nil:
+		return otellog.Value{}
+	}
+	return otellog.StringValue(fmt.Sprint(v))
+}
+
+// The writer of <type>otlp</type>, with an OTLP/HTTP exporter
+func newOTLPWriter(props []log.Property) (log.LogWriter, error) {
+	var opts []otlploghttp.Option
+	headers := make(map[string]string)
+	service := ""
+	for _, prop := range props {
+		value := strings.TrimSpace(prop.Value)
+		switch prop.Name {
+		case "endpoint":
+			if strings.Contains(value, "://") {
+				opts = append(opts, otlploghttp.WithEndpointURL(value))
+			} else {
+				opts = append(opts, otlploghttp.WithEndpoint(value))
+			}
+		case "insecure":
+			if value != "false" {
+				opts = append(opts, otlploghttp.WithInsecure())
+			}
+		case "header":
+			i := strings.Index(value, ":")
+			if i <= 0 {
+				return nil, fmt.Errorf("invalid header %q, expect Name: value", value)
+			}
+			headers[strings.TrimSpace(value[:i])] = strings.TrimSpace(value[i+1:])
+		case "service_name":
+			service = value
+		default:
+			return nil, fmt.Errorf("unknown property %q", prop.Name)
+		}
+	}
+	if len(headers) > 0 {
+		opts = append(opts, otlploghttp.WithHeaders(headers))
+	}
+
+	exporter, err := otlploghttp.New(context.Background(), opts...)
+	if err != nil {
+		return nil, err
+	}
+	res := resource.Default()
+	if service != "" {
+		if res, err = resource.Merge(res, resource.NewSchemaless(semconv.ServiceName(service))); err != nil {
+			return nil, errors.New("can't set the service name: " + err.Error())
+		}
+	}
+	provider := sdklog.NewLoggerProvider(
+		sdklog.WithResource(res),
+		sdklog.WithProcessor(sdklog.NewBatchProcessor(exporter)))
+	w := NewWriter(provider)
+	w.provider = provider
+	return w, nil
+}
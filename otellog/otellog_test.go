@@ -0,0 +1,74 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package otellog
+
+import (
+	"context"
+	log "github.com/kimiazhu/log4go"
+	otellog "go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/trace"
+	"sync"
+	"testing"
+)
+
+// An exporter keeping the records
+type memExporter struct {
+	mu   sync.Mutex
+	recs []sdklog.Record
+}
+
+func (e *memExporter) Export(ctx context.Context, recs []sdklog.Record) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, r := range recs {
+		e.recs = append(e.recs, r.Clone())
+	}
+	return nil
+}
+
+func (e *memExporter) Shutdown(ctx context.Context) error   { return nil }
+func (e *memExporter) ForceFlush(ctx context.Context) error { return nil }
+
+func TestOTel(t *testing.T) {
+	exporter := &memExporter{}
+	provider := sdklog.NewLoggerProvider(sdklog.WithProcessor(sdklog.NewSimpleProcessor(exporter)))
+	defer provider.Shutdown(context.Background())
+
+	mlw := log.NewMemoryLogWriter(10)
+	logger := log.NewLogger().
+		AddFilter("memory", log.INFO, mlw).
+		AddFilter("otel", log.INFO, NewWriter(provider))
+
+	tid, _ := trace.TraceIDFromHex("0af7651916cd43dd8448eb211c80319c")
+	sid, _ := trace.SpanIDFromHex("b7ad6b7169203331")
+	ctx := trace.ContextWithSpanContext(context.Background(),
+		trace.NewSpanContext(trace.SpanContextConfig{TraceID: tid, SpanID: sid, TraceFlags: trace.FlagsSampled}))
+	logger.WarnCtx(ctx, "charged %d", 42)
+	logger.Info("no span")
+
+	recs := mlw.Records()
+	if len(recs) != 2 || len(recs[0].Fields) != 2 || recs[0].Fields[0].Value != tid.String() || recs[0].Fields[1].Value != sid.String() || len(recs[1].Fields) != 0 {
+		t.Fatalf("OTel: got the records %+v", recs)
+	}
+
+	if len(exporter.recs) != 2 {
+		t.Fatalf("OTel: got %d records exported, want 2", len(exporter.recs))
+	}
+	r := exporter.recs[0]
+	if r.Body().AsString() != "charged 42" || r.Severity() != otellog.SeverityWarn1 || r.SeverityText() != "WARN" {
+		t.Errorf("OTel: exported %q at %v %q", r.Body().AsString(), r.Severity(), r.SeverityText())
+	}
+	if r.TraceID() != tid || r.SpanID() != sid {
+		t.Errorf("OTel: exported with the span %s/%s", r.TraceID(), r.SpanID())
+	}
+	r.WalkAttributes(func(kv otellog.KeyValue) bool {
+		if kv.Key == "trace_id" || kv.Key == "span_id" {
+			t.Errorf("OTel: exported the attribute %s", kv.Key)
+		}
+		return true
+	})
+	if r := exporter.recs[1]; r.TraceID().IsValid() {
+		t.Errorf("OTel: exported a span for a record without one")
+	}
+}
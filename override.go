@@ -0,0 +1,85 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+// EnvLevel is the environment variable which overrides the levels of all the
+// filters at startup, e.g. LOG4GO_LEVEL=DEBUG, see OverrideLevel.
+const EnvLevel = "LOG4GO_LEVEL"
+
+// The level of all the filters plus one, 0 if they keep their own
+var levelOverride int64
+
+func init() {
+	if s := os.Getenv(EnvLevel); s != "" {
+		lvl, err := ParseLevel(s)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "log4go: Warning: %s ignored: %s\n", EnvLevel, err)
+			return
+		}
+		OverrideLevel(lvl)
+	}
+}
+
+// OverrideLevel makes all the filters of all the loggers use lvl rather than
+// their own level, e.g. to crank up the verbosity of one instance without
+// editing its configuration.  The levels set by Filter.SetLevel, e.g. from the
+// admin API, still take precedence.  It's called at startup with the level of
+// the LOG4GO_LEVEL environment variable if it's set, and by the flag of
+// BindFlags.
+func OverrideLevel(lvl Level) {
+	atomic.StoreInt64(&levelOverride, int64(lvl)+1)
+}
+
+// ResetLevelOverride gives the filters their own levels back.
+func ResetLevelOverride() {
+	atomic.StoreInt64(&levelOverride, 0)
+}
+
+// The level which overrides those of the filters, if there is one
+func overriddenLevel() (Level, bool) {
+	if o := atomic.LoadInt64(&levelOverride); o != 0 {
+		return Level(o - 1), true
+	}
+	return 0, false
+}
+
+// BindFlags defines the flag -log4go.level in fs, which overrides the levels of
+// all the filters (see OverrideLevel) with a level in the syntax of
+// ParseLevel, and takes precedence over LOG4GO_LEVEL:
+//
+//	log.BindFlags(flag.CommandLine)
+//	flag.Parse()
+//
+// A nil fs means flag.CommandLine.
+func BindFlags(fs *flag.FlagSet) {
+	if fs == nil {
+		fs = flag.CommandLine
+	}
+	fs.Var(levelFlag{}, "log4go.level", "override the level of all the log filters, e.g. DEBUG")
+}
+
+// The flag.Value of -log4go.level
+type levelFlag struct{}
+
+func (levelFlag) String() string {
+	if lvl, ok := overriddenLevel(); ok {
+		return levelName(lvl)
+	}
+	return ""
+}
+
+func (levelFlag) Set(s string) error {
+	lvl, err := ParseLevel(s)
+	if err != nil {
+		return err
+	}
+	OverrideLevel(lvl)
+	return nil
+}
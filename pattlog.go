@@ -6,7 +6,13 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const (
@@ -15,26 +21,64 @@ const (
 	FORMAT_ABBREV  = "[%L] %M"
 )
 
+// The dates and times of the last second formatted.  %T has the nanoseconds
+// of the record between the clock and the zone.
 type formatCacheType struct {
-	LastUpdateNanoSec    int64
 	LastUpdateSeconds    int64
+	location             *time.Location
 	shortTime, shortDate string
-	longTime, longDate   string
+	clock, zone          string
+	longDate             string
 }
 
-var formatCache = &formatCacheType{}
+var formatCache atomic.Value // *formatCacheType
+
+// The formats split on their % signs, by format, so that a format is only
+// split once
+var formatPieces = struct {
+	sync.RWMutex
+	m map[string][][]byte
+}{m: make(map[string][][]byte)}
+
+var pid = strconv.Itoa(os.Getpid())
+
+// Set once a %G was formatted: the id of the goroutine is only looked up for
+// the records when a format needs it
+var goroutineIDWanted int32
 
 // Known format codes:
 // %T - Time (15:04:05.000000000 MST)
 // %t - Time (15:04)
 // %D - Date (2006/01/02)
+// %D{LAYOUT} or %T{LAYOUT} - Date and time in a Go time layout or a preset (see FormatTime)
+// %D{LAYOUT}{UTC}, %T{UTC} and the like - The same in UTC
 // %d - Date (01/02/06)
 // %L - Level (FNST, FINE, DEBG, TRAC, WARN, EROR, CRIT)
-// %S - Source
-// %M - Message
+// %Z - Date and time in the time format of the writer (see FormatTime)
+// %H - Hostname, %I - Instance ID, %R - Region (see CurrentIdentity)
+// %P - Process ID
+// %G - Goroutine ID of the caller (? for the first records formatted)
+// %E{NAME} - Value of the environment variable NAME
+// %S - Source, the function and the line (github.com/user/pkg.Func:42)
+// %S{short} - Source without the package path (pkg.Func:42), the same as %s
+// %S{func} - Function without the package path (pkg.Func)
+// %S{file} - Base name of the file and line (pkg.go:42)
+// %S{long} - Full path of the file and line (/home/user/src/pkg/pkg.go:42)
+// %N - Name of the NamedLogger
+// %x - Nested diagnostic context, space separated (see PushContext)
+// %X{KEY} - Value of KEY in the mapped diagnostic context (see MDCSet)
+// %X - Mapped diagnostic context, as key=value pairs sorted by key
+// %M - Message, followed by the record fields (key=value) if any and there is no %F
+// %F - Record fields as logfmt (key=value key2="quoted value")
+// %F{json} - Record fields as a JSON object, %F{logfmt} is the same as %F
 // Ignores unknown formats
 // Recommended: "[%D %T] [%L] (%S) %M"
 func FormatLogRecord(format string, rec *LogRecord) string {
+	return formatLogRecord(format, "", rec)
+}
+
+// Format a record like FormatLogRecord, %Z in the given time format
+func formatLogRecord(format, timeformat string, rec *LogRecord) string {
 	if rec == nil {
 		return "<nil>"
 	}
@@ -43,54 +87,123 @@ func FormatLogRecord(format string, rec *LogRecord) string {
 	}
 
 	out := bytes.NewBuffer(make([]byte, 0, 64))
+	writeLogRecord(out, format, timeformat, rec)
+	return out.String()
+}
 
-	nanosec := rec.Created.UnixNano()
-	secs := nanosec / 1e9
-	//if strings.Contains(format, "%T") {
-	//	secs = rec.Created.UnixNano()
-	//}
+// Format a record like formatLogRecord into out, e.g. a buffer the writer
+// reuses for all its records
+func writeLogRecord(out *bytes.Buffer, format, timeformat string, rec *LogRecord) {
+	if len(format) == 0 {
+		return
+	}
 
-	cache := *formatCache
-	if cache.LastUpdateNanoSec != nanosec {
+	secs := rec.Created.Unix()
+	cache, _ := formatCache.Load().(*formatCacheType)
+	if cache == nil || cache.LastUpdateSeconds != secs || cache.location != rec.Created.Location() {
 		month, day, year := rec.Created.Month(), rec.Created.Day(), rec.Created.Year()
-		hour, minute, second, nanosce := rec.Created.Hour(), rec.Created.Minute(), rec.Created.Second(), rec.Created.Nanosecond()
+		hour, minute, second := rec.Created.Hour(), rec.Created.Minute(), rec.Created.Second()
 		zone, _ := rec.Created.Zone()
-		updated := &formatCacheType{
-			LastUpdateNanoSec: nanosec,
+		cache = &formatCacheType{
 			LastUpdateSeconds: secs,
+			location:          rec.Created.Location(),
 			shortTime:         fmt.Sprintf("%02d:%02d", hour, minute),
 			shortDate:         fmt.Sprintf("%02d/%02d/%02d", day, month, year%100),
-			longTime:          fmt.Sprintf("%02d:%02d:%02d.%09d %s", hour, minute, second, nanosce, zone),
+			clock:             fmt.Sprintf("%02d:%02d:%02d", hour, minute, second),
+			zone:              zone,
 			longDate:          fmt.Sprintf("%04d/%02d/%02d", year, month, day),
 		}
-		cache = *updated
-		formatCache = updated
+		formatCache.Store(cache)
 	}
 
+	// The fields go where %F is, if anywhere, rather than after the message
+	fieldsVerb := strings.Contains(format, "%F")
+
 	// Split the string into pieces by % signs
-	pieces := bytes.Split([]byte(format), []byte{'%'})
+	pieces := splitFormat(format)
 
 	// Iterate over the pieces, replacing known formats
 	for i, piece := range pieces {
 		if i > 0 && len(piece) > 0 {
 			switch piece[0] {
 			case 'T':
-				out.WriteString(cache.longTime)
+				if t, rest, ok := timeArgs(piece[1:], rec.Created, "15:04:05.000000000 MST"); ok {
+					out.WriteString(t)
+					piece = append(piece[:1:1], rest...)
+				} else {
+					writeLongTime(out, cache, rec.Created.Nanosecond())
+				}
 			case 't':
 				out.WriteString(cache.shortTime)
 			case 'D':
-				out.WriteString(cache.longDate)
+				if t, rest, ok := timeArgs(piece[1:], rec.Created, "2006/01/02"); ok {
+					out.WriteString(t)
+					piece = append(piece[:1:1], rest...)
+				} else {
+					out.WriteString(cache.longDate)
+				}
 			case 'd':
 				out.WriteString(cache.shortDate)
+			case 'Z':
+				out.WriteString(FormatTime(rec.Created, timeformat))
+			case 'H':
+				out.WriteString(CurrentIdentity().Hostname)
+			case 'I':
+				out.WriteString(CurrentIdentity().InstanceID)
+			case 'R':
+				out.WriteString(CurrentIdentity().Region)
+			case 'P':
+				out.WriteString(pid)
+			case 'G':
+				if rec.Goroutine != 0 {
+					out.WriteString(strconv.FormatInt(rec.Goroutine, 10))
+				} else {
+					atomic.StoreInt32(&goroutineIDWanted, 1)
+					out.WriteByte('?')
+				}
+			case 'E':
+				if arg, rest, ok := braceArg(piece[1:]); ok {
+					out.WriteString(os.Getenv(arg))
+					piece = append(piece[:1:1], rest...)
+				}
 			case 'L':
-				out.WriteString(levelStrings[rec.Level])
+				out.WriteString(rec.Level.String())
 			case 'S':
-				out.WriteString(rec.Source)
+				if style, rest, ok := braceArg(piece[1:]); ok {
+					out.WriteString(formatSource(rec.Source, style))
+					piece = append(piece[:1:1], rest...)
+				} else {
+					out.WriteString(rec.Source)
+				}
 			case 's':
 				slice := strings.Split(rec.Source, "/")
 				out.WriteString(slice[len(slice)-1])
+			case 'N':
+				out.WriteString(rec.Name)
+			case 'x':
+				out.WriteString(strings.Join(rec.NDC, " "))
+			case 'X':
+				if arg, rest, ok := braceArg(piece[1:]); ok {
+					out.WriteString(rec.MDC[arg])
+					piece = append(piece[:1:1], rest...)
+				} else {
+					out.WriteString(formatMDC(rec.MDC))
+				}
 			case 'M':
 				out.WriteString(rec.Message)
+				if !fieldsVerb {
+					writeFields(out, rec.Fields)
+				}
+			case 'F':
+				style, rest, ok := braceArg(piece[1:])
+				if ok {
+					piece = append(piece[:1:1], rest...)
+				}
+				if style == "json" {
+					writeJSONObject(out, rec.Fields)
+				} else {
+					writeLogfmtFields(out, rec.Fields)
+				}
 			}
 			if len(piece) > 1 {
 				out.Write(piece[1:])
@@ -100,8 +213,105 @@ func FormatLogRecord(format string, rec *LogRecord) string {
 		}
 	}
 	out.WriteByte('\n')
+}
 
-	return out.String()
+// The pieces of format between its % signs, which must not be modified
+func splitFormat(format string) [][]byte {
+	formatPieces.RLock()
+	pieces, ok := formatPieces.m[format]
+	formatPieces.RUnlock()
+	if ok {
+		return pieces
+	}
+
+	// The formats are usually a few constants, but don't grow without bounds
+	// if they aren't
+	pieces = bytes.Split([]byte(format), []byte{'%'})
+	formatPieces.Lock()
+	if len(formatPieces.m) < 256 {
+		formatPieces.m[format] = pieces
+	}
+	formatPieces.Unlock()
+	return pieces
+}
+
+// Write the %T of a record: the clock of the cache, the nanoseconds and the
+// zone, as in 15:04:05.000000000 MST
+func writeLongTime(out *bytes.Buffer, cache *formatCacheType, nanos int) {
+	var digits [10]byte
+	digits[0] = '.'
+	for i := 9; i > 0; i-- {
+		digits[i] = byte('0' + nanos%10)
+		nanos /= 10
+	}
+	out.WriteString(cache.clock)
+	out.Write(digits[:])
+	out.WriteByte(' ')
+	out.WriteString(cache.zone)
+}
+
+// The source src in style, see %S{style}: as is for an unknown style, and
+// without the package path for file and long if the file of the source isn't
+// known, e.g. a source given to Log
+func formatSource(src, style string) string {
+	short := src[strings.LastIndex(src, "/")+1:]
+	line := ""
+	if i := strings.LastIndexByte(short, ':'); i >= 0 {
+		line = short[i:]
+	}
+	switch style {
+	case "short":
+		return short
+	case "func":
+		return strings.TrimSuffix(short, line)
+	case "file", "long":
+		file := sourceFile(src)
+		if file == "" {
+			return short
+		}
+		if style == "file" {
+			file = filepath.Base(file)
+		}
+		return file + line
+	}
+	return src
+}
+
+// Split the {argument} at the start of piece from the rest
+func braceArg(piece []byte) (arg string, rest []byte, ok bool) {
+	if len(piece) == 0 || piece[0] != '{' {
+		return "", piece, false
+	}
+	end := bytes.IndexByte(piece, '}')
+	if end < 0 {
+		return "", piece, false
+	}
+	return string(piece[1:end]), piece[end+1:], true
+}
+
+// Format t in the {LAYOUT}{UTC} arguments at the start of piece, if any, and
+// return what follows them.  A lone {UTC} keeps the default layout of the verb.
+func timeArgs(piece []byte, t time.Time, deflayout string) (string, []byte, bool) {
+	layout, rest, ok := braceArg(piece)
+	if !ok {
+		return "", piece, false
+	}
+	if layout == "UTC" {
+		layout, t = deflayout, t.UTC()
+	} else if zone, after, ok := braceArg(rest); ok && zone == "UTC" {
+		t, rest = t.UTC(), after
+	}
+	if layout == "" {
+		layout = deflayout
+	}
+	return FormatTime(t, layout), rest, true
+}
+
+// Append the fields as space separated key=value pairs
+func writeFields(out *bytes.Buffer, fields []Field) {
+	for _, field := range fields {
+		fmt.Fprintf(out, " %s=%v", field.Key, field.Value)
+	}
 }
 
 // This is the standard writer that prints to standard output.
@@ -126,6 +336,10 @@ func (w FormatLogWriter) LogWrite(rec *LogRecord) {
 	w <- rec
 }
 
+func (w FormatLogWriter) queued() (int, int) {
+	return len(w), cap(w)
+}
+
 // Close stops the logger from sending messages to standard output.  Attempts to
 // send log messages to this logger after a Close have undefined behavior.
 func (w FormatLogWriter) Close() {
@@ -0,0 +1,96 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// The sources of the call sites, "function:line" by program counter, so that
+// a call site is only described once, and the sites of the sources, with
+// their file for %S{long} and %S{file} and the results of the excludes
+var callerSources = struct {
+	sync.RWMutex
+	m     map[uintptr]string
+	sites map[string]*sourceSite
+}{m: make(map[uintptr]string), sites: make(map[string]*sourceSite)}
+
+// The source of the caller skip frames above the caller of callerSource, ""
+// if it can't be found
+func callerSource(skip int) string {
+	pc, file, lineno, ok := runtime.Caller(skip + 1)
+	if !ok {
+		return ""
+	}
+
+	callerSources.RLock()
+	src, ok := callerSources.m[pc]
+	callerSources.RUnlock()
+	if ok {
+		return src
+	}
+
+	src = runtime.FuncForPC(pc).Name() + ":" + strconv.Itoa(lineno)
+	callerSources.Lock()
+	callerSources.m[pc] = src
+	if _, ok := callerSources.sites[src]; !ok {
+		callerSources.sites[src] = &sourceSite{file: file}
+	}
+	callerSources.Unlock()
+	return src
+}
+
+// The file of a source made by callerSource, "" for another one
+func sourceFile(src string) string {
+	if site := sourceSiteOf(src); site != nil {
+		return site.file
+	}
+	return ""
+}
+
+// The records made by the logging calls are taken from a pool, and given back
+// once written when all the writers they go to format them right away and
+// keep nothing (the console and file writers).  LogRecord.refs counts the
+// writers still to release a record, it's -1 for a record of the pool not
+// dispatched yet, and 0 for a record which isn't given back.
+var recordPool = sync.Pool{
+	New: func() interface{} { return new(LogRecord) },
+}
+
+// The writers which release the records they are done with, see releaseRecord
+type recordReleaser interface {
+	releasesRecords()
+}
+
+// A record of the pool, see recordPool
+func newRecord(lvl Level, src, msg string) *LogRecord {
+	rec := recordPool.Get().(*LogRecord)
+	rec.Level = lvl
+	rec.Created = clockNow()
+	rec.Source = src
+	rec.Message = msg
+	rec.refs = -1
+	return rec
+}
+
+// Release a record a writer is done with: the last of the writers it was
+// dispatched to gives it back to the pool.  It does nothing for a record not
+// from the pool.
+func releaseRecord(rec *LogRecord) {
+	for {
+		refs := atomic.LoadInt32(&rec.refs)
+		if refs <= 0 {
+			return
+		}
+		if atomic.CompareAndSwapInt32(&rec.refs, refs, refs-1) {
+			if refs == 1 {
+				*rec = LogRecord{}
+				recordPool.Put(rec)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// A Predicate decides whether a filter writes a record it accepts, past the
+// level and the excludes: the filter drops the records for which it returns
+// false.  It's called from the logging goroutine and must not log.
+type Predicate func(rec *LogRecord) bool
+
+// The predicates the configuration can name, see RegisterPredicate
+var predicates = struct {
+	sync.RWMutex
+	m map[string]Predicate
+}{m: make(map[string]Predicate)}
+
+// RegisterPredicate makes the predicate p available to the configuration as
+// <property name="predicate">name</property>, e.g. to drop the access lines of
+// the health checks:
+//
+//	log4go.RegisterPredicate("no_healthz", func(rec *log4go.LogRecord) bool {
+//	    return !strings.Contains(rec.Message, "/healthz")
+//	})
+//
+// Register the predicates before loading the configuration.  Registering a
+// name again replaces the predicate, a nil p removes it.
+func RegisterPredicate(name string, p Predicate) {
+	predicates.Lock()
+	defer predicates.Unlock()
+	if p == nil {
+		delete(predicates.m, name)
+		return
+	}
+	predicates.m[name] = p
+}
+
+// SetPredicate makes the filter drop the records for which p returns false,
+// none if p is nil.  It's safe while records are being logged.
+func (f *Filter) SetPredicate(p Predicate) {
+	f.predicate.Store(p)
+}
+
+// Report whether the predicate of the filter, if any, keeps rec
+func (f *Filter) keeps(rec *LogRecord) bool {
+	p, _ := f.predicate.Load().(Predicate)
+	return p == nil || p(rec)
+}
+
+// Report whether the filter has a predicate
+func (f *Filter) hasPredicate() bool {
+	p, _ := f.predicate.Load().(Predicate)
+	return p != nil
+}
+
+// All of ps, which keeps the records all of them keep
+func allPredicates(ps []Predicate) Predicate {
+	if len(ps) == 1 {
+		return ps[0]
+	}
+	return func(rec *LogRecord) bool {
+		for _, p := range ps {
+			if !p(rec) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Parse the predicate properties of a filter, each naming one or more
+// registered predicates separated by commas.  It returns nil if there are
+// none.
+func xmlToPredicate(names []string) (Predicate, bool) {
+	var ps []Predicate
+	predicates.RLock()
+	defer predicates.RUnlock()
+	for _, list := range names {
+		for _, name := range strings.Split(list, ",") {
+			name = strings.TrimSpace(name)
+			p, ok := predicates.m[name]
+			if !ok {
+				fmt.Fprintf(configOut, "LoadConfiguration: Error: Invalid property \"%s\" for filter: unknown predicate %q, see RegisterPredicate\n", "predicate", name)
+				return nil, false
+			}
+			ps = append(ps, p)
+		}
+	}
+	if len(ps) == 0 {
+		return nil, true
+	}
+	return allPredicates(ps), true
+}
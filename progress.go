@@ -0,0 +1,84 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ProgressInterval specifies how often Progress logs the progress of a given
+// name.  Calls in between are only accounted.
+var ProgressInterval = 10 * time.Second
+
+type progressState struct {
+	started time.Time
+	logged  time.Time
+}
+
+var progress = struct {
+	sync.Mutex
+	names map[string]*progressState
+}{names: make(map[string]*progressState)}
+
+// Progress reports that done of total items of the task name are processed.
+// It can be called on every iteration of a long loop: the progress is logged
+// at the info level at most once per ProgressInterval, and when done reaches
+// total, with the throughput and the estimated time to completion computed
+// since the first call.  A total of 0 or less means the total is unknown.
+func (log Logger) Progress(name string, done, total int) {
+	if msg, fields, ok := progressRecord(name, done, total); ok {
+		log.intLogFields(INFO, fields, msg)
+	}
+}
+
+// Account a call to Progress, and build the message and fields if it's time to
+// log it
+func progressRecord(name string, done, total int) (msg string, fields []Field, ok bool) {
+	now := clockNow()
+
+	progress.Lock()
+	state, ok := progress.names[name]
+	if !ok {
+		state = &progressState{started: now, logged: now}
+		progress.names[name] = state
+	}
+	finished := total > 0 && done >= total
+	if finished {
+		delete(progress.names, name)
+	} else if now.Sub(state.logged) < ProgressInterval {
+		progress.Unlock()
+		return "", nil, false
+	}
+	state.logged = now
+	progress.Unlock()
+
+	elapsed := now.Sub(state.started)
+	fields = []Field{{"task", name}, {"done", done}}
+	msg = fmt.Sprintf("%s: %d", name, done)
+	if total > 0 {
+		fields = append(fields, Field{"total", total})
+		msg = fmt.Sprintf("%s: %d/%d (%.1f%%)", name, done, total, 100*float64(done)/float64(total))
+	}
+	if elapsed > 0 {
+		rate := float64(done) / elapsed.Seconds()
+		fields = append(fields, Field{"rate", fmt.Sprintf("%.1f/s", rate)})
+		if total > 0 && !finished && rate > 0 {
+			eta := time.Duration(float64(total-done) / rate * float64(time.Second))
+			fields = append(fields, Field{"eta", eta.Round(time.Second)})
+		}
+	}
+	if finished {
+		fields = append(fields, Field{"elapsed", elapsed.Round(time.Millisecond)})
+	}
+	return msg, fields, true
+}
+
+// Utility for rate limited progress messages (see (*Logger).Progress)
+// Wrapper for (*Logger).Progress
+func Progress(name string, done, total int) {
+	if msg, fields, ok := progressRecord(name, done, total); ok {
+		Global.intLogFields(INFO, fields, msg)
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+// Package promlog exposes the counters of the log4go writers (see
+// log4go.Stats) to Prometheus, so that a logging pipeline which drops records
+// or fails to write can be alerted on:
+//
+//	prometheus.MustRegister(promlog.NewCollector(nil))
+//
+// The metrics are counters labelled with the filter tag:
+//
+//	log4go_records_written_total{filter="file"}
+//	log4go_bytes_written_total{filter="file"}
+//	log4go_records_dropped_total{filter="file"}
+//	log4go_write_errors_total{filter="file"}
+//	log4go_rotations_total{filter="file"}
+//	log4go_file_evictions_total{filter="split"}
+package promlog
+
+import (
+	log "github.com/kimiazhu/log4go"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	writtenDesc = prometheus.NewDesc("log4go_records_written_total",
+		"Records written by the log4go writer.", []string{"filter"}, nil)
+	bytesDesc = prometheus.NewDesc("log4go_bytes_written_total",
+		"Bytes written by the log4go writer, as formatted.", []string{"filter"}, nil)
+	droppedDesc = prometheus.NewDesc("log4go_records_dropped_total",
+		"Records discarded by the log4go writer, e.g. buffer full or expired.", []string{"filter"}, nil)
+	errorsDesc = prometheus.NewDesc("log4go_write_errors_total",
+		"Failed writes, connects or rotations of the log4go writer.", []string{"filter"}, nil)
+	rotationsDesc = prometheus.NewDesc("log4go_rotations_total",
+		"Files rotated by the log4go writer.", []string{"filter"}, nil)
+	evictionsDesc = prometheus.NewDesc("log4go_file_evictions_total",
+		"Files closed by the log4go writer to stay within its file descriptor budget.", []string{"filter"}, nil)
+)
+
+// A Collector collects the counters of the writers of a logger.
+type Collector struct {
+	logger *log.Logger
+}
+
+// NewCollector creates a Collector for the writers of logger, or of the global
+// logger if it's nil.  The global logger is read on every scrape, so that a
+// reconfiguration is picked up.
+func NewCollector(logger *log.Logger) *Collector {
+	return &Collector{logger}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- writtenDesc
+	ch <- bytesDesc
+	ch <- droppedDesc
+	ch <- errorsDesc
+	ch <- rotationsDesc
+	ch <- evictionsDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	logger := log.Global
+	if c.logger != nil {
+		logger = *c.logger
+	}
+	for tag, stats := range logger.Stats() {
+		ch <- prometheus.MustNewConstMetric(writtenDesc, prometheus.CounterValue, float64(stats.Written), tag)
+		ch <- prometheus.MustNewConstMetric(bytesDesc, prometheus.CounterValue, float64(stats.Bytes), tag)
+		ch <- prometheus.MustNewConstMetric(droppedDesc, prometheus.CounterValue, float64(stats.Dropped), tag)
+		ch <- prometheus.MustNewConstMetric(errorsDesc, prometheus.CounterValue, float64(stats.Errors), tag)
+		ch <- prometheus.MustNewConstMetric(rotationsDesc, prometheus.CounterValue, float64(stats.Rotations), tag)
+		ch <- prometheus.MustNewConstMetric(evictionsDesc, prometheus.CounterValue, float64(stats.Evictions), tag)
+	}
+}
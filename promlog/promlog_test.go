@@ -0,0 +1,55 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package promlog
+
+import (
+	log "github.com/kimiazhu/log4go"
+	"github.com/prometheus/client_golang/prometheus"
+	"testing"
+)
+
+// A writer with fixed counters
+type statsWriter log.WriterStats
+
+func (w statsWriter) LogWrite(rec *log.LogRecord) {}
+func (w statsWriter) Close()                      {}
+func (w statsWriter) Stats() log.WriterStats      { return log.WriterStats(w) }
+
+func TestCollector(t *testing.T) {
+	logger := log.NewLogger().
+		SetFilter("file", &log.Filter{Level: log.INFO, LogWriter: statsWriter{Written: 10, Bytes: 420, Rotations: 1}}).
+		SetFilter("shipper", &log.Filter{Level: log.INFO, LogWriter: statsWriter{Written: 7, Dropped: 3, Errors: 2, Evictions: 4}})
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(NewCollector(&logger)); err != nil {
+		t.Fatalf("Register: %s", err)
+	}
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %s", err)
+	}
+
+	got := make(map[string]float64)
+	for _, mf := range families {
+		for _, m := range mf.GetMetric() {
+			got[mf.GetName()+"/"+m.GetLabel()[0].GetValue()] = m.GetCounter().GetValue()
+		}
+	}
+	want := map[string]float64{
+		"log4go_records_written_total/file":    10,
+		"log4go_bytes_written_total/file":      420,
+		"log4go_rotations_total/file":          1,
+		"log4go_records_written_total/shipper": 7,
+		"log4go_records_dropped_total/shipper": 3,
+		"log4go_write_errors_total/shipper":    2,
+		"log4go_file_evictions_total/shipper":  4,
+		"log4go_write_errors_total/file":       0,
+	}
+	for name, value := range want {
+		if got[name] != value {
+			t.Errorf("%s = %v, want %v", name, got[name], value)
+		}
+	}
+	if len(got) != 12 {
+		t.Errorf("got %d metrics, want 12: %v", len(got), got)
+	}
+}
@@ -0,0 +1,269 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"time"
+)
+
+// ProtobufLayout encodes a record as a protocol buffers message prefixed by
+// its size as a varint, as the delimited streams of protocol buffers (e.g.
+// parseDelimitedFrom in Java).  The messages are:
+//
+//	message Record {
+//	  sint64 level = 1;
+//	  int64 created_unix_nano = 2;
+//	  string source = 3;
+//	  string message = 4;
+//	  repeated Field fields = 5;
+//	  int64 goroutine = 6;
+//	  repeated string ndc = 7;
+//	  map<string, string> mdc = 8;
+//	  string name = 9;
+//	}
+//
+//	message Field {
+//	  string key = 1;
+//	  oneof value {
+//	    string string_value = 2;
+//	    sint64 int_value = 3;
+//	    uint64 uint_value = 4;
+//	    double double_value = 5;
+//	    bool bool_value = 6;
+//	    bytes bytes_value = 7;
+//	  }
+//	}
+//
+// A field without a value is nil, and the times are strings in RFC 3339 with
+// the nanoseconds, like the values protocol buffers have no type for are their
+// text.
+type ProtobufLayout struct{}
+
+func (ProtobufLayout) Format(rec *LogRecord) []byte {
+	msg := make([]byte, 0, 128)
+	msg = protoVarint(msg, 1, zigzag(int64(rec.Level)))
+	if !rec.Created.IsZero() {
+		msg = protoVarint(msg, 2, uint64(rec.Created.UnixNano()))
+	}
+	msg = protoBytes(msg, 3, rec.Source)
+	msg = protoBytes(msg, 4, rec.Message)
+	for _, f := range rec.Fields {
+		msg = protoBytes(msg, 5, string(protoField(f)))
+	}
+	msg = protoVarint(msg, 6, uint64(rec.Goroutine))
+	for _, s := range rec.NDC {
+		msg = protoBytes(msg, 7, s)
+	}
+	for _, k := range sortedKeys(rec.MDC) {
+		entry := protoBytes(protoBytes(nil, 1, k), 2, rec.MDC[k])
+		msg = protoBytes(msg, 8, string(entry))
+	}
+	msg = protoBytes(msg, 9, rec.Name)
+
+	out := binary.AppendUvarint(make([]byte, 0, len(msg)+2), uint64(len(msg)))
+	return append(out, msg...)
+}
+
+// A Field message
+func protoField(f Field) []byte {
+	b := protoString(nil, 1, f.Key)
+
+	switch v := wireValue(f.Value).(type) {
+	case nil:
+	case string:
+		b = protoString(b, 2, v)
+	case int64:
+		b = binary.AppendUvarint(protoTag(b, 3, 0), zigzag(v))
+	case uint64:
+		b = binary.AppendUvarint(protoTag(b, 4, 0), v)
+	case float64:
+		b = binary.LittleEndian.AppendUint64(protoTag(b, 5, 1), math.Float64bits(v))
+	case bool:
+		n := uint64(0)
+		if v {
+			n = 1
+		}
+		b = binary.AppendUvarint(protoTag(b, 6, 0), n)
+	case []byte:
+		b = protoString(b, 7, string(v))
+	case time.Time:
+		b = protoString(b, 2, v.Format(time.RFC3339Nano))
+	}
+	return b
+}
+
+func protoTag(b []byte, field int, wiretype int) []byte {
+	return binary.AppendUvarint(b, uint64(field<<3|wiretype))
+}
+
+// A varint field, left out if it's 0 as proto3 does
+func protoVarint(b []byte, field int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	return binary.AppendUvarint(protoTag(b, field, 0), v)
+}
+
+// A string or bytes field, left out if it's empty as proto3 does
+func protoBytes(b []byte, field int, s string) []byte {
+	if s == "" {
+		return b
+	}
+	return protoString(b, field, s)
+}
+
+// A string or bytes field, even empty, e.g. the member of a oneof
+func protoString(b []byte, field int, s string) []byte {
+	b = binary.AppendUvarint(protoTag(b, field, 2), uint64(len(s)))
+	return append(b, s...)
+}
+
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
+
+func unzigzag(v uint64) int64 {
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+var errProtobuf = errors.New("protobuf: invalid record")
+
+// Read a record encoded by ProtobufLayout
+func decodeProtobufRecord(r *bufio.Reader) (*LogRecord, error) {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if size > uint64(MaxWireRecord) {
+		return nil, errWireTooLarge
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	rec := &LogRecord{}
+	var nanos int64
+	err = protoEach(msg, func(field int, v uint64, data []byte) error {
+		switch field {
+		case 1:
+			rec.Level = Level(unzigzag(v))
+		case 2:
+			nanos = int64(v)
+		case 3:
+			rec.Source = string(data)
+		case 4:
+			rec.Message = string(data)
+		case 5:
+			f, err := decodeProtoField(data)
+			if err != nil {
+				return err
+			}
+			rec.Fields = append(rec.Fields, f)
+		case 6:
+			rec.Goroutine = int64(v)
+		case 7:
+			rec.NDC = append(rec.NDC, string(data))
+		case 8:
+			var key, value string
+			err := protoEach(data, func(field int, _ uint64, data []byte) error {
+				if field == 1 {
+					key = string(data)
+				} else if field == 2 {
+					value = string(data)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if rec.MDC == nil {
+				rec.MDC = make(map[string]string)
+			}
+			rec.MDC[key] = value
+		case 9:
+			rec.Name = string(data)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if nanos != 0 {
+		rec.Created = time.Unix(0, nanos)
+	}
+	return rec, nil
+}
+
+// Read a Field message
+func decodeProtoField(msg []byte) (Field, error) {
+	var f Field
+	err := protoEach(msg, func(field int, v uint64, data []byte) error {
+		switch field {
+		case 1:
+			f.Key = string(data)
+		case 2:
+			f.Value = string(data)
+		case 3:
+			f.Value = unzigzag(v)
+		case 4:
+			f.Value = v
+		case 5:
+			f.Value = math.Float64frombits(v)
+		case 6:
+			f.Value = v != 0
+		case 7:
+			f.Value = append([]byte(nil), data...)
+		}
+		return nil
+	})
+	return f, err
+}
+
+// Call fn with the number of each field of msg and its value: v for the
+// varints and the fixed ones, data for the length-delimited ones
+func protoEach(msg []byte, fn func(field int, v uint64, data []byte) error) error {
+	for len(msg) > 0 {
+		tag, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return errProtobuf
+		}
+		msg = msg[n:]
+		var v uint64
+		var data []byte
+		switch tag & 7 {
+		case 0:
+			if v, n = binary.Uvarint(msg); n <= 0 {
+				return errProtobuf
+			}
+			msg = msg[n:]
+		case 1:
+			if len(msg) < 8 {
+				return errProtobuf
+			}
+			v, msg = binary.LittleEndian.Uint64(msg), msg[8:]
+		case 2:
+			size, n := binary.Uvarint(msg)
+			if n <= 0 || uint64(len(msg)-n) < size {
+				return errProtobuf
+			}
+			data, msg = msg[n:n+int(size)], msg[n+int(size):]
+		case 5:
+			if len(msg) < 4 {
+				return errProtobuf
+			}
+			v, msg = uint64(binary.LittleEndian.Uint32(msg)), msg[4:]
+		default:
+			return errProtobuf
+		}
+		if err := fn(int(tag>>3), v, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"sync"
+	"time"
+)
+
+// WarmupTimeout specifies how long the network writers wait for their first
+// connection at startup, holding the records back rather than dropping them,
+// before they give up and are ready anyway, see Logger.Ready.
+var WarmupTimeout = 5 * time.Second
+
+// The writers which need time to connect at startup implement this, e.g. the
+// socket and gelf writers: the channel is closed once the writer is connected,
+// or after WarmupTimeout.
+type ReadyWriter interface {
+	Ready() <-chan struct{}
+}
+
+// Ready returns a channel closed once all the writers of the logger are ready
+// (see ReadyWriter), e.g. for main to wait for the logging to be up before it
+// takes traffic:
+//
+//	select {
+//	case <-log.Ready():
+//	case <-time.After(10 * time.Second):
+//	}
+//
+// The records logged meanwhile are not lost, the writers hold them back.  The
+// channel is closed right away if no writer needs a warm-up.
+func (log Logger) Ready() <-chan struct{} {
+	var writers []LogWriter
+	for _, filt := range log.filters() {
+		writers = append(writers, filt.LogWriter)
+	}
+	return readyOf(writers)
+}
+
+// A channel closed once all the writers which need a warm-up are ready
+func readyOf(writers []LogWriter) <-chan struct{} {
+	var waits []<-chan struct{}
+	for _, writer := range writers {
+		if rw, ok := writer.(ReadyWriter); ok {
+			waits = append(waits, rw.Ready())
+		}
+	}
+
+	ready := make(chan struct{})
+	go func() {
+		for _, wait := range waits {
+			<-wait
+		}
+		close(ready)
+	}()
+	return ready
+}
+
+// The readiness of a writer, marked once it's connected or after
+// WarmupTimeout, whichever comes first
+type readiness struct {
+	once sync.Once
+	ch   chan struct{}
+}
+
+func newReadiness() *readiness {
+	r := &readiness{ch: make(chan struct{})}
+	time.AfterFunc(WarmupTimeout, r.mark)
+	return r
+}
+
+func (r *readiness) mark() {
+	r.once.Do(func() { close(r.ch) })
+}
+
+func (r *readiness) done() bool {
+	select {
+	case <-r.ch:
+		return true
+	default:
+		return false
+	}
+}
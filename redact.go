@@ -0,0 +1,222 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// RedactedText replaces what a Redactor scrubs, unless a pattern says
+// otherwise.
+const RedactedText = "[REDACTED]"
+
+// The built-in patterns of the redactors, see Redactor.AddBuiltin
+var (
+	// The numbers of 13 to 19 digits, possibly grouped by spaces or dashes,
+	// which pass the Luhn check
+	cardPattern = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)
+
+	// The values of the credentials given as key=value, key: value or
+	// "Bearer value", JSON web tokens and AWS access key ids
+	tokenPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)(\b(?:password|passwd|pwd|secret|token|api[_-]?key|access[_-]?key|auth)\b"?\s*[:=]\s*"?)[^\s"&,;]+`),
+		regexp.MustCompile(`(?i)(\bbearer\s+)[A-Za-z0-9._~+/=-]+`),
+		regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`),
+		regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+	}
+)
+
+// A Redactor scrubs the personal data and the secrets out of the records
+// before a filter writes them, see Filter.Redactor: what matches its patterns
+// in the message and in the values of the fields is replaced, and the values
+// of the fields named as secret are replaced whole.  The records logged are
+// not changed, the filter gets a scrubbed copy.  A Redactor must be set up
+// before the filter is in use.
+type Redactor struct {
+	rules  []redactRule
+	fields map[string]bool
+}
+
+type redactRule struct {
+	re   *regexp.Regexp
+	repl string
+
+	// If not nil, only the matches it accepts are replaced
+	match func(s string) bool
+}
+
+// NewRedactor creates a Redactor without patterns, which changes nothing.
+func NewRedactor() *Redactor {
+	return &Redactor{fields: make(map[string]bool)}
+}
+
+// DefaultRedactor creates a Redactor with all the built-in patterns: the
+// payment card numbers, the email addresses and the tokens.
+func DefaultRedactor() *Redactor {
+	r, _ := NewRedactor().AddBuiltin("cards", "emails", "tokens")
+	return r
+}
+
+// AddPattern replaces what matches re with repl, which may refer to the
+// submatches like in regexp.ReplaceAllString, e.g. "${1}[REDACTED]"
+// (chainable).
+func (r *Redactor) AddPattern(re *regexp.Regexp, repl string) *Redactor {
+	r.rules = append(r.rules, redactRule{re: re, repl: repl})
+	return r
+}
+
+// AddField replaces the whole value of the fields with one of the names, e.g.
+// "password", whatever it is (chainable).
+func (r *Redactor) AddField(names ...string) *Redactor {
+	for _, name := range names {
+		r.fields[name] = true
+	}
+	return r
+}
+
+// AddBuiltin adds the built-in patterns by name: "cards" for the payment card
+// numbers (checked with the Luhn algorithm, so that most other numbers are
+// left alone), "emails" for the email addresses, and "tokens" for the values
+// of the credentials given as password=..., token: ..., Bearer ..., the JSON
+// web tokens and the AWS access key ids.  It returns an error for an unknown
+// name, after adding the known ones.
+func (r *Redactor) AddBuiltin(names ...string) (*Redactor, error) {
+	var unknown []string
+	for _, name := range names {
+		switch name {
+		case "cards":
+			r.rules = append(r.rules, redactRule{re: cardPattern, repl: RedactedText, match: luhnValid})
+		case "emails":
+			r.AddPattern(emailPattern, RedactedText)
+		case "tokens":
+			r.AddPattern(tokenPatterns[0], "${1}"+RedactedText)
+			r.AddPattern(tokenPatterns[1], "${1}"+RedactedText)
+			r.AddPattern(tokenPatterns[2], RedactedText)
+			r.AddPattern(tokenPatterns[3], RedactedText)
+		default:
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		return r, fmt.Errorf("unknown redaction %s, expect cards, emails or tokens", strings.Join(unknown, ", "))
+	}
+	return r, nil
+}
+
+// RedactString returns s scrubbed with the patterns.
+func (r *Redactor) RedactString(s string) string {
+	for _, rule := range r.rules {
+		if rule.match == nil {
+			s = rule.re.ReplaceAllString(s, rule.repl)
+			continue
+		}
+		s = rule.re.ReplaceAllStringFunc(s, func(m string) string {
+			if !rule.match(m) {
+				return m
+			}
+			return rule.re.ReplaceAllString(m, rule.repl)
+		})
+	}
+	return s
+}
+
+// Redact returns rec scrubbed: rec itself if there is nothing to scrub, or
+// else a copy.  The values of the fields which aren't strings are scrubbed as
+// printed by fmt.Sprint, and replaced by the scrubbed text only if it differs.
+func (r *Redactor) Redact(rec *LogRecord) *LogRecord {
+	msg := r.RedactString(rec.Message)
+	var fields []Field
+	for i, field := range rec.Fields {
+		value, changed := field.Value, false
+		if r.fields[field.Key] {
+			value, changed = RedactedText, true
+		} else if field.Value != nil {
+			s, ok := field.Value.(string)
+			if !ok {
+				s = fmt.Sprint(field.Value)
+			}
+			if scrubbed := r.RedactString(s); scrubbed != s {
+				value, changed = scrubbed, true
+			}
+		}
+		if fields == nil && changed {
+			fields = make([]Field, len(rec.Fields))
+			copy(fields, rec.Fields[:i])
+		}
+		if fields != nil {
+			fields[i] = Field{field.Key, value}
+		}
+	}
+	if msg == rec.Message && fields == nil {
+		return rec
+	}
+
+	scrubbed := new(LogRecord)
+	*scrubbed = *rec
+	scrubbed.refs = 0
+	scrubbed.Message = msg
+	if fields != nil {
+		scrubbed.Fields = fields
+	}
+	return scrubbed
+}
+
+// Report whether the digits of s pass the Luhn check of the payment cards
+func luhnValid(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && n <= 19 && sum%10 == 0
+}
+
+// Build the redactor of a filter from its properties: redact, the names of
+// the built-in patterns separated by commas (or "all"), redact_pattern, a
+// regular expression whose matches are replaced, and redact_field, the name
+// of a field replaced whole.  It's nil without any of them, or with redact
+// set to none.
+func xmlToRedactor(builtins string, patterns, fields []string) (*Redactor, bool) {
+	if (builtins == "" || builtins == "none") && len(patterns) == 0 && len(fields) == 0 {
+		return nil, true
+	}
+
+	r := NewRedactor()
+	if builtins == "all" {
+		builtins = "cards,emails,tokens"
+	}
+	if builtins != "" && builtins != "none" {
+		var names []string
+		for _, name := range strings.Split(builtins, ",") {
+			names = append(names, strings.TrimSpace(name))
+		}
+		if _, err := r.AddBuiltin(names...); err != nil {
+			fmt.Fprintf(configOut, "LoadConfiguration: Error: Invalid property \"%s\" for filter: %s\n", "redact", err)
+			return nil, false
+		}
+	}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			fmt.Fprintf(configOut, "LoadConfiguration: Error: Invalid property \"%s\" for filter: %s\n", "redact_pattern", err)
+			return nil, false
+		}
+		r.AddPattern(re, RedactedText)
+	}
+	r.AddField(fields...)
+	return r, true
+}
@@ -0,0 +1,156 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// A RouteConfig is a <route> of the XML configuration, which sends the
+// records matching it to the filters tagged To:
+//
+//	<route>
+//	  <match>(?i)payment</match>
+//	  <field name="team">billing</field>
+//	  <to>payments</to>
+//	</route>
+//
+// A record matches if its message matches the regular expression Match and
+// its fields have the values of Field (compared with their %v form), either
+// being optional.  A filter named by routes only writes the records matching
+// one of them.  The records matching a route with final="true" are only
+// written by the filters it names, as by log4j's additivity="false".
+type RouteConfig struct {
+	Final string     `xml:"final,attr"`
+	Match string     `xml:"match"`
+	Field []Property `xml:"field"`
+	To    []string   `xml:"to"`
+}
+
+// A route of the configuration, parsed
+type route struct {
+	match  *regexp.Regexp
+	fields []Property
+	to     map[string]bool
+	final  bool
+}
+
+// Report whether rec matches the route
+func (r *route) matches(rec *LogRecord) bool {
+	if r.match != nil && !r.match.MatchString(rec.Message) {
+		return false
+	}
+	for _, want := range r.fields {
+		found := false
+		for _, f := range rec.Fields {
+			if f.Key == want.Name && fmt.Sprint(f.Value) == want.Value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Parse the routes of a configuration, whose filters are tagged tags.  The
+// errors are reported to configOut, and false is returned if there is one.
+func configRoutes(xc *LoggerConfig, tags map[string]bool) ([]*route, bool) {
+	var routes []*route
+	good := true
+	for _, rc := range xc.Route {
+		r := &route{to: make(map[string]bool)}
+		switch final := strings.Trim(rc.Final, " \r\n"); final {
+		case "", "false":
+		case "true":
+			r.final = true
+		default:
+			fmt.Fprintf(configOut, "LoadConfiguration: Error: Invalid attribute %s for route: %s, expect true or false\n", "final", final)
+			good = false
+		}
+		if match := strings.Trim(rc.Match, " \r\n"); match != "" {
+			var err error
+			if r.match, err = regexp.Compile(match); err != nil {
+				fmt.Fprintf(configOut, "LoadConfiguration: Error: Invalid child <%s> for route: %s\n", "match", err)
+				good = false
+			}
+		}
+		for _, f := range rc.Field {
+			if f.Name == "" {
+				fmt.Fprintf(configOut, "LoadConfiguration: Error: Required attribute %s for route <field>\n", "name")
+				good = false
+			}
+			r.fields = append(r.fields, Property{f.Name, strings.Trim(f.Value, " \r\n")})
+		}
+		if len(rc.To) == 0 {
+			fmt.Fprintf(configOut, "LoadConfiguration: Error: Required child <%s> for route\n", "to")
+			good = false
+		}
+		for _, tag := range rc.To {
+			tag = strings.Trim(tag, " \r\n")
+			if !tags[tag] {
+				fmt.Fprintf(configOut, "LoadConfiguration: Error: Route to unknown filter \"%s\"\n", tag)
+				good = false
+			}
+			r.to[tag] = true
+		}
+		if r.match == nil && len(r.fields) == 0 && good {
+			fmt.Fprintf(configOut, "LoadConfiguration: Warning: Route to %s matches all the records, it has neither <match> nor <field>\n", strings.Join(rc.To, ", "))
+		}
+		routes = append(routes, r)
+	}
+	return routes, good
+}
+
+// The predicate of the filter tagged tag, which keeps the records matching
+// one of the routes to it, if any, and none of the final routes to other
+// filters.  It returns nil if the routes don't concern the filter.
+func routePredicate(tag string, routes []*route) Predicate {
+	var to, others []*route
+	for _, r := range routes {
+		if r.to[tag] {
+			to = append(to, r)
+		} else if r.final {
+			others = append(others, r)
+		}
+	}
+	if len(to) == 0 && len(others) == 0 {
+		return nil
+	}
+	return func(rec *LogRecord) bool {
+		for _, r := range others {
+			if r.matches(rec) {
+				return false
+			}
+		}
+		if len(to) == 0 {
+			return true
+		}
+		for _, r := range to {
+			if r.matches(rec) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Apply the routes of the configuration xc to its filters, after their own
+// predicates
+func applyRoutes(filters map[string]*Filter, routes []*route, xc *LoggerConfig) {
+	for tag, filt := range filters {
+		p := routePredicate(tag, routes)
+		if p == nil {
+			continue
+		}
+		if own, _ := filt.predicate.Load().(Predicate); own != nil {
+			p = allPredicates([]Predicate{own, p})
+		}
+		filt.SetPredicate(p)
+		filt.routes = xc.Route
+	}
+}
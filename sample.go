@@ -0,0 +1,121 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// A Sampler decides which of the records accepted by a filter are written,
+// see Filter.Sampler.
+type Sampler interface {
+	Keep(rec *LogRecord) bool
+}
+
+// A RandomSampler keeps each record with the probability Rate.  Its decisions
+// are drawn from a seeded generator: two samplers with the same seed make the
+// same decisions on the same sequence of records, e.g. in a test.
+type RandomSampler struct {
+	Rate float64
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// NewRandomSampler returns a RandomSampler keeping the given fraction of the
+// records, with its generator seeded with seed.
+func NewRandomSampler(rate float64, seed int64) *RandomSampler {
+	return &RandomSampler{Rate: rate, rng: rand.New(rand.NewSource(seed))}
+}
+
+func (s *RandomSampler) Keep(rec *LogRecord) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rng.Float64() < s.Rate
+}
+
+// A HashSampler keeps the records whose hash is below Rate: the decision
+// only depends on the record (its source and message) and the salt, so that
+// whoever has the records and the settings can recompute what was kept, e.g.
+// an auditor.  The same message from the same place is always kept, or never.
+type HashSampler struct {
+	Rate float64
+	Salt string
+}
+
+// NewHashSampler returns a HashSampler keeping about the given fraction of
+// the records.
+func NewHashSampler(rate float64, salt string) *HashSampler {
+	return &HashSampler{Rate: rate, Salt: salt}
+}
+
+func (s *HashSampler) Keep(rec *LogRecord) bool {
+	h := fnv.New64a()
+	h.Write([]byte(s.Salt))
+	h.Write([]byte{0})
+	h.Write([]byte(rec.Source))
+	h.Write([]byte{0})
+	h.Write([]byte(rec.Message))
+
+	// FNV barely mixes the last bytes into the high bits, finish with the
+	// finalizer of SplitMix64
+	x := h.Sum64()
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	x ^= x >> 31
+	return float64(x)/(1<<64) < s.Rate
+}
+
+// SampleBelow returns a Sampler which keeps all the records at or above lvl,
+// and leaves the others to s, e.g. to sample the debug records but never the
+// errors.
+func SampleBelow(lvl Level, s Sampler) Sampler {
+	return levelSampler{lvl, s}
+}
+
+type levelSampler struct {
+	lvl Level
+	s   Sampler
+}
+
+func (s levelSampler) Keep(rec *LogRecord) bool {
+	return rec.Level >= s.lvl || s.s.Keep(rec)
+}
+
+// Build the sampler of a filter from its sample_* properties: the rate, the
+// mode, the seed of the random mode or the salt of the hash one, and the level
+// from which all the records are kept (ACCESS for none)
+func xmlToSampler(rate, mode, seed string, lvl Level) (Sampler, bool) {
+	r, err := strconv.ParseFloat(rate, 64)
+	if err != nil || r < 0 || r > 1 {
+		fmt.Fprintf(configOut, "LoadConfiguration: Error: Invalid property \"%s\" for filter: %s, expect a number between 0 and 1\n", "sample_rate", rate)
+		return nil, false
+	}
+
+	var s Sampler
+	switch mode {
+	case "", "random":
+		n := time.Now().UnixNano()
+		if seed != "" {
+			if n, err = strconv.ParseInt(seed, 10, 64); err != nil {
+				fmt.Fprintf(configOut, "LoadConfiguration: Error: Invalid property \"%s\" for filter: %s, expect an integer\n", "sample_seed", seed)
+				return nil, false
+			}
+		}
+		s = NewRandomSampler(r, n)
+	case "hash":
+		s = NewHashSampler(r, seed)
+	default:
+		fmt.Fprintf(configOut, "LoadConfiguration: Error: Invalid property \"%s\" for filter: unknown mode %s, expect random or hash\n", "sample_mode", mode)
+		return nil, false
+	}
+	if lvl != ACCESS {
+		s = SampleBelow(lvl, s)
+	}
+	return s, true
+}
@@ -0,0 +1,415 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+//go:build soak
+// +build soak
+
+package log4go
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The faults a soak run can inject
+type SoakFault int
+
+const (
+	SoakDiskFull    SoakFault = 1 << iota // log to a full device for a while
+	SoakDeleteFile                        // remove the log file being written
+	SoakSocketReset                       // reset the connections of the collector
+	SoakReload                            // reload the configuration
+
+	SoakAllFaults = SoakDiskFull | SoakDeleteFile | SoakSocketReset | SoakReload
+)
+
+var soakFaultNames = map[SoakFault]string{
+	SoakDiskFull:    "disk-full",
+	SoakDeleteFile:  "delete-file",
+	SoakSocketReset: "socket-reset",
+	SoakReload:      "reload",
+}
+
+func (f SoakFault) String() string {
+	if name, ok := soakFaultNames[f]; ok {
+		return name
+	}
+	return fmt.Sprintf("SoakFault(%d)", int(f))
+}
+
+// SoakConfig describes a soak run.  The zero value of a field selects its
+// default.
+type SoakConfig struct {
+	// Directory of the log files, a temporary directory (removed at the end
+	// of the run) by default
+	Dir string
+
+	// How long to log, 1 minute by default
+	Duration time.Duration
+
+	// Number of goroutines logging as fast as they can, 8 by default
+	Producers int
+
+	// The faults to inject (all by default) and the delay between two of
+	// them (250ms by default)
+	Faults        SoakFault
+	FaultInterval time.Duration
+
+	// No record logged for this long is reported as a deadlock, 10s by
+	// default
+	StallTimeout time.Duration
+
+	// Highest acceptable share of the records dropped by the socket writer,
+	// 0.5 by default
+	MaxDropRatio float64
+}
+
+// SoakReport is the outcome of a soak run
+type SoakReport struct {
+	Elapsed time.Duration
+
+	// Records logged, and records dropped by the socket writers
+	Records uint64
+	Dropped uint64
+
+	// How many times each fault was injected
+	Faults map[SoakFault]int
+
+	// Goroutines before the run and after everything was closed
+	GoroutinesBefore, GoroutinesAfter int
+
+	// Stack traces of all goroutines when a deadlock or a leak was detected
+	Stacks string
+}
+
+func (r *SoakReport) String() string {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "soak: %s, %d records (%.0f/s), %d dropped, goroutines %d -> %d",
+		r.Elapsed, r.Records, float64(r.Records)/r.Elapsed.Seconds(), r.Dropped,
+		r.GoroutinesBefore, r.GoroutinesAfter)
+
+	faults := make([]int, 0, len(r.Faults))
+	for f := range r.Faults {
+		faults = append(faults, int(f))
+	}
+	sort.Ints(faults)
+	for _, f := range faults {
+		fmt.Fprintf(buf, ", %s x%d", SoakFault(f), r.Faults[SoakFault(f)])
+	}
+	return buf.String()
+}
+
+// Soak logs from several goroutines at once for cfg.Duration, while it
+// injects faults into the writers: a full disk, deletion of the log file,
+// resets of the socket connections and reloads of the configuration.
+//
+// It returns an error if logging stalls (a deadlock), if goroutines are left
+// over once the logger is closed (a leak), or if the socket writer drops more
+// than cfg.MaxDropRatio of the records.  The report is returned in any case.
+//
+// Writers report the injected faults to stderr, so expect some noise there.
+func Soak(cfg SoakConfig) (*SoakReport, error) {
+	if cfg.Duration <= 0 {
+		cfg.Duration = time.Minute
+	}
+	if cfg.Producers <= 0 {
+		cfg.Producers = 8
+	}
+	if cfg.Faults == 0 {
+		cfg.Faults = SoakAllFaults
+	}
+	if cfg.FaultInterval <= 0 {
+		cfg.FaultInterval = 250 * time.Millisecond
+	}
+	if cfg.StallTimeout <= 0 {
+		cfg.StallTimeout = 10 * time.Second
+	}
+	if cfg.MaxDropRatio <= 0 {
+		cfg.MaxDropRatio = 0.5
+	}
+
+	report := &SoakReport{
+		Faults:           make(map[SoakFault]int),
+		GoroutinesBefore: runtime.NumGoroutine(),
+	}
+
+	if cfg.Dir == "" {
+		dir, err := ioutil.TempDir("", "log4go-soak")
+		if err != nil {
+			return report, err
+		}
+		defer os.RemoveAll(dir)
+		cfg.Dir = dir
+	}
+
+	col, err := newSoakCollector()
+	if err != nil {
+		return report, err
+	}
+
+	s := &soak{
+		cfg:      cfg,
+		log:      NewLogger(),
+		filename: filepath.Join(cfg.Dir, "soak.log"),
+		col:      col,
+		report:   report,
+	}
+	s.configure()
+
+	// Producers log while the faults reconfigure the logger
+	stop := make(chan struct{})
+	var producers sync.WaitGroup
+	for i := 0; i < cfg.Producers; i++ {
+		producers.Add(1)
+		go func(id int) {
+			defer producers.Done()
+			for n := 0; ; n++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if n%1000 == 0 {
+					s.log.Warn("soak: producer %d record %d", id, n)
+				} else {
+					s.log.Info("soak: producer %d record %d", id, n)
+				}
+				atomic.AddUint64(&s.records, 1)
+			}
+		}(i)
+	}
+
+	faults := make(chan struct{})
+	go func() {
+		defer close(faults)
+		s.inject(stop)
+	}()
+
+	start := time.Now()
+	if err := s.watch(start, stop); err != nil {
+		// The stuck goroutines can't be stopped, leave them behind
+		report.Elapsed = time.Since(start)
+		report.Records = atomic.LoadUint64(&s.records)
+		return report, err
+	}
+	close(stop)
+	producers.Wait()
+	<-faults
+
+	s.mu.Lock()
+	s.close()
+	s.mu.Unlock()
+	col.Close()
+
+	report.Elapsed = time.Since(start)
+	report.Records = atomic.LoadUint64(&s.records)
+
+	// Goroutines take a moment to exit after their channel is closed
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		report.GoroutinesAfter = runtime.NumGoroutine()
+		if report.GoroutinesAfter <= report.GoroutinesBefore || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if report.GoroutinesAfter > report.GoroutinesBefore {
+		report.Stacks = soakStacks()
+		return report, fmt.Errorf("soak: %d goroutines leaked", report.GoroutinesAfter-report.GoroutinesBefore)
+	}
+
+	if report.Records > 0 && float64(report.Dropped) > cfg.MaxDropRatio*float64(report.Records) {
+		return report, fmt.Errorf("soak: socket writer dropped %d of %d records", report.Dropped, report.Records)
+	}
+	return report, nil
+}
+
+type soak struct {
+	cfg      SoakConfig
+	mu       sync.Mutex
+	log      Logger
+	filename string
+	full     *FileLogWriter
+	col      *soakCollector
+	report   *SoakReport
+	records  uint64
+}
+
+// Wait for the end of the run, checking that records are still being logged
+func (s *soak) watch(start time.Time, stop chan struct{}) error {
+	tick := time.NewTicker(s.cfg.StallTimeout / 10)
+	defer tick.Stop()
+
+	last, progress := uint64(0), time.Now()
+	for now := range tick.C {
+		if n := atomic.LoadUint64(&s.records); n != last {
+			last, progress = n, now
+		} else if now.Sub(progress) > s.cfg.StallTimeout {
+			s.report.Stacks = soakStacks()
+			return fmt.Errorf("soak: no record logged for %s, deadlock?", now.Sub(progress))
+		}
+		if now.Sub(start) >= s.cfg.Duration {
+			break
+		}
+	}
+	return nil
+}
+
+// Inject the configured faults in turn until stop is closed
+func (s *soak) inject(stop chan struct{}) {
+	var faults []SoakFault
+	for f := SoakDiskFull; f <= SoakReload; f <<= 1 {
+		if s.cfg.Faults&f != 0 {
+			faults = append(faults, f)
+		}
+	}
+
+	tick := time.NewTicker(s.cfg.FaultInterval)
+	defer tick.Stop()
+	for i := 0; ; i++ {
+		select {
+		case <-stop:
+			return
+		case <-tick.C:
+		}
+
+		f := faults[i%len(faults)]
+		switch f {
+		case SoakDiskFull:
+			// Turns the full device on and off again on the next turn
+			s.mu.Lock()
+			if s.full == nil {
+				s.full = NewFileLogWriter("/dev/full", false, false)
+				if s.full == nil {
+					s.mu.Unlock()
+					continue
+				}
+				s.log.SetFilter("soak-full", &Filter{Level: WARNING, LogWriter: s.full})
+			} else {
+				s.log.RemoveFilter("soak-full")
+				s.full.Close()
+				s.full = nil
+			}
+			s.mu.Unlock()
+		case SoakDeleteFile:
+			os.Remove(s.filename)
+		case SoakSocketReset:
+			s.col.Reset()
+		case SoakReload:
+			s.mu.Lock()
+			s.close()
+			s.configure()
+			s.mu.Unlock()
+		}
+		s.report.Faults[f]++
+	}
+}
+
+// Set up the filters of the logger.  The socket filter goes through the XML
+// configuration, so that reloads exercise it too.
+func (s *soak) configure() {
+	s.log.Config([]byte(fmt.Sprintf(`<logging>
+  <filter enabled="true">
+    <tag>socket</tag>
+    <type>socket</type>
+    <level>INFO</level>
+    <property name="endpoint">%s</property>
+    <property name="protocol">tcp</property>
+  </filter>
+</logging>`, s.col.Addr())))
+
+	flw := NewFileLogWriter(s.filename, true, false).SetRotateSize(1 << 20).SetRotateMaxBackup(3)
+	if flw != nil {
+		s.log.SetFilter("file", &Filter{Level: INFO, LogWriter: flw})
+	}
+}
+
+// Close the logger, keeping count of the records dropped by the socket writer
+func (s *soak) close() {
+	if filt := s.log.Filter("socket"); filt != nil {
+		if slw, ok := filt.LogWriter.(*SocketLogWriter); ok {
+			defer func() { s.report.Dropped += slw.Dropped() }()
+		}
+	}
+	s.log.Close()
+	s.full = nil
+}
+
+// A TCP endpoint which discards what it receives, and can reset the
+// connections of its clients
+type soakCollector struct {
+	ln    net.Listener
+	mu    sync.Mutex
+	conns map[net.Conn]bool
+	wg    sync.WaitGroup
+}
+
+func newSoakCollector() (*soakCollector, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	c := &soakCollector{ln: ln, conns: make(map[net.Conn]bool)}
+	c.wg.Add(1)
+	go c.accept()
+	return c, nil
+}
+
+func (c *soakCollector) Addr() string {
+	return c.ln.Addr().String()
+}
+
+func (c *soakCollector) accept() {
+	defer c.wg.Done()
+	for {
+		conn, err := c.ln.Accept()
+		if err != nil {
+			return
+		}
+		c.mu.Lock()
+		c.conns[conn] = true
+		c.mu.Unlock()
+
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			io.Copy(ioutil.Discard, conn)
+			c.mu.Lock()
+			delete(c.conns, conn)
+			c.mu.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+// Reset all the connections: closing with no linger sends a RST
+func (c *soakCollector) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for conn := range c.conns {
+		if tcp, ok := conn.(*net.TCPConn); ok {
+			tcp.SetLinger(0)
+		}
+		conn.Close()
+	}
+}
+
+func (c *soakCollector) Close() {
+	c.ln.Close()
+	c.Reset()
+	c.wg.Wait()
+}
+
+func soakStacks() string {
+	buf := make([]byte, 1<<20)
+	return string(buf[:runtime.Stack(buf, true)])
+}
@@ -0,0 +1,31 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+//go:build soak
+// +build soak
+
+package log4go
+
+import (
+	"flag"
+	"testing"
+	"time"
+)
+
+var soakDuration = flag.Duration("soak.duration", time.Minute, "how long TestSoak logs")
+
+// Run with: go test -tags soak -run TestSoak -soak.duration 10m
+func TestSoak(t *testing.T) {
+	report, err := Soak(SoakConfig{Duration: *soakDuration})
+	t.Log(report)
+	if err != nil {
+		if report.Stacks != "" {
+			t.Log(report.Stacks)
+		}
+		t.Fatal(err)
+	}
+	for f := SoakDiskFull; f <= SoakReload; f <<= 1 {
+		if report.Faults[f] == 0 {
+			t.Errorf("Soak: fault %s was never injected", f)
+		}
+	}
+}
@@ -6,52 +6,289 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
-	"os"
+	"time"
 )
 
-// This log writer sends output to a socket
-type SocketLogWriter chan *LogRecord
+// Defaults for the SocketLogWriter reconnect behavior
+var (
+	// SocketMaxBuffered specifies how many records a SocketLogWriter holds
+	// back while its connection is down, before it starts to drop the oldest.
+	SocketMaxBuffered = 1024
+
+	// SocketMinBackoff and SocketMaxBackoff bound the delay between two
+	// reconnect attempts, which doubles after every failed attempt.
+	SocketMinBackoff = 100 * time.Millisecond
+	SocketMaxBackoff = 30 * time.Second
+)
+
+// This log writer sends output to a socket.  If the connection breaks, the
+// records are buffered and the writer reconnects with exponential backoff.
+type SocketLogWriter struct {
+	rec  chan *LogRecord
+	done chan struct{}
+
+	proto, hostport string
+	sock            net.Conn
+	ready           *readiness
+
+	// How the records are sent, JSON if nil, and whether their times are
+	// converted to UTC
+	layout Layout
+	utc    bool
+
+	// The character encoding of the records, UTF-8 if nil
+	transcoder Transcoder
+
+	// Records waiting for the connection to come back, and how long they
+	// stay worth sending
+	pending     []*LogRecord
+	maxbuffered int
+	ttl         recordTTL
+
+	// Reconnect backoff
+	minbackoff, maxbackoff time.Duration
+	backoff                time.Duration
+	retryAt                time.Time
+
+	writerStats
+}
 
 // This is the SocketLogWriter's output method
-func (w SocketLogWriter) LogWrite(rec *LogRecord) {
-	w <- rec
+func (w *SocketLogWriter) LogWrite(rec *LogRecord) {
+	w.rec <- rec
+}
+
+func (w *SocketLogWriter) queued() (int, int) {
+	return len(w.rec), cap(w.rec)
+}
+
+// Ready returns a channel closed once the writer has connected, or after
+// WarmupTimeout.  The records are buffered until then anyway.
+func (w *SocketLogWriter) Ready() <-chan struct{} {
+	return w.ready.ch
 }
 
-func (w SocketLogWriter) Close() {
-	close(w)
+// Close sends the records still buffered if the connection is up, and closes
+// the connection.
+func (w *SocketLogWriter) Close() {
+	close(w.rec)
+	<-w.done
 }
 
-func NewSocketLogWriter(proto, hostport string) SocketLogWriter {
+// NewSocketLogWriter creates a new LogWriter which sends the records as JSON to
+// the given endpoint.  The protocol is one of net.Dial: udp or tcp with a
+// host:port endpoint, or unix (a stream) or unixgram (datagrams) with the path
+// of the socket of a local agent as endpoint, which spares the network stack.
+//
+// Connection failures are not fatal: up to SocketMaxBuffered records are kept
+// while the writer reconnects, waiting between SocketMinBackoff and
+// SocketMaxBackoff between the attempts.  This also applies if the endpoint
+// can't be reached when the writer is created.
+func NewSocketLogWriter(proto, hostport string) *SocketLogWriter {
+	w := &SocketLogWriter{
+		rec:         make(chan *LogRecord, LogBufferLength),
+		done:        make(chan struct{}),
+		proto:       proto,
+		hostport:    hostport,
+		ready:       newReadiness(),
+		maxbuffered: SocketMaxBuffered,
+		minbackoff:  SocketMinBackoff,
+		maxbackoff:  SocketMaxBackoff,
+	}
+
 	sock, err := net.Dial(proto, hostport)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "NewSocketLogWriter(%q): %s\n", hostport, err)
-		return nil
+		w.failedConn(err)
+	} else {
+		w.sock = sock
+		w.ready.mark()
 	}
 
-	w := SocketLogWriter(make(chan *LogRecord, LogBufferLength))
+	go w.run()
 
-	go func() {
-		defer func() {
-			if sock != nil && proto == "tcp" {
-				sock.Close()
-			}
-		}()
+	return w
+}
 
-		for rec := range w {
-			// Marshall into JSON
-			js, err := json.Marshal(rec)
-			if err != nil {
-				fmt.Fprint(os.Stderr, "SocketLogWriter(%q): %s", hostport, err)
-				return
-			}
+func (w *SocketLogWriter) run() {
+	defer func() {
+		if w.sock != nil {
+			w.sock.Close()
+		}
+		close(w.done)
+	}()
 
-			_, err = sock.Write(js)
-			if err != nil {
-				fmt.Fprint(os.Stderr, "SocketLogWriter(%q): %s", hostport, err)
+	var retry <-chan time.Time
+	for {
+		select {
+		case rec, ok := <-w.rec:
+			if !ok {
+				// Last chance for the buffered records, but don't wait for a
+				// reconnect or a stuck peer
+				if w.sock != nil {
+					w.sock.SetWriteDeadline(time.Now().Add(time.Second))
+					w.send()
+				}
 				return
 			}
+			w.buffer(rec)
+			w.flush()
+		case <-retry:
+			w.flush()
 		}
-	}()
 
+		retry = nil
+		if len(w.pending) > 0 {
+			retry = time.After(w.retryAt.Sub(time.Now()))
+		}
+	}
+}
+
+// Queue a record, dropping the oldest one if the buffer is full
+func (w *SocketLogWriter) buffer(rec *LogRecord) {
+	if w.maxbuffered > 0 && len(w.pending) >= w.maxbuffered {
+		w.pending[0] = nil
+		w.pending = w.pending[1:]
+		w.drop(1)
+	}
+	w.pending = append(w.pending, rec)
+}
+
+// Connect if needed and it's time to, then send the buffered records
+func (w *SocketLogWriter) flush() {
+	if w.sock == nil {
+		if time.Now().Before(w.retryAt) {
+			return
+		}
+		sock, err := net.Dial(w.proto, w.hostport)
+		if err != nil {
+			w.failedConn(err)
+			return
+		}
+		w.sock = sock
+		w.backoff = 0
+		w.ready.mark()
+	}
+	w.send()
+}
+
+// Send the buffered records in order, until all are sent or the connection
+// fails.  The expired ones are dropped.
+func (w *SocketLogWriter) send() {
+	now := clockNow()
+	for len(w.pending) > 0 {
+		rec := w.pending[0]
+		if w.ttl.expired(rec, now) {
+			w.pending[0] = nil
+			w.pending = w.pending[1:]
+			w.drop(1)
+			continue
+		}
+
+		// Marshall into JSON, unless there is a layout
+		var js []byte
+		var err error
+		if w.utc {
+			rec = utcRecord(rec)
+		}
+		if w.layout != nil {
+			js = w.layout.Format(rec)
+		} else {
+			js, err = json.Marshal(rec)
+		}
+		if err == nil && w.transcoder != nil {
+			js, err = w.transcoder.Transcode(js)
+		}
+		if err != nil {
+			ReportError(fmt.Sprintf("SocketLogWriter(%q)", w.hostport), err)
+			w.pending[0] = nil
+			w.pending = w.pending[1:]
+			w.drop(1)
+			continue
+		}
+
+		n, err := w.sock.Write(js)
+		if err != nil {
+			w.sock.Close()
+			w.sock = nil
+			w.failedConn(err)
+			return
+		}
+		w.wrote(1, n)
+		w.pending[0] = nil
+		w.pending = w.pending[1:]
+	}
+}
+
+// Report a connection failure and schedule the next attempt
+func (w *SocketLogWriter) failedConn(err error) {
+	w.failed()
+	ReportError(fmt.Sprintf("SocketLogWriter(%q)", w.hostport), err)
+	if w.backoff == 0 {
+		w.backoff = w.minbackoff
+	} else if w.backoff *= 2; w.backoff > w.maxbackoff {
+		w.backoff = w.maxbackoff
+	}
+	w.retryAt = time.Now().Add(w.backoff)
+}
+
+// Set how many records are buffered while the connection is down (chainable),
+// 0 means unlimited.  Must be called before the first log message is written.
+func (w *SocketLogWriter) SetMaxBuffered(maxbuffered int) *SocketLogWriter {
+	w.maxbuffered = maxbuffered
+	return w
+}
+
+// Set how long the records at lvl and above stay worth sending while the
+// connection is down (chainable): when it comes back, the older ones are
+// dropped rather than replayed.  0 means forever, the default.  Call it for
+// increasing levels to keep the severe records longer, e.g.
+//
+//	w.SetRecordTTL(FINEST, time.Hour).SetRecordTTL(ERROR, 24*time.Hour)
+//
+// Must be called before the first log message is written.
+func (w *SocketLogWriter) SetRecordTTL(lvl Level, ttl time.Duration) *SocketLogWriter {
+	w.ttl.set(lvl, ttl)
 	return w
 }
+
+// Set the layout of the records, which are sent as JSON without one
+// (chainable).  Must be called before the first log message is written.
+func (w *SocketLogWriter) SetLayout(layout Layout) *SocketLogWriter {
+	w.layout = layout
+	return w
+}
+
+// Set the character encoding of the records, UTF-8 if nil (chainable).  Must be
+// called before the first log message is written.
+func (w *SocketLogWriter) SetTranscoder(t Transcoder) *SocketLogWriter {
+	w.transcoder = t
+	return w
+}
+
+// Send the times in UTC rather than in the local time zone (chainable).  Must
+// be called before the first log message is written.
+func (w *SocketLogWriter) SetUTC(utc bool) *SocketLogWriter {
+	w.utc = utc
+	return w
+}
+
+// Set the bounds of the delay between reconnect attempts (chainable).  Must be
+// called before the first log message is written.  A zero or negative min is
+// SocketMinBackoff, so that a dead endpoint isn't dialed in a loop, and a max
+// below min is min.
+func (w *SocketLogWriter) SetReconnectBackoff(min, max time.Duration) *SocketLogWriter {
+	if min <= 0 {
+		min = SocketMinBackoff
+	}
+	if max < min {
+		max = min
+	}
+	w.minbackoff, w.maxbackoff = min, max
+	return w
+}
+
+// Dropped returns how many records have been dropped because the buffer was
+// full while the connection was down, or because they expired.
+func (w *SocketLogWriter) Dropped() uint64 {
+	return w.Stats().Dropped
+}
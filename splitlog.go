@@ -0,0 +1,315 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"container/list"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Defaults for the SplitLogWriter file descriptor budget
+var (
+	// SplitMaxOpen specifies how many files a SplitLogWriter keeps open at
+	// most: opening another one closes the least recently used.
+	SplitMaxOpen = 64
+
+	// SplitIdleTimeout specifies after how long without a record a file of a
+	// SplitLogWriter is closed, 0 means never.
+	SplitIdleTimeout = 5 * time.Minute
+)
+
+// This log writer splits the records into several files, one per key, e.g.
+// per package or per tenant.  The files are opened on demand, within a budget
+// of file descriptors: the least recently used file is closed when the budget
+// is reached (an eviction, counted in the Evictions of the stats), and the
+// idle ones are closed, so that logging never exhausts the ulimit.
+type SplitLogWriter struct {
+	rec  chan *LogRecord
+	done chan struct{}
+
+	// The name of the file of a key is pattern with %s replaced by the key
+	pattern string
+	key     func(rec *LogRecord) string
+
+	// The permissions of the new files and directories
+	filemode, dirmode os.FileMode
+
+	format     string
+	timeformat string
+	layout     Layout
+	utc        bool
+
+	// The open files, most recently used first
+	files   map[string]*list.Element
+	lru     *list.List
+	nopen   int64 // the length of lru, read by OpenFiles
+	maxopen int
+	idle    time.Duration
+
+	writerStats
+}
+
+// An open file of a SplitLogWriter
+type splitFile struct {
+	key  string
+	file *os.File
+	last time.Time
+}
+
+// This is the SplitLogWriter's output method
+func (w *SplitLogWriter) LogWrite(rec *LogRecord) {
+	w.rec <- rec
+}
+
+func (w *SplitLogWriter) queued() (int, int) {
+	return len(w.rec), cap(w.rec)
+}
+
+// Close writes the records still queued and closes the files.
+func (w *SplitLogWriter) Close() {
+	close(w.rec)
+	<-w.done
+}
+
+// NewSplitLogWriter creates a new LogWriter which writes each record to the
+// file named after pattern with %s replaced by the key of the record, e.g.
+//
+//	NewSplitLogWriter("logs/%s.log", SplitBySource)
+//
+// The records without a key go to the file of "default".  The directories are
+// created as needed.
+func NewSplitLogWriter(pattern string, key func(rec *LogRecord) string) *SplitLogWriter {
+	w := &SplitLogWriter{
+		rec:      make(chan *LogRecord, LogBufferLength),
+		done:     make(chan struct{}),
+		pattern:  pattern,
+		key:      key,
+		filemode: FileMode,
+		dirmode:  os.ModePerm,
+		format:   "[%D %T] [%L] (%S) %M",
+		files:    make(map[string]*list.Element),
+		lru:      list.New(),
+		maxopen:  SplitMaxOpen,
+		idle:     SplitIdleTimeout,
+	}
+	go w.run()
+	return w
+}
+
+func (w *SplitLogWriter) run() {
+	defer func() {
+		for w.lru.Len() > 0 {
+			w.closeFile(w.lru.Back())
+		}
+		close(w.done)
+	}()
+
+	// The idle files are looked for from the first record, when the settings
+	// are known
+	var tick <-chan time.Time
+	for {
+		select {
+		case rec, ok := <-w.rec:
+			if !ok {
+				return
+			}
+			if tick == nil && w.idle > 0 {
+				ticker := time.NewTicker(w.idle / 2)
+				defer ticker.Stop()
+				tick = ticker.C
+			}
+			w.write(rec)
+		case now := <-tick:
+			w.closeIdle(now)
+		}
+	}
+}
+
+// Write a record to the file of its key
+func (w *SplitLogWriter) write(rec *LogRecord) {
+	key := sanitizeKey(w.key(rec))
+	sf, err := w.open(key)
+	if err != nil {
+		ReportError(fmt.Sprintf("SplitLogWriter(%q)", w.pattern), err)
+		w.failed()
+		return
+	}
+
+	if w.utc {
+		rec = utcRecord(rec)
+	}
+	var out []byte
+	if w.layout != nil {
+		out = w.layout.Format(rec)
+	} else {
+		out = []byte(formatLogRecord(w.format, w.timeformat, rec))
+	}
+	n, err := sf.file.Write(out)
+	if err != nil {
+		ReportError(fmt.Sprintf("SplitLogWriter(%q)", w.pattern), err)
+		w.failed()
+		return
+	}
+	w.wrote(1, n)
+}
+
+// The open file of key, opened if needed within the budget
+func (w *SplitLogWriter) open(key string) (*splitFile, error) {
+	if e, ok := w.files[key]; ok {
+		w.lru.MoveToFront(e)
+		sf := e.Value.(*splitFile)
+		sf.last = time.Now()
+		return sf, nil
+	}
+
+	for w.maxopen > 0 && w.lru.Len() >= w.maxopen {
+		w.closeFile(w.lru.Back())
+		w.evicted()
+	}
+
+	filename := w.filename(key)
+	if dir := filepath.Dir(filename); dir != "" {
+		os.MkdirAll(dir, os.ModeDir|w.dirmode)
+	}
+	fd, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, w.filemode)
+	if err != nil {
+		return nil, err
+	}
+	sf := &splitFile{key: key, file: fd, last: time.Now()}
+	w.files[key] = w.lru.PushFront(sf)
+	atomic.AddInt64(&w.nopen, 1)
+	return sf, nil
+}
+
+func (w *SplitLogWriter) closeFile(e *list.Element) {
+	sf := w.lru.Remove(e).(*splitFile)
+	delete(w.files, sf.key)
+	sf.file.Close()
+	atomic.AddInt64(&w.nopen, -1)
+}
+
+// Close the files without a record for the idle timeout
+func (w *SplitLogWriter) closeIdle(now time.Time) {
+	for e := w.lru.Back(); e != nil; {
+		prev := e.Prev()
+		if now.Sub(e.Value.(*splitFile).last) < w.idle {
+			break
+		}
+		w.closeFile(e)
+		e = prev
+	}
+}
+
+// The name of the file of key
+func (w *SplitLogWriter) filename(key string) string {
+	return strings.Replace(w.pattern, "%s", key, -1)
+}
+
+// OpenFiles returns how many files are open.
+func (w *SplitLogWriter) OpenFiles() int {
+	return int(atomic.LoadInt64(&w.nopen))
+}
+
+// Set the logging format (chainable).  Must be called before the first log
+// message is written.
+func (w *SplitLogWriter) SetFormat(format string) *SplitLogWriter {
+	w.format = format
+	return w
+}
+
+// Set the time format of %Z, a preset name or a layout (see FormatTime)
+// (chainable).  Must be called before the first log message is written.
+func (w *SplitLogWriter) SetTimeFormat(timeformat string) *SplitLogWriter {
+	w.timeformat = timeformat
+	return w
+}
+
+// Set the layout of the records, which replaces the format (chainable).  Must
+// be called before the first log message is written.
+func (w *SplitLogWriter) SetLayout(layout Layout) *SplitLogWriter {
+	w.layout = layout
+	return w
+}
+
+// Print the times in UTC rather than in the local time zone (chainable).  Must
+// be called before the first log message is written.
+func (w *SplitLogWriter) SetUTC(utc bool) *SplitLogWriter {
+	w.utc = utc
+	return w
+}
+
+// Set how many files are kept open at most, 0 means unlimited (chainable).
+// Must be called before the first log message is written.
+func (w *SplitLogWriter) SetMaxOpen(maxopen int) *SplitLogWriter {
+	w.maxopen = maxopen
+	return w
+}
+
+// Set after how long without a record a file is closed, 0 means never
+// (chainable).  Must be called before the first log message is written.
+func (w *SplitLogWriter) SetIdleTimeout(idle time.Duration) *SplitLogWriter {
+	w.idle = idle
+	return w
+}
+
+// Set the permissions of the new files, FileMode by default (chainable).  Must
+// be called before the first log message is written.
+func (w *SplitLogWriter) SetFileMode(mode os.FileMode) *SplitLogWriter {
+	w.filemode = mode.Perm()
+	return w
+}
+
+// Set the permissions of the new directories, 0777 by default (chainable).
+// The umask applies.  Must be called before the first log message is written.
+func (w *SplitLogWriter) SetDirMode(mode os.FileMode) *SplitLogWriter {
+	w.dirmode = mode.Perm()
+	return w
+}
+
+// SplitBySource is a key for a SplitLogWriter: the package of the source of
+// the record, e.g. "github.com/kimiazhu/log4go" for
+// "github.com/kimiazhu/log4go.(*Logger).Info:42".
+func SplitBySource(rec *LogRecord) string {
+	src := rec.Source
+	if i := strings.LastIndex(src, ":"); i >= 0 {
+		src = src[:i]
+	}
+	slash := strings.LastIndex(src, "/")
+	if i := strings.Index(src[slash+1:], "."); i >= 0 {
+		src = src[:slash+1+i]
+	}
+	return src
+}
+
+// SplitByField returns a key for a SplitLogWriter: the value of the field of
+// the record named name, e.g. "tenant".
+func SplitByField(name string) func(rec *LogRecord) string {
+	return func(rec *LogRecord) string {
+		for _, f := range rec.Fields {
+			if f.Key == name {
+				return fmt.Sprint(f.Value)
+			}
+		}
+		return ""
+	}
+}
+
+// Make a key safe as a file name: no directory, no parent
+func sanitizeKey(key string) string {
+	key = strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', 0:
+			return '_'
+		}
+		return r
+	}, key)
+	if key == "" || key == "." || key == ".." {
+		return "default"
+	}
+	return key
+}
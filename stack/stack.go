@@ -0,0 +1,137 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+// Package stack captures the call stacks log4go appends to the records, and
+// formats them in full, one frame on two lines like a panic, or condensed on
+// a single line.
+package stack
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// A Frame is a function call of a stack.
+type Frame struct {
+	Function string // The package path and the name, e.g. net/http.(*Server).Serve
+	File     string
+	Line     int
+	PC       uintptr
+}
+
+// Callers returns the frames of the stack of its caller, skip being the
+// number of frames to leave out above it, up to depth frames (all of them if
+// depth is not positive).
+func Callers(skip, depth int) []Frame {
+	pcs := make([]uintptr, 64)
+	for {
+		n := runtime.Callers(skip+2, pcs)
+		if n < len(pcs) || (depth > 0 && n >= depth) {
+			pcs = pcs[:n]
+			break
+		}
+		pcs = make([]uintptr, 2*len(pcs))
+	}
+
+	var frames []Frame
+	iter := runtime.CallersFrames(pcs)
+	for {
+		f, more := iter.Next()
+		frames = append(frames, Frame{f.Function, f.File, f.Line, f.PC})
+		if !more || (depth > 0 && len(frames) == depth) {
+			break
+		}
+	}
+	return frames
+}
+
+// TrimPackage drops the frames at the top of the stack which are in the
+// package pkg, its path, e.g. those of a logging library above its caller.
+// The frames of the tests of the package are kept.
+func TrimPackage(frames []Frame, pkg string) []Frame {
+	for len(frames) > 0 && inPackage(frames[0], pkg) {
+		frames = frames[1:]
+	}
+	return frames
+}
+
+// Whether f is in the package pkg, outside of its tests
+func inPackage(f Frame, pkg string) bool {
+	if strings.HasSuffix(f.File, "_test.go") || !strings.HasPrefix(f.Function, pkg) {
+		return false
+	}
+	rest := f.Function[len(pkg):]
+	return strings.HasPrefix(rest, ".")
+}
+
+// Package returns the path of the package of a function, as
+// runtime.FuncForPC names it: "net/http" for "net/http.(*Server).Serve".
+func Package(function string) string {
+	slash := strings.LastIndex(function, "/")
+	if dot := strings.Index(function[slash+1:], "."); dot >= 0 {
+		return function[:slash+1+dot]
+	}
+	return function
+}
+
+// A Format is a way to print a stack.
+type Format int
+
+const (
+	// Each frame on two lines, the file and the line, then the function,
+	// like the stacks of golib:
+	//
+	//	/src/app/db.go:42 (0x4a5b6c)
+	//		app.(*DB).Query
+	Full Format = iota
+
+	// All the frames on a single line, the innermost first, with the
+	// function without its package path and the base name of its file:
+	//
+	//	app.(*DB).Query(db.go:42) < main.main(main.go:10)
+	Condensed
+)
+
+var formatNames = []string{"full", "condensed"}
+
+func (f Format) String() string {
+	if f < 0 || int(f) >= len(formatNames) {
+		return "unknown"
+	}
+	return formatNames[f]
+}
+
+// ParseFormat returns the format named name, full or condensed.
+func ParseFormat(name string) (Format, bool) {
+	for i, n := range formatNames {
+		if strings.EqualFold(n, name) {
+			return Format(i), true
+		}
+	}
+	return Full, false
+}
+
+// Sprint formats frames, with a trailing newline in the Full format.
+func (f Format) Sprint(frames []Frame) string {
+	buf := new(bytes.Buffer)
+	for i, frame := range frames {
+		if f == Condensed {
+			if i > 0 {
+				buf.WriteString(" < ")
+			}
+			fmt.Fprintf(buf, "%s(%s:%d)", frame.Function[strings.LastIndex(frame.Function, "/")+1:], filepath.Base(frame.File), frame.Line)
+			continue
+		}
+		fmt.Fprintf(buf, "%s:%d (0x%x)\n\t%s\n", frame.File, frame.Line, frame.PC, frame.Function)
+	}
+	return buf.String()
+}
+
+// CallStack returns the stack of its caller in the Full format, skip being
+// the number of frames to leave out above it, as golib's stack.CallStack
+// does.
+func CallStack(skip int) string {
+	return Full.Sprint(Callers(skip+1, 0))
+}
@@ -0,0 +1,63 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package stack
+
+import (
+	"strings"
+	"testing"
+)
+
+func inner(depth int) []Frame {
+	return Callers(0, depth)
+}
+
+func TestCallers(t *testing.T) {
+	frames := inner(0)
+	if len(frames) < 3 || !strings.HasSuffix(frames[0].Function, "stack.inner") || !strings.HasSuffix(frames[1].Function, "stack.TestCallers") {
+		t.Fatalf("Callers: got %+v", frames)
+	}
+	if !strings.HasSuffix(frames[0].File, "stack_test.go") || frames[0].Line == 0 {
+		t.Errorf("Callers: frame %+v", frames[0])
+	}
+	if frames := inner(2); len(frames) != 2 {
+		t.Errorf("Callers(0, 2): got %d frames", len(frames))
+	}
+
+	// The package of the tests is kept, the others are trimmed
+	pkg := Package(frames[0].Function)
+	if pkg != "github.com/kimiazhu/log4go/stack" {
+		t.Errorf("Package(%s) = %s", frames[0].Function, pkg)
+	}
+	if trimmed := TrimPackage(frames, pkg); len(trimmed) != len(frames) {
+		t.Errorf("TrimPackage dropped the frames of the tests")
+	}
+	lib := []Frame{{Function: "example.com/lib.(*T).log", File: "lib.go"}, {Function: "example.com/lib.Log", File: "lib.go"}, {Function: "example.com/lib/sub.Call", File: "sub.go"}}
+	if trimmed := TrimPackage(lib, "example.com/lib"); len(trimmed) != 1 || trimmed[0].Function != "example.com/lib/sub.Call" {
+		t.Errorf("TrimPackage: got %+v", trimmed)
+	}
+}
+
+func TestFormats(t *testing.T) {
+	frames := []Frame{
+		{Function: "example.com/app/db.(*DB).Query", File: "/src/app/db/db.go", Line: 42, PC: 0x4a5b6c},
+		{Function: "main.main", File: "/src/app/main.go", Line: 10, PC: 0x401000},
+	}
+	if got, want := Full.Sprint(frames), "/src/app/db/db.go:42 (0x4a5b6c)\n\texample.com/app/db.(*DB).Query\n/src/app/main.go:10 (0x401000)\n\tmain.main\n"; got != want {
+		t.Errorf("Full: got %q, want %q", got, want)
+	}
+	if got, want := Condensed.Sprint(frames), "db.(*DB).Query(db.go:42) < main.main(main.go:10)"; got != want {
+		t.Errorf("Condensed: got %q, want %q", got, want)
+	}
+
+	for _, name := range []string{"full", "Condensed"} {
+		if f, ok := ParseFormat(name); !ok || !strings.EqualFold(f.String(), name) {
+			t.Errorf("ParseFormat(%s) = %s, %v", name, f, ok)
+		}
+	}
+	if _, ok := ParseFormat("short"); ok {
+		t.Errorf("ParseFormat(short) accepted")
+	}
+	if !strings.Contains(CallStack(0), "stack.TestFormats") {
+		t.Errorf("CallStack: %q", CallStack(0))
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"fmt"
+	"github.com/kimiazhu/log4go/stack"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// DumpState writes the internal state of the logger to out: its filters with
+// their writer, level, queue and counters, the settings of the package, the
+// last failures reported by the writers, and the stacks of all the
+// goroutines.  It's meant to debug a program whose logging stalls.
+func (log Logger) DumpState(out io.Writer) error {
+	const layout = "2006/01/02 15:04:05.000 MST"
+	w := &stateWriter{out: out}
+
+	filters := log.filters()
+	tags := make([]string, 0, len(filters))
+	for tag := range filters {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	w.printf("=== log4go state at %s: %d filters\n", time.Now().Format(layout), len(tags))
+	for _, tag := range tags {
+		filt := filters[tag]
+		w.printf("filter %q: %T, level %s", tag, filt.LogWriter, levelName(filt.CurrentLevel()))
+		if filt.Access != AccessInclude {
+			w.printf(", access %s", filt.Access)
+		}
+		if filt.StackLevel != ACCESS {
+			w.printf(", stacktrace_level %s", levelName(filt.StackLevel))
+			if filt.StackFormat != stack.Full || filt.StackDepth > 0 {
+				w.printf(" (%s, depth %d)", filt.StackFormat, filt.StackDepth)
+			}
+		}
+		if len(filt.Excludes) > 0 {
+			w.printf(", excludes %q", filt.Excludes)
+		}
+		if filt.hasPredicate() {
+			w.printf(", predicate")
+		}
+		w.printf("\n")
+		if q, ok := filt.LogWriter.(queueStatus); ok {
+			n, capacity := q.queued()
+			w.printf("  queue: %d of %d records\n", n, capacity)
+		}
+		if sw, ok := filt.LogWriter.(StatsWriter); ok {
+			s := sw.Stats()
+			w.printf("  stats: %d written, %d bytes, %d dropped, %d errors, %d rotations, %d evictions\n", s.Written, s.Bytes, s.Dropped, s.Errors, s.Rotations, s.Evictions)
+		}
+	}
+
+	w.printf("\n=== Settings\n")
+	w.printf("block watchdog: %s\n", time.Duration(atomic.LoadInt64(&watchdogTimeout)))
+	w.printf("cost accounting: %t\n", atomic.LoadInt32(&costAccounting) != 0)
+
+	recentErrors.Lock()
+	errs := append([]writerError(nil), recentErrors.errs...)
+	recentErrors.Unlock()
+	w.printf("\n=== Last %d writer errors\n", len(errs))
+	for _, e := range errs {
+		w.printf("%s %s: %s\n", e.when.Format(layout), e.writer, e.err)
+	}
+
+	summary := log.ErrorSummary()
+	if len(summary) > 10 {
+		summary = summary[:10]
+	}
+	w.printf("\n=== Last %d groups of errors\n", len(summary))
+	for _, g := range summary {
+		w.printf("%s %s x%d since %s: %s (%s)\n", g.LastSeen.Format(layout), g.Level, g.Count, g.FirstSeen.Format(layout), g.Template, g.Source)
+	}
+
+	w.printf("\n=== Goroutines\n")
+	w.write(allStacks())
+	w.printf("\n=== End of state\n")
+	return w.err
+}
+
+// Wrapper for (*Logger).DumpState
+func DumpState(out io.Writer) error {
+	return Global.DumpState(out)
+}
+
+// DumpStateOnSignal writes the state of the global logger (see DumpState) to
+// out whenever the program receives one of sigs, SIGQUIT if there are none.
+// Unlike the default behavior of SIGQUIT, the program keeps running.  stop
+// restores the default behavior.
+func DumpStateOnSignal(out io.Writer, sigs ...os.Signal) (stop func()) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGQUIT}
+	}
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, sigs...)
+	go func() {
+		for {
+			select {
+			case <-ch:
+				DumpState(out)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
+
+// Writes to out until the first error, which it keeps
+type stateWriter struct {
+	out io.Writer
+	err error
+}
+
+func (w *stateWriter) printf(format string, args ...interface{}) {
+	if w.err == nil {
+		_, w.err = fmt.Fprintf(w.out, format, args...)
+	}
+}
+
+func (w *stateWriter) write(b []byte) {
+	if w.err == nil {
+		_, w.err = w.out.Write(b)
+	}
+}
@@ -2,21 +2,49 @@ package support
 
 import (
 	"bufio"
+	"bytes"
 	"os"
 	"time"
 )
 
+// FileTimes are the times of a file, as far as the system tells them.
+type FileTimes struct {
+	Access time.Time // The last access
+	Change time.Time // The last change of the inode on unix, the creation on windows
+	Modify time.Time // The last write
+	Birth  time.Time // The creation, zero where the system doesn't tell it (linux)
+}
+
 type support interface {
-	StatTimes(filepath string) (atime, ctime, mtime time.Time, err error)
+	FileTimes(fi os.FileInfo) FileTimes
 }
 
-var _support support
+var _support support = supportOther{}
+
+// GetFileTimes returns the times of the file at the given filepath.
+func GetFileTimes(filepath string) (FileTimes, error) {
+	fi, err := os.Stat(filepath)
+	if err != nil {
+		return FileTimes{}, err
+	}
+	return _support.FileTimes(fi), nil
+}
 
 // GetStatTime returns the times properties corresponding to the given filepath
 // NOTE: the atime under windows system may not correct, it maybe the same with
 // ctime. (2016-02-26 golang version 1.5.3)
 func GetStatTime(filepath string) (atime, ctime, mtime time.Time, err error) {
-	return _support.StatTimes(filepath)
+	t, err := GetFileTimes(filepath)
+	return t.Access, t.Change, t.Modify, err
+}
+
+// The systems without an implementation of their own only have the time of
+// the last write
+type supportOther struct{}
+
+func (supportOther) FileTimes(fi os.FileInfo) FileTimes {
+	mtime := fi.ModTime()
+	return FileTimes{Access: mtime, Change: mtime, Modify: mtime}
 }
 
 func GetLines(filepath string) int {
@@ -39,6 +67,34 @@ func GetLines(filepath string) int {
 	return count + 1
 }
 
+// CountLines returns the number of the lines of the file at the given
+// filepath, a last line without a newline included, or 0 if it can't be read.
+func CountLines(filepath string) int {
+	fd, err := os.Open(filepath)
+	if err != nil {
+		return 0
+	}
+	defer fd.Close()
+
+	count := 0
+	last := byte('\n')
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := fd.Read(buf)
+		if n > 0 {
+			count += bytes.Count(buf[:n], []byte{'\n'})
+			last = buf[n-1]
+		}
+		if err != nil {
+			break
+		}
+	}
+	if last != '\n' {
+		count++
+	}
+	return count
+}
+
 func GetSize(filepath string) int64 {
 	if fi, err := os.Stat(filepath); err == nil {
 		return fi.Size()
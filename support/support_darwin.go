@@ -12,14 +12,12 @@ func init() {
 
 type supportDarwin struct{}
 
-func (t *supportDarwin) StatTimes(filepath string) (atime, ctime, mtime time.Time, err error) {
-	fi, err := os.Stat(filepath)
-	if err != nil {
-		return
+func (t *supportDarwin) FileTimes(fi os.FileInfo) FileTimes {
+	times := FileTimes{Modify: fi.ModTime()}
+	if stat, ok := fi.Sys().(*syscall.Stat_t); ok {
+		times.Access = time.Unix(int64(stat.Atimespec.Sec), int64(stat.Atimespec.Nsec))
+		times.Change = time.Unix(int64(stat.Ctimespec.Sec), int64(stat.Ctimespec.Nsec))
+		times.Birth = time.Unix(int64(stat.Birthtimespec.Sec), int64(stat.Birthtimespec.Nsec))
 	}
-	mtime = fi.ModTime()
-	stat := fi.Sys().(*syscall.Stat_t)
-	atime = time.Unix(int64(stat.Atimespec.Sec), int64(stat.Atimespec.Nsec))
-	ctime = time.Unix(int64(stat.Ctimespec.Sec), int64(stat.Ctimespec.Nsec))
-	return
+	return times
 }
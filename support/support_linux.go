@@ -12,14 +12,12 @@ func init() {
 
 type supportLinux struct{}
 
-func (t *supportLinux) StatTimes(filepath string) (atime, ctime, mtime time.Time, err error) {
-	fi, err := os.Stat(filepath)
-	if err != nil {
-		return
+// The birth time needs statx, which the syscall package doesn't have
+func (t *supportLinux) FileTimes(fi os.FileInfo) FileTimes {
+	times := FileTimes{Modify: fi.ModTime()}
+	if stat, ok := fi.Sys().(*syscall.Stat_t); ok {
+		times.Access = time.Unix(int64(stat.Atim.Sec), int64(stat.Atim.Nsec))
+		times.Change = time.Unix(int64(stat.Ctim.Sec), int64(stat.Ctim.Nsec))
 	}
-	mtime = fi.ModTime()
-	stat := fi.Sys().(*syscall.Stat_t)
-	atime = time.Unix(int64(stat.Atim.Sec), int64(stat.Atim.Nsec))
-	ctime = time.Unix(int64(stat.Ctim.Sec), int64(stat.Ctim.Nsec))
-	return
+	return times
 }
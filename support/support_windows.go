@@ -12,15 +12,12 @@ func init() {
 
 type supportWin struct{}
 
-func (t *supportWin) StatTimes(filepath string) (atime, ctime, mtime time.Time, err error) {
-	fi, err := os.Lstat(filepath)
-	if err != nil {
-		return
+func (t *supportWin) FileTimes(fi os.FileInfo) FileTimes {
+	times := FileTimes{Modify: fi.ModTime()}
+	if data, ok := fi.Sys().(*syscall.Win32FileAttributeData); ok {
+		times.Access = time.Unix(0, data.LastAccessTime.Nanoseconds())
+		times.Change = time.Unix(0, data.CreationTime.Nanoseconds())
+		times.Birth = times.Change
 	}
-	data := fi.Sys().(*syscall.Win32FileAttributeData)
-	atime = time.Unix(0, data.LastAccessTime.Nanoseconds())
-	ctime = time.Unix(0, data.CreationTime.Nanoseconds())
-	mtime = fi.ModTime()
-	err = nil
-	return
+	return times
 }
@@ -0,0 +1,104 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Talker is the log volume of one source package
+type Talker struct {
+	Package string `json:"package"`
+	Records uint64 `json:"records"`
+	Bytes   uint64 `json:"bytes"`
+}
+
+// Per package counters, only updated while cost accounting is on
+var (
+	costAccounting int32
+	talkersMu      sync.RWMutex
+	talkers        = make(map[string]*Talker)
+)
+
+// SetCostAccounting turns counting the records and bytes logged per source
+// package on or off.  It is off by default; the counters are kept when it is
+// turned off.
+func SetCostAccounting(on bool) {
+	if on {
+		atomic.StoreInt32(&costAccounting, 1)
+	} else {
+		atomic.StoreInt32(&costAccounting, 0)
+	}
+}
+
+// ResetTalkers clears the counters of all packages
+func ResetTalkers() {
+	talkersMu.Lock()
+	talkers = make(map[string]*Talker)
+	talkersMu.Unlock()
+}
+
+// TopTalkers returns the n packages which logged the most bytes, with the
+// most first.  All packages are returned if n <= 0.  The bytes are those of
+// the messages, before any formatting by the writers.
+func TopTalkers(n int) []Talker {
+	talkersMu.RLock()
+	top := make([]Talker, 0, len(talkers))
+	for _, t := range talkers {
+		top = append(top, Talker{
+			Package: t.Package,
+			Records: atomic.LoadUint64(&t.Records),
+			Bytes:   atomic.LoadUint64(&t.Bytes),
+		})
+	}
+	talkersMu.RUnlock()
+
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Bytes != top[j].Bytes {
+			return top[i].Bytes > top[j].Bytes
+		}
+		return top[i].Package < top[j].Package
+	})
+	if n > 0 && n < len(top) {
+		top = top[:n]
+	}
+	return top
+}
+
+// Count a record against the package of its source
+func account(rec *LogRecord) {
+	if atomic.LoadInt32(&costAccounting) == 0 {
+		return
+	}
+
+	pkg := sourcePackage(rec.Source)
+	talkersMu.RLock()
+	t, ok := talkers[pkg]
+	talkersMu.RUnlock()
+	if !ok {
+		talkersMu.Lock()
+		if t, ok = talkers[pkg]; !ok {
+			t = &Talker{Package: pkg}
+			talkers[pkg] = t
+		}
+		talkersMu.Unlock()
+	}
+	atomic.AddUint64(&t.Records, 1)
+	atomic.AddUint64(&t.Bytes, uint64(len(rec.Message)))
+}
+
+// Extract the package from a source such as
+// "github.com/user/pkg.(*Type).Method:42"
+func sourcePackage(src string) string {
+	if i := strings.LastIndexByte(src, ':'); i >= 0 {
+		src = src[:i]
+	}
+	slash := strings.LastIndexByte(src, '/')
+	if i := strings.IndexByte(src[slash+1:], '.'); i >= 0 {
+		src = src[:slash+1+i]
+	}
+	return src
+}
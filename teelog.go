@@ -0,0 +1,159 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"fmt"
+	"strings"
+)
+
+func init() {
+	writerFactories["tee"] = func(excludes []string, props []Property, enabled bool) (LogWriter, bool) {
+		return xmlToTeeLogWriter(excludes, props, enabled)
+	}
+}
+
+// This log writer hands each record to several writers, each with its own
+// format or layout, e.g. a console in the default format and a file of JSON
+// lines: a single filter serves them all, and the level, the excludes, the
+// sampler and the redactor of the filter are applied once.
+type TeeLogWriter struct {
+	writers []LogWriter
+}
+
+// NewTeeLogWriter creates a new LogWriter which writes the records to all of
+// writers, in order.  It owns them: closing it closes them.
+func NewTeeLogWriter(writers ...LogWriter) *TeeLogWriter {
+	return &TeeLogWriter{writers: writers}
+}
+
+// Add another writer (chainable).  Must be called before the first log
+// message is written.
+func (w *TeeLogWriter) Add(writer LogWriter) *TeeLogWriter {
+	w.writers = append(w.writers, writer)
+	return w
+}
+
+// Writers returns the writers the records are written to.
+func (w *TeeLogWriter) Writers() []LogWriter {
+	return append([]LogWriter(nil), w.writers...)
+}
+
+// This is the TeeLogWriter's output method
+func (w *TeeLogWriter) LogWrite(rec *LogRecord) {
+	for _, writer := range w.writers {
+		writer.LogWrite(rec)
+	}
+}
+
+// Close closes the writers, in order.
+func (w *TeeLogWriter) Close() {
+	for _, writer := range w.writers {
+		writer.Close()
+	}
+}
+
+// Flush flushes the writers which buffer the records, see Flusher.
+func (w *TeeLogWriter) Flush() {
+	for _, writer := range w.writers {
+		if f, ok := writer.(Flusher); ok {
+			f.Flush()
+		}
+	}
+}
+
+// Stats returns the sums of the counters of the writers which keep some.  A
+// record counts once per writer.
+func (w *TeeLogWriter) Stats() WriterStats {
+	var sum WriterStats
+	for _, writer := range w.writers {
+		sw, ok := writer.(StatsWriter)
+		if !ok {
+			continue
+		}
+		s := sw.Stats()
+		sum.Written += s.Written
+		sum.Bytes += s.Bytes
+		sum.Dropped += s.Dropped
+		sum.Errors += s.Errors
+		sum.Rotations += s.Rotations
+		sum.Evictions += s.Evictions
+	}
+	return sum
+}
+
+// Ready returns a channel closed once all the writers which need a warm-up are
+// ready, see ReadyWriter.
+func (w *TeeLogWriter) Ready() <-chan struct{} {
+	return readyOf(w.writers)
+}
+
+// The fullest queue of the writers
+func (w *TeeLogWriter) queued() (int, int) {
+	n, capacity := 0, 0
+	for _, writer := range w.writers {
+		q, ok := writer.(queueStatus)
+		if !ok {
+			continue
+		}
+		if qn, qcap := q.queued(); capacity == 0 || qn*capacity > n*qcap {
+			n, capacity = qn, qcap
+		}
+	}
+	return n, capacity
+}
+
+// Build the writers of a tee filter from its properties, in order: each
+// <property name="writer">type</property> starts a writer of that type, which
+// takes the properties up to the next writer, e.g.
+//
+//	<property name="writer">console</property>
+//	<property name="format">[%D %T] [%L] %M</property>
+//	<property name="writer">file</property>
+//	<property name="filename">app.json</property>
+//	<property name="format">json</property>
+func xmlToTeeLogWriter(excludes []string, props []Property, enabled bool) (*TeeLogWriter, bool) {
+	type teeChild struct {
+		typ   string
+		props []Property
+	}
+
+	// Parse properties
+	var children []*teeChild
+	for _, prop := range props {
+		if prop.Name == "writer" {
+			children = append(children, &teeChild{typ: strings.Trim(prop.Value, " \r\n")})
+			continue
+		}
+		if len(children) == 0 {
+			fmt.Fprintf(configOut, "LoadConfiguration: Warning: Property \"%s\" before the first writer of tee filter\n", prop.Name)
+			continue
+		}
+		child := children[len(children)-1]
+		child.props = append(child.props, prop)
+	}
+
+	// Check properties
+	if len(children) == 0 {
+		fmt.Fprintf(configOut, "LoadConfiguration: Error: Required property \"%s\" for tee filter\n", "writer")
+		return nil, false
+	}
+
+	tee := NewTeeLogWriter()
+	for _, child := range children {
+		writer, ok := xmlToChildWriter("tee", "writer", child.typ, excludes, child.props, enabled)
+		if !ok {
+			tee.Close()
+			return nil, false
+		}
+		if enabled {
+			tee.Add(writer)
+		}
+	}
+
+	// If it's disabled, we're just checking syntax
+	if !enabled {
+		return nil, true
+	}
+	return tee, true
+}
@@ -3,27 +3,38 @@
 package log4go
 
 import (
-	"fmt"
+	"bytes"
 	"io"
 	"os"
 	"time"
 )
 
 var stdout io.Writer = os.Stdout
+var stderr io.Writer = os.Stderr
 
 // This is the standard writer that prints to standard output.
 type ConsoleLogWriter struct {
-	format string
-	w      chan *LogRecord
+	format     string
+	timeformat string
+	layout     Layout
+	utc        bool
+	w          chan *LogRecord
+	writerStats
 }
 
 // This creates a new ConsoleLogWriter
 func NewConsoleLogWriter() *ConsoleLogWriter {
+	return NewConsoleLogWriterTo(stdout)
+}
+
+// NewConsoleLogWriterTo creates a new ConsoleLogWriter which prints to out
+// instead of standard output, e.g. os.Stderr.
+func NewConsoleLogWriterTo(out io.Writer) *ConsoleLogWriter {
 	consoleWriter := &ConsoleLogWriter{
 		format: "[%T %D] [%L] (%S) %M",
 		w:      make(chan *LogRecord, LogBufferLength),
 	}
-	go consoleWriter.run(stdout)
+	go consoleWriter.run(out)
 	return consoleWriter
 }
 
@@ -31,9 +42,47 @@ func (c *ConsoleLogWriter) SetFormat(format string) {
 	c.format = format
 }
 
+// Set the time format of %Z, a preset name or a layout (see FormatTime).  Must
+// be called before the first log message is written.
+func (c *ConsoleLogWriter) SetTimeFormat(timeformat string) {
+	c.timeformat = timeformat
+}
+
+// Set the layout of the records, which replaces the format.  Must be called
+// before the first log message is written.
+func (c *ConsoleLogWriter) SetLayout(layout Layout) {
+	c.layout = layout
+}
+
+// Print the times in UTC rather than in the local time zone.  Must be called
+// before the first log message is written.
+func (c *ConsoleLogWriter) SetUTC(utc bool) {
+	c.utc = utc
+}
+
 func (c *ConsoleLogWriter) run(out io.Writer) {
+	var buf bytes.Buffer
 	for rec := range c.w {
-		fmt.Fprint(out, FormatLogRecord(c.format, rec))
+		released := rec
+		if c.utc {
+			rec = utcRecord(rec)
+		}
+		var n int
+		var err error
+		if c.layout != nil {
+			n, err = out.Write(c.layout.Format(rec))
+		} else {
+			buf.Reset()
+			writeLogRecord(&buf, c.format, c.timeformat, rec)
+			n, err = out.Write(buf.Bytes())
+		}
+		releaseRecord(released)
+		if err != nil {
+			ReportError("ConsoleLogWriter", err)
+			c.failed()
+		} else {
+			c.wrote(1, n)
+		}
 	}
 }
 
@@ -43,6 +92,12 @@ func (c *ConsoleLogWriter) LogWrite(rec *LogRecord) {
 	c.w <- rec
 }
 
+func (c *ConsoleLogWriter) releasesRecords() {}
+
+func (c *ConsoleLogWriter) queued() (int, int) {
+	return len(c.w), cap(c.w)
+}
+
 // Close stops the logger from sending messages to standard output.  Attempts to
 // send log messages to this logger after a Close have undefined behavior.
 func (c *ConsoleLogWriter) Close() {
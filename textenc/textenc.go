@@ -0,0 +1,86 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+// Package textenc converts the output of the log4go writers to the character
+// encodings of golang.org/x/text, for the legacy systems which read GBK or
+// Shift-JIS files.
+//
+// Importing the package makes the encodings available to the encoding
+// property of the file and socket filters, by their IANA name:
+//
+//   <filter enabled="true">
+//     <tag>legacy</tag>
+//     <type>file</type>
+//     <level>INFO</level>
+//     <property name="filename">log/legacy.log</property>
+//     <property name="encoding">GBK</property>
+//     <property name="unmappable">replace</property> <!-- replace (default), escape or error -->
+//   </filter>
+//
+// In code:
+//
+//   t, err := textenc.New("Shift_JIS", log.UnmappableEscape)
+//   w := log.NewFileLogWriter("legacy.log", false, false).SetTranscoder(t)
+package textenc
+
+import (
+	"fmt"
+	log "github.com/kimiazhu/log4go"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/transform"
+)
+
+// The encodings registered with log4go, the other ones can be used with New
+var Names = []string{
+	"GBK", "GB18030", "HZ-GB-2312", "Big5",
+	"Shift_JIS", "EUC-JP", "ISO-2022-JP",
+	"EUC-KR",
+	"windows-1250", "windows-1251", "windows-1252",
+	"ISO-8859-1", "ISO-8859-2", "ISO-8859-15",
+	"KOI8-R", "UTF-16LE", "UTF-16BE",
+}
+
+func init() {
+	for _, name := range Names {
+		name := name
+		log.RegisterEncoding(name, func(unmappable string) (log.Transcoder, error) {
+			return New(name, unmappable)
+		})
+	}
+}
+
+// A Transcoder converts the records to an encoding of golang.org/x/text.
+type Transcoder struct {
+	encoder *encoding.Encoder
+}
+
+// New creates a Transcoder to the encoding with the given IANA name, which
+// writes the runes the encoding can't represent as told by unmappable:
+// log.UnmappableReplace, log.UnmappableEscape or log.UnmappableError.
+func New(name, unmappable string) (*Transcoder, error) {
+	enc, err := ianaindex.IANA.Encoding(name)
+	if err != nil {
+		return nil, err
+	}
+	if enc == nil {
+		return nil, fmt.Errorf("unsupported encoding %q", name)
+	}
+
+	encoder := enc.NewEncoder()
+	switch unmappable {
+	case log.UnmappableReplace, "":
+		encoder = encoding.ReplaceUnsupported(encoder)
+	case log.UnmappableEscape:
+		encoder = encoding.HTMLEscapeUnsupported(encoder)
+	case log.UnmappableError:
+	default:
+		return nil, fmt.Errorf("unknown unmappable %q, expect replace, escape or error", unmappable)
+	}
+	return &Transcoder{encoder}, nil
+}
+
+// Transcode implements log.Transcoder.
+func (t *Transcoder) Transcode(b []byte) ([]byte, error) {
+	out, _, err := transform.Bytes(t.encoder, b)
+	return out, err
+}
@@ -0,0 +1,43 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package textenc
+
+import (
+	"bytes"
+	log "github.com/kimiazhu/log4go"
+	"testing"
+)
+
+func TestTranscode(t *testing.T) {
+	tests := []struct {
+		name, unmappable, in string
+		out                  []byte
+		fails                bool
+	}{
+		{"GBK", log.UnmappableReplace, "日志 ok\n", []byte{0xc8, 0xd5, 0xd6, 0xbe, ' ', 'o', 'k', '\n'}, false},
+		{"Shift_JIS", log.UnmappableReplace, "ログ", []byte{0x83, 0x8d, 0x83, 0x4f}, false},
+		{"ISO-8859-1", log.UnmappableReplace, "é日", []byte{0xe9, 0x1a}, false},
+		{"ISO-8859-1", log.UnmappableEscape, "é日", []byte("\xe9&#26085;"), false},
+		{"ISO-8859-1", log.UnmappableError, "é日", nil, true},
+	}
+	for _, test := range tests {
+		tr, err := New(test.name, test.unmappable)
+		if err != nil {
+			t.Fatalf("New(%q, %q): %s", test.name, test.unmappable, err)
+		}
+		out, err := tr.Transcode([]byte(test.in))
+		if test.fails {
+			if err == nil {
+				t.Errorf("%s/%s: Transcode(%q) didn't fail", test.name, test.unmappable, test.in)
+			}
+			continue
+		}
+		if err != nil || !bytes.Equal(out, test.out) {
+			t.Errorf("%s/%s: Transcode(%q) = %x (%v), want %x", test.name, test.unmappable, test.in, out, err, test.out)
+		}
+	}
+
+	if _, err := New("no-such-encoding", ""); err == nil {
+		t.Errorf("New: accepted an unknown encoding")
+	}
+}
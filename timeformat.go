@@ -0,0 +1,90 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The time format used by %Z when the writer has none
+var DefaultTimeFormat = "default"
+
+// The time format presets, by name
+var (
+	timeFormatsMu sync.RWMutex
+	timeFormats   = map[string]func(t time.Time) string{
+		"default":     layoutTimeFormat("2006/01/02 15:04:05.000000000 MST"), // same as %D %T
+		"iso8601":     layoutTimeFormat("2006-01-02T15:04:05.000Z0700"),
+		"rfc3339":     layoutTimeFormat(time.RFC3339),
+		"rfc3339nano": layoutTimeFormat(time.RFC3339Nano),
+		"epoch": func(t time.Time) string {
+			return strconv.FormatInt(t.Unix(), 10)
+		},
+		"epochmillis": func(t time.Time) string {
+			return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+		},
+		"epochnanos": func(t time.Time) string {
+			return strconv.FormatInt(t.UnixNano(), 10)
+		},
+	}
+)
+
+func layoutTimeFormat(layout string) func(t time.Time) string {
+	return func(t time.Time) string {
+		return t.Format(layout)
+	}
+}
+
+// RegisterTimeFormat adds a time format preset, or replaces one.  The name can
+// then be used wherever a time format is expected.
+func RegisterTimeFormat(name string, format func(t time.Time) string) {
+	timeFormatsMu.Lock()
+	timeFormats[name] = format
+	timeFormatsMu.Unlock()
+}
+
+// FormatTime formats t with a time format, which is either the name of a
+// preset (default, iso8601, rfc3339, rfc3339nano, epoch, epochmillis,
+// epochnanos or a registered one), or a custom layout for time.Format, e.g.
+// "2006-01-02 15:04:05".  An empty timeformat means DefaultTimeFormat.
+func FormatTime(t time.Time, timeformat string) string {
+	if timeformat == "" {
+		timeformat = DefaultTimeFormat
+	}
+	timeFormatsMu.RLock()
+	format, ok := timeFormats[timeformat]
+	timeFormatsMu.RUnlock()
+	if ok {
+		return format(t)
+	}
+	return t.Format(timeformat)
+}
+
+// Return a copy of rec with its time in UTC, for the writers set to UTC: the
+// record itself is shared with the other writers
+func utcRecord(rec *LogRecord) *LogRecord {
+	utc := *rec
+	utc.Created = rec.Created.UTC()
+	utc.refs = 0
+	return &utc
+}
+
+// Report whether timeformat is a preset or looks like a layout, i.e. has a
+// date or a time of day in it.  Anything else is most likely a typo.
+func validTimeFormat(timeformat string) bool {
+	timeFormatsMu.RLock()
+	_, ok := timeFormats[timeformat]
+	timeFormatsMu.RUnlock()
+	if ok {
+		return true
+	}
+	for _, elem := range []string{"2006", "Jan", "01", "02", "15", "03", "04", "05"} {
+		if strings.Contains(timeformat, elem) {
+			return true
+		}
+	}
+	return false
+}
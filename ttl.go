@@ -0,0 +1,47 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"time"
+)
+
+// How long the records of each level stay worth sending when a writer holds
+// them back, e.g. while its connection is down.  0 means forever.
+type recordTTL [FATAL + 1]time.Duration
+
+// Set the TTL of the records at lvl and above
+func (t *recordTTL) set(lvl Level, ttl time.Duration) {
+	if lvl < ACCESS {
+		lvl = ACCESS
+	}
+	for l := lvl; l <= FATAL; l++ {
+		t[l] = ttl
+	}
+}
+
+// Whether the record is too old to be sent at now
+func (t *recordTTL) expired(rec *LogRecord, now time.Time) bool {
+	if rec.Level < ACCESS || rec.Level > FATAL {
+		return false
+	}
+	ttl := t[rec.Level]
+	return ttl > 0 && now.Sub(rec.Created) > ttl
+}
+
+// The records of recs which haven't expired at now, recs itself if none has
+func (t *recordTTL) unexpired(recs []*LogRecord, now time.Time) []*LogRecord {
+	for i, rec := range recs {
+		if !t.expired(rec, now) {
+			continue
+		}
+		kept := append([]*LogRecord(nil), recs[:i]...)
+		for _, rec := range recs[i+1:] {
+			if !t.expired(rec, now) {
+				kept = append(kept, rec)
+			}
+		}
+		return kept
+	}
+	return recs
+}
@@ -0,0 +1,100 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// The block watchdog: how long a caller may wait for a writer to take a
+// record before it's reported (0 disables it), and when it last reported
+var (
+	watchdogTimeout int64 // time.Duration
+	watchdogLast    int64 // unix nanoseconds
+)
+
+// Where the watchdog reports
+var watchdogOut io.Writer = os.Stderr
+
+// The writers which can tell how full their queue is implement this
+type queueStatus interface {
+	queued() (n, capacity int)
+}
+
+// SetBlockWatchdog turns the block watchdog on, if timeout is positive, or off.
+// When a caller has been waiting for more than timeout for a writer to take a
+// record, typically because the writer is stuck and its queue is full, the
+// watchdog reports to stderr the filter, the state of its queue and the stacks
+// of the goroutines blocked in the logger: a hang becomes something which can
+// be diagnosed.  It reports at most once per timeout.
+//
+// Each record then costs a timer, the watchdog is off by default.
+func SetBlockWatchdog(timeout time.Duration) {
+	atomic.StoreInt64(&watchdogTimeout, int64(timeout))
+}
+
+// Hand the record to the writer of the filter tagged tag, under the watch of
+// the block watchdog if it's on
+func (f *Filter) write(tag string, rec *LogRecord) {
+	timeout := time.Duration(atomic.LoadInt64(&watchdogTimeout))
+	if timeout <= 0 {
+		f.LogWrite(rec)
+		return
+	}
+
+	start := time.Now()
+	t := time.AfterFunc(timeout, func() { f.reportBlocked(tag, start, timeout) })
+	f.LogWrite(rec)
+	t.Stop()
+}
+
+// Report a caller blocked since start on the filter tagged tag
+func (f *Filter) reportBlocked(tag string, start time.Time, timeout time.Duration) {
+	now := time.Now()
+	last := atomic.LoadInt64(&watchdogLast)
+	if now.UnixNano()-last < int64(timeout) || !atomic.CompareAndSwapInt64(&watchdogLast, last, now.UnixNano()) {
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "log4go: a caller has been blocked for %s writing to filter %q (%T)", now.Sub(start).Round(time.Millisecond), tag, f.LogWriter)
+	if q, ok := f.LogWriter.(queueStatus); ok {
+		n, capacity := q.queued()
+		fmt.Fprintf(buf, ", %d of %d records queued", n, capacity)
+	}
+	buf.WriteString("\ngoroutines blocked in the logger:\n\n")
+	for _, stack := range blockedStacks() {
+		buf.Write(stack)
+		buf.WriteString("\n\n")
+	}
+	watchdogOut.Write(buf.Bytes())
+}
+
+// The stacks of the goroutines which are handing a record to a writer
+func blockedStacks() [][]byte {
+	var stacks [][]byte
+	for _, stack := range bytes.Split(allStacks(), []byte("\n\n")) {
+		if bytes.Contains(stack, []byte(".(*Filter).write(")) {
+			stacks = append(stacks, stack)
+		}
+	}
+	return stacks
+}
+
+// The stacks of all the goroutines
+func allStacks() []byte {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// A WireFormat is how a SocketLogWriter encodes the records, so that receivers
+// other than a JSON one can take them, see SetWireFormat and NewWireDecoder.
+type WireFormat int
+
+const (
+	// The records as encoding/json marshals them, back to back: the default
+	WireJSON WireFormat = iota
+
+	// MessagePack maps, back to back, see MsgpackLayout
+	WireMsgpack
+
+	// Protocol buffers messages, each prefixed by its size, see ProtobufLayout
+	WireProtobuf
+
+	// The JSON of the records, each prefixed by its size, see BinaryLayout
+	WireBinary
+)
+
+var wireFormatNames = []string{"json", "msgpack", "protobuf", "binary"}
+
+func (f WireFormat) String() string {
+	if f < 0 || int(f) >= len(wireFormatNames) {
+		return "unknown"
+	}
+	return wireFormatNames[f]
+}
+
+// The format named name, see WireFormat.String
+func wireFormatByName(name string) (WireFormat, bool) {
+	for i, n := range wireFormatNames {
+		if strings.EqualFold(n, name) {
+			return WireFormat(i), true
+		}
+	}
+	return WireJSON, false
+}
+
+// Layout returns the layout encoding the records in the format, nil for
+// WireJSON, the encoding of the writers without a layout.
+func (f WireFormat) Layout() Layout {
+	switch f {
+	case WireMsgpack:
+		return MsgpackLayout{}
+	case WireProtobuf:
+		return ProtobufLayout{}
+	case WireBinary:
+		return BinaryLayout{}
+	}
+	return nil
+}
+
+// Set the encoding of the records (chainable), which replaces the layout.  Must
+// be called before the first log message is written.
+func (w *SocketLogWriter) SetWireFormat(f WireFormat) *SocketLogWriter {
+	return w.SetLayout(f.Layout())
+}
+
+// BinaryLayout encodes a record as its JSON (see WireJSON) prefixed by the
+// size of the JSON on 4 bytes, big endian, for the receivers which split the
+// stream into frames before decoding them.
+type BinaryLayout struct{}
+
+func (BinaryLayout) Format(rec *LogRecord) []byte {
+	js := marshalRecord(rec)
+	out := make([]byte, 4, 4+len(js))
+	binary.BigEndian.PutUint32(out, uint32(len(js)))
+	return append(out, js...)
+}
+
+// The JSON of a record, with the fields which can't be marshalled as their
+// text
+func marshalRecord(rec *LogRecord) []byte {
+	js, err := json.Marshal(rec)
+	if err == nil {
+		return js
+	}
+	text := *rec
+	text.Fields = make([]Field, len(rec.Fields))
+	for i, f := range rec.Fields {
+		text.Fields[i] = Field{f.Key, fmt.Sprint(f.Value)}
+	}
+	js, _ = json.Marshal(&text)
+	return js
+}
+
+// The value of a field as the binary formats encode it: nil, a bool, an
+// int64, a uint64, a float64, a string, a []byte, a time.Time, or else its
+// text
+func wireValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil, bool, int64, uint64, float64, string, []byte, time.Time:
+		return v
+	case int:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case uint:
+		return uint64(v)
+	case uint8:
+		return uint64(v)
+	case uint16:
+		return uint64(v)
+	case uint32:
+		return uint64(v)
+	case uintptr:
+		return uint64(v)
+	case float32:
+		return float64(v)
+	case time.Duration:
+		return v.String()
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return fmt.Sprint(v)
+}
+
+// MaxWireRecord is the largest record a WireDecoder accepts, in bytes, so that
+// a corrupted size doesn't make it allocate gigabytes.
+var MaxWireRecord = 16 << 20
+
+var errWireTooLarge = errors.New("wire: record too large")
+
+// A WireDecoder reads the records sent by a SocketLogWriter in a WireFormat,
+// e.g. to build a receiver:
+//
+//	dec := log.NewWireDecoder(conn, log.WireMsgpack)
+//	for {
+//		rec, err := dec.Decode()
+//		if err != nil {
+//			break
+//		}
+//		...
+//	}
+//
+// Over UDP, each datagram is a record of its own.
+type WireDecoder struct {
+	format WireFormat
+	r      *bufio.Reader
+	js     *json.Decoder
+}
+
+// NewWireDecoder creates a WireDecoder reading the records in format from r.
+func NewWireDecoder(r io.Reader, format WireFormat) *WireDecoder {
+	d := &WireDecoder{format: format}
+	if format == WireJSON {
+		d.js = json.NewDecoder(r)
+	} else {
+		d.r = bufio.NewReader(r)
+	}
+	return d
+}
+
+// Decode reads the next record, and returns io.EOF at the end of the stream.
+// The values of the fields come back as the format has them: float64 for the
+// numbers of JSON, int64, uint64 or float64 for the others, whose strings,
+// booleans, byte slices and times are kept too.
+func (d *WireDecoder) Decode() (*LogRecord, error) {
+	switch d.format {
+	case WireJSON:
+		rec := &LogRecord{}
+		if err := d.js.Decode(rec); err != nil {
+			return nil, err
+		}
+		return rec, nil
+	case WireMsgpack:
+		return decodeMsgpackRecord(d.r)
+	case WireProtobuf:
+		return decodeProtobufRecord(d.r)
+	case WireBinary:
+		var size [4]byte
+		if _, err := io.ReadFull(d.r, size[:]); err != nil {
+			return nil, err
+		}
+		n := binary.BigEndian.Uint32(size[:])
+		if int64(n) > int64(MaxWireRecord) {
+			return nil, errWireTooLarge
+		}
+		js := make([]byte, n)
+		if _, err := io.ReadFull(d.r, js); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		rec := &LogRecord{}
+		if err := json.Unmarshal(js, rec); err != nil {
+			return nil, err
+		}
+		return rec, nil
+	}
+	return nil, fmt.Errorf("wire: unknown format %d", d.format)
+}
+
+// A record cut short is an error of its own, not the end of the stream
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
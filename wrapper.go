@@ -5,11 +5,11 @@ package log4go
 import (
 	"errors"
 	"fmt"
-	. "github.com/kimiazhu/golib/stack"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strings"
+	"time"
 )
 
 var (
@@ -37,55 +37,171 @@ func Setup(config []byte) {
 	Global.Config(config)
 }
 
+// Wrapper for (*Logger).ApplyConfig
+func ApplyConfig(xc *LoggerConfig) {
+	Global.ApplyConfig(xc)
+}
+
+// Wrapper for (*Logger).Env
+func Env() ([]string, error) {
+	return Global.Env()
+}
+
+// Wrapper for (*Logger).InheritFromEnv
+func InheritFromEnv() bool {
+	return Global.InheritFromEnv()
+}
+
 // Wrapper for (*Logger).LoadConfiguration
 func LoadConfiguration(filename string) {
 	Global.LoadConfiguration(filename)
 }
 
+// Wrapper for (*Logger).ReplaceConfig
+func ReplaceConfig(xc *LoggerConfig) error {
+	return Global.ReplaceConfig(xc)
+}
+
+// Wrapper for (*Logger).ReloadConfiguration
+func ReloadConfiguration(filename string) error {
+	return Global.ReloadConfiguration(filename)
+}
+
+// Wrapper for (*Logger).ApplyConfigDelta
+func ApplyConfigDelta(config []byte) error {
+	return Global.ApplyConfigDelta(config)
+}
+
 // Wrapper for (*Logger).AddFilter
 func AddFilter(name string, lvl Level, writer LogWriter) {
 	Global.AddFilter(name, lvl, writer)
 }
 
+// Wrapper for (*Logger).AddAccessFilter
+func AddAccessFilter(name string, writer LogWriter) {
+	Global.AddAccessFilter(name, writer)
+}
+
 // Wrapper for (*Logger).Close (closes and removes all logwriters)
 func Close() {
 	Global.Close()
 }
 
+// Wrapper for (*Logger).DumpMemory
+func DumpMemory(out io.Writer) error {
+	return Global.DumpMemory(out)
+}
+
+// Wrapper for (*Logger).Audit
+func Audit(who, action string, fields ...Field) {
+	Global.Audit(who, action, fields...)
+}
+
+// Wrapper for (*Logger).Ready
+func Ready() <-chan struct{} {
+	return Global.Ready()
+}
+
+// Wrapper for (*Logger).HealthCheck
+func HealthCheck() error {
+	return Global.HealthCheck()
+}
+
+// Wrapper for (*Logger).Flush
+func Flush() {
+	Global.Flush()
+}
+
+// Wrapper for (*Logger).Stats
+func Stats() map[string]WriterStats {
+	return Global.Stats()
+}
+
+// Wrapper for (*Logger).ErrorSummary
+func ErrorSummary() []ErrorGroup {
+	return Global.ErrorSummary()
+}
+
 func Crash(args ...interface{}) {
 	if len(args) > 0 {
-		Global.intLogf(CRITICAL, strings.Repeat(" %v", len(args))[1:], args...)
+		Global.intLogln(CRITICAL, args...)
 	}
+	Global.crashDump(sprintln(args...))
 	panic(args)
 }
 
 // Logs the given message and crashes the program
 func Crashf(format string, args ...interface{}) {
 	Global.intLogf(CRITICAL, format, args...)
+	Global.crashDump(fmt.Sprintf(format, args...))
 	Global.Close() // so that hopefully the messages get logged
 	panic(fmt.Sprintf(format, args...))
 }
 
-// Compatibility with `log`
+// Compatibility with `log`.  Exits with status 0, see ExitWith.
 func Exit(args ...interface{}) {
 	if len(args) > 0 {
-		Global.intLogf(ERROR, strings.Repeat(" %v", len(args))[1:], args...)
+		Global.intLogln(ERROR, args...)
 	}
-	Global.Close() // so that hopefully the messages get logged
-	os.Exit(0)
+	Global.exit(0)
 }
 
-// Compatibility with `log`
+// Compatibility with `log`.  Exits with status 0, see ExitWithf.
 func Exitf(format string, args ...interface{}) {
 	Global.intLogf(ERROR, format, args...)
-	Global.Close() // so that hopefully the messages get logged
-	os.Exit(0)
+	Global.exit(0)
+}
+
+// Logs the arguments at the error level like Exit, runs the exit hooks (see
+// AddExitHook), closes the logger and exits with the given status.
+func ExitWith(code int, args ...interface{}) {
+	if len(args) > 0 {
+		Global.intLogln(ERROR, args...)
+	}
+	Global.exit(code)
+}
+
+// Logs the formatted message at the error level like Exitf, runs the exit
+// hooks (see AddExitHook), closes the logger and exits with the given status.
+func ExitWithf(code int, format string, args ...interface{}) {
+	Global.intLogf(ERROR, format, args...)
+	Global.exit(code)
+}
+
+// Wrapper for (*Logger).Fatal
+func Fatal(args ...interface{}) {
+	Global.intLogln(CRITICAL, args...)
+	Global.crashDump(sprintln(args...))
+	Global.exit(1)
+}
+
+// Wrapper for (*Logger).Fatalf
+func Fatalf(format string, args ...interface{}) {
+	Global.intLogf(CRITICAL, format, args...)
+	Global.crashDump(fmt.Sprintf(format, args...))
+	Global.exit(1)
+}
+
+// Wrapper for (*Logger).Panic
+func Panic(args ...interface{}) {
+	msg := sprintln(args...)
+	Global.intLogv(CRITICAL, msg, nil)
+	Global.crashDump(msg)
+	panic(msg)
+}
+
+// Wrapper for (*Logger).Panicf
+func Panicf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	Global.intLogv(CRITICAL, msg, nil)
+	Global.crashDump(msg)
+	panic(msg)
 }
 
 // Compatibility with `log`
 func Stderr(args ...interface{}) {
 	if len(args) > 0 {
-		Global.intLogf(ERROR, strings.Repeat(" %v", len(args))[1:], args...)
+		Global.intLogln(ERROR, args...)
 	}
 }
 
@@ -97,7 +213,7 @@ func Stderrf(format string, args ...interface{}) {
 // Compatibility with `log`
 func Stdout(args ...interface{}) {
 	if len(args) > 0 {
-		Global.intLogf(INFO, strings.Repeat(" %v", len(args))[1:], args...)
+		Global.intLogln(INFO, args...)
 	}
 }
 
@@ -124,42 +240,46 @@ func Logc(lvl Level, closure func() string) {
 	Global.intLogc(lvl, closure)
 }
 
+// Send a closure log message with fields
+// Wrapper for (*Logger).LogcFields
+func LogcFields(lvl Level, closure func() (string, []Field)) {
+	Global.intLogcFields(lvl, closure)
+}
+
+// Wrapper for (*Logger).Once
+func Once(lvl Level, arg0 interface{}, args ...interface{}) {
+	if Global.skip(lvl) || !siteOf(1).once() {
+		return
+	}
+	Global.intLogv(lvl, arg0, args)
+}
+
+// Wrapper for (*Logger).EveryN
+func EveryN(n int, lvl Level, arg0 interface{}, args ...interface{}) {
+	if Global.skip(lvl) || !siteOf(1).everyN(n) {
+		return
+	}
+	Global.intLogv(lvl, arg0, args)
+}
+
+// Wrapper for (*Logger).Every
+func Every(d time.Duration, lvl Level, arg0 interface{}, args ...interface{}) {
+	if Global.skip(lvl) || !siteOf(1).every(d) {
+		return
+	}
+	Global.intLogv(lvl, arg0, args)
+}
+
 // Utility for finest log messages (see Debug() for parameter explanation)
 // Wrapper for (*Logger).Finest
 func Finest(arg0 interface{}, args ...interface{}) {
-	const (
-		lvl = FINEST
-	)
-	switch first := arg0.(type) {
-	case string:
-		// Use the string as a format string
-		Global.intLogf(lvl, first, args...)
-	case func() string:
-		// Log the closure (no other arguments used)
-		Global.intLogc(lvl, first)
-	default:
-		// Build a format string so that it will be similar to Sprint
-		Global.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
-	}
+	Global.intLogv(FINEST, arg0, args)
 }
 
 // Utility for fine log messages (see Debug() for parameter explanation)
 // Wrapper for (*Logger).Fine
 func Fine(arg0 interface{}, args ...interface{}) {
-	const (
-		lvl = FINE
-	)
-	switch first := arg0.(type) {
-	case string:
-		// Use the string as a format string
-		Global.intLogf(lvl, first, args...)
-	case func() string:
-		// Log the closure (no other arguments used)
-		Global.intLogc(lvl, first)
-	default:
-		// Build a format string so that it will be similar to Sprint
-		Global.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
-	}
+	Global.intLogv(FINE, arg0, args)
 }
 
 // Utility for debug log messages
@@ -168,160 +288,54 @@ func Fine(arg0 interface{}, args ...interface{}) {
 // When given anything else, the log message will be each of the arguments formatted with %v and separated by spaces (ala Sprint).
 // Wrapper for (*Logger).Debug
 func Debug(arg0 interface{}, args ...interface{}) {
-	const (
-		lvl = DEBUG
-	)
-	switch first := arg0.(type) {
-	case string:
-		// Use the string as a format string
-		Global.intLogf(lvl, first, args...)
-	case func() string:
-		// Log the closure (no other arguments used)
-		Global.intLogc(lvl, first)
-	default:
-		// Build a format string so that it will be similar to Sprint
-		Global.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
-	}
+	Global.intLogv(DEBUG, arg0, args)
 }
 
 // Utility for trace log messages (see Debug() for parameter explanation)
 // Wrapper for (*Logger).Trace
 func Trace(arg0 interface{}, args ...interface{}) {
-	const (
-		lvl = TRACE
-	)
-	switch first := arg0.(type) {
-	case string:
-		// Use the string as a format string
-		Global.intLogf(lvl, first, args...)
-	case func() string:
-		// Log the closure (no other arguments used)
-		Global.intLogc(lvl, first)
-	default:
-		// Build a format string so that it will be similar to Sprint
-		Global.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
-	}
+	Global.intLogv(TRACE, arg0, args)
 }
 
 // Utility for info log messages (see Debug() for parameter explanation)
 // Wrapper for (*Logger).Info
 func Info(arg0 interface{}, args ...interface{}) {
-	const (
-		lvl = INFO
-	)
-	switch first := arg0.(type) {
-	case string:
-		// Use the string as a format string
-		Global.intLogf(lvl, first, args...)
-	case func() string:
-		// Log the closure (no other arguments used)
-		Global.intLogc(lvl, first)
-	default:
-		// Build a format string so that it will be similar to Sprint
-		Global.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
-	}
+	Global.intLogv(INFO, arg0, args)
 }
 
 // Utility for Access log messages (see Debug() for parameter explanation)
 // Wrapper for (*Logger).Info
 func Access(arg0 interface{}, args ...interface{}) {
-	const (
-		lvl = ACCESS
-	)
-	switch first := arg0.(type) {
-	case string:
-		// Use the string as a format string
-		Global.intLogf(lvl, first, args...)
-	case func() string:
-		// Log the closure (no other arguments used)
-		Global.intLogc(lvl, first)
-	default:
-		// Build a format string so that it will be similar to Sprint
-		Global.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
-	}
+	Global.intLogv(ACCESS, arg0, args)
 }
 
 // Utility for warn log messages (returns an error for easy function returns) (see Debug() for parameter explanation)
 // These functions will execute a closure exactly once, to build the error message for the return
 // Wrapper for (*Logger).Warn
 func Warn(arg0 interface{}, args ...interface{}) error {
-	const (
-		lvl = WARNING
-	)
-	switch first := arg0.(type) {
-	case string:
-		// Use the string as a format string
-		Global.intLogf(lvl, first, args...)
-		return errors.New(fmt.Sprintf(first, args...))
-	case func() string:
-		// Log the closure (no other arguments used)
-		str := first()
-		Global.intLogf(lvl, "%s", str)
-		return errors.New(str)
-	default:
-		// Build a format string so that it will be similar to Sprint
-		Global.intLogf(lvl, fmt.Sprint(first)+strings.Repeat(" %v", len(args)), args...)
-		return errors.New(fmt.Sprint(first) + fmt.Sprintf(strings.Repeat(" %v", len(args)), args...))
-	}
-	return nil
+	msg := argsMessage(arg0, args)
+	Global.intLogv(WARNING, msg, nil)
+	return argsError(msg, arg0, args)
 }
 
 // Utility for error log messages (returns an error for easy function returns) (see Debug() for parameter explanation)
 // These functions will execute a closure exactly once, to build the error message for the return
 // Wrapper for (*Logger).Error
 func Error(arg0 interface{}, args ...interface{}) error {
-	const (
-		lvl = ERROR
-	)
-	switch first := arg0.(type) {
-	case string:
-		// Use the string as a format string
-		Global.intLogf(lvl, first, args...)
-		return errors.New(fmt.Sprintf(first, args...))
-	case func() string:
-		// Log the closure (no other arguments used)
-		str := first()
-		Global.intLogf(lvl, "%s", str)
-		return errors.New(str)
-	default:
-		// Build a format string so that it will be similar to Sprint
-		Global.intLogf(lvl, fmt.Sprint(first)+strings.Repeat(" %v", len(args)), args...)
-		return errors.New(fmt.Sprint(first) + fmt.Sprintf(strings.Repeat(" %v", len(args)), args...))
-	}
-	return nil
+	msg := argsMessage(arg0, args)
+	Global.intLogv(ERROR, msg, nil)
+	return argsError(msg, arg0, args)
 }
 
 // Utility for critical log messages (returns an error for easy function returns) (see Debug() for parameter explanation)
 // These functions will execute a closure exactly once, to build the error message for the return
 // Wrapper for (*Logger).Critical. This method will log the call stack
 func Critical(arg0 interface{}, args ...interface{}) error {
-	const (
-		lvl = CRITICAL
-	)
-	switch first := arg0.(type) {
-	case string:
-		// Use the string as a format string
-		msg := fmt.Sprintf("%s\n%s", fmt.Sprintf(first, args...), CallStack(3))
-		Global.intLogf(lvl, msg)
-		//Global.intLogf(lvl, "%s", CallStack(3))
-		return errors.New(fmt.Sprintf(first, args...))
-	case func() string:
-		// Log the closure (no other arguments used)
-		str := first()
-		Global.intLogf(lvl, "%s\n%s", str, CallStack(3))
-		//Global.intLogf(lvl, "%s", CallStack(3))
-		return errors.New(str)
-	case func(interface{}) string:
-		str := first(args[0])
-		Global.intLogf(lvl, "%s\n%s", str, CallStack(3))
-		return errors.New(str)
-	default:
-		// Build a format string so that it will be similar to Sprint
-		msg := fmt.Sprintf("%s\n%s", fmt.Sprint(first) + fmt.Sprintf(strings.Repeat(" %v", len(args)), args...), CallStack(3))
-		Global.intLogf(lvl, msg)
-		return errors.New(fmt.Sprint(first) + fmt.Sprintf(strings.Repeat(" %v", len(args)), args...))
+	msg := argsMessage(arg0, args)
+	if isLevelEnabled(CRITICAL) {
+		Global.intLogv(CRITICAL, msg+"\n"+callStack(), nil)
 	}
-	return nil
+	return argsError(msg, arg0, args)
 }
 
 // Recover used to log the stack when panic occur.
@@ -336,15 +350,175 @@ func Recover(arg0 interface{}, args ...interface{}) {
 		switch a := arg0.(type) {
 		case func(interface{}) string:
 			// the recovered err will pass to this func
-			Critical(arg0, append([]interface{}{err}, args)...)
+			Critical(arg0, append([]interface{}{err}, args...)...)
 		case string:
 			Critical(a+"\n%v", append(args, err)...)
 		default:
 			Critical(arg0, append(args, err)...)
 		}
+		Global.crashDump(err)
 	}
 }
 
+// Wrapper for (*Logger).Finestf
+func Finestf(format string, args ...interface{}) {
+	Global.intLogf(FINEST, format, args...)
+}
+
+// Wrapper for (*Logger).Finestln
+func Finestln(args ...interface{}) {
+	Global.intLogln(FINEST, args...)
+}
+
+// Wrapper for (*Logger).Finestc
+func Finestc(closure func() string) {
+	Global.intLogc(FINEST, closure)
+}
+
+// Wrapper for (*Logger).Finef
+func Finef(format string, args ...interface{}) {
+	Global.intLogf(FINE, format, args...)
+}
+
+// Wrapper for (*Logger).Fineln
+func Fineln(args ...interface{}) {
+	Global.intLogln(FINE, args...)
+}
+
+// Wrapper for (*Logger).Finec
+func Finec(closure func() string) {
+	Global.intLogc(FINE, closure)
+}
+
+// Wrapper for (*Logger).Debugf
+func Debugf(format string, args ...interface{}) {
+	Global.intLogf(DEBUG, format, args...)
+}
+
+// Wrapper for (*Logger).Debugln
+func Debugln(args ...interface{}) {
+	Global.intLogln(DEBUG, args...)
+}
+
+// Wrapper for (*Logger).Debugc
+func Debugc(closure func() string) {
+	Global.intLogc(DEBUG, closure)
+}
+
+// Wrapper for (*Logger).Tracef
+func Tracef(format string, args ...interface{}) {
+	Global.intLogf(TRACE, format, args...)
+}
+
+// Wrapper for (*Logger).Traceln
+func Traceln(args ...interface{}) {
+	Global.intLogln(TRACE, args...)
+}
+
+// Wrapper for (*Logger).Tracec
+func Tracec(closure func() string) {
+	Global.intLogc(TRACE, closure)
+}
+
+// Wrapper for (*Logger).Infof
+func Infof(format string, args ...interface{}) {
+	Global.intLogf(INFO, format, args...)
+}
+
+// Wrapper for (*Logger).Infoln
+func Infoln(args ...interface{}) {
+	Global.intLogln(INFO, args...)
+}
+
+// Wrapper for (*Logger).Infoc
+func Infoc(closure func() string) {
+	Global.intLogc(INFO, closure)
+}
+
+// Wrapper for (*Logger).Accessf
+func Accessf(format string, args ...interface{}) {
+	Global.intLogf(ACCESS, format, args...)
+}
+
+// Wrapper for (*Logger).Accessln
+func Accessln(args ...interface{}) {
+	Global.intLogln(ACCESS, args...)
+}
+
+// Wrapper for (*Logger).Accessc
+func Accessc(closure func() string) {
+	Global.intLogc(ACCESS, closure)
+}
+
+// Wrapper for (*Logger).Warnf
+func Warnf(format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	Global.intLogv(WARNING, msg, nil)
+	return argsError(msg, nil, args)
+}
+
+// Wrapper for (*Logger).Warnln
+func Warnln(args ...interface{}) error {
+	msg := sprintln(args...)
+	Global.intLogv(WARNING, msg, nil)
+	return argsError(msg, nil, args)
+}
+
+// Wrapper for (*Logger).Warnc
+func Warnc(closure func() string) error {
+	msg := closure()
+	Global.intLogv(WARNING, msg, nil)
+	return errors.New(msg)
+}
+
+// Wrapper for (*Logger).Errorf
+func Errorf(format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	Global.intLogv(ERROR, msg, nil)
+	return argsError(msg, nil, args)
+}
+
+// Wrapper for (*Logger).Errorln
+func Errorln(args ...interface{}) error {
+	msg := sprintln(args...)
+	Global.intLogv(ERROR, msg, nil)
+	return argsError(msg, nil, args)
+}
+
+// Wrapper for (*Logger).Errorc
+func Errorc(closure func() string) error {
+	msg := closure()
+	Global.intLogv(ERROR, msg, nil)
+	return errors.New(msg)
+}
+
+// Wrapper for (*Logger).Criticalf
+func Criticalf(format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	if isLevelEnabled(CRITICAL) {
+		Global.intLogv(CRITICAL, msg+"\n"+callStack(), nil)
+	}
+	return argsError(msg, nil, args)
+}
+
+// Wrapper for (*Logger).Criticalln
+func Criticalln(args ...interface{}) error {
+	msg := sprintln(args...)
+	if isLevelEnabled(CRITICAL) {
+		Global.intLogv(CRITICAL, msg+"\n"+callStack(), nil)
+	}
+	return argsError(msg, nil, args)
+}
+
+// Wrapper for (*Logger).Criticalc
+func Criticalc(closure func() string) error {
+	msg := closure()
+	if isLevelEnabled(CRITICAL) {
+		Global.intLogv(CRITICAL, msg+"\n"+callStack(), nil)
+	}
+	return errors.New(msg)
+}
+
 func IsFinestEnabled() bool {
 	return isLevelEnabled(FINEST)
 }
@@ -373,14 +547,8 @@ func IsErrorEnabled() bool {
 	return isLevelEnabled(ERROR)
 }
 
+// Report whether a filter of Global takes the records at lvl, the cheapest
+// check there is: the wrappers make it before they format anything
 func isLevelEnabled(lvl Level) bool {
-	enabled := false
-	for _, filt := range Global {
-		if lvl >= filt.Level {
-			// return true if any filt matched
-			enabled = true
-			break
-		}
-	}
-	return enabled
+	return !Global.skip(lvl)
 }
\ No newline at end of file
@@ -0,0 +1,179 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+// Package yamlconf reads the log4go configuration from YAML, with the same
+// schema as the XML one:
+//
+//	locale: en
+//	path_base: config-dir
+//	duplicates: error
+//	filters:
+//	  - tag: stdout
+//	    type: console
+//	    level: DEBUG
+//	    access: exclude
+//	    exclude: [github.com/example]
+//	  - tag: file
+//	    enabled: false
+//	    type: file
+//	    level: FINEST
+//	    properties:
+//	      filename: test.log
+//	      format: "[%D %T] [%L] (%S) %M"
+//	      rotate: false
+//	  - tag: shipper
+//	    type: http
+//	    level: INFO
+//	    properties:
+//	      endpoint: https://logs.example.com/ingest
+//	      header: ["Authorization: Bearer secret", "X-Team: shop"]
+//	routes:
+//	  - match: "(?i)payment"
+//	    fields:
+//	      team: billing
+//	    to: [file]
+//	    final: true
+//
+// A filter is enabled unless it says otherwise; a list as the value of a
+// property repeats the property.
+//
+// Importing the package makes LoadConfiguration read the .yaml and .yml files
+// as YAML.
+package yamlconf
+
+import (
+	"fmt"
+	log "github.com/kimiazhu/log4go"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"os"
+)
+
+func init() {
+	log.RegisterConfigFormat(".yaml", Parse)
+	log.RegisterConfigFormat(".yml", Parse)
+}
+
+type yamlFilter struct {
+	Enabled    *bool     `yaml:"enabled"`
+	Tag        string    `yaml:"tag"`
+	Level      string    `yaml:"level"`
+	Type       string    `yaml:"type"`
+	Properties yaml.Node `yaml:"properties"`
+	Exclude    []string  `yaml:"exclude"`
+	Access     string    `yaml:"access"`
+	Async      bool      `yaml:"async"`
+	Audit      bool      `yaml:"audit"`
+}
+
+type yamlRoute struct {
+	Match  string    `yaml:"match"`
+	Fields yaml.Node `yaml:"fields"`
+	To     []string  `yaml:"to"`
+	Final  bool      `yaml:"final"`
+}
+
+type yamlConfig struct {
+	Locale     string       `yaml:"locale"`
+	PathBase   string       `yaml:"path_base"`
+	Filters    []yamlFilter `yaml:"filters"`
+	Routes     []yamlRoute  `yaml:"routes"`
+	Duplicates string       `yaml:"duplicates"`
+}
+
+// Parse parses a YAML configuration, see log.ApplyConfig.
+func Parse(config []byte) (*log.LoggerConfig, error) {
+	var yc yamlConfig
+	if err := yaml.Unmarshal(config, &yc); err != nil {
+		return nil, err
+	}
+
+	lc := &log.LoggerConfig{Locale: yc.Locale, PathBase: yc.PathBase, Duplicates: yc.Duplicates}
+	for _, yf := range yc.Filters {
+		fc := log.FilterConfig{
+			Enabled: "true",
+			Tag:     yf.Tag,
+			Level:   yf.Level,
+			Type:    yf.Type,
+			Exclude: yf.Exclude,
+			Access:  yf.Access,
+		}
+		if yf.Enabled != nil && !*yf.Enabled {
+			fc.Enabled = "false"
+		}
+		if yf.Async {
+			fc.Async = "true"
+		}
+		if yf.Audit {
+			fc.Audit = "true"
+		}
+		props, err := properties(&yf.Properties)
+		if err != nil {
+			return nil, fmt.Errorf("filter %q: %s", yf.Tag, err)
+		}
+		fc.Property = props
+		lc.Filter = append(lc.Filter, fc)
+	}
+	for i, yr := range yc.Routes {
+		rc := log.RouteConfig{Match: yr.Match, To: yr.To}
+		if yr.Final {
+			rc.Final = "true"
+		}
+		fields, err := properties(&yr.Fields)
+		if err != nil {
+			return nil, fmt.Errorf("route %d: %s", i+1, err)
+		}
+		rc.Field = fields
+		lc.Route = append(lc.Route, rc)
+	}
+	return lc, nil
+}
+
+// The properties of a filter, in order, from a mapping of scalars or lists of
+// scalars
+func properties(node *yaml.Node) ([]log.Property, error) {
+	if node.Kind == 0 {
+		return nil, nil
+	}
+	if node.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: properties must be a mapping", node.Line)
+	}
+
+	var props []log.Property
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		name, value := node.Content[i].Value, node.Content[i+1]
+		switch value.Kind {
+		case yaml.ScalarNode:
+			props = append(props, log.Property{Name: name, Value: value.Value})
+		case yaml.SequenceNode:
+			for _, item := range value.Content {
+				if item.Kind != yaml.ScalarNode {
+					return nil, fmt.Errorf("line %d: property %q must be a scalar or a list of scalars", item.Line, name)
+				}
+				props = append(props, log.Property{Name: name, Value: item.Value})
+			}
+		default:
+			return nil, fmt.Errorf("line %d: property %q must be a scalar or a list of scalars", value.Line, name)
+		}
+	}
+	return props, nil
+}
+
+// LoadYAMLConfiguration loads the YAML configuration in filename into the
+// global logger, whatever its extension.  Like log.LoadConfiguration, it
+// replaces all the filters, and the errors are fatal.
+func LoadYAMLConfiguration(filename string) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Could not read %q: %s\n", filename, err)
+		os.Exit(1)
+	}
+	lc, err := Parse(contents)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Could not parse %q: %s\n", filename, err)
+		os.Exit(1)
+	}
+	lc.Dir = log.ConfigDir(filename)
+	if err := log.ReplaceConfig(lc); err != nil {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package yamlconf
+
+import (
+	log "github.com/kimiazhu/log4go"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testConfig = `
+filters:
+  - tag: memory
+    type: memory
+    level: DEBUG
+    access: exclude
+    exclude: [github.com/example, github.com/sample]
+    properties:
+      size: 100
+      format: "[%L] %M"
+  - tag: shipper
+    enabled: false
+    type: http
+    level: INFO
+    properties:
+      endpoint: https://logs.example.com/ingest
+      header: ["Authorization: Bearer secret", "X-Team: shop"]
+routes:
+  - match: "(?i)payment"
+    fields:
+      team: billing
+    to: [memory]
+    final: true
+`
+
+func TestParse(t *testing.T) {
+	lc, err := Parse([]byte(testConfig))
+	if err != nil {
+		t.Fatalf("Parse: %s", err)
+	}
+	want := &log.LoggerConfig{Filter: []log.FilterConfig{{
+		Enabled:  "true",
+		Tag:      "memory",
+		Level:    "DEBUG",
+		Type:     "memory",
+		Property: []log.Property{{Name: "size", Value: "100"}, {Name: "format", Value: "[%L] %M"}},
+		Exclude:  []string{"github.com/example", "github.com/sample"},
+		Access:   "exclude",
+	}, {
+		Enabled: "false",
+		Tag:     "shipper",
+		Level:   "INFO",
+		Type:    "http",
+		Property: []log.Property{
+			{Name: "endpoint", Value: "https://logs.example.com/ingest"},
+			{Name: "header", Value: "Authorization: Bearer secret"},
+			{Name: "header", Value: "X-Team: shop"},
+		},
+	}}, Route: []log.RouteConfig{{
+		Final: "true",
+		Match: "(?i)payment",
+		Field: []log.Property{{Name: "team", Value: "billing"}},
+		To:    []string{"memory"},
+	}}}
+	if !reflect.DeepEqual(lc, want) {
+		t.Errorf("Parse:\ngot  %+v\nwant %+v", lc, want)
+	}
+
+	if _, err := Parse([]byte("filters:\n  - tag: bad\n    properties: [1, 2]\n")); err == nil {
+		t.Errorf("Parse: accepted a list of properties")
+	}
+}
+
+func TestLoadConfiguration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yamlconf")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "log4go.yml")
+	if err := ioutil.WriteFile(filename, []byte(testConfig), 0644); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+
+	logger := log.NewLogger()
+	logger.LoadConfiguration(filename)
+	defer logger.Close()
+	filt := logger.Filter("memory")
+	if len(logger.Filters()) != 1 || filt == nil {
+		t.Fatalf("LoadConfiguration: got filters %v, want memory only", logger.Filters())
+	}
+	if _, ok := filt.LogWriter.(*log.MemoryLogWriter); !ok || filt.Level != log.DEBUG || filt.Access != log.AccessExclude || len(filt.Excludes) != 2 {
+		t.Errorf("LoadConfiguration: unexpected filter %+v", filt)
+	}
+}
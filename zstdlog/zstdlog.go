@@ -0,0 +1,281 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+// Package zstdlog sends log records compressed with zstd, optionally with a
+// dictionary trained from sample records.
+//
+// Records are short and look alike, so compressing them one by one gains
+// little: most of what they have in common only appears across records.  A
+// shared dictionary holds these common parts, which typically makes each
+// record several times smaller.  Train one from the records of a running
+// system, and use the same dictionary on both ends:
+//
+//	dict, err := zstdlog.TrainDictionary(1, samples, 0)
+//	ioutil.WriteFile("records.dict", dict, 0644)
+//	...
+//	dict, err := zstdlog.LoadDictionary("records.dict")
+//	w, err := zstdlog.NewSocketLogWriter("tcp", "collector:9999", dict)
+//	log.AddFilter("zstd", log.INFO, w)
+//
+// The receiving end reads the records back with NewReader.
+//
+// Importing the package also adds the zstd type to the configuration:
+//
+//   <filter enabled="true">
+//     <tag>zstd</tag>
+//     <type>zstd</type>
+//     <level>INFO</level>
+//     <property name="endpoint">collector:9999</property>
+//     <property name="protocol">tcp</property> <!-- tcp or udp -->
+//     <property name="dictionary">records.dict</property> <!-- optional -->
+//   </filter>
+package zstdlog
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/kimiazhu/log4go"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+)
+
+func init() {
+	log.RegisterWriterType("zstd", xmlToSocketLogWriter)
+}
+
+// Create a SocketLogWriter from the properties of a <type>zstd</type> filter:
+// endpoint, protocol (tcp or udp, tcp by default) and dictionary (the file of
+// a dictionary, none by default)
+func xmlToSocketLogWriter(props []log.Property) (log.LogWriter, error) {
+	endpoint, protocol, dictfile := "", "tcp", ""
+	for _, prop := range props {
+		switch prop.Name {
+		case "endpoint":
+			endpoint = strings.Trim(prop.Value, " \r\n")
+		case "protocol":
+			protocol = strings.Trim(prop.Value, " \r\n")
+		case "dictionary":
+			dictfile = strings.Trim(prop.Value, " \r\n")
+		default:
+			fmt.Fprintf(os.Stderr, "LoadConfiguration: Warning: Unknown property \"%s\" for zstd filter\n", prop.Name)
+		}
+	}
+
+	if endpoint == "" {
+		return nil, fmt.Errorf("required property \"%s\"", "endpoint")
+	}
+	var dict []byte
+	if dictfile != "" {
+		var err error
+		if dict, err = LoadDictionary(dictfile); err != nil {
+			return nil, err
+		}
+	}
+	return NewSocketLogWriter(protocol, endpoint, dict)
+}
+
+// The default size of a trained dictionary
+const DefaultDictionarySize = 64 << 10
+
+// TrainDictionary builds a dictionary with the given id from sample records,
+// e.g. lines of an existing log file or JSON records.  The dictionary is at
+// most size bytes (DefaultDictionarySize if size <= 0), made of the most
+// recent samples.  Use a few thousand samples, similar to what will be sent.
+func TrainDictionary(id uint32, samples [][]byte, size int) ([]byte, error) {
+	if len(samples) == 0 {
+		return nil, errors.New("zstdlog: no sample to train the dictionary")
+	}
+	if size <= 0 {
+		size = DefaultDictionarySize
+	}
+
+	// The content matched by the records: the latest samples, the most
+	// likely to repeat in the records to come
+	var history []byte
+	for i := len(samples) - 1; i >= 0 && len(history)+len(samples[i]) <= size; i-- {
+		history = append(append([]byte{}, samples[i]...), history...)
+	}
+	if len(history) < 8 {
+		return nil, errors.New("zstdlog: samples too short to train the dictionary")
+	}
+
+	return zstd.BuildDict(zstd.BuildDictOptions{
+		ID:       id,
+		Contents: samples,
+		History:  history,
+		Offsets:  [3]int{1, 4, 8},
+	})
+}
+
+// LoadDictionary reads a dictionary saved from TrainDictionary, or trained by
+// the zstd command line tool, and checks it.
+func LoadDictionary(filename string) ([]byte, error) {
+	dict, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zstd.InspectDictionary(dict); err != nil {
+		return nil, fmt.Errorf("zstdlog: invalid dictionary %q: %s", filename, err)
+	}
+	return dict, nil
+}
+
+// This log writer sends each record as JSON in its own zstd frame.  On tcp
+// every frame is preceded by its length as a 4 bytes big endian integer, on
+// udp it is sent as one datagram.
+type SocketLogWriter struct {
+	rec  chan *log.LogRecord
+	done chan struct{}
+
+	proto, hostport string
+	sock            net.Conn
+	enc             *zstd.Encoder
+}
+
+// NewSocketLogWriter creates a new LogWriter which compresses the records with
+// dict, or without a dictionary if dict is nil.  The connection is made when
+// the first record is sent, and made again after an error; the records which
+// can't be sent are dropped.
+func NewSocketLogWriter(proto, hostport string, dict []byte) (*SocketLogWriter, error) {
+	opts := []zstd.EOption{zstd.WithEncoderConcurrency(1)}
+	if dict != nil {
+		opts = append(opts, zstd.WithEncoderDict(dict))
+	}
+	enc, err := zstd.NewWriter(nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &SocketLogWriter{
+		rec:      make(chan *log.LogRecord, log.LogBufferLength),
+		done:     make(chan struct{}),
+		proto:    proto,
+		hostport: hostport,
+		enc:      enc,
+	}
+	go w.run()
+	return w, nil
+}
+
+// This is the SocketLogWriter's output method
+func (w *SocketLogWriter) LogWrite(rec *log.LogRecord) {
+	w.rec <- rec
+}
+
+// Close sends the queued records and closes the connection.
+func (w *SocketLogWriter) Close() {
+	close(w.rec)
+	<-w.done
+}
+
+func (w *SocketLogWriter) run() {
+	defer func() {
+		if w.sock != nil {
+			w.sock.Close()
+		}
+		w.enc.Close()
+		close(w.done)
+	}()
+
+	var frame []byte
+	for rec := range w.rec {
+		js, err := json.Marshal(rec)
+		if err != nil {
+			log.ReportError(fmt.Sprintf("zstdlog.SocketLogWriter(%q)", w.hostport), err)
+			continue
+		}
+
+		frame = frame[:0]
+		if w.proto == "tcp" {
+			frame = append(frame, 0, 0, 0, 0)
+		}
+		frame = w.enc.EncodeAll(js, frame)
+		if w.proto == "tcp" {
+			binary.BigEndian.PutUint32(frame, uint32(len(frame)-4))
+		}
+
+		if err := w.send(frame); err != nil {
+			log.ReportError(fmt.Sprintf("zstdlog.SocketLogWriter(%q)", w.hostport), err)
+		}
+	}
+}
+
+// Send a frame, connecting first if needed
+func (w *SocketLogWriter) send(frame []byte) error {
+	if w.sock == nil {
+		sock, err := net.Dial(w.proto, w.hostport)
+		if err != nil {
+			return err
+		}
+		w.sock = sock
+	}
+	if _, err := w.sock.Write(frame); err != nil {
+		w.sock.Close()
+		w.sock = nil
+		return err
+	}
+	return nil
+}
+
+// Reader reads the records sent over tcp by a SocketLogWriter.
+type Reader struct {
+	r     *bufio.Reader
+	dec   *zstd.Decoder
+	frame []byte
+	buf   []byte
+}
+
+// NewReader creates a Reader of the records of a tcp connection, with the
+// dictionary of the writer (nil if it has none).
+func NewReader(r io.Reader, dict []byte) (*Reader, error) {
+	opts := []zstd.DOption{zstd.WithDecoderConcurrency(1)}
+	if dict != nil {
+		opts = append(opts, zstd.WithDecoderDicts(dict))
+	}
+	dec, err := zstd.NewReader(nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{r: bufio.NewReader(r), dec: dec}, nil
+}
+
+// Next returns the next record, or io.EOF at the end of the stream.
+func (r *Reader) Next() (*log.LogRecord, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r.r, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if cap(r.frame) < int(n) {
+		r.frame = make([]byte, n)
+	}
+	r.frame = r.frame[:n]
+	if _, err := io.ReadFull(r.r, r.frame); err != nil {
+		return nil, err
+	}
+	return r.Decode(r.frame)
+}
+
+// Decode decodes one frame, e.g. an udp datagram.
+func (r *Reader) Decode(frame []byte) (*log.LogRecord, error) {
+	var err error
+	if r.buf, err = r.dec.DecodeAll(frame, r.buf[:0]); err != nil {
+		return nil, err
+	}
+	rec := new(log.LogRecord)
+	if err := json.Unmarshal(r.buf, rec); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// Close releases the resources of the decoder.
+func (r *Reader) Close() {
+	r.dec.Close()
+}
@@ -0,0 +1,79 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package zstdlog
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/kimiazhu/log4go"
+	"github.com/klauspost/compress/zstd"
+	"net"
+	"testing"
+	"time"
+)
+
+func sampleRecord(i int) *log.LogRecord {
+	return &log.LogRecord{
+		Level:   log.INFO,
+		Created: time.Date(2017, 3, 1, 12, 0, i%60, 0, time.UTC),
+		Source:  "github.com/example/shop/cart.(*Service).Checkout:128",
+		Message: fmt.Sprintf("checkout completed for user %d with %d items", 1000+i, i%7),
+	}
+}
+
+func TestDictionary(t *testing.T) {
+	var samples [][]byte
+	for i := 0; i < 500; i++ {
+		js, _ := json.Marshal(sampleRecord(i))
+		samples = append(samples, js)
+	}
+	dict, err := TrainDictionary(7, samples, 0)
+	if err != nil {
+		t.Fatalf("TrainDictionary: %s", err)
+	}
+
+	// A trained dictionary must compress new records much better
+	js, _ := json.Marshal(sampleRecord(4242))
+	plain, _ := zstd.NewWriter(nil)
+	withDict, _ := zstd.NewWriter(nil, zstd.WithEncoderDict(dict))
+	without, with := len(plain.EncodeAll(js, nil)), len(withDict.EncodeAll(js, nil))
+	if with*2 > without {
+		t.Errorf("TrainDictionary: %d bytes with the dictionary, %d without", with, without)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %s", err)
+	}
+	defer ln.Close()
+
+	w, err := NewSocketLogWriter("tcp", ln.Addr().String(), dict)
+	if err != nil {
+		t.Fatalf("NewSocketLogWriter: %s", err)
+	}
+	for i := 0; i < 3; i++ {
+		w.LogWrite(sampleRecord(i))
+	}
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("Accept: %s", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	w.Close()
+
+	r, err := NewReader(conn, dict)
+	if err != nil {
+		t.Fatalf("NewReader: %s", err)
+	}
+	defer r.Close()
+	for i := 0; i < 3; i++ {
+		rec, err := r.Next()
+		if err != nil {
+			t.Fatalf("Next: %s", err)
+		}
+		if want := sampleRecord(i).Message; rec.Message != want {
+			t.Errorf("Next: got %q, want %q", rec.Message, want)
+		}
+	}
+}